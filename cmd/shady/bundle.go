@@ -0,0 +1,169 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// manifestName is the name of the file in a bundle that describes how its
+// shader is run.
+const manifestName = "shady.json"
+
+// A manifest holds the settings of a bundle. Paths are relative to the root of
+// the bundle.
+type manifest struct {
+	// Files are the shader files that are passed with -i.
+	Files     []string `json:"files"`
+	Geometry  string   `json:"geometry,omitempty"`
+	Framerate float64  `json:"framerate,omitempty"`
+	GLSL      string   `json:"glsl,omitempty"`
+	// Mappings hold the mappings of the shader with the paths rewritten to
+	// the files in the bundle.
+	Mappings []string          `json:"mappings,omitempty"`
+	Uniforms []string          `json:"uniforms,omitempty"`
+	Defines  map[string]string `json:"defines,omitempty"`
+	// Include are the include paths of the preprocessor.
+	Include []string `json:"include,omitempty"`
+}
+
+// isBundle reports whether a file is a bundle created by the pack command,
+// judging by its extension.
+func isBundle(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".zip", ".tar":
+		return true
+	}
+	return false
+}
+
+// openBundle opens a zip or tar bundle as a filesystem and reads its
+// manifest. Tar archives are read into memory.
+func openBundle(filename string) (fs.FS, *manifest, error) {
+	var fsys fs.FS
+	if strings.EqualFold(filepath.Ext(filename), ".tar") {
+		fd, err := os.Open(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer fd.Close()
+		if fsys, err = tarToZip(fd); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", filename, err)
+		}
+	} else {
+		zr, err := zip.OpenReader(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		// The archive is read from while the shader runs, so it is never
+		// closed.
+		fsys = zr
+	}
+
+	b, err := fs.ReadFile(fsys, manifestName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	var m manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, nil, fmt.Errorf("%s: %s: %w", filename, manifestName, err)
+	}
+	if len(m.Files) == 0 {
+		return nil, nil, fmt.Errorf("%s: the manifest lists no shader files", filename)
+	}
+	return fsys, &m, nil
+}
+
+// tarToZip converts a tar archive to an uncompressed zip archive in memory,
+// which unlike a tar archive can be used as a filesystem.
+func tarToZip(r io.Reader) (fs.FS, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     hdr.Name,
+			Method:   zip.Store,
+			Modified: hdr.ModTime,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(w, tr); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+}
+
+// bundleWriter writes the files of a bundle to either a zip or a tar archive.
+type bundleWriter interface {
+	// add adds a file to the archive. The name is slash separated.
+	add(name string, size int64, modTime time.Time, r io.Reader) error
+	Close() error
+}
+
+func newBundleWriter(filename string, w io.Writer) (bundleWriter, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".zip":
+		return zipBundleWriter{zip.NewWriter(w)}, nil
+	case ".tar":
+		return tarBundleWriter{tar.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("unsupported bundle format %q, expected .zip or .tar", filepath.Ext(filename))
+}
+
+type zipBundleWriter struct {
+	*zip.Writer
+}
+
+func (zw zipBundleWriter) add(name string, _ int64, modTime time.Time, r io.Reader) error {
+	hdr := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime}
+	hdr.SetMode(0o644)
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+type tarBundleWriter struct {
+	*tar.Writer
+}
+
+func (tw tarBundleWriter) add(name string, size int64, modTime time.Time, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o644,
+		Size:     size,
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, r)
+	return err
+}
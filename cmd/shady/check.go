@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+// The exit codes of the check command.
+const (
+	checkOK = 0
+	// checkFailed means that a shader does not compile.
+	checkFailed = 1
+	// checkError means that the shaders could not be checked, e.g. because a
+	// file could not be read.
+	checkError = 2
+)
+
+// runCheck implements the check command, which compiles all passes of a
+// shader without rendering and writes the diagnostics to out. It returns the
+// exit code.
+func runCheck(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	var inputFiles arrayFlags
+	fs.Var(&inputFiles, "i", "The shader file(s) to check")
+	format := fs.String("format", "text", "The format of the diagnostics, either \"text\" or \"json\"")
+	glslVersion := fs.String("glsl", "330", "The GLSL version to use")
+	openGLVersionStr := fs.String("opengl", "glsl", "The OpenGL version to use. If \"glsl\", the version is inferred from the requested GLSL version")
+	var mappingFlags arrayFlags
+	fs.Var(&mappingFlags, "map", "Specify or override ShaderToy input mappings")
+	var uniformFlags arrayFlags
+	fs.Var(&uniformFlags, "u", "Set the value of a uniform in <name>=<value> format")
+	var defineFlags arrayFlags
+	fs.Var(&defineFlags, "D", "Define a preprocessor macro in <name>=<value> format")
+	var includeFlags arrayFlags
+	fs.Var(&includeFlags, "I", "Add a directory to search for included files")
+	if err := fs.Parse(args); err != nil {
+		return checkError
+	}
+	if len(inputFiles) == 0 {
+		log.Printf("Please specify at least one GLSL file with -i")
+		return checkError
+	}
+	if *format != "text" && *format != "json" {
+		log.Printf("Unknown format: %q", *format)
+		return checkError
+	}
+
+	glVersion, err := parseOpenGLVersion(*openGLVersionStr, *glslVersion)
+	if err != nil {
+		log.Print(err)
+		return checkError
+	}
+	pp := newPreprocessor(defineFlags, includeFlags, *glslVersion)
+	diags, _, err := check(pp, inputFiles, mappingFlags, uniformFlags, *glslVersion, glVersion)
+	if err != nil {
+		log.Print(err)
+		return checkError
+	}
+	if err := writeDiagnostics(out, *format, diags); err != nil {
+		log.Print(err)
+		return checkError
+	}
+	for _, d := range diags {
+		if d.Severity == renderer.SeverityError {
+			return checkFailed
+		}
+	}
+	return checkOK
+}
+
+// check compiles the image and sound passes of a shader, including its
+// buffers. The environment of the image pass is returned after it has been
+// closed, its sources still include the declarations of the resources. If a
+// directive of the sources is invalid, its diagnostic is returned without an
+// environment.
+func check(pp renderer.Preprocessor, inputFiles, mappingFlags, uniformFlags []string, glslVersion string, glVersion renderer.OpenGLVersion) ([]renderer.Diagnostic, *shadertoy.ShaderToy, error) {
+	pre, err := pp.Process(inputFiles...)
+	var perr renderer.PreprocessError
+	if errors.As(err, &perr) {
+		return []renderer.Diagnostic{perr.Diagnostic()}, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	sources := pre.Sources
+	mappings, err := parseMappings(mappingFlags, ".")
+	if err != nil {
+		return nil, nil, err
+	}
+	uniforms, err := parseUniformValues(uniformFlags)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	env, err := shadertoy.NewShaderToy(sources, mappings, uniforms, glslVersion)
+	if errors.As(err, &perr) {
+		return []renderer.Diagnostic{perr.Diagnostic()}, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	env.Preprocessor = pp
+	diags, err := renderer.Check(env, glVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if ok, err := shadertoy.HasMainSound(sources); err != nil {
+		return nil, nil, err
+	} else if ok {
+		env, err := shadertoy.NewSoundShaderToy(sources, mappings, uniforms, glslVersion)
+		if errors.As(err, &perr) {
+			return append(diags, perr.Diagnostic()), nil, nil
+		} else if err != nil {
+			return nil, nil, err
+		}
+		env.Preprocessor = pp
+		soundDiags, err := renderer.Check(env, glVersion)
+		if err != nil {
+			return nil, nil, err
+		}
+		diags = append(diags, soundDiags...)
+	}
+	return diags, env, nil
+}
+
+// writeDiagnostics writes diagnostics either as lines of text in the style of
+// other compilers, or as a JSON array.
+func writeDiagnostics(w io.Writer, format string, diags []renderer.Diagnostic) error {
+	if format == "json" {
+		if diags == nil {
+			diags = []renderer.Diagnostic{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diags)
+	}
+	for _, d := range diags {
+		if _, err := fmt.Fprintln(w, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+func TestWriteDiagnostics(t *testing.T) {
+	diags := []renderer.Diagnostic{
+		{Filename: "a.glsl", Line: 3, Column: 5, Severity: renderer.SeverityError, Message: "syntax error"},
+		{Filename: "b.glsl", Line: 1, Severity: renderer.SeverityWarning, Message: "unused"},
+	}
+
+	var buf bytes.Buffer
+	if err := writeDiagnostics(&buf, "text", diags); err != nil {
+		t.Fatal(err)
+	}
+	exp := "a.glsl:3:5: error: syntax error\nb.glsl:1: warning: unused\n"
+	if buf.String() != exp {
+		t.Errorf("unexpected text output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := writeDiagnostics(&buf, "json", diags); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []renderer.Diagnostic
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, diags) {
+		t.Errorf("unexpected json output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := writeDiagnostics(&buf, "json", nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[]\n" {
+		t.Errorf("unexpected json output without diagnostics: %q", buf.String())
+	}
+}
+
+func TestCheckExitCodes(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+
+	if code := runCheck([]string{}, io.Discard); code != checkError {
+		t.Errorf("unexpected exit code without input files: %d", code)
+	}
+	if code := runCheck([]string{"-i", "../../testdata/does-not-exist.glsl"}, io.Discard); code != checkError {
+		t.Errorf("unexpected exit code for a missing file: %d", code)
+	}
+	if code := runCheck([]string{"-i", "../../shaders/example.glsl", "-format", "xml"}, io.Discard); code != checkError {
+		t.Errorf("unexpected exit code for an unknown format: %d", code)
+	}
+}
+
+func TestCheckPreprocessError(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "shader.glsl")
+	if err := os.WriteFile(filename, []byte("void main() {}\n#endif\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if code := runCheck([]string{"-i", filename}, &buf); code != checkFailed {
+		t.Errorf("unexpected exit code: %d", code)
+	}
+	if exp := filename + ":2: error: #endif without #if\n"; buf.String() != exp {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+}
+
+func TestCheckDirectiveError(t *testing.T) {
+	tests := []struct {
+		text     string
+		uniforms []string
+		exp      string
+	}{
+		{text: "void mainImage(out vec4 c, in vec2 p) {}\n#pragma uniform float speed = fast\n", exp: ":2: error: "},
+		{text: "uniform float speed;\nvoid mainImage(out vec4 c, in vec2 p) {}\n", uniforms: []string{"-u", "speed=vec2(1, 2)"}, exp: ":1: error: "},
+	}
+	for _, tt := range tests {
+		filename := filepath.Join(t.TempDir(), "shader.glsl")
+		if err := os.WriteFile(filename, []byte(tt.text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if code := runCheck(append([]string{"-i", filename}, tt.uniforms...), &buf); code != checkFailed {
+			t.Errorf("%q: unexpected exit code: %d", tt.text, code)
+		}
+		if !strings.HasPrefix(buf.String(), filename+tt.exp) {
+			t.Errorf("%q: unexpected output: %q", tt.text, buf.String())
+		}
+	}
+}
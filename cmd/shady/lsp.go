@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/polyfloyd/shady/lsp"
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// runLSP implements the lsp command, which serves the language server on
+// stdin and stdout. It returns the exit code.
+func runLSP(args []string) int {
+	fs := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	glslVersion := fs.String("glsl", "330", "The GLSL version to use")
+	openGLVersionStr := fs.String("opengl", "glsl", "The OpenGL version to use. If \"glsl\", the version is inferred from the requested GLSL version")
+	var mappingFlags arrayFlags
+	fs.Var(&mappingFlags, "map", "Specify or override ShaderToy input mappings")
+	var uniformFlags arrayFlags
+	fs.Var(&uniformFlags, "u", "Set the value of a uniform in <name>=<value> format")
+	var defineFlags arrayFlags
+	fs.Var(&defineFlags, "D", "Define a preprocessor macro in <name>=<value> format")
+	var includeFlags arrayFlags
+	fs.Var(&includeFlags, "I", "Add a directory to search for included files")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	glVersion, err := parseOpenGLVersion(*openGLVersionStr, *glslVersion)
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+	pp := newPreprocessor(defineFlags, includeFlags, *glslVersion)
+
+	analyze := func(filename string) (lsp.Analysis, error) {
+		diags, env, err := check(pp, []string{filename}, mappingFlags, uniformFlags, *glslVersion, glVersion)
+		if err != nil {
+			return lsp.Analysis{}, err
+		}
+		if env == nil {
+			// A directive is invalid, so the files that are included can
+			// not be known.
+			files := []string{filename}
+			for _, d := range diags {
+				files = append(files, d.Filename)
+			}
+			return lsp.Analysis{Diagnostics: diags, Files: files}, nil
+		}
+		pre, err := pp.Process(filename)
+		if err != nil {
+			return lsp.Analysis{}, err
+		}
+		sources, err := env.Sources()
+		if err != nil {
+			return lsp.Analysis{}, err
+		}
+		uniforms, err := lsp.DeclaredUniforms(sources[renderer.StageFragment])
+		if err != nil {
+			return lsp.Analysis{}, err
+		}
+		return lsp.Analysis{Diagnostics: diags, Files: pre.Files, Uniforms: uniforms}, nil
+	}
+	if err := lsp.NewServer(analyze, pp).Serve(os.Stdin, os.Stdout); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
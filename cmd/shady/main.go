@@ -10,32 +10,62 @@ import (
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
+	"io/fs"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 
+	"github.com/polyfloyd/shady/control"
 	"github.com/polyfloyd/shady/encode"
+	"github.com/polyfloyd/shady/playlist"
 	"github.com/polyfloyd/shady/renderer"
 	"github.com/polyfloyd/shady/shadertoy"
-	_ "github.com/polyfloyd/shady/shadertoy/audio"
+	"github.com/polyfloyd/shady/shadertoy/audio"
+	_ "github.com/polyfloyd/shady/shadertoy/camera"
+	_ "github.com/polyfloyd/shady/shadertoy/gamepad"
 	_ "github.com/polyfloyd/shady/shadertoy/image"
+	_ "github.com/polyfloyd/shady/shadertoy/midi"
+	_ "github.com/polyfloyd/shady/shadertoy/osc"
 	_ "github.com/polyfloyd/shady/shadertoy/peripheral"
+	_ "github.com/polyfloyd/shady/shadertoy/timeline"
 	_ "github.com/polyfloyd/shady/shadertoy/video"
 )
 
+// defaultSoundDuration is the length of the audio rendered from sound shaders
+// if no duration is set, which is the same as on shadertoy.com.
+const defaultSoundDuration = 180 * time.Second
+
+// defaultPlaylistDuration is the time an entry of a playlist is shown if it
+// does not set a duration.
+const defaultPlaylistDuration = time.Minute
+
 func main() {
 	log.SetOutput(os.Stderr)
 	// Lock this goroutine to the current thread. This is required because
 	// OpenGL contexts are bounds to threads.
 	runtime.LockOSThread()
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check":
+			os.Exit(runCheck(os.Args[2:], os.Stdout))
+		case "lsp":
+			os.Exit(runLSP(os.Args[2:]))
+		case "pack":
+			os.Exit(runPack(os.Args[2:]))
+		}
+	}
+
 	formatNames := make([]string, 0, len(encode.Formats))
 	for name := range encode.Formats {
 		formatNames = append(formatNames, name)
@@ -55,15 +85,69 @@ func main() {
 	realtime := flag.Bool("rt", false, "Render at the actual number of frames per second set by -framerate")
 	verbose := flag.Bool("v", false, "Show verbose output about rendering")
 	watch := flag.Bool("w", false, "Watch the shader source files for changes")
+	play := flag.Bool("play", false, "Play the sound of audio and video mappings while rendering to a window")
+	soundOut := flag.String("sound-out", "", "Render the sound of the mainSound function to the specified WAV or raw PCM file and exit. The length is set with -d")
 	glslVersion := flag.String("glsl", "330", "The GLSL version to use")
 	openGLVersionStr := flag.String("opengl", "glsl", "The OpenGL version to use. If \"glsl\", the version is inferred from the requested GLSL version")
 	var shadertoyMappings arrayFlags
 	flag.Var(&shadertoyMappings, "map", "Specify or override ShaderToy input mappings")
+	var uniformValues arrayFlags
+	flag.Var(&uniformValues, "u", "Set the value of a uniform in <name>=<value> format, e.g. speed=2.0 or color=vec3(1,0.5,0)")
+	var defineFlags arrayFlags
+	flag.Var(&defineFlags, "D", "Define a preprocessor macro in <name>=<value> format. The value defaults to 1")
+	var includeFlags arrayFlags
+	flag.Var(&includeFlags, "I", "Add a directory to search for included files. These precede the directories in SHADY_PATH")
+	controlAddr := flag.String("control", "", "Serve the remote control API on the specified Unix socket, or TCP address if prefixed with \"tcp:\"")
+	playlistFile := flag.String("playlist", "", "Show the shaders listed in the specified playlist file in turn instead of those set with -i")
+	transitionFile := flag.String("transition", "", "The GLSL file with the transition between the entries of a playlist. Entries are crossfaded by default")
+	transitionDuration := flag.Float64("transition-duration", 1.0, "The duration of the transitions between the entries of a playlist in seconds")
 	flag.Parse()
 
-	if len(inputFiles) == 0 {
+	if *playlistFile != "" {
+		if len(inputFiles) > 0 {
+			log.Fatalf("-i and -playlist are mutually exclusive")
+		}
+		if *watch {
+			log.Fatalf("-w can not be combined with -playlist")
+		}
+	} else if len(inputFiles) == 0 {
 		log.Fatalf("Please specify at least one GLSL file with -i")
 	}
+	// fsys is the filesystem of a bundle, nil if the files are read from the
+	// OS.
+	var fsys fs.FS
+	if len(inputFiles) == 1 && isBundle(inputFiles[0]) {
+		var m *manifest
+		var err error
+		if fsys, m, err = openBundle(inputFiles[0]); err != nil {
+			log.Fatal(err)
+		}
+		if *watch {
+			log.Fatalf("-w can not be combined with a bundle")
+		}
+		// Settings on the command line take precedence over those of the
+		// manifest.
+		set := map[string]bool{}
+		flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if m.GLSL != "" && !set["glsl"] {
+			*glslVersion = m.GLSL
+		}
+		if m.Geometry != "" && !set["g"] {
+			*geometry = m.Geometry
+		}
+		if m.Framerate != 0 && !set["f"] && !set["framerate"] {
+			*framerate = m.Framerate
+		}
+		inputFiles = m.Files
+		shadertoyMappings = append(shadertoyMappings, m.Mappings...)
+		uniformValues = append(m.Uniforms, uniformValues...)
+		defines := make([]string, 0, len(m.Defines)+len(defineFlags))
+		for name, value := range m.Defines {
+			defines = append(defines, name+"="+value)
+		}
+		defineFlags = append(defines, defineFlags...)
+		includeFlags = append(m.Include, includeFlags...)
+	}
 	if *framerateOld != 0 {
 		log.Println("-framerate is deprecated, please use -f")
 		*framerate = *framerateOld
@@ -88,7 +172,7 @@ func main() {
 		animateNumFrames = *numFrames
 	}
 	if *duration != 0.0 {
-		if *framerate == 0 {
+		if *framerate == 0 && *soundOut == "" {
 			log.Fatalf("-duration is set while -framerate is not set")
 		}
 		animateNumFrames = uint(*duration * *framerate)
@@ -99,6 +183,14 @@ func main() {
 	if *realtime && *framerate == 0 {
 		log.Fatalf("-rt is set while -framerate is not set")
 	}
+	if *play && *outputFormat != "x11" {
+		log.Fatalf("-play is only supported when rendering to a window")
+	}
+	if *playlistFile != "" && *outputFormat != "x11" && !*realtime {
+		// Entries are switched by the wall clock, which does not match the
+		// animation when rendering faster or slower than real time.
+		log.Fatalf("-playlist requires -rt when not rendering to a window")
+	}
 	interval := time.Duration(float64(time.Second) / *framerate)
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -111,45 +203,144 @@ func main() {
 		cancel()
 	}()
 
-	var openGLVersion renderer.OpenGLVersion
-	if *openGLVersionStr == "glsl" {
-		var err error
-		openGLVersion, err = renderer.OpenGLVersionFromGLSLVersion(*glslVersion)
+	openGLVersion, err := parseOpenGLVersion(*openGLVersionStr, *glslVersion)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pp := newPreprocessor(defineFlags, includeFlags, *glslVersion)
+	pp.FS = fsys
+	shadertoy.Verbose = *verbose
+	if *verbose {
+		log.Printf("OpenGL version: %s", openGLVersion)
+		log.Printf("GLSL version: %s", *glslVersion)
+	}
+
+	soundDuration := defaultSoundDuration
+	if *duration != 0.0 {
+		soundDuration = time.Duration(*duration * float64(time.Second))
+	}
+	if *soundOut != "" {
+		samples, err := renderSound(ctx, pp, inputFiles, shadertoyMappings, uniformValues, *glslVersion, openGLVersion, soundDuration)
 		if err != nil {
 			log.Fatal(err)
 		}
-	} else {
-		var err error
-		openGLVersion, err = renderer.ParseOpenGLVersion(*openGLVersionStr)
+		if samples == nil {
+			log.Fatalf("No mainSound function found in the shader sources")
+		}
+		w, err := openWriter(*soundOut)
 		if err != nil {
 			log.Fatal(err)
 		}
+		defer w.Close()
+		if err := encode.EncodeSound(w, *soundOut, shadertoy.SoundSampleRate, 2, samples); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
-	if *verbose {
-		log.Printf("OpenGL version: %s", openGLVersion)
-		log.Printf("GLSL version: %s", *glslVersion)
+
+	if *play {
+		// Sound shaders are rendered up front and then played like any
+		// other audio mapping.
+		samples, err := renderSound(ctx, pp, inputFiles, shadertoyMappings, uniformValues, *glslVersion, openGLVersion, soundDuration)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if samples != nil && fsys != nil {
+			// The rendered sound is stored in a temporary file, which can
+			// not be read from a bundle.
+			log.Printf("The sound of mainSound can not be played from a bundle")
+		} else if samples != nil {
+			f, err := os.CreateTemp("", "shady-sound-*.wav")
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			err = encode.EncodeWAV(f, shadertoy.SoundSampleRate, 2, samples)
+			f.Close()
+			if err != nil {
+				log.Fatal(err)
+			}
+			shadertoyMappings = append(shadertoyMappings, "iSound=audio:"+f.Name())
+		}
+		audio.EnablePlayback(audio.NewDeviceSink)
 	}
 
+	// The shader files may be switched using the control API, so access to
+	// them is guarded.
+	var filesLock sync.Mutex
+	currentFiles := func() []string {
+		filesLock.Lock()
+		defer filesLock.Unlock()
+		return inputFiles
+	}
 	newFn := func() (renderer.Environment, []string, error) {
-		sources, err := renderer.Includes([]string(inputFiles)...)
+		pre, err := pp.Process(currentFiles()...)
 		if err != nil {
-			return nil, sources, err
+			return nil, nil, err
 		}
 
-		mappings := make([]shadertoy.Mapping, 0, len(shadertoyMappings))
-		for _, str := range shadertoyMappings {
-			m, err := shadertoy.ParseMapping(str, ".")
-			if err != nil {
-				return nil, sources, err
-			}
-			mappings = append(mappings, m)
+		mappings, err := parseMappings(shadertoyMappings, ".")
+		if err != nil {
+			return nil, pre.Files, err
+		}
+		uniforms, err := parseUniformValues(uniformValues)
+		if err != nil {
+			return nil, pre.Files, err
 		}
 		env, err := shadertoy.NewShaderToy(
-			renderer.SourceFiles(sources...),
+			pre.Sources,
 			mappings,
+			uniforms,
 			*glslVersion,
 		)
-		return env, sources, err
+		if err != nil {
+			return nil, pre.Files, err
+		}
+		env.Preprocessor = pp
+		env.FS = fsys
+		return env, pre.Files, nil
+	}
+
+	// The mappings and uniforms set on the command line apply to all entries
+	// of a playlist, those of an entry take precedence.
+	playlistDefaults := playlist.Entry{
+		Duration:           defaultPlaylistDuration,
+		TransitionDuration: time.Duration(*transitionDuration * float64(time.Second)),
+	}
+	if *transitionFile != "" {
+		var err error
+		if playlistDefaults.Transition, err = filepath.Abs(*transitionFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	newEntryFn := func(entry playlist.Entry, dir string) (renderer.Environment, error) {
+		pre, err := pp.Process(entry.Files...)
+		if err != nil {
+			return nil, err
+		}
+		entryMappings, err := parseMappings(entry.Mappings, dir)
+		if err != nil {
+			return nil, err
+		}
+		mappings, err := parseMappings(shadertoyMappings, ".")
+		if err != nil {
+			return nil, err
+		}
+		uniforms, err := parseUniformValues(append(slices.Clone(uniformValues), entry.Uniforms...))
+		if err != nil {
+			return nil, err
+		}
+		env, err := shadertoy.NewShaderToy(
+			pre.Sources,
+			append(entryMappings, mappings...),
+			uniforms,
+			*glslVersion,
+		)
+		if err != nil {
+			return nil, err
+		}
+		env.Preprocessor = pp
+		return env, nil
 	}
 
 	// Check whether we should render directly to an onscreen window. This is a
@@ -161,8 +352,15 @@ func main() {
 		}
 		defer engine.Close()
 
-		if *watch {
-			go watchEnvironment(ctx, engine, newFn)
+		reload := make(chan struct{}, 1)
+		if *playlistFile != "" {
+			go func() {
+				if err := playPlaylist(ctx, engine, *playlistFile, playlistDefaults, newEntryFn); err != nil {
+					log.Fatal(err)
+				}
+			}()
+		} else if *watch {
+			go watchEnvironment(ctx, engine, newFn, fsys == nil, reload)
 		} else {
 			env, _, err := newFn()
 			if err != nil {
@@ -170,6 +368,13 @@ func main() {
 			}
 			engine.SetEnvironment(env)
 		}
+		if *controlAddr != "" {
+			var switchFn control.SwitchFunc
+			if *playlistFile == "" {
+				switchFn = switchEnvironment(engine, newFn, &filesLock, &inputFiles, *watch, reload)
+			}
+			serveControl(ctx, *controlAddr, control.NewServer(&engine.Controls, switchFn))
+		}
 
 		if err := engine.Animate(ctx); errors.Is(err, renderer.ErrWindowClosed) {
 			return
@@ -224,8 +429,15 @@ func main() {
 		cancel()
 	}()
 
-	if *watch {
-		go watchEnvironment(ctx, engine, newFn)
+	reload := make(chan struct{}, 1)
+	if *playlistFile != "" {
+		go func() {
+			if err := playPlaylist(ctx, engine, *playlistFile, playlistDefaults, newEntryFn); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	} else if *watch {
+		go watchEnvironment(ctx, engine, newFn, fsys == nil, reload)
 	} else {
 		env, _, err := newFn()
 		if err != nil {
@@ -233,11 +445,169 @@ func main() {
 		}
 		engine.SetEnvironment(env)
 	}
+	if *controlAddr != "" {
+		var switchFn control.SwitchFunc
+		if *playlistFile == "" {
+			switchFn = switchEnvironment(engine, newFn, &filesLock, &inputFiles, *watch, reload)
+		}
+		serveControl(ctx, *controlAddr, control.NewServer(&engine.Controls, switchFn))
+	}
 
 	engine.Animate(ctx, interval, in)
 }
 
-func watchEnvironment(ctx context.Context, engine interface{ SetEnvironment(renderer.Environment) }, newFn func() (renderer.Environment, []string, error)) {
+// renderSound renders the sound of the mainSound function in the specified
+// files. If there is no such function, nil is returned.
+func renderSound(ctx context.Context, pp renderer.Preprocessor, inputFiles, mappingFlags, uniformFlags []string, glslVersion string, glVersion renderer.OpenGLVersion, duration time.Duration) ([]int16, error) {
+	pre, err := pp.Process(inputFiles...)
+	if err != nil {
+		return nil, err
+	}
+	sources := pre.Sources
+	if ok, err := shadertoy.HasMainSound(sources); err != nil || !ok {
+		return nil, err
+	}
+
+	mappings, err := parseMappings(mappingFlags, ".")
+	if err != nil {
+		return nil, err
+	}
+	uniforms, err := parseUniformValues(uniformFlags)
+	if err != nil {
+		return nil, err
+	}
+	env, err := shadertoy.NewSoundShaderToy(sources, mappings, uniforms, glslVersion)
+	if err != nil {
+		return nil, err
+	}
+	env.Preprocessor = pp
+	env.FS = pp.FS
+	return shadertoy.RenderSound(ctx, glVersion, env, duration)
+}
+
+// parseOpenGLVersion parses the value of the -opengl flag, which is inferred
+// from the GLSL version if it is "glsl".
+func parseOpenGLVersion(str, glslVersion string) (renderer.OpenGLVersion, error) {
+	if str == "glsl" {
+		return renderer.OpenGLVersionFromGLSLVersion(glslVersion)
+	}
+	return renderer.ParseOpenGLVersion(str)
+}
+
+// newPreprocessor creates the preprocessor for the values of -D and -I flags.
+// Macros without a value are defined as 1, like with C compilers. Included
+// files are looked up in the -I directories, then in those listed in the
+// SHADY_PATH environment variable and finally in the library directory.
+func newPreprocessor(defineFlags, includeFlags []string, glslVersion string) renderer.Preprocessor {
+	defines := map[string]string{}
+	for _, str := range defineFlags {
+		name, value, ok := strings.Cut(str, "=")
+		if !ok {
+			value = "1"
+		}
+		defines[name] = value
+	}
+	includePaths := slices.Clone(includeFlags)
+	for _, dir := range filepath.SplitList(os.Getenv("SHADY_PATH")) {
+		if dir != "" {
+			includePaths = append(includePaths, dir)
+		}
+	}
+	if dir, err := libraryDir(); err == nil {
+		includePaths = append(includePaths, dir)
+	}
+	return renderer.Preprocessor{
+		Defines:      defines,
+		Version:      glslVersion,
+		IncludePaths: includePaths,
+	}
+}
+
+// libraryDir returns the directory in which shared GLSL libraries are
+// installed, which is $XDG_DATA_HOME/shady/lib.
+func libraryDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "shady", "lib"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "shady", "lib"), nil
+}
+
+// parseMappings parses the values of -map flags. Relative paths are resolved
+// against dir.
+func parseMappings(flags []string, dir string) ([]shadertoy.Mapping, error) {
+	mappings := make([]shadertoy.Mapping, 0, len(flags))
+	for _, str := range flags {
+		m, err := shadertoy.ParseMapping(str, dir)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, nil
+}
+
+func parseUniformValues(flags []string) ([]shadertoy.UniformValue, error) {
+	values := make([]shadertoy.UniformValue, 0, len(flags))
+	for _, str := range flags {
+		uv, err := shadertoy.ParseUniformValue(str)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, uv)
+	}
+	return values, nil
+}
+
+// switchEnvironment returns a function for the control API that switches the
+// shader files. The files are checked by loading the environment. If the
+// sources are watched, the watcher is signaled to reload, otherwise the
+// environment is set right away.
+func switchEnvironment(engine interface{ SetEnvironment(renderer.Environment) }, newFn func() (renderer.Environment, []string, error), lock *sync.Mutex, files *arrayFlags, watch bool, reload chan<- struct{}) control.SwitchFunc {
+	return func(newFiles []string) error {
+		lock.Lock()
+		oldFiles := *files
+		*files = newFiles
+		lock.Unlock()
+
+		env, _, err := newFn()
+		if err != nil {
+			lock.Lock()
+			*files = oldFiles
+			lock.Unlock()
+			return err
+		}
+		if watch {
+			env.Close()
+			select {
+			case reload <- struct{}{}:
+			default:
+			}
+			return nil
+		}
+		engine.SetEnvironment(env)
+		return nil
+	}
+}
+
+// serveControl serves the control API in the background until the context is
+// canceled, which also removes the socket.
+func serveControl(ctx context.Context, addr string, server *control.Server) {
+	ln, err := control.Listen(addr)
+	if err != nil {
+		log.Fatalf("Could not open control socket: %v", err)
+	}
+	go func() {
+		if err := server.Serve(ctx, ln); err != nil {
+			log.Printf("Error serving control API: %v", err)
+		}
+	}()
+}
+
+func watchEnvironment(ctx context.Context, engine interface{ SetEnvironment(renderer.Environment) }, newFn func() (renderer.Environment, []string, error), watchFiles bool, reload <-chan struct{}) {
 	for ctx.Err() == nil {
 		loopCtx, loopCancel := context.WithCancel(ctx)
 
@@ -247,8 +617,12 @@ func watchEnvironment(ctx context.Context, engine interface{ SetEnvironment(rend
 				return nil, nil, err
 			}
 			env, files, err := newFn()
-			for _, f := range files {
-				watcher.Add(f)
+			// Only files of the OS can be watched, other environments
+			// are only reloaded when signaled.
+			if watchFiles {
+				for _, f := range files {
+					watcher.Add(f)
+				}
 			}
 			return env, watcher, err
 		}()
@@ -256,6 +630,7 @@ func watchEnvironment(ctx context.Context, engine interface{ SetEnvironment(rend
 			log.Println(err)
 			select {
 			case <-watcher.Events:
+			case <-reload:
 			case err := <-watcher.Errors:
 				log.Println(err)
 			case <-loopCtx.Done():
@@ -282,6 +657,7 @@ func watchEnvironment(ctx context.Context, engine interface{ SetEnvironment(rend
 				}
 			}
 			loopCancel()
+		case <-reload:
 		case err := <-watcher.Errors:
 			log.Println(err)
 		case <-loopCtx.Done():
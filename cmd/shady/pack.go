@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+// runPack implements the pack command, which writes a shader with all files it
+// needs to a bundle that can be run with -i. It returns the exit code.
+func runPack(args []string) int {
+	fs := flag.NewFlagSet("pack", flag.ContinueOnError)
+	var inputFiles arrayFlags
+	fs.Var(&inputFiles, "i", "The shader file(s) to pack")
+	outputFile := fs.String("o", "", "The bundle to write, either a .zip or .tar file")
+	geometry := fs.String("g", "", "The geometry of the rendered image in WIDTHxHEIGHT format")
+	framerate := fs.Float64("f", 0, "The number of frames per second to animate the shader with")
+	glslVersion := fs.String("glsl", "330", "The GLSL version to use")
+	var mappingFlags arrayFlags
+	fs.Var(&mappingFlags, "map", "Specify or override ShaderToy input mappings")
+	var uniformFlags arrayFlags
+	fs.Var(&uniformFlags, "u", "Set the value of a uniform in <name>=<value> format")
+	var defineFlags arrayFlags
+	fs.Var(&defineFlags, "D", "Define a preprocessor macro in <name>=<value> format")
+	var includeFlags arrayFlags
+	fs.Var(&includeFlags, "I", "Add a directory to search for included files")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(inputFiles) == 0 {
+		log.Printf("Please specify at least one GLSL file with -i")
+		return 2
+	}
+	if !isBundle(*outputFile) {
+		log.Printf("Please specify the .zip or .tar bundle to write with -o")
+		return 2
+	}
+	if *geometry != "" {
+		if _, _, err := parseGeometry(*geometry); err != nil {
+			log.Print(err)
+			return 2
+		}
+	}
+
+	pp := newPreprocessor(defineFlags, includeFlags, *glslVersion)
+	mappings, err := parseMappings(mappingFlags, ".")
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+	if _, err := parseUniformValues(uniformFlags); err != nil {
+		log.Print(err)
+		return 2
+	}
+	b, err := collectBundle(pp, inputFiles, mappings, *glslVersion)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	b.manifest.Geometry = *geometry
+	b.manifest.Framerate = *framerate
+	b.manifest.GLSL = *glslVersion
+	b.manifest.Uniforms = uniformFlags
+	if len(pp.Defines) > 0 {
+		b.manifest.Defines = pp.Defines
+	}
+	if err := b.write(*outputFile); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+// A bundle holds the files of a shader and the names they are stored under.
+type bundle struct {
+	manifest manifest
+	// names maps the absolute paths of the files to their slash separated
+	// names in the bundle.
+	names map[string]string
+}
+
+// collectBundle finds all files of a shader: the sources, included files and
+// the files of mappings, recursing into the sources of buffers.
+//
+// The files are stored relative to the directory that contains all of them,
+// so relative paths in the sources remain valid. Library files found in the
+// include paths are stored in include/<n> unless they are in that directory
+// too. The mappings are rewritten to refer to the files in the bundle.
+func collectBundle(pp renderer.Preprocessor, inputFiles []string, overrideMappings []shadertoy.Mapping, glslVersion string) (*bundle, error) {
+	var files []string
+	// visited holds the sources of the buffers that have been collected, as
+	// buffers may refer to themselves and to each other.
+	visited := map[string]bool{}
+	for _, f := range inputFiles {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return nil, err
+		}
+		visited[abs] = true
+	}
+	var collect func(inputs []string, overrides []shadertoy.Mapping) ([]shadertoy.Mapping, error)
+	collect = func(inputs []string, overrides []shadertoy.Mapping) ([]shadertoy.Mapping, error) {
+		pre, err := pp.Process(inputs...)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, pre.Files...)
+		env, err := shadertoy.NewShaderToy(pre.Sources, overrides, nil, glslVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range env.Mappings() {
+			var mappingFiles []string
+			if _, err := m.Relocate(func(path string) string {
+				mappingFiles = append(mappingFiles, path)
+				return path
+			}); err != nil {
+				return nil, err
+			}
+			for _, f := range mappingFiles {
+				abs, err := filepath.Abs(f)
+				if err != nil {
+					return nil, err
+				}
+				files = append(files, abs)
+				if m.Namespace != "buffer" || visited[abs] {
+					continue
+				}
+				visited[abs] = true
+				bufferMappings, err := collect([]string{abs}, nil)
+				if err != nil {
+					return nil, err
+				}
+				// The mappings of buffers are read from their sources,
+				// which are packed as they are.
+				for _, bm := range bufferMappings {
+					paths, err := absolutePaths(bm)
+					if err != nil {
+						return nil, err
+					}
+					if len(paths) > 0 {
+						return nil, fmt.Errorf("%s: mapping %s refers to %s by an absolute path, only relative paths can be packed in buffers", abs, bm.Name, paths[0])
+					}
+				}
+			}
+		}
+		return env.Mappings(), nil
+	}
+	mappings, err := collect(inputFiles, overrideMappings)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bundle{names: map[string]string{}}
+	if err := b.layout(files, inputFiles, pp.IncludePaths); err != nil {
+		return nil, err
+	}
+	for _, f := range inputFiles {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return nil, err
+		}
+		b.manifest.Files = append(b.manifest.Files, b.names[abs])
+	}
+	for _, m := range mappings {
+		m, err := m.Relocate(func(path string) string {
+			abs, _ := filepath.Abs(path)
+			return "/" + b.names[abs]
+		})
+		if err != nil {
+			return nil, err
+		}
+		b.manifest.Mappings = append(b.manifest.Mappings, fmt.Sprintf("%s=%s:%s", m.Name, m.Namespace, m.Value))
+	}
+	return b, nil
+}
+
+// absolutePaths returns the files that a mapping refers to by absolute paths
+// or paths in the home directory. These are found by resolving the mapping
+// from another directory, which only changes the relative paths.
+func absolutePaths(m shadertoy.Mapping) ([]string, error) {
+	var paths, moved []string
+	if _, err := m.Relocate(func(path string) string {
+		paths = append(paths, path)
+		return path
+	}); err != nil {
+		return nil, err
+	}
+	m.PWD = filepath.Join(m.PWD, "moved")
+	if _, err := m.Relocate(func(path string) string {
+		moved = append(moved, path)
+		return path
+	}); err != nil {
+		return nil, err
+	}
+	var abs []string
+	for i, path := range paths {
+		if path == moved[i] {
+			abs = append(abs, path)
+		}
+	}
+	return abs, nil
+}
+
+// layout determines the names of the files in the bundle and the include
+// paths of the manifest.
+func (b *bundle) layout(files, inputFiles []string, includePaths []string) error {
+	inputs := map[string]bool{}
+	for _, f := range inputFiles {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return err
+		}
+		inputs[abs] = true
+	}
+	includeDirs := make([]string, len(includePaths))
+	for i, dir := range includePaths {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		includeDirs[i] = abs
+	}
+	// includeDir returns the index of the include path that contains a
+	// file, -1 if there is none.
+	includeDir := func(file string) int {
+		for i, dir := range includeDirs {
+			if isWithin(dir, file) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	root := ""
+	for _, f := range files {
+		if !inputs[f] && includeDir(f) >= 0 {
+			continue
+		}
+		if root == "" {
+			root = filepath.Dir(f)
+		}
+		for !isWithin(root, f) {
+			root = filepath.Dir(root)
+		}
+	}
+
+	usedIncludes := map[int]string{}
+	for _, f := range files {
+		if _, ok := b.names[f]; ok {
+			continue
+		}
+		i := includeDir(f)
+		if i >= 0 && !isWithin(root, includeDirs[i]) {
+			rel, err := filepath.Rel(includeDirs[i], f)
+			if err != nil {
+				return err
+			}
+			usedIncludes[i] = path.Join("include", fmt.Sprint(i))
+			b.names[f] = path.Join(usedIncludes[i], filepath.ToSlash(rel))
+			continue
+		}
+		if i >= 0 {
+			rel, err := filepath.Rel(root, includeDirs[i])
+			if err != nil {
+				return err
+			}
+			usedIncludes[i] = filepath.ToSlash(rel)
+		}
+		rel, err := filepath.Rel(root, f)
+		if err != nil {
+			return err
+		}
+		b.names[f] = filepath.ToSlash(rel)
+	}
+	for i := range includeDirs {
+		if dir, ok := usedIncludes[i]; ok {
+			b.manifest.Include = append(b.manifest.Include, path.Join("/", dir))
+		}
+	}
+
+	owners := map[string]string{}
+	for f, name := range b.names {
+		if name == manifestName {
+			return fmt.Errorf("%s can not be packed, its name is reserved for the manifest", f)
+		}
+		if other, ok := owners[name]; ok {
+			return fmt.Errorf("%s and %s would both be stored as %s", other, f, name)
+		}
+		owners[name] = f
+	}
+	return nil
+}
+
+// isWithin reports whether a path is a directory or is in a directory.
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// write writes the bundle to a zip or tar archive. Directories, like those of
+// image sequences, are stored with all files in them.
+//
+// The archive is written to a temporary file next to the destination, which
+// replaces it once complete.
+func (b *bundle) write(filename string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	if err := b.writeTo(filename, tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// writeTo writes the archive of the bundle, in the format of the extension of
+// filename.
+func (b *bundle) writeTo(filename string, w io.Writer) error {
+	bw, err := newBundleWriter(filename, w)
+	if err != nil {
+		return err
+	}
+	manifestJSON, err := json.MarshalIndent(b.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := bw.add(manifestName, int64(len(manifestJSON)), time.Now(), bytes.NewReader(manifestJSON)); err != nil {
+		return err
+	}
+
+	files := make([]string, 0, len(b.names))
+	for f := range b.names {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		err := filepath.WalkDir(f, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(f, p)
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			fd, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer fd.Close()
+			return bw.add(path.Join(b.names[f], filepath.ToSlash(rel)), info.Size(), info.ModTime(), fd)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Close()
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPack(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"project/main.glsl": "#include \"common/util.glsl\"\n" +
+			"#include <noise.glsl>\n" +
+			"#pragma map tex=image:textures/wall.png\n" +
+			"#pragma map buf=buffer:passes/buffer.glsl;64x64\n" +
+			"void mainImage(out vec4 c, in vec2 p) {}\n",
+		"project/common/util.glsl":     "float util;\n",
+		"project/passes/buffer.glsl":   "#pragma map self=buffer:buffer.glsl;64x64\n#pragma map noise=image:../textures/noise.png\nvoid mainImage(out vec4 c, in vec2 p) {}\n",
+		"project/textures/wall.png":    "wall",
+		"project/textures/noise.png":   "noise",
+		"project/textures/unused.png":  "unused",
+		"library/noise.glsl":           "float noise;\n",
+		"library/unused/unused.glsl":   "float unused;\n",
+		"project/frames/0001.png":      "frame 1",
+		"project/frames/0002.png":      "frame 2",
+		"project/frames/sub/notes.txt": "notes",
+	})
+	project := filepath.Join(dir, "project")
+
+	for _, ext := range []string{".zip", ".tar"} {
+		t.Run(ext, func(t *testing.T) {
+			out := filepath.Join(dir, "bundle"+ext)
+			code := runPack([]string{
+				"-i", filepath.Join(project, "main.glsl"),
+				"-o", out,
+				"-I", filepath.Join(dir, "library"),
+				"-map", "frames=video:" + filepath.Join(project, "frames") + ";fps=10",
+				"-g", "64x32",
+				"-f", "30",
+				"-u", "speed=2.0",
+				"-D", "QUALITY=2",
+			})
+			if code != 0 {
+				t.Fatalf("unexpected exit code: %d", code)
+			}
+
+			fsys, m, err := openBundle(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			exp := manifest{
+				Files:     []string{"main.glsl"},
+				Geometry:  "64x32",
+				Framerate: 30,
+				GLSL:      "330",
+				Mappings: []string{
+					"frames=video:/frames;fps=10",
+					"tex=image:/textures/wall.png",
+					"buf=buffer:/passes/buffer.glsl;64x64",
+				},
+				Uniforms: []string{"speed=2.0"},
+				Defines:  map[string]string{"QUALITY": "2"},
+				Include:  []string{"/include/0"},
+			}
+			if !reflect.DeepEqual(*m, exp) {
+				t.Fatalf("unexpected manifest: %+v", *m)
+			}
+
+			var names []string
+			err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					names = append(names, path)
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(names)
+			expNames := []string{
+				"common/util.glsl",
+				"frames/0001.png",
+				"frames/0002.png",
+				"frames/sub/notes.txt",
+				"include/0/noise.glsl",
+				"main.glsl",
+				"passes/buffer.glsl",
+				"shady.json",
+				"textures/noise.png",
+				"textures/wall.png",
+			}
+			if !slices.Equal(names, expNames) {
+				t.Fatalf("unexpected files: %q", names)
+			}
+			if b, err := fs.ReadFile(fsys, "textures/noise.png"); err != nil || string(b) != "noise" {
+				t.Fatalf("unexpected contents: %q, %v", b, err)
+			}
+
+			pp := renderer.Preprocessor{IncludePaths: m.Include, FS: fsys}
+			pre, err := pp.Process(m.Files...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expFiles := []string{"/main.glsl", "/common/util.glsl", "/include/0/noise.glsl"}
+			if !slices.Equal(pre.Files, expFiles) {
+				t.Fatalf("unexpected included files: %q", pre.Files)
+			}
+		})
+	}
+}
+
+func TestPackInvalid(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+
+	dir := t.TempDir()
+	if code := runPack([]string{"-o", filepath.Join(dir, "bundle.zip")}); code != 2 {
+		t.Errorf("unexpected exit code without input files: %d", code)
+	}
+	if code := runPack([]string{"-i", "../../shaders/example.glsl", "-o", filepath.Join(dir, "bundle.7z")}); code != 2 {
+		t.Errorf("unexpected exit code for an unsupported format: %d", code)
+	}
+	if code := runPack([]string{"-i", "../../testdata/does-not-exist.glsl", "-o", filepath.Join(dir, "bundle.zip")}); code != 1 {
+		t.Errorf("unexpected exit code for a missing file: %d", code)
+	}
+}
+
+func TestPackAbsoluteBufferMapping(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+
+	dir := t.TempDir()
+	noise := filepath.Join(dir, "textures", "noise.png")
+	writeTestFiles(t, dir, map[string]string{
+		"main.glsl":          "#pragma map buf=buffer:buffer.glsl;64x64\nvoid mainImage(out vec4 c, in vec2 p) {}\n",
+		"buffer.glsl":        "#pragma map noise=image:" + filepath.ToSlash(noise) + "\nvoid mainImage(out vec4 c, in vec2 p) {}\n",
+		"textures/noise.png": "noise",
+	})
+	out := filepath.Join(dir, "bundle.zip")
+	if code := runPack([]string{"-i", filepath.Join(dir, "main.glsl"), "-o", out}); code != 1 {
+		t.Fatalf("unexpected exit code: %d", code)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 3 {
+		t.Fatalf("unexpected files after failing: %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/polyfloyd/shady/playlist"
+	"github.com/polyfloyd/shady/renderer"
+)
+
+type transitionEngine interface {
+	SetEnvironment(renderer.Environment)
+	TransitionTo(renderer.Environment, renderer.Transition)
+}
+
+// playPlaylist shows the entries of a playlist in turn until the context is
+// canceled. The playlist is read again each time it has been played through,
+// so it can be edited while it is playing.
+//
+// Entries that can not be loaded are skipped. An error is only returned if
+// none of the entries could be shown the first time the playlist is read.
+func playPlaylist(ctx context.Context, engine transitionEngine, filename string, defaults playlist.Entry, newFn func(playlist.Entry, string) (renderer.Environment, error)) error {
+	started := false
+	for ctx.Err() == nil {
+		shown := 0
+		pl, err := playlist.Load(filename, defaults)
+		if err != nil {
+			if !started {
+				return err
+			}
+			log.Printf("Error reading playlist: %v", err)
+			pl = &playlist.Playlist{}
+		}
+
+		for _, entry := range pl.Entries {
+			env, err := newFn(entry, pl.Dir)
+			if err != nil {
+				log.Printf("%s:%d: %v", filename, entry.Line, err)
+				continue
+			}
+			if !started {
+				engine.SetEnvironment(env)
+				started = true
+			} else {
+				tr := renderer.Transition{Duration: entry.TransitionDuration}
+				if entry.Transition != "" {
+					tr.Source = renderer.SourceFile{Filename: entry.Transition}
+				}
+				engine.TransitionTo(env, tr)
+			}
+			shown++
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(entry.Duration):
+			}
+		}
+
+		if shown == 0 {
+			if !started {
+				return fmt.Errorf("none of the entries of %s could be loaded", filename)
+			}
+			// Do not spin while the playlist is broken.
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}
+	return nil
+}
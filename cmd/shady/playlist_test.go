@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/polyfloyd/shady/playlist"
+	"github.com/polyfloyd/shady/renderer"
+)
+
+type fakeEngine struct {
+	sync.Mutex
+	calls []string
+}
+
+func (eng *fakeEngine) SetEnvironment(env renderer.Environment) {
+	eng.Lock()
+	defer eng.Unlock()
+	eng.calls = append(eng.calls, "set")
+}
+
+func (eng *fakeEngine) TransitionTo(env renderer.Environment, tr renderer.Transition) {
+	eng.Lock()
+	defer eng.Unlock()
+	source := "crossfade"
+	if tr.Source != nil {
+		source = filepath.Base(tr.Source.(renderer.SourceFile).Filename)
+	}
+	eng.calls = append(eng.calls, fmt.Sprintf("transition %s %v", source, tr.Duration))
+}
+
+func writePlaylist(t *testing.T, contents string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "show.playlist")
+	if err := os.WriteFile(filename, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestPlayPlaylist(t *testing.T) {
+	filename := writePlaylist(t, `
+-i a.glsl -d 0.01
+-i broken.glsl -d 0.01
+-i b.glsl -d 0.01 -transition wipe.glsl -transition-duration 0.005
+`)
+	defaults := playlist.Entry{Duration: time.Minute}
+	newFn := func(entry playlist.Entry, dir string) (renderer.Environment, error) {
+		if filepath.Base(entry.Files[0]) == "broken.glsl" {
+			return nil, fmt.Errorf("compile error")
+		}
+		return nil, nil
+	}
+
+	var eng fakeEngine
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- playPlaylist(ctx, &eng, filename, defaults, newFn)
+	}()
+	for {
+		eng.Lock()
+		n := len(eng.calls)
+		eng.Unlock()
+		if n >= 3 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{"set", "transition wipe.glsl 5ms", "transition crossfade 0s"}
+	for i, call := range exp {
+		if eng.calls[i] != call {
+			t.Fatalf("unexpected calls: %q", eng.calls)
+		}
+	}
+}
+
+func TestPlayPlaylistInvalid(t *testing.T) {
+	newFn := func(entry playlist.Entry, dir string) (renderer.Environment, error) {
+		return nil, fmt.Errorf("compile error")
+	}
+	var eng fakeEngine
+	filename := writePlaylist(t, "-i a.glsl\n")
+	if err := playPlaylist(context.Background(), &eng, filename, playlist.Entry{Duration: time.Minute}, newFn); err == nil {
+		t.Fatalf("expected an error if no entry can be loaded")
+	}
+	if err := playPlaylist(context.Background(), &eng, filepath.Join(t.TempDir(), "missing"), playlist.Entry{}, newFn); err == nil {
+		t.Fatalf("expected an error for a missing playlist")
+	}
+	if len(eng.calls) != 0 {
+		t.Fatalf("unexpected calls: %q", eng.calls)
+	}
+}
@@ -0,0 +1,289 @@
+// Package control implements an HTTP API to control a running instance of
+// Shady.
+//
+// The API is served on a Unix socket or TCP address and uses JSON for request
+// and response bodies:
+//
+//	GET    /stats              Frame counters, time and FPS
+//	GET    /uniforms           The uniforms of the current shader
+//	POST   /uniforms           Set uniforms, e.g. {"speed": 2, "tint": "vec3(1, 0, 0)"}
+//	DELETE /uniforms/{name}    Hand control of a uniform back to the shader
+//	POST   /pause              Pause the clock
+//	POST   /resume             Resume the clock
+//	POST   /seek               Set the time in seconds, e.g. {"time": 12.5}
+//	POST   /environment        Switch to other shaders, e.g. {"files": ["a.glsl"]}
+//	GET    /snapshot           The next frame as PNG
+//
+// Errors are returned as {"error": "..."} with an appropriate status code.
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+// snapshotTimeout is the maximum time to wait for the next frame.
+const snapshotTimeout = 5 * time.Second
+
+// A SwitchFunc loads the environment of the specified shader files and sets it
+// on the engine.
+type SwitchFunc func(files []string) error
+
+// Server serves the control API for an engine.
+type Server struct {
+	controls *renderer.Controls
+	switchFn SwitchFunc
+	mux      *http.ServeMux
+}
+
+// NewServer creates a server that controls an engine through its controls.
+// If switchFn is nil, switching environments is not supported.
+func NewServer(controls *renderer.Controls, switchFn SwitchFunc) *Server {
+	s := &Server{
+		controls: controls,
+		switchFn: switchFn,
+		mux:      http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /stats", s.handleStats)
+	s.mux.HandleFunc("GET /uniforms", s.handleUniforms)
+	s.mux.HandleFunc("POST /uniforms", s.handleSetUniforms)
+	s.mux.HandleFunc("DELETE /uniforms/{name}", s.handleResetUniform)
+	s.mux.HandleFunc("POST /pause", s.handlePause(true))
+	s.mux.HandleFunc("POST /resume", s.handlePause(false))
+	s.mux.HandleFunc("POST /seek", s.handleSeek)
+	s.mux.HandleFunc("POST /environment", s.handleEnvironment)
+	s.mux.HandleFunc("GET /snapshot", s.handleSnapshot)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Listen opens the address to serve the API on. An address starting with
+// "tcp:" is a TCP address, anything else is the path of a Unix socket. A
+// stale socket left behind by a previous instance is removed.
+func Listen(addr string) (net.Listener, error) {
+	if tcpAddr, ok := strings.CutPrefix(addr, "tcp:"); ok {
+		return net.Listen("tcp", tcpAddr)
+	}
+	if info, err := os.Stat(addr); err == nil && info.Mode().Type() == fs.ModeSocket {
+		if conn, err := net.Dial("unix", addr); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control socket %s is in use", addr)
+		}
+		os.Remove(addr)
+	}
+	return net.Listen("unix", addr)
+}
+
+// Serve serves the API on a listener until the context is canceled.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{Handler: s}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+type statsResponse struct {
+	Frames    uint64  `json:"frames"`
+	Time      float64 `json:"time"`
+	FPS       float64 `json:"fps"`
+	FrameTime float64 `json:"frame_time"`
+	Paused    bool    `json:"paused"`
+	Width     uint    `json:"width"`
+	Height    uint    `json:"height"`
+	Error     string  `json:"error,omitempty"`
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	stats := s.controls.Stats()
+	resp := statsResponse{
+		Frames:    stats.Frames,
+		Time:      stats.Time.Seconds(),
+		FPS:       stats.FPS,
+		FrameTime: stats.FrameTime.Seconds(),
+		Paused:    stats.Paused,
+		Width:     stats.Width,
+		Height:    stats.Height,
+	}
+	if stats.Error != nil {
+		resp.Error = stats.Error.Error()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type uniformResponse struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+func (s *Server) handleUniforms(w http.ResponseWriter, r *http.Request) {
+	uniforms := s.controls.Uniforms()
+	resp := make([]uniformResponse, 0, len(uniforms))
+	for _, u := range uniforms {
+		resp = append(resp, uniformResponse{Name: u.Name, Type: u.TypeLiteral()})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleSetUniforms(w http.ResponseWriter, r *http.Request) {
+	var req map[string]json.RawMessage
+	if !readJSON(w, r, &req) {
+		return
+	}
+	uniforms := map[string]renderer.Uniform{}
+	for _, u := range s.controls.Uniforms() {
+		uniforms[u.Name] = u
+	}
+	// Validate all values before setting any.
+	values := map[string][]float64{}
+	for name, raw := range req {
+		u, ok := uniforms[name]
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no such uniform: %q", name))
+			return
+		}
+		literal, err := parseValue(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid value for uniform %q: %w", name, err))
+			return
+		}
+		v, err := shadertoy.UniformValue{Name: name, Value: literal}.Resolve(u)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		values[name] = v
+	}
+	for name, v := range values {
+		if err := s.controls.SetUniform(name, v); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseValue converts a JSON number, array of numbers or string holding a
+// GLSL literal to a literal.
+func parseValue(raw json.RawMessage) (string, error) {
+	if string(raw) == "null" {
+		return "", fmt.Errorf("expected a number, an array of numbers or a GLSL literal, got null")
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return str, nil
+	}
+	var num float64
+	if err := json.Unmarshal(raw, &num); err == nil {
+		return fmt.Sprint(num), nil
+	}
+	var nums []float64
+	if err := json.Unmarshal(raw, &nums); err == nil && len(nums) > 0 {
+		strs := make([]string, len(nums))
+		for i, n := range nums {
+			strs[i] = fmt.Sprint(n)
+		}
+		return strings.Join(strs, ","), nil
+	}
+	return "", fmt.Errorf("expected a number, an array of numbers or a GLSL literal, got %s", raw)
+}
+
+func (s *Server) handleResetUniform(w http.ResponseWriter, r *http.Request) {
+	s.controls.ResetUniform(r.PathValue("name"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handlePause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.controls.Pause(paused)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) handleSeek(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Time *float64 `json:"time"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Time == nil || *req.Time < 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("expected a positive time in seconds"))
+		return
+	}
+	s.controls.Seek(time.Duration(*req.Time * float64(time.Second)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleEnvironment(w http.ResponseWriter, r *http.Request) {
+	if s.switchFn == nil {
+		writeError(w, http.StatusNotImplemented, fmt.Errorf("switching shaders is not supported"))
+		return
+	}
+	var req struct {
+		Files []string `json:"files"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if len(req.Files) == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("expected at least one file"))
+		return
+	}
+	if err := s.switchFn(req.Files); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), snapshotTimeout)
+	defer cancel()
+	img, err := s.controls.Snapshot(ctx)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("no frame was rendered: %w", err))
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	png.Encode(w, img)
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,191 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// startServer serves the API on a Unix socket and returns a client for it.
+func startServer(t *testing.T, switchFn SwitchFunc) (*http.Client, *renderer.Controls, string) {
+	t.Helper()
+	controls := &renderer.Controls{}
+	path := filepath.Join(t.TempDir(), "shady.sock")
+	ln, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := NewServer(controls, switchFn).Serve(ctx, ln); err != nil {
+			t.Error(err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		},
+	}
+	return client, controls, path
+}
+
+func request(t *testing.T, client *http.Client, method, path, body string) (int, map[string]any) {
+	t.Helper()
+	req, err := http.NewRequest(method, "http://shady"+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var v map[string]any
+	if resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+			t.Fatalf("%s %s: invalid response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode, v
+}
+
+func TestStats(t *testing.T) {
+	client, _, _ := startServer(t, nil)
+	status, v := request(t, client, "GET", "/stats", "")
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status: %d", status)
+	}
+	for _, key := range []string{"frames", "time", "fps", "frame_time", "paused", "width", "height"} {
+		if _, ok := v[key]; !ok {
+			t.Errorf("missing key %q in %v", key, v)
+		}
+	}
+}
+
+func TestClock(t *testing.T) {
+	client, _, _ := startServer(t, nil)
+	for _, tt := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{"POST", "/pause", "", http.StatusNoContent},
+		{"POST", "/resume", "", http.StatusNoContent},
+		{"POST", "/seek", `{"time": 12.5}`, http.StatusNoContent},
+		{"POST", "/seek", `{"time": -1}`, http.StatusBadRequest},
+		{"POST", "/seek", `{}`, http.StatusBadRequest},
+		{"POST", "/seek", `{"position": 1}`, http.StatusBadRequest},
+		{"GET", "/seek", ``, http.StatusMethodNotAllowed},
+	} {
+		req, _ := http.NewRequest(tt.method, "http://shady"+tt.path, strings.NewReader(tt.body))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s %s: expected status %d, got %d", tt.method, tt.path, tt.body, tt.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestSetUniforms(t *testing.T) {
+	client, _, _ := startServer(t, nil)
+	status, v := request(t, client, "POST", "/uniforms", `{"speed": 2}`)
+	if status != http.StatusNotFound || v["error"] == nil {
+		t.Fatalf("unexpected response for an unknown uniform: %d %v", status, v)
+	}
+	status, _ = request(t, client, "POST", "/uniforms", `[1, 2]`)
+	if status != http.StatusBadRequest {
+		t.Fatalf("unexpected status for an invalid body: %d", status)
+	}
+	status, _ = request(t, client, "DELETE", "/uniforms/speed", "")
+	if status != http.StatusNoContent {
+		t.Fatalf("unexpected status for resetting: %d", status)
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	for raw, exp := range map[string]string{
+		`2.5`:               "2.5",
+		`[1, 0.5, 0]`:       "1,0.5,0",
+		`"vec3(1, 0.5, 0)"`: "vec3(1, 0.5, 0)",
+		`"true"`:            "true",
+		`1e3`:               "1000",
+	} {
+		lit, err := parseValue(json.RawMessage(raw))
+		if err != nil || lit != exp {
+			t.Errorf("%s: expected %q, got %q, %v", raw, exp, lit, err)
+		}
+	}
+	for _, raw := range []string{`{}`, `[]`, `null`, `[true]`} {
+		if _, err := parseValue(json.RawMessage(raw)); err == nil {
+			t.Errorf("%s: expected an error", raw)
+		}
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	var switched []string
+	client, _, _ := startServer(t, func(files []string) error {
+		if files[0] == "missing.glsl" {
+			return fmt.Errorf("no such file")
+		}
+		switched = files
+		return nil
+	})
+	status, _ := request(t, client, "POST", "/environment", `{"files": ["a.glsl", "b.glsl"]}`)
+	if status != http.StatusNoContent || !reflect.DeepEqual(switched, []string{"a.glsl", "b.glsl"}) {
+		t.Fatalf("unexpected result: %d %v", status, switched)
+	}
+	status, v := request(t, client, "POST", "/environment", `{"files": ["missing.glsl"]}`)
+	if status != http.StatusUnprocessableEntity || v["error"] != "no such file" {
+		t.Fatalf("unexpected response: %d %v", status, v)
+	}
+	status, _ = request(t, client, "POST", "/environment", `{"files": []}`)
+	if status != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", status)
+	}
+
+	client, _, _ = startServer(t, nil)
+	status, _ = request(t, client, "POST", "/environment", `{"files": ["a.glsl"]}`)
+	if status != http.StatusNotImplemented {
+		t.Fatalf("unexpected status without a switch function: %d", status)
+	}
+}
+
+func TestListen(t *testing.T) {
+	_, _, path := startServer(t, nil)
+	if _, err := Listen(path); err == nil {
+		t.Fatalf("expected an error for a socket that is in use")
+	}
+
+	// A stale socket is replaced.
+	stale := filepath.Join(t.TempDir(), "stale.sock")
+	ln, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	ln, err = Listen(stale)
+	if err != nil {
+		t.Fatalf("stale socket was not replaced: %v", err)
+	}
+	ln.Close()
+}
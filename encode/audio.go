@@ -0,0 +1,62 @@
+package encode
+
+import (
+	"encoding/binary"
+	"io"
+	"path"
+)
+
+// EncodeSound writes 16-bit signed PCM samples to w. If the filename has a
+// .wav extension, a WAV file is written. Otherwise, the samples are written as
+// raw little endian PCM.
+//
+// Multiple channels are expected to be interleaved.
+func EncodeSound(w io.Writer, filename string, sampleRate, channels int, samples []int16) error {
+	if path.Ext(filename) == ".wav" {
+		return EncodeWAV(w, sampleRate, channels, samples)
+	}
+	return EncodePCM(w, samples)
+}
+
+// EncodePCM writes the samples as raw signed 16-bit little endian PCM.
+func EncodePCM(w io.Writer, samples []int16) error {
+	return binary.Write(w, binary.LittleEndian, samples)
+}
+
+// EncodeWAV writes the samples as a 16-bit PCM WAV file.
+func EncodeWAV(w io.Writer, sampleRate, channels int, samples []int16) error {
+	dataSize := uint32(len(samples) * 2)
+	header := struct {
+		RIFF          [4]byte
+		ChunkSize     uint32
+		WAVE          [4]byte
+		Fmt           [4]byte
+		FmtSize       uint32
+		AudioFormat   uint16
+		NumChannels   uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Data          [4]byte
+		DataSize      uint32
+	}{
+		RIFF:          [4]byte{'R', 'I', 'F', 'F'},
+		ChunkSize:     36 + dataSize,
+		WAVE:          [4]byte{'W', 'A', 'V', 'E'},
+		Fmt:           [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		AudioFormat:   1, // PCM
+		NumChannels:   uint16(channels),
+		SampleRate:    uint32(sampleRate),
+		ByteRate:      uint32(sampleRate * channels * 2),
+		BlockAlign:    uint16(channels * 2),
+		BitsPerSample: 16,
+		Data:          [4]byte{'d', 'a', 't', 'a'},
+		DataSize:      dataSize,
+	}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	return EncodePCM(w, samples)
+}
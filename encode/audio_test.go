@@ -0,0 +1,85 @@
+package encode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestEncodeWAV(t *testing.T) {
+	tests := []struct {
+		sampleRate, channels int
+		samples              []int16
+	}{
+		{sampleRate: 44100, channels: 2, samples: []int16{1, -1, 2, -2}},
+		{sampleRate: 48000, channels: 1, samples: []int16{0, 32767, -32768}},
+		{sampleRate: 22050, channels: 2, samples: nil},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := EncodeWAV(&buf, tt.sampleRate, tt.channels, tt.samples); err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+		dataSize := uint32(len(tt.samples) * 2)
+		if len(b) != 44+int(dataSize) {
+			t.Errorf("%d channels at %d Hz: unexpected size %d", tt.channels, tt.sampleRate, len(b))
+			continue
+		}
+		le := binary.LittleEndian
+		for _, f := range []struct {
+			name     string
+			got, exp uint32
+		}{
+			{"chunk size", le.Uint32(b[4:]), 36 + dataSize},
+			{"fmt size", le.Uint32(b[16:]), 16},
+			{"audio format", uint32(le.Uint16(b[20:])), 1},
+			{"channels", uint32(le.Uint16(b[22:])), uint32(tt.channels)},
+			{"sample rate", le.Uint32(b[24:]), uint32(tt.sampleRate)},
+			{"byte rate", le.Uint32(b[28:]), uint32(tt.sampleRate * tt.channels * 2)},
+			{"block align", uint32(le.Uint16(b[32:])), uint32(tt.channels * 2)},
+			{"bits per sample", uint32(le.Uint16(b[34:])), 16},
+			{"data size", le.Uint32(b[40:]), dataSize},
+		} {
+			if f.got != f.exp {
+				t.Errorf("%d channels at %d Hz: unexpected %s %d, expected %d", tt.channels, tt.sampleRate, f.name, f.got, f.exp)
+			}
+		}
+		if string(b[0:4]) != "RIFF" || string(b[8:12]) != "WAVE" || string(b[12:16]) != "fmt " || string(b[36:40]) != "data" {
+			t.Errorf("%d channels at %d Hz: unexpected chunk IDs in %q", tt.channels, tt.sampleRate, b[:44])
+		}
+		for i, s := range tt.samples {
+			if v := int16(le.Uint16(b[44+i*2:])); v != s {
+				t.Errorf("%d channels at %d Hz: unexpected sample %d: %d", tt.channels, tt.sampleRate, i, v)
+			}
+		}
+	}
+}
+
+func TestEncodeSound(t *testing.T) {
+	samples := []int16{1, -1}
+	tests := []struct {
+		filename string
+		wav      bool
+	}{
+		{"out.wav", true},
+		{"dir.d/out.wav", true},
+		{"out.pcm", false},
+		{"out.raw", false},
+		{"out.WAV", false},
+		{"wav", false},
+		{"-", false},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := EncodeSound(&buf, tt.filename, 44100, 2, samples); err != nil {
+			t.Fatal(err)
+		}
+		if wav := bytes.HasPrefix(buf.Bytes(), []byte("RIFF")); wav != tt.wav {
+			t.Errorf("%q: expected WAV to be %v", tt.filename, tt.wav)
+		}
+		if !tt.wav && !bytes.Equal(buf.Bytes(), []byte{1, 0, 0xff, 0xff}) {
+			t.Errorf("%q: unexpected PCM data %v", tt.filename, buf.Bytes())
+		}
+	}
+}
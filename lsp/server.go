@@ -0,0 +1,447 @@
+// Package lsp implements a language server for the shaders of Shady.
+//
+// The server speaks the Language Server Protocol over a stream such as stdio
+// and offers:
+//
+//   - Diagnostics from compiling the shader each time a file is opened or
+//     saved. Files that are included by an open shader are checked through
+//     that shader.
+//   - Go to definition of functions, macros, structs, globals and uniforms
+//     across files included with #include or #pragma use, and of the
+//     included files themselves.
+//   - Completion of the uniforms declared by the environment, like the
+//     builtins of Shadertoy and the uniforms of #pragma map resources.
+//   - Hover information for map and use directives and declared uniforms.
+//
+// Compiling requires an OpenGL context, which is left to the AnalyzeFunc.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+// An AnalyzeFunc compiles the shader of which the specified file is the main
+// source. The files of the shader are read from disk.
+type AnalyzeFunc func(filename string) (Analysis, error)
+
+// An Analysis is the result of compiling a shader.
+type Analysis struct {
+	Diagnostics []renderer.Diagnostic
+	// Files are the source files of the shader, including those included.
+	Files []string
+	// Uniforms are the uniforms declared by the environment.
+	Uniforms []Uniform
+}
+
+// A Uniform is a uniform that is declared by the environment.
+type Uniform struct {
+	Name string
+	// Type is the GLSL type, with the size appended for arrays.
+	Type string
+	// Origin is the name of the generated source that declares the uniform,
+	// e.g. "<map iChannel0=image:foo.png>".
+	Origin string
+}
+
+// DeclaredUniforms returns the uniforms that are declared by the generated
+// sources of an environment. Generated sources are those of which the source
+// map refers to a name enclosed in angle brackets.
+func DeclaredUniforms(sources []renderer.Source) ([]Uniform, error) {
+	var uniforms []Uniform
+	for _, s := range sources {
+		origin, _ := renderer.SourceMapOf(s).Lookup(1)
+		if !strings.HasPrefix(origin, "<") {
+			continue
+		}
+		src, err := s.Contents()
+		if err != nil {
+			return nil, err
+		}
+		uniforms = append(uniforms, uniformDecls(string(src), origin)...)
+	}
+	return uniforms, nil
+}
+
+// Server is a language server for a single client.
+type Server struct {
+	analyze AnalyzeFunc
+	// pp resolves the files that are included by a shader.
+	pp renderer.Preprocessor
+	// docs holds the contents of the documents opened by the client by
+	// their path.
+	docs map[string]string
+	// analyses holds the last analysis of each shader by its main file.
+	analyses map[string]*Analysis
+	// published holds the files for which diagnostics have been published
+	// by the shader they were published for.
+	published map[string][]string
+
+	out      io.Writer
+	shutdown bool
+}
+
+// NewServer creates a server that compiles shaders with analyze. Included
+// files are resolved like pp does.
+func NewServer(analyze AnalyzeFunc, pp renderer.Preprocessor) *Server {
+	return &Server{
+		analyze:   analyze,
+		pp:        pp,
+		docs:      map[string]string{},
+		analyses:  map[string]*Analysis{},
+		published: map[string][]string{},
+	}
+}
+
+// Serve handles the messages read from r until the client exits or r is
+// closed. Messages are handled one at a time on the calling goroutine, so
+// the AnalyzeFunc can use an OpenGL context that is current on its thread.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.out = w
+	br := bufio.NewReader(r)
+	for {
+		msg, err := readMessage(br)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit before shutdown")
+			}
+			return nil
+		}
+		result, rerr := s.handle(msg)
+		if msg.ID == nil {
+			// Notifications have no response.
+			continue
+		}
+		resp := &message{ID: msg.ID, Error: rerr}
+		if rerr == nil {
+			if resp.Result, err = json.Marshal(result); err != nil {
+				return err
+			}
+		}
+		if err := writeMessage(w, resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *message) (any, *responseError) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync": map[string]any{
+					"openClose": true,
+					"change":    1, // Full.
+					"save":      true,
+				},
+				"definitionProvider": true,
+				"hoverProvider":      true,
+				"completionProvider": map[string]any{},
+			},
+			"serverInfo": map[string]string{"name": "shady"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		return s.withPath(msg, &params, &params.TextDocument.URI, func(path string) (any, error) {
+			s.docs[path] = params.TextDocument.Text
+			return nil, s.check(path)
+		})
+	case "textDocument/didChange":
+		var params didChangeParams
+		return s.withPath(msg, &params, &params.TextDocument.URI, func(path string) (any, error) {
+			if n := len(params.ContentChanges); n > 0 {
+				s.docs[path] = params.ContentChanges[n-1].Text
+			}
+			return nil, nil
+		})
+	case "textDocument/didSave":
+		var params documentParams
+		return s.withPath(msg, &params, &params.TextDocument.URI, func(path string) (any, error) {
+			return nil, s.check(path)
+		})
+	case "textDocument/didClose":
+		var params documentParams
+		return s.withPath(msg, &params, &params.TextDocument.URI, func(path string) (any, error) {
+			delete(s.docs, path)
+			return nil, nil
+		})
+	case "textDocument/definition":
+		var params positionParams
+		return s.withPath(msg, &params, &params.TextDocument.URI, func(path string) (any, error) {
+			return s.definition(path, params.Position), nil
+		})
+	case "textDocument/completion":
+		var params positionParams
+		return s.withPath(msg, &params, &params.TextDocument.URI, func(path string) (any, error) {
+			return s.completion(path), nil
+		})
+	case "textDocument/hover":
+		var params positionParams
+		return s.withPath(msg, &params, &params.TextDocument.URI, func(path string) (any, error) {
+			return s.hover(path, params.Position), nil
+		})
+	}
+	if msg.ID == nil {
+		// Unknown notifications are ignored.
+		return nil, nil
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not found: %s", msg.Method)}
+}
+
+// withPath decodes the parameters of a message and calls fn with the path of
+// the document they refer to.
+func (s *Server) withPath(msg *message, params any, uri *string, fn func(path string) (any, error)) (any, *responseError) {
+	if err := json.Unmarshal(msg.Params, params); err != nil {
+		return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	path, err := uriToPath(*uri)
+	if err != nil {
+		return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	result, err := fn(path)
+	if err != nil {
+		s.logMessage(err.Error())
+	}
+	return result, nil
+}
+
+// readFile returns the contents of a file, preferring the contents of the
+// document if it is open.
+func (s *Server) readFile(path string) (string, error) {
+	if text, ok := s.docs[path]; ok {
+		return text, nil
+	}
+	b, err := os.ReadFile(path)
+	return string(b), err
+}
+
+// shadersOf returns the main files of the analyzed shaders that use the
+// specified file. If there are none, the file itself is assumed to be the main
+// file of a shader.
+func (s *Server) shadersOf(path string) []string {
+	var mains []string
+	for main, a := range s.analyses {
+		if main == path || slices.Contains(a.Files, path) {
+			mains = append(mains, main)
+		}
+	}
+	if len(mains) == 0 {
+		return []string{path}
+	}
+	sort.Strings(mains)
+	return mains
+}
+
+// check analyzes the shaders that use a file and publishes the diagnostics.
+func (s *Server) check(path string) error {
+	for _, main := range s.shadersOf(path) {
+		a, err := s.analyze(main)
+		if err != nil {
+			// Keep the previous analysis for completion and such, but replace
+			// its diagnostics, which may no longer apply.
+			diag := renderer.Diagnostic{Filename: main, Line: 1, Severity: renderer.SeverityError, Message: err.Error()}
+			if err := s.publish(main, []renderer.Diagnostic{diag}); err != nil {
+				return err
+			}
+			return fmt.Errorf("could not check %s: %w", main, err)
+		}
+		s.analyses[main] = &a
+		if err := s.publish(main, a.Diagnostics); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publish sends the diagnostics of a shader grouped by file. Diagnostics in
+// generated sources are attributed to the main file. Files that had
+// diagnostics before are cleared.
+func (s *Server) publish(main string, diags []renderer.Diagnostic) error {
+	byFile := map[string][]diagnostic{}
+	for _, file := range s.published[main] {
+		byFile[file] = []diagnostic{}
+	}
+	byFile[main] = []diagnostic{}
+	for _, d := range diags {
+		file, message := d.Filename, d.Message
+		line, col := max(d.Line-1, 0), max(d.Column-1, 0)
+		if strings.HasPrefix(file, "<") {
+			file, message, line, col = main, d.String(), 0, 0
+		}
+		severity := severityError
+		if d.Severity == renderer.SeverityWarning {
+			severity = severityWarning
+		}
+		end := col
+		if text, err := s.readFile(file); err == nil {
+			end = max(len(lineAt(text, line)), col)
+		}
+		byFile[file] = append(byFile[file], diagnostic{
+			Range: rangeLSP{
+				Start: position{Line: line, Character: col},
+				End:   position{Line: line, Character: end},
+			},
+			Severity: severity,
+			Source:   "shady",
+			Message:  message,
+		})
+	}
+
+	files := make([]string, 0, len(byFile))
+	for file := range byFile {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	s.published[main] = files
+	for _, file := range files {
+		err := s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+			URI:         pathToURI(file),
+			Diagnostics: byFile[file],
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) notify(method string, params any) error {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return writeMessage(s.out, &message{Method: method, Params: b})
+}
+
+// logMessage shows an error message in the client.
+func (s *Server) logMessage(text string) {
+	s.notify("window/logMessage", map[string]any{"type": 1, "message": text})
+}
+
+// files returns the source files of the shaders that use a file.
+func (s *Server) files(path string) []string {
+	files := []string{}
+	for _, main := range s.shadersOf(path) {
+		if a, ok := s.analyses[main]; ok {
+			files = append(files, a.Files...)
+		} else if pre, err := s.pp.Process(main); err == nil {
+			files = append(files, pre.Files...)
+		} else {
+			files = append(files, main)
+		}
+	}
+	slices.Sort(files)
+	return slices.Compact(files)
+}
+
+// uniforms returns the uniforms declared by the environment of the shaders
+// that use a file.
+func (s *Server) uniforms(path string) []Uniform {
+	var uniforms []Uniform
+	seen := map[string]bool{}
+	for _, main := range s.shadersOf(path) {
+		a, ok := s.analyses[main]
+		if !ok {
+			continue
+		}
+		for _, u := range a.Uniforms {
+			if !seen[u.Name] {
+				seen[u.Name] = true
+				uniforms = append(uniforms, u)
+			}
+		}
+	}
+	return uniforms
+}
+
+func (s *Server) definition(path string, pos position) []location {
+	text, err := s.readFile(path)
+	if err != nil {
+		return nil
+	}
+	if file, ok := s.includedFile(path, lineAt(text, pos.Line)); ok {
+		return []location{{URI: pathToURI(file)}}
+	}
+	return findDefinitions(wordAt(text, pos), s.files(path), s.readFile)
+}
+
+func (s *Server) completion(path string) []completionItem {
+	items := []completionItem{}
+	for _, u := range s.uniforms(path) {
+		items = append(items, completionItem{
+			Label:  u.Name,
+			Kind:   completionKindVariable,
+			Detail: fmt.Sprintf("%s %s", u.Type, u.Origin),
+		})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items
+}
+
+func (s *Server) hover(path string, pos position) *hover {
+	text, err := s.readFile(path)
+	if err != nil {
+		return nil
+	}
+	line := lineAt(text, pos.Line)
+	var buf strings.Builder
+	if m := mapDirectiveRe.FindStringSubmatch(line); m != nil {
+		mapping, err := shadertoy.ParseMapping(m[1], filepath.Dir(path))
+		if err != nil {
+			fmt.Fprintf(&buf, "Invalid mapping: %v", err)
+		} else {
+			fmt.Fprintf(&buf, "**%s** is mapped to a `%s` resource with value `%s`.\n", mapping.Name, mapping.Namespace, mapping.Value)
+			if resolved, err := shadertoy.ResolvePath(mapping.PWD, mapping.Value); err == nil {
+				if _, err := os.Stat(resolved); err == nil {
+					fmt.Fprintf(&buf, "\nFile: `%s`\n", resolved)
+				}
+			}
+			// The name of the source that declares the uniforms of the
+			// mapping in the ShaderToy environment.
+			origin := fmt.Sprintf("<map %s=%s:%s>", mapping.Name, mapping.Namespace, mapping.Value)
+			var decls []string
+			for _, u := range s.uniforms(path) {
+				if u.Origin == origin {
+					decls = append(decls, u.declaration())
+				}
+			}
+			if len(decls) > 0 {
+				fmt.Fprintf(&buf, "\n```glsl\n%s\n```\n", strings.Join(decls, "\n"))
+			}
+		}
+	} else if file, ok := s.includedFile(path, line); ok {
+		fmt.Fprintf(&buf, "Includes `%s`", file)
+	} else if word := wordAt(text, pos); word != "" {
+		for _, u := range s.uniforms(path) {
+			if u.Name == word {
+				fmt.Fprintf(&buf, "```glsl\n%s\n```\nDeclared by `%s`", u.declaration(), u.Origin)
+				break
+			}
+		}
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	return &hover{Contents: markupContent{Kind: "markdown", Value: buf.String()}}
+}
@@ -0,0 +1,249 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// session runs a server with the specified messages as its input and returns
+// the messages that were written by the server.
+func session(t *testing.T, analyze AnalyzeFunc, requests ...map[string]any) []*message {
+	t.Helper()
+	var in bytes.Buffer
+	for _, req := range requests {
+		b, err := json.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := &message{}
+		if err := json.Unmarshal(b, msg); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeMessage(&in, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var out bytes.Buffer
+	if err := NewServer(analyze, renderer.Preprocessor{}).Serve(&in, &out); err != nil {
+		t.Fatal(err)
+	}
+	var msgs []*message
+	r := bufio.NewReader(&out)
+	for {
+		msg, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+// response returns the result of the response to the request with the
+// specified ID.
+func response(t *testing.T, msgs []*message, id int, result any) {
+	t.Helper()
+	for _, msg := range msgs {
+		if msg.ID != nil && string(*msg.ID) == strings.TrimSpace(string(mustJSON(id))) {
+			if msg.Error != nil {
+				t.Fatalf("error response to %d: %v", id, msg.Error.Message)
+			}
+			if err := json.Unmarshal(msg.Result, result); err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+	}
+	t.Fatalf("no response to %d", id)
+}
+
+func mustJSON(v any) []byte {
+	b, _ := json.Marshal(v)
+	return b
+}
+
+func writeFile(t *testing.T, path, text string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.glsl")
+	lib := filepath.Join(dir, "lib.glsl")
+	writeFile(t, lib, "float wave(float x) {\n\treturn sin(x);\n}\n")
+	mainText := strings.Join([]string{
+		`#pragma use "lib.glsl"`,
+		`#pragma map iChannel0=image:tex.png`,
+		`void mainImage(out vec4 fragColor, in vec2 fragCoord) {`,
+		`	fragColor = vec4(wave(iTime) + oops);`,
+		`}`,
+	}, "\n")
+	writeFile(t, main, mainText)
+
+	analyze := func(filename string) (Analysis, error) {
+		if filename != main {
+			t.Errorf("unexpected file analyzed: %s", filename)
+		}
+		return Analysis{
+			Diagnostics: []renderer.Diagnostic{
+				{Filename: main, Line: 4, Column: 32, Severity: renderer.SeverityError, Message: "`oops' undeclared"},
+				{Filename: lib, Line: 2, Severity: renderer.SeverityWarning, Message: "meh"},
+			},
+			Files: []string{lib, main},
+			Uniforms: []Uniform{
+				{Name: "iTime", Type: "float", Origin: "<shadertoy preamble>"},
+				{Name: "iChannel0", Type: "sampler2D", Origin: "<map iChannel0=image:tex.png>"},
+			},
+		}, nil
+	}
+	mainURI, libURI := pathToURI(main), pathToURI(lib)
+	at := func(uri string, line, char int) map[string]any {
+		return map[string]any{
+			"textDocument": map[string]any{"uri": uri},
+			"position":     map[string]any{"line": line, "character": char},
+		}
+	}
+	msgs := session(t, analyze,
+		map[string]any{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": map[string]any{}},
+		map[string]any{"jsonrpc": "2.0", "method": "initialized", "params": map[string]any{}},
+		map[string]any{"jsonrpc": "2.0", "method": "textDocument/didOpen", "params": map[string]any{
+			"textDocument": map[string]any{"uri": mainURI, "languageId": "glsl", "version": 1, "text": mainText},
+		}},
+		map[string]any{"jsonrpc": "2.0", "id": 2, "method": "textDocument/definition", "params": at(mainURI, 3, 20)},
+		map[string]any{"jsonrpc": "2.0", "id": 3, "method": "textDocument/definition", "params": at(mainURI, 0, 5)},
+		map[string]any{"jsonrpc": "2.0", "id": 4, "method": "textDocument/completion", "params": at(mainURI, 3, 0)},
+		map[string]any{"jsonrpc": "2.0", "id": 5, "method": "textDocument/hover", "params": at(mainURI, 1, 3)},
+		map[string]any{"jsonrpc": "2.0", "id": 6, "method": "textDocument/hover", "params": at(mainURI, 3, 27)},
+		map[string]any{"jsonrpc": "2.0", "id": 7, "method": "textDocument/completion", "params": at(libURI, 0, 0)},
+		map[string]any{"jsonrpc": "2.0", "id": 8, "method": "shutdown"},
+		map[string]any{"jsonrpc": "2.0", "method": "exit"},
+	)
+
+	published := map[string][]diagnostic{}
+	for _, msg := range msgs {
+		if msg.Method == "textDocument/publishDiagnostics" {
+			var params publishDiagnosticsParams
+			if err := json.Unmarshal(msg.Params, &params); err != nil {
+				t.Fatal(err)
+			}
+			published[params.URI] = params.Diagnostics
+		}
+	}
+	if d := published[mainURI]; len(d) != 1 || d[0].Severity != severityError || d[0].Range.Start != (position{Line: 3, Character: 31}) {
+		t.Errorf("unexpected diagnostics of the main file: %+v", d)
+	}
+	if d := published[libURI]; len(d) != 1 || d[0].Severity != severityWarning || d[0].Range.Start.Line != 1 {
+		t.Errorf("unexpected diagnostics of the included file: %+v", d)
+	}
+
+	var locs []location
+	response(t, msgs, 2, &locs)
+	if len(locs) != 1 || locs[0].URI != libURI || locs[0].Range.Start != (position{Line: 0, Character: 6}) {
+		t.Errorf("unexpected definition of wave: %+v", locs)
+	}
+	response(t, msgs, 3, &locs)
+	if len(locs) != 1 || locs[0].URI != libURI {
+		t.Errorf("unexpected definition of an include: %+v", locs)
+	}
+
+	var items []completionItem
+	response(t, msgs, 4, &items)
+	if len(items) != 2 || items[0].Label != "iChannel0" || items[1].Label != "iTime" {
+		t.Errorf("unexpected completion items: %+v", items)
+	}
+	response(t, msgs, 7, &items)
+	if len(items) != 2 {
+		t.Errorf("unexpected completion items of the included file: %+v", items)
+	}
+
+	var h hover
+	response(t, msgs, 5, &h)
+	if !strings.Contains(h.Contents.Value, "`image`") || !strings.Contains(h.Contents.Value, "uniform sampler2D iChannel0;") {
+		t.Errorf("unexpected hover of a mapping:\n%s", h.Contents.Value)
+	}
+	response(t, msgs, 6, &h)
+	if !strings.Contains(h.Contents.Value, "uniform float iTime;") {
+		t.Errorf("unexpected hover of a uniform:\n%s", h.Contents.Value)
+	}
+}
+
+func TestServerAnalyzeError(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.glsl")
+	lib := filepath.Join(dir, "lib.glsl")
+	writeFile(t, main, "void mainImage(out vec4 fragColor, in vec2 fragCoord) {}\n")
+
+	calls := 0
+	analyze := func(filename string) (Analysis, error) {
+		if calls++; calls > 1 {
+			return Analysis{}, errors.New("broken")
+		}
+		return Analysis{
+			Diagnostics: []renderer.Diagnostic{{Filename: lib, Line: 1, Severity: renderer.SeverityWarning, Message: "meh"}},
+			Files:       []string{lib, main},
+		}, nil
+	}
+	mainURI, libURI := pathToURI(main), pathToURI(lib)
+	msgs := session(t, analyze,
+		map[string]any{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": map[string]any{}},
+		map[string]any{"jsonrpc": "2.0", "method": "textDocument/didOpen", "params": map[string]any{
+			"textDocument": map[string]any{"uri": mainURI, "languageId": "glsl", "version": 1, "text": ""},
+		}},
+		map[string]any{"jsonrpc": "2.0", "method": "textDocument/didSave", "params": map[string]any{
+			"textDocument": map[string]any{"uri": mainURI},
+		}},
+		map[string]any{"jsonrpc": "2.0", "id": 2, "method": "shutdown"},
+		map[string]any{"jsonrpc": "2.0", "method": "exit"},
+	)
+
+	published := map[string][]diagnostic{}
+	for _, msg := range msgs {
+		if msg.Method == "textDocument/publishDiagnostics" {
+			var params publishDiagnosticsParams
+			if err := json.Unmarshal(msg.Params, &params); err != nil {
+				t.Fatal(err)
+			}
+			published[params.URI] = params.Diagnostics
+		}
+	}
+	if d := published[mainURI]; len(d) != 1 || d[0].Severity != severityError || !strings.Contains(d[0].Message, "broken") {
+		t.Errorf("unexpected diagnostics of the main file: %+v", d)
+	}
+	if d, ok := published[libURI]; !ok || len(d) != 0 {
+		t.Errorf("stale diagnostics of the included file were not cleared: %+v", d)
+	}
+}
+
+func TestDeclaredUniforms(t *testing.T) {
+	uniforms, err := DeclaredUniforms([]renderer.Source{
+		renderer.MappedSource{
+			Source: renderer.SourceBuf("uniform vec3 iResolution;\nuniform float iChannelTime[4];"),
+			Map:    renderer.SourceMap{{Line: 1, Filename: "<preamble>", FileLine: 1}},
+		},
+		renderer.SourceBuf("uniform float notGenerated;"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []Uniform{
+		{Name: "iResolution", Type: "vec3", Origin: "<preamble>"},
+		{Name: "iChannelTime", Type: "float[4]", Origin: "<preamble>"},
+	}
+	if len(uniforms) != len(exp) || uniforms[0] != exp[0] || uniforms[1] != exp[1] {
+		t.Errorf("unexpected uniforms: %+v", uniforms)
+	}
+	if decl := uniforms[1].declaration(); decl != "uniform float iChannelTime[4];" {
+		t.Errorf("unexpected declaration: %q", decl)
+	}
+}
@@ -0,0 +1,142 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	mapDirectiveRe = regexp.MustCompile(`^\s*#pragma\s+map\s+(\S+)`)
+	useDirectiveRe = regexp.MustCompile(`^\s*#\s*(?:include|pragma\s+use)\s+(?:"([^"]+)"|<([^>]+)>)`)
+	uniformDeclRe  = regexp.MustCompile(`\buniform\s+(\w+)\s+(\w+)(\s*\[\s*\d+\s*\])?\s*;`)
+)
+
+// definitionPatterns return the patterns that match the line on which an
+// identifier is defined: functions, macros, structs, global variables and the
+// uniforms declared by directives.
+func definitionPatterns(name string) []*regexp.Regexp {
+	n := regexp.QuoteMeta(name)
+	return []*regexp.Regexp{
+		regexp.MustCompile(`^\s*(?:\w+\s+)*[\w\[\]]+\s+` + n + `\s*\([^;]*$`),
+		regexp.MustCompile(`^\s*#\s*define\s+` + n + `\b`),
+		regexp.MustCompile(`^\s*struct\s+` + n + `\b`),
+		regexp.MustCompile(`^\s*(?:const\s+|uniform\s+)?\w+\s+` + n + `\s*(?:=|;|\[)`),
+		regexp.MustCompile(`^\s*#pragma\s+uniform\s+\w+\s+` + n + `\b`),
+		regexp.MustCompile(`^\s*#pragma\s+map\s+` + n + `=`),
+	}
+}
+
+// isIdentChar reports whether a byte is part of a GLSL identifier.
+func isIdentChar(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// lineAt returns the line with the specified index, starting at 0.
+func lineAt(text string, line int) string {
+	lines := strings.Split(text, "\n")
+	if line < 0 || line >= len(lines) {
+		return ""
+	}
+	return strings.TrimRight(lines[line], "\r")
+}
+
+// wordAt returns the identifier at a position in the text.
+func wordAt(text string, pos position) string {
+	line := lineAt(text, pos.Line)
+	if pos.Character < 0 || pos.Character > len(line) {
+		return ""
+	}
+	start, end := pos.Character, pos.Character
+	for start > 0 && isIdentChar(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isIdentChar(line[end]) {
+		end++
+	}
+	return line[start:end]
+}
+
+// findDefinitions returns the locations at which an identifier is defined in
+// the specified files. The contents of the files are looked up with read.
+func findDefinitions(name string, files []string, read func(string) (string, error)) []location {
+	if name == "" {
+		return nil
+	}
+	patterns := definitionPatterns(name)
+	var locations []location
+	for _, file := range files {
+		text, err := read(file)
+		if err != nil {
+			continue
+		}
+		for i, line := range strings.Split(text, "\n") {
+			for _, re := range patterns {
+				if !re.MatchString(line) {
+					continue
+				}
+				col := identIndex(line, name)
+				locations = append(locations, location{
+					URI: pathToURI(file),
+					Range: rangeLSP{
+						Start: position{Line: i, Character: col},
+						End:   position{Line: i, Character: col + len(name)},
+					},
+				})
+				break
+			}
+		}
+	}
+	return locations
+}
+
+// identIndex returns the offset of the first occurrence of an identifier in a
+// line that is not part of a longer identifier.
+func identIndex(line, name string) int {
+	for offset := 0; offset < len(line); {
+		i := strings.Index(line[offset:], name)
+		if i < 0 {
+			break
+		}
+		i += offset
+		end := i + len(name)
+		if (i == 0 || !isIdentChar(line[i-1])) && (end == len(line) || !isIdentChar(line[end])) {
+			return i
+		}
+		offset = end
+	}
+	return 0
+}
+
+// includedFile returns the absolute path of the file that is included by an
+// include or use directive on a line of the specified file.
+func (s *Server) includedFile(file, line string) (string, bool) {
+	m := useDirectiveRe.FindStringSubmatch(line)
+	if m == nil {
+		return "", false
+	}
+	filename, err := s.pp.ResolveInclude(file, m[1]+m[2], m[2] != "")
+	return filename, err == nil
+}
+
+// uniformDecls returns the uniforms declared in a GLSL source.
+func uniformDecls(src, origin string) []Uniform {
+	var uniforms []Uniform
+	for _, m := range uniformDeclRe.FindAllStringSubmatch(src, -1) {
+		uniforms = append(uniforms, Uniform{
+			Name:   m[2],
+			Type:   m[1] + strings.ReplaceAll(m[3], " ", ""),
+			Origin: origin,
+		})
+	}
+	return uniforms
+}
+
+// declaration formats a uniform as GLSL.
+func (u Uniform) declaration() string {
+	typ, array, _ := strings.Cut(u.Type, "[")
+	if array != "" {
+		return fmt.Sprintf("uniform %s %s[%s;", typ, u.Name, array)
+	}
+	return fmt.Sprintf("uniform %s %s;", typ, u.Name)
+}
@@ -0,0 +1,215 @@
+// Package playlist reads playlists that list sets of shaders that are shown
+// in turn.
+//
+// A playlist has one entry per line. Entries are written like the command
+// line of shady and accept these flags:
+//
+//	-i <file>                  A shader file, may be repeated
+//	-map <mapping>             A mapping, may be repeated
+//	-u <name>=<value>          The value of a uniform, may be repeated
+//	-d <seconds>               The time the entry is shown
+//	-transition <file>         The transition to the entry
+//	-transition-duration <s>   The duration of the transition
+//
+// Values containing spaces can be quoted. Blank lines and lines starting
+// with # are ignored. Relative paths are resolved against the directory of
+// the playlist.
+//
+//	# Show a plasma for 30 seconds, then a tunnel for a minute.
+//	-i plasma.glsl -d 30
+//	-i tunnel.glsl -i common.glsl -map iChannel0=image:rock.png -u 'tint=vec3(1, 0.5, 0)' -d 60
+package playlist
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Entry is a set of shaders in a playlist.
+type Entry struct {
+	// Files are the shader source files.
+	Files []string
+	// Mappings and Uniforms hold the values of the -map and -u flags.
+	Mappings []string
+	Uniforms []string
+	// Duration is the time the entry is shown, including the transition to
+	// it.
+	Duration time.Duration
+	// Transition is the file with the transition function that blends from
+	// the previous entry to this one. If empty, the entries are crossfaded.
+	Transition         string
+	TransitionDuration time.Duration
+
+	// Line is the line number of the entry in the playlist.
+	Line int
+}
+
+// Playlist is a list of shader sets.
+type Playlist struct {
+	Entries []Entry
+	// Dir is the directory that relative paths in the playlist, like those
+	// of mappings, are resolved against.
+	Dir string
+}
+
+// Load reads the playlist in a file. The duration and transition of the
+// defaults are used for entries that do not set them.
+func Load(filename string, defaults Entry) (*Playlist, error) {
+	fd, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	pl, err := Parse(fd, filepath.Dir(filename), defaults)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return pl, nil
+}
+
+// Parse reads a playlist. Relative paths are resolved against dir. The
+// duration and transition of the defaults are used for entries that do not
+// set them.
+func Parse(r io.Reader, dir string, defaults Entry) (*Playlist, error) {
+	pl := &Playlist{Dir: dir}
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry, err := parseEntry(line, dir, defaults)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineno, err)
+		}
+		entry.Line = lineno
+		pl.Entries = append(pl.Entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(pl.Entries) == 0 {
+		return nil, fmt.Errorf("the playlist is empty")
+	}
+	return pl, nil
+}
+
+func parseEntry(line, dir string, defaults Entry) (Entry, error) {
+	args, err := splitArgs(line)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	var entry Entry
+	fs := flag.NewFlagSet("entry", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Var((*listFlag)(&entry.Files), "i", "")
+	fs.Var((*listFlag)(&entry.Mappings), "map", "")
+	fs.Var((*listFlag)(&entry.Uniforms), "u", "")
+	duration := fs.Float64("d", defaults.Duration.Seconds(), "")
+	fs.StringVar(&entry.Transition, "transition", defaults.Transition, "")
+	transitionDuration := fs.Float64("transition-duration", defaults.TransitionDuration.Seconds(), "")
+	if err := fs.Parse(args); err != nil {
+		return Entry{}, err
+	}
+	if fs.NArg() > 0 {
+		return Entry{}, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if len(entry.Files) == 0 {
+		return Entry{}, fmt.Errorf("no shader files, please specify at least one with -i")
+	}
+	if *duration <= 0 {
+		return Entry{}, fmt.Errorf("the duration must be positive, got %v", *duration)
+	}
+	if *transitionDuration < 0 || *transitionDuration > *duration {
+		return Entry{}, fmt.Errorf("the duration of the transition must be between 0 and %v, got %v", *duration, *transitionDuration)
+	}
+	entry.Duration = seconds(*duration)
+	entry.TransitionDuration = seconds(*transitionDuration)
+
+	for i, f := range entry.Files {
+		entry.Files[i] = resolve(dir, f)
+	}
+	fs.Visit(func(f *flag.Flag) {
+		// The default transition is not relative to the playlist.
+		if f.Name == "transition" && entry.Transition != "" {
+			entry.Transition = resolve(dir, entry.Transition)
+		}
+	})
+	return entry, nil
+}
+
+func resolve(dir, filename string) string {
+	if filepath.IsAbs(filename) {
+		return filename
+	}
+	return filepath.Join(dir, filename)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// splitArgs splits a line into arguments like a shell does. Arguments are
+// separated by whitespace, unless it is quoted or escaped with a backslash.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if escaped {
+		return nil, fmt.Errorf("unterminated escape")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// listFlag is a flag that may be repeated.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
@@ -0,0 +1,90 @@
+package playlist
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	src := `
+# The intro.
+-i intro.glsl -d 10
+
+-i /abs/tunnel.glsl -i common.glsl -map iChannel0=image:rock.png -u 'tint=vec3(1, 0.5, 0)' -d 1.5 -transition wipe.glsl -transition-duration 0.5
+`
+	defaults := Entry{
+		Duration:           time.Minute,
+		Transition:         "/default.glsl",
+		TransitionDuration: time.Second,
+	}
+	pl, err := Parse(strings.NewReader(src), "/show", defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []Entry{
+		{
+			Files:              []string{"/show/intro.glsl"},
+			Duration:           10 * time.Second,
+			Transition:         "/default.glsl",
+			TransitionDuration: time.Second,
+			Line:               3,
+		},
+		{
+			Files:              []string{"/abs/tunnel.glsl", "/show/common.glsl"},
+			Mappings:           []string{"iChannel0=image:rock.png"},
+			Uniforms:           []string{"tint=vec3(1, 0.5, 0)"},
+			Duration:           1500 * time.Millisecond,
+			Transition:         "/show/wipe.glsl",
+			TransitionDuration: 500 * time.Millisecond,
+			Line:               5,
+		},
+	}
+	if !reflect.DeepEqual(pl.Entries, exp) {
+		t.Fatalf("unexpected entries:\n%+v\n%+v", pl.Entries, exp)
+	}
+	if pl.Dir != "/show" {
+		t.Fatalf("unexpected dir: %q", pl.Dir)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	defaults := Entry{Duration: time.Minute, TransitionDuration: time.Second}
+	for _, src := range []string{
+		"",
+		"# only a comment",
+		"-d 10",
+		"-i a.glsl -d 0",
+		"-i a.glsl -d 10 -transition-duration 20",
+		"-i a.glsl -speed 2",
+		"-i a.glsl extra",
+		"-i 'a.glsl",
+	} {
+		if _, err := Parse(strings.NewReader(src), ".", defaults); err == nil {
+			t.Errorf("%q: expected an error", src)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	for line, exp := range map[string][]string{
+		`-i a.glsl`:            {"-i", "a.glsl"},
+		`  -i   a.glsl  `:      {"-i", "a.glsl"},
+		`-u 'c=vec3(1, 2, 3)'`: {"-u", "c=vec3(1, 2, 3)"},
+		`-i "my shader.glsl"`:  {"-i", "my shader.glsl"},
+		`-i my\ shader.glsl`:   {"-i", "my shader.glsl"},
+		`-i ''`:                {"-i", ""},
+		`-map a=b:"x y"z`:      {"-map", "a=b:x yz"},
+		`-u 'a=\n'`:            {"-u", `a=\n`},
+	} {
+		args, err := splitArgs(line)
+		if err != nil {
+			t.Errorf("%q: %v", line, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, exp) {
+			t.Errorf("%q: expected %q, got %q", line, exp, args)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package renderer
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+// Check compiles and links the program of an environment and those of its sub
+// environments without rendering anything.
+//
+// Compile and link errors are returned as diagnostics together with the
+// warnings of the compiler, as are errors in the directives of the sources
+// of sub environments. An error is only returned if the environment could not
+// be checked, e.g. because a file could not be read.
+func Check(env Environment, glVersion OpenGLVersion) ([]Diagnostic, error) {
+	if err := initHeadless(glVersion); err != nil {
+		return nil, err
+	}
+	return checkEnvironment(env, RenderState{CanvasWidth: 1, CanvasHeight: 1})
+}
+
+func checkEnvironment(env Environment, state RenderState) ([]Diagnostic, error) {
+	defer env.Close()
+	setup := env.Setup
+	if d, ok := env.(Declarer); ok {
+		setup = d.Declare
+	}
+	if err := setup(state); err != nil {
+		return nil, fmt.Errorf("error setting up environment: %w", err)
+	}
+
+	var diags []Diagnostic
+	subEnvs, err := env.SubEnvironments()
+	var perr PreprocessError
+	if errors.As(err, &perr) {
+		return []Diagnostic{perr.Diagnostic()}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, sub := range subEnvs {
+		subDiags, err := checkEnvironment(sub.Environment, RenderState{
+			CanvasWidth:  sub.Width,
+			CanvasHeight: sub.Height,
+		})
+		if err != nil {
+			return nil, err
+		}
+		diags = append(diags, subDiags...)
+	}
+
+	sources, err := env.Sources()
+	if err != nil {
+		return nil, err
+	}
+	program, programDiags, err := linkProgramLog(sources)
+	var cerr CompileError
+	var lerr LinkError
+	if errors.As(err, &cerr) {
+		compileDiags := cerr.Diagnostics()
+		if !slices.ContainsFunc(compileDiags, func(d Diagnostic) bool { return d.Severity == SeverityError }) {
+			// The format of the log is not known.
+			compileDiags = append(compileDiags, Diagnostic{
+				Filename: fmt.Sprintf("<%s>", cerr.stage),
+				Severity: SeverityError,
+				Message:  strings.TrimSpace(strings.TrimRight(cerr.log, "\x00")),
+			})
+		}
+		return append(diags, compileDiags...), nil
+	} else if errors.As(err, &lerr) {
+		return append(diags, lerr.Diagnostics()...), nil
+	} else if err != nil {
+		return nil, err
+	}
+	gl.DeleteProgram(program)
+	return append(diags, programDiags...), nil
+}
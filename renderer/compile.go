@@ -12,19 +12,29 @@ import (
 )
 
 func compileShader(stage Stage, sources ...Source) (uint32, error) {
+	shader, _, err := compileShaderLog(stage, sources...)
+	return shader, err
+}
+
+// compileShaderLog compiles a shader like compileShader and also returns the
+// messages that the compiler logged while compiling it successfully, like
+// warnings.
+func compileShaderLog(stage Stage, sources ...Source) (uint32, []Diagnostic, error) {
 	glStage, err := stage.glEnum()
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 
 	originalSources := make([]string, len(sources))
+	maps := make([]SourceMap, len(sources))
 	src := ""
 	for i, s := range sources {
 		c, err := s.Contents()
 		if err != nil {
-			return 0, err
+			return 0, nil, err
 		}
 		originalSources[i] = string(c)
+		maps[i] = SourceMapOf(s)
 		if i != 0 {
 			src += fmt.Sprintf("#line 1 %d\n", i)
 		}
@@ -38,24 +48,35 @@ func compileShader(stage Stage, sources ...Source) (uint32, error) {
 	free()
 	gl.CompileShader(shader)
 
+	var logLen int32
+	gl.GetShaderiv(shader, gl.INFO_LOG_LENGTH, &logLen)
+	log := strings.Repeat("\x00", int(logLen+1))
+	gl.GetShaderInfoLog(shader, logLen, nil, gl.Str(log))
+	cerr := CompileError{
+		sources: originalSources,
+		maps:    maps,
+		stage:   stage,
+		log:     log,
+	}
+
 	var status int32
 	gl.GetShaderiv(shader, gl.COMPILE_STATUS, &status)
 	if status == gl.FALSE {
-		var logLen int32
-		gl.GetShaderiv(shader, gl.INFO_LOG_LENGTH, &logLen)
-		log := strings.Repeat("\x00", int(logLen+1))
-		gl.GetShaderInfoLog(shader, logLen, nil, gl.Str(log))
 		gl.DeleteShader(shader)
-		return 0, CompileError{
-			sources: originalSources,
-			stage:   stage,
-			log:     log,
-		}
+		return 0, nil, cerr
 	}
-	return shader, nil
+	return shader, cerr.Diagnostics(), nil
 }
 
 func linkProgram(sources map[Stage][]Source) (uint32, error) {
+	program, _, err := linkProgramLog(sources)
+	return program, err
+}
+
+// linkProgramLog links a program like linkProgram and also returns the
+// messages that were logged while compiling its shaders successfully.
+func linkProgramLog(sources map[Stage][]Source) (uint32, []Diagnostic, error) {
+	var diags []Diagnostic
 	shaders := map[uint32]uint32{}
 	freeShaders := func() {
 		for _, sh := range shaders {
@@ -64,14 +85,15 @@ func linkProgram(sources map[Stage][]Source) (uint32, error) {
 	}
 
 	for stage, source := range sources {
-		sh, err := compileShader(stage, source...)
+		sh, shaderDiags, err := compileShaderLog(stage, source...)
 		if err != nil {
 			freeShaders()
-			return 0, err
+			return 0, nil, err
 		}
+		diags = append(diags, shaderDiags...)
 		glStage, err := stage.glEnum()
 		if err != nil {
-			return 0, err
+			return 0, nil, err
 		}
 		shaders[glStage] = sh
 	}
@@ -99,13 +121,15 @@ func linkProgram(sources map[Stage][]Source) (uint32, error) {
 	freeShaders()
 	if linkErr != nil {
 		gl.DeleteProgram(program)
-		return 0, linkErr
+		return 0, nil, linkErr
 	}
-	return program, nil
+	return program, diags, nil
 }
 
 type CompileError struct {
 	sources []string
+	// maps holds the source map of each source.
+	maps []SourceMap
 
 	stage Stage
 	log   string
@@ -129,37 +153,137 @@ func (err CompileError) PrettyPrint(out io.Writer) {
 	}
 
 	for _, marker := range markers {
+		diag := err.diagnostic(marker)
+		if marker.fileno < 0 || marker.fileno >= len(err.sources) {
+			fmt.Fprintf(out, "%s\n", diag)
+			continue
+		}
+		fmt.Fprintf(out, "%s:\n", diag.location())
 		lines := strings.Split(err.sources[marker.fileno], "\n")
 		for i := marker.lineno - 2; i < marker.lineno+2; i++ {
 			if 0 <= i && i < len(lines) {
-				fmt.Fprintf(out, "%04d: %s\n", i+1, lines[i])
+				_, fileLine := err.sourceMap(marker.fileno).Lookup(i + 1)
+				fmt.Fprintf(out, "%04d: %s\n", fileLine, lines[i])
 			}
 			if i+1 == marker.lineno {
-				fmt.Fprintf(out, "      ^ %s\n", marker.message)
+				fmt.Fprintf(out, "      ^ %s: %s\n", marker.severity, marker.message)
 			}
 		}
 	}
 }
 
-func (err CompileError) markers() []errorMarker {
-	errLineRe := regexp.MustCompile(`(?m)^(\d+):(\d+)\((\d+)\): (.+)$`)
+// Diagnostics returns the messages of the compiler with their locations
+// mapped to the files the sources originate from.
+func (err CompileError) Diagnostics() []Diagnostic {
+	markers := err.markers()
+	diags := make([]Diagnostic, len(markers))
+	for i, marker := range markers {
+		diags[i] = err.diagnostic(marker)
+	}
+	return diags
+}
+
+func (err CompileError) diagnostic(marker errorMarker) Diagnostic {
+	filename, line := err.sourceMap(marker.fileno).Lookup(marker.lineno)
+	if filename == "" {
+		filename = fmt.Sprintf("<source %d>", marker.fileno)
+	}
+	return Diagnostic{
+		Filename: filename,
+		Line:     line,
+		Column:   marker.column,
+		Severity: marker.severity,
+		Message:  marker.message,
+	}
+}
+
+func (err CompileError) sourceMap(fileno int) SourceMap {
+	if 0 <= fileno && fileno < len(err.maps) {
+		return err.maps[fileno]
+	}
+	return nil
+}
 
+// errorLogFormats match the lines of the info logs of the GLSL compilers of
+// various drivers. The submatches are named after the fields of an
+// errorMarker, the column and severity are optional.
+var errorLogFormats = []*regexp.Regexp{
+	// Mesa: 0:12(5): error: message
+	regexp.MustCompile(`^(?P<fileno>\d+):(?P<lineno>\d+)\((?P<column>\d+)\): (?P<severity>\w+(?: \w+)?): (?P<message>.+)$`),
+	// NVIDIA: 0(12) : error C0000: message
+	regexp.MustCompile(`^(?P<fileno>\d+)\((?P<lineno>\d+)\) : (?P<severity>\w+)(?: \w+)?: (?P<message>.+)$`),
+	// AMD and others: ERROR: 0:12: message
+	regexp.MustCompile(`^(?P<severity>[A-Z]+): (?P<fileno>\d+):(?P<lineno>\d+): (?P<message>.+)$`),
+}
+
+func (err CompileError) markers() []errorMarker {
 	var markers []errorMarker
-	matches := errLineRe.FindAllStringSubmatch(err.log, -1)
-	for _, m := range matches {
-		fileno, _ := strconv.Atoi(m[1])
-		lineno, _ := strconv.Atoi(m[2])
-		message := m[4]
-
-		markers = append(markers, errorMarker{
-			fileno:  fileno,
-			lineno:  lineno,
-			message: message,
-		})
+	for _, line := range strings.Split(err.log, "\n") {
+		line = strings.TrimRight(line, "\r\x00")
+		for _, re := range errorLogFormats {
+			m := re.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			marker := errorMarker{severity: SeverityError}
+			for i, name := range re.SubexpNames() {
+				switch name {
+				case "fileno":
+					marker.fileno, _ = strconv.Atoi(m[i])
+				case "lineno":
+					marker.lineno, _ = strconv.Atoi(m[i])
+				case "column":
+					marker.column, _ = strconv.Atoi(m[i])
+				case "severity":
+					marker.severity = parseSeverity(m[i])
+				case "message":
+					marker.message = m[i]
+				}
+			}
+			markers = append(markers, marker)
+			break
+		}
 	}
 	return markers
 }
 
+// Severity is the importance of a Diagnostic.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+func parseSeverity(s string) Severity {
+	if strings.Contains(strings.ToLower(s), "warning") {
+		return SeverityWarning
+	}
+	return SeverityError
+}
+
+// A Diagnostic is a message of the compiler about a location in a source
+// file. Line and Column start at 1, a Column of 0 means that the column is
+// not known.
+type Diagnostic struct {
+	Filename string   `json:"file"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+func (d Diagnostic) location() string {
+	if d.Column > 0 {
+		return fmt.Sprintf("%s:%d:%d", d.Filename, d.Line, d.Column)
+	}
+	return fmt.Sprintf("%s:%d", d.Filename, d.Line)
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.location(), d.Severity, d.Message)
+}
+
 type LinkError struct {
 	log string
 }
@@ -168,8 +292,20 @@ func (err LinkError) Error() (str string) {
 	return err.log
 }
 
+// Diagnostics returns the log of the linker as a single diagnostic, as linker
+// errors are not specific to a source file.
+func (err LinkError) Diagnostics() []Diagnostic {
+	return []Diagnostic{{
+		Filename: "<link>",
+		Severity: SeverityError,
+		Message:  strings.TrimSpace(strings.TrimRight(err.log, "\x00")),
+	}}
+}
+
 type errorMarker struct {
-	lineno  int
-	fileno  int
-	message string
+	lineno   int
+	fileno   int
+	column   int
+	severity Severity
+	message  string
 }
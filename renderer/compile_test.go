@@ -1,6 +1,7 @@
 package renderer
 
 import (
+	"slices"
 	"testing"
 )
 
@@ -58,3 +59,67 @@ void main() {
 		t.Fatalf("Unexpected lineno")
 	}
 }
+
+func TestDiagnosticsLogFormats(t *testing.T) {
+	tests := []struct {
+		name string
+		log  string
+		exp  Diagnostic
+	}{
+		{
+			"mesa",
+			"1:3(12): error: `foo' undeclared\n",
+			Diagnostic{Filename: "a.glsl", Line: 3, Column: 12, Severity: SeverityError, Message: "`foo' undeclared"},
+		},
+		{
+			"mesa preprocessor",
+			"1:2(1): preprocessor error: meh\n",
+			Diagnostic{Filename: "a.glsl", Line: 2, Column: 1, Severity: SeverityError, Message: "meh"},
+		},
+		{
+			"nvidia",
+			"1(4) : warning C7022: unrecognized profile specifier\n",
+			Diagnostic{Filename: "a.glsl", Line: 4, Severity: SeverityWarning, Message: "unrecognized profile specifier"},
+		},
+		{
+			"amd",
+			"ERROR: 1:5: 'foo' : undeclared identifier \n",
+			Diagnostic{Filename: "a.glsl", Line: 5, Severity: SeverityError, Message: "'foo' : undeclared identifier "},
+		},
+	}
+	for _, tt := range tests {
+		err := CompileError{
+			sources: []string{"", "a\nb\nc\nd\ne\n"},
+			maps:    []SourceMap{nil, SourceMapOf(SourceFile{Filename: "a.glsl"})},
+			log:     tt.log,
+		}
+		diags := err.Diagnostics()
+		if len(diags) != 1 {
+			t.Errorf("%s: expected 1 diagnostic, got %d", tt.name, len(diags))
+			continue
+		}
+		if diags[0] != tt.exp {
+			t.Errorf("%s: unexpected diagnostic: %+v", tt.name, diags[0])
+		}
+	}
+}
+
+func TestDiagnosticsSourceMap(t *testing.T) {
+	err := CompileError{
+		sources: []string{"", "", ""},
+		maps: []SourceMap{
+			nil,
+			{{Line: 1, Filename: "<generated>", FileLine: 1}},
+			{{Line: 1, Filename: "main.glsl", FileLine: 1}, {Line: 4, Filename: "lib.glsl", FileLine: 10}},
+		},
+		log: "0:2(1): error: a\n1:2(1): error: b\n2:3(1): error: c\n2:5(1): error: d\n",
+	}
+	var locations []string
+	for _, d := range err.Diagnostics() {
+		locations = append(locations, d.location())
+	}
+	exp := []string{"<source 0>:2:1", "<generated>:2:1", "main.glsl:3:1", "lib.glsl:11:1"}
+	if !slices.Equal(locations, exp) {
+		t.Errorf("unexpected locations: %q", locations)
+	}
+}
@@ -0,0 +1,240 @@
+package renderer
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+// Stats describes the progress of an engine.
+type Stats struct {
+	// Frames is the number of frames rendered since the engine was started.
+	Frames uint64
+	// Time is the animation time.
+	Time time.Duration
+	// FPS is the number of frames rendered during the last second.
+	FPS float64
+	// FrameTime is the average time taken to render a frame during the last
+	// second.
+	FrameTime time.Duration
+	Paused    bool
+	Width     uint
+	Height    uint
+	// Error is the error of the most recent attempt to load an environment,
+	// if it failed.
+	Error error
+}
+
+// Controls allow an engine to be controlled from other goroutines while it is
+// animating. The methods are safe for concurrent use.
+type Controls struct {
+	mu     sync.Mutex
+	paused bool
+	seek   *time.Duration
+	// uniforms holds the values of uniforms that are set after the
+	// environment has set its values.
+	uniforms map[string][]float64
+	// available are the uniforms of the current program.
+	available map[string]Uniform
+	snapshots []chan<- image.Image
+	stats     Stats
+	err       error
+
+	// frameTimes holds the times at which the frames of the last second
+	// were completed.
+	frameTimes []time.Time
+}
+
+// Pause stops or resumes the animation clock. Frames are still rendered while
+// paused, but the time stays the same.
+//
+// Environments that keep their own time, like those playing back audio,
+// are not paused.
+func (c *Controls) Pause(paused bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = paused
+}
+
+// Seek sets the animation time of the next frame.
+func (c *Controls) Seek(t time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seek = &t
+}
+
+// SetUniform overrides the value of a uniform of the current program. The
+// values are validated against the type of the uniform. The override is
+// retained when the environment is changed, as long as the new program has a
+// uniform of the same name and size.
+func (c *Controls) SetUniform(name string, values []float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.available[name]
+	if !ok {
+		return fmt.Errorf("no such uniform: %q", name)
+	}
+	if n := u.Components(); n == 0 || len(values) != n {
+		return fmt.Errorf("uniform %q is a %s and can not be set to %d values", name, u.TypeLiteral(), len(values))
+	}
+	if c.uniforms == nil {
+		c.uniforms = map[string][]float64{}
+	}
+	c.uniforms[name] = append([]float64(nil), values...)
+	return nil
+}
+
+// ResetUniform removes the override of a uniform, handing control of its value
+// back to the environment.
+func (c *Controls) ResetUniform(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.uniforms, name)
+}
+
+// Uniforms returns the uniforms of the current program, sorted by name.
+func (c *Controls) Uniforms() []Uniform {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	uniforms := make([]Uniform, 0, len(c.available))
+	for _, u := range c.available {
+		uniforms = append(uniforms, u)
+	}
+	sort.Slice(uniforms, func(i, j int) bool {
+		return uniforms[i].Name < uniforms[j].Name
+	})
+	return uniforms
+}
+
+// Stats returns the statistics of the most recently rendered frame.
+func (c *Controls) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Snapshot returns the next frame that is rendered.
+func (c *Controls) Snapshot(ctx context.Context) (image.Image, error) {
+	ch := make(chan image.Image, 1)
+	c.mu.Lock()
+	c.snapshots = append(c.snapshots, ch)
+	c.mu.Unlock()
+	select {
+	case img := <-ch:
+		return img, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// setProgram is called by the engine after an environment has been loaded.
+func (c *Controls) setProgram(uniforms map[string]Uniform) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.available = uniforms
+}
+
+// setError is called by the engine with the result of loading an
+// environment.
+func (c *Controls) setError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+	c.stats.Error = err
+}
+
+// advance is called by the engine to determine the time of the next frame
+// given the current time and the time elapsed.
+func (c *Controls) advance(t, interval time.Duration) (time.Duration, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seek != nil {
+		t, c.seek = *c.seek, nil
+		return t, 0
+	}
+	if c.paused {
+		return t, 0
+	}
+	return t + interval, interval
+}
+
+// apply sets the overridden uniforms in the program that is currently in use.
+func (c *Controls) apply(uniforms map[string]Uniform) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, values := range c.uniforms {
+		if u, ok := uniforms[name]; ok && u.Components() == len(values) {
+			u.Set(values...)
+		}
+	}
+}
+
+// wantSnapshot reports whether the framebuffer should be read after the next
+// frame is drawn.
+func (c *Controls) wantSnapshot() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.snapshots) > 0
+}
+
+// frameDone is called by the engine after a frame has been drawn. If a
+// snapshot was requested, img is the rendered frame.
+func (c *Controls) frameDone(frames uint64, t time.Duration, width, height uint, img image.Image) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i := 0
+	for i < len(c.frameTimes) && now.Sub(c.frameTimes[i]) > time.Second {
+		i++
+	}
+	c.frameTimes = append(c.frameTimes[i:], now)
+	c.stats = Stats{
+		Frames: frames,
+		Time:   t,
+		FPS:    float64(len(c.frameTimes)),
+		Paused: c.paused,
+		Width:  width,
+		Height: height,
+		Error:  c.err,
+	}
+	if n := len(c.frameTimes); n > 1 {
+		c.stats.FrameTime = c.frameTimes[n-1].Sub(c.frameTimes[0]) / time.Duration(n-1)
+	}
+
+	if img != nil {
+		for _, ch := range c.snapshots {
+			ch <- img
+		}
+		c.snapshots = c.snapshots[:0]
+	}
+}
+
+// readFramebuffer reads the pixels of the currently bound framebuffer.
+func readFramebuffer(width, height uint) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
+	gl.BindBuffer(gl.PIXEL_PACK_BUFFER, 0)
+	gl.PixelStorei(gl.PACK_ALIGNMENT, 1)
+	gl.ReadPixels(0, 0, int32(width), int32(height), gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(&img.Pix[0]))
+	gl.PixelStorei(gl.PACK_ALIGNMENT, 4)
+	return img
+}
+
+// flipVertical mirrors an image upside down.
+func flipVertical(img *image.RGBA) *image.RGBA {
+	h := img.Rect.Dy()
+	row := make([]byte, img.Stride)
+	for y := 0; y < h/2; y++ {
+		top := img.Pix[y*img.Stride : (y+1)*img.Stride]
+		bottom := img.Pix[(h-1-y)*img.Stride : (h-y)*img.Stride]
+		copy(row, top)
+		copy(top, bottom)
+		copy(bottom, row)
+	}
+	return img
+}
@@ -0,0 +1,106 @@
+package renderer
+
+import (
+	"context"
+	"image"
+	"testing"
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+func TestControlsClock(t *testing.T) {
+	var c Controls
+	now, iv := c.advance(time.Second, time.Second/10)
+	if now != time.Second+time.Second/10 || iv != time.Second/10 {
+		t.Fatalf("unexpected time: %v, %v", now, iv)
+	}
+
+	c.Pause(true)
+	if now, iv = c.advance(now, time.Second/10); now != time.Second+time.Second/10 || iv != 0 {
+		t.Fatalf("time advanced while paused: %v, %v", now, iv)
+	}
+
+	c.Seek(5 * time.Second)
+	if now, _ = c.advance(now, time.Second/10); now != 5*time.Second {
+		t.Fatalf("unexpected time after seeking: %v", now)
+	}
+	c.Pause(false)
+	if now, _ = c.advance(now, time.Second/10); now != 5*time.Second+time.Second/10 {
+		t.Fatalf("unexpected time after resuming: %v", now)
+	}
+}
+
+func TestControlsSetUniform(t *testing.T) {
+	var c Controls
+	if err := c.SetUniform("speed", []float64{1}); err == nil {
+		t.Fatalf("expected an error for an unknown uniform")
+	}
+	c.setProgram(map[string]Uniform{
+		"speed": {Name: "speed", Type: gl.FLOAT},
+		"tex":   {Name: "tex", Type: gl.SAMPLER_2D},
+	})
+	if err := c.SetUniform("speed", []float64{1, 2}); err == nil {
+		t.Fatalf("expected an error for the wrong number of values")
+	}
+	if err := c.SetUniform("tex", []float64{1}); err == nil {
+		t.Fatalf("expected an error for a sampler")
+	}
+	if err := c.SetUniform("speed", []float64{2}); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.uniforms) != 1 {
+		t.Fatalf("unexpected overrides: %v", c.uniforms)
+	}
+	c.ResetUniform("speed")
+	if len(c.uniforms) != 0 {
+		t.Fatalf("unexpected overrides after reset: %v", c.uniforms)
+	}
+	if us := c.Uniforms(); len(us) != 2 || us[0].Name != "speed" {
+		t.Fatalf("unexpected uniforms: %v", us)
+	}
+}
+
+func TestControlsSnapshot(t *testing.T) {
+	var c Controls
+	done := make(chan image.Image)
+	go func() {
+		img, err := c.Snapshot(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		done <- img
+	}()
+
+	for !c.wantSnapshot() {
+		time.Sleep(time.Millisecond)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	c.frameDone(1, 0, 2, 2, img)
+	if got := <-done; got != img {
+		t.Fatalf("unexpected snapshot")
+	}
+	if c.wantSnapshot() {
+		t.Fatalf("snapshot is still pending")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Snapshot(ctx); err == nil {
+		t.Fatalf("expected an error for a canceled context")
+	}
+}
+
+func TestControlsStats(t *testing.T) {
+	var c Controls
+	for i := range 10 {
+		c.frameDone(uint64(i+1), time.Duration(i)*time.Second, 4, 3, nil)
+	}
+	stats := c.Stats()
+	if stats.Frames != 10 || stats.Time != 9*time.Second || stats.Width != 4 || stats.Height != 3 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if stats.FPS != 10 {
+		t.Fatalf("unexpected FPS: %v", stats.FPS)
+	}
+}
@@ -2,8 +2,7 @@ package renderer
 
 import (
 	"fmt"
-	"io/ioutil"
-	"os"
+	"io/fs"
 	"path/filepath"
 	"time"
 
@@ -52,9 +51,14 @@ func (s SourceBuf) Dir() string {
 	return "."
 }
 
-// SourceFile is an implementation of the Source interface for real files.
+// SourceFile is an implementation of the Source interface for files, which are
+// read from the filesystem in the FS field or, if it is nil, from that of the
+// OS.
 type SourceFile struct {
 	Filename string
+	// FS is the filesystem from which the file is read, nil for that of the
+	// OS.
+	FS fs.FS
 }
 
 func SourceFiles(filenames ...string) []SourceFile {
@@ -67,12 +71,7 @@ func SourceFiles(filenames ...string) []SourceFile {
 
 // Contents implemetns the Source interface.
 func (s SourceFile) Contents() ([]byte, error) {
-	fd, err := os.Open(s.Filename)
-	if err != nil {
-		return nil, err
-	}
-	defer fd.Close()
-	return ioutil.ReadAll(fd)
+	return ReadFile(s.FS, s.Filename)
 }
 
 // Dir implemetns the Source interface.
@@ -80,6 +79,59 @@ func (s SourceFile) Dir() string {
 	return filepath.Dir(s.Filename)
 }
 
+// A SourceMap relates the lines of a source to the files they originate from.
+// The spans are ordered by the line they start at.
+type SourceMap []SourceSpan
+
+// A SourceSpan maps the lines of a source starting at Line to the lines of a
+// file starting at FileLine. Line numbers start at 1.
+type SourceSpan struct {
+	Line     int
+	Filename string
+	FileLine int
+}
+
+// Lookup returns the file and line in that file of a line of the source. An
+// empty filename is returned if the origin of the line is unknown.
+func (m SourceMap) Lookup(line int) (filename string, fileLine int) {
+	for i := len(m) - 1; i >= 0; i-- {
+		if m[i].Line <= line {
+			return m[i].Filename, m[i].FileLine + line - m[i].Line
+		}
+	}
+	return "", line
+}
+
+// A SourceMapper is a source that knows where its contents originate from.
+type SourceMapper interface {
+	SourceMap() SourceMap
+}
+
+// SourceMapOf returns the source map of a source. Sources that do not
+// implement SourceMapper are mapped to their own filename if they are files,
+// otherwise their origin is unknown.
+func SourceMapOf(s Source) SourceMap {
+	switch s := s.(type) {
+	case SourceMapper:
+		return s.SourceMap()
+	case SourceFile:
+		return SourceMap{{Line: 1, Filename: s.Filename, FileLine: 1}}
+	}
+	return nil
+}
+
+// MappedSource attaches a source map to a source, e.g. to attribute generated
+// code to the file that caused it to be generated.
+type MappedSource struct {
+	Source
+	Map SourceMap
+}
+
+// SourceMap implements the SourceMapper interface.
+func (s MappedSource) SourceMap() SourceMap {
+	return s.Map
+}
+
 type Environment interface {
 	// Sources should return the shader sources mapped by their pipeline stage.
 	// Multiple shader sources are combined per stage.
@@ -107,6 +159,51 @@ type Environment interface {
 	Close() error
 }
 
+// A Clock provides the animation time. Environments implementing Clock take
+// over the timekeeping of the OnScreenEngine, e.g. to stay in sync with audio
+// that is being played back.
+type Clock interface {
+	// Time returns the current animation time. If ok is false, the clock is
+	// not running and the engine keeps time by itself.
+	Time() (t time.Duration, ok bool)
+}
+
+// A Reuser is an environment that can take over resources of the environment
+// it replaces, e.g. to keep a video playing when only the shader source has
+// changed.
+type Reuser interface {
+	// Reuse is called before Setup with the environment that is currently
+	// rendered. The previous environment keeps rendering until the new one is
+	// set up successfully, so taken over resources must remain usable by both
+	// environments until either one is closed.
+	Reuse(prev Environment)
+}
+
+// A Declarer is an environment that can declare the uniforms of its resources
+// without setting them up. Check calls Declare instead of Setup, so checking a
+// shader does not open the files and devices it uses.
+type Declarer interface {
+	// Declare prepares the environment for compiling, but not rendering. It
+	// is called instead of Setup.
+	Declare(state RenderState) error
+}
+
+// A UniformHinter describes how the uniforms of an environment are used.
+// Uniforms of environments that do not implement UniformHinter are assumed to
+// be free for the user to tweak.
+type UniformHinter interface {
+	UniformHint(name string) UniformHint
+}
+
+// UniformHint describes a single uniform.
+type UniformHint struct {
+	// Driven is true if the environment sets the value of the uniform, e.g.
+	// because it is the time or a texture.
+	Driven bool
+	// Min and Max are the range of the value, if Max is larger than Min.
+	Min, Max float64
+}
+
 type SubEnvironment struct {
 	Environment
 	Width, Height uint
@@ -126,4 +223,14 @@ type RenderState struct {
 	// SubBuffers contains the render output for each environment returned by
 	// SubEnvironments as a textureID.
 	SubBuffers map[string]uint32
+
+	// FS is the filesystem from which resources read their files, nil for
+	// that of the OS. It is set by the environment, not by the engine.
+	FS fs.FS
+
+	// Gamepads holds the state of the game controllers by joystick number, a
+	// nil entry means that no controller is connected. Gamepads is nil if
+	// the engine has no access to game controllers, like the offscreen
+	// Shader.
+	Gamepads []*GamepadState
 }
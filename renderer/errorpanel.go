@@ -0,0 +1,76 @@
+package renderer
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/polyfloyd/shady/renderer/ui"
+)
+
+var (
+	colorErrorMarker = ui.Color{1, 0.4, 0.35, 1}
+	colorErrorPanel  = ui.Color{0.15, 0.02, 0.02, 0.85}
+)
+
+// sourceLineRe matches the lines of source code that are printed by
+// CompileError.PrettyPrint.
+var sourceLineRe = regexp.MustCompile(`^\d{4}: `)
+
+// errorPanel is an overlay of the OnScreenEngine that shows why the last
+// environment could not be loaded on top of the frames that are still being
+// rendered.
+type errorPanel struct {
+	// err is the error that is shown, nil hides the panel.
+	err  error
+	list ui.List
+}
+
+// An errorLine is a line of an error message and the color it is drawn in.
+type errorLine struct {
+	text  string
+	color ui.Color
+}
+
+// errorLines splits the message of an error into lines. Source code is
+// dimmed so the messages and markers stand out.
+func errorLines(err error) []errorLine {
+	text := strings.TrimRight(err.Error(), "\n")
+	// The font has no tab glyph.
+	text = strings.ReplaceAll(text, "\t", "    ")
+	var lines []errorLine
+	for _, line := range strings.Split(text, "\n") {
+		color := ui.ColorText
+		if sourceLineRe.MatchString(line) {
+			color = ui.ColorTextDimmed
+		} else if strings.HasPrefix(strings.TrimSpace(line), "^") {
+			color = colorErrorMarker
+		}
+		lines = append(lines, errorLine{text: line, color: color})
+	}
+	return lines
+}
+
+// draw lays out the panel at the top of the screen. Lines that do not fit are
+// left out.
+func (ep *errorPanel) draw(scale, width, height int) {
+	ep.list.Reset()
+	if ep.err == nil {
+		return
+	}
+	s := float64(scale)
+	pad := 4 * s
+	rowHeight := 10 * s
+	lines := errorLines(ep.err)
+	maxLines := max(int((float64(height)-2*pad)/rowHeight), 1)
+	if len(lines) > maxLines {
+		lines = append(lines[:maxLines-1], errorLine{text: "...", color: ui.ColorTextDimmed})
+	}
+
+	panel := ui.Rect{W: float64(width), H: float64(len(lines))*rowHeight + 2*pad}
+	ep.list.Rect(panel, colorErrorPanel)
+	y := pad
+	for _, line := range lines {
+		ep.list.Text(pad, y+(rowHeight-ui.GlyphHeight*s)/2, scale, line.text, line.color)
+		y += rowHeight
+	}
+}
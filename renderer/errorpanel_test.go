@@ -0,0 +1,52 @@
+package renderer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/polyfloyd/shady/renderer/ui"
+)
+
+func TestErrorLines(t *testing.T) {
+	err := CompileError{
+		sources: []string{"", "void main() {\n\tfoo();\n}"},
+		maps:    []SourceMap{nil, SourceMapOf(SourceFile{Filename: "shader.glsl"})},
+		stage:   StageFragment,
+		log:     "1:2(2): error: no function with name 'foo'\n",
+	}
+	lines := errorLines(err)
+	exp := []errorLine{
+		{"Error compiling fragment shader:", ui.ColorText},
+		{"shader.glsl:2:2:", ui.ColorText},
+		{"0001: void main() {", ui.ColorTextDimmed},
+		{"0002:     foo();", ui.ColorTextDimmed},
+		{"      ^ error: no function with name 'foo'", colorErrorMarker},
+		{"0003: }", ui.ColorTextDimmed},
+	}
+	if len(lines) != len(exp) {
+		t.Fatalf("expected %d lines, got %d: %+v", len(exp), len(lines), lines)
+	}
+	for i, line := range lines {
+		if line != exp[i] {
+			t.Errorf("line %d: expected %+v, got %+v", i, exp[i], line)
+		}
+	}
+}
+
+func TestErrorPanelDraw(t *testing.T) {
+	var ep errorPanel
+	ep.draw(1, 640, 480)
+	if len(ep.list.Vertices) != 0 {
+		t.Errorf("the panel is drawn without an error")
+	}
+	ep.err = errors.New("a\nb\nc\nd")
+	ep.draw(1, 640, 480)
+	if len(ep.list.Vertices) == 0 {
+		t.Errorf("the panel is not drawn")
+	}
+	// Only two rows fit, the last of which is replaced by an ellipsis.
+	ep.draw(1, 640, 28)
+	if n := len(ep.list.Vertices); n != 6*(1+1+3) {
+		t.Errorf("unexpected number of vertices: %d", n)
+	}
+}
@@ -0,0 +1,98 @@
+package renderer
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The functions in this file read files from a filesystem other than that of
+// the OS, which makes it possible to load shaders from e.g. an embed.FS, a zip
+// archive or an fstest.MapFS. A nil fs.FS stands for the filesystem of the
+// OS.
+//
+// Paths in other filesystems are resolved as if the root of the filesystem is
+// the root directory and the working directory. Devices, like cameras and MIDI
+// controllers, are always opened from the OS.
+
+// fsName converts a path to a name that is valid for an fs.FS.
+func fsName(name string) string {
+	name = path.Clean("/" + filepath.ToSlash(name))
+	if name == "/" {
+		return "."
+	}
+	return strings.TrimPrefix(name, "/")
+}
+
+// AbsPath returns the absolute form of a path. In filesystems other than that
+// of the OS, relative paths are relative to the root.
+func AbsPath(fsys fs.FS, name string) (string, error) {
+	if fsys == nil {
+		return filepath.Abs(name)
+	}
+	return filepath.FromSlash("/" + fsName(name)), nil
+}
+
+// OpenFile opens a file for reading.
+func OpenFile(fsys fs.FS, name string) (fs.File, error) {
+	if fsys == nil {
+		return os.Open(name)
+	}
+	return fsys.Open(fsName(name))
+}
+
+// ReadFile reads the contents of a file.
+func ReadFile(fsys fs.FS, name string) ([]byte, error) {
+	if fsys == nil {
+		return os.ReadFile(name)
+	}
+	return fs.ReadFile(fsys, fsName(name))
+}
+
+// StatFile returns information about a file.
+func StatFile(fsys fs.FS, name string) (fs.FileInfo, error) {
+	if fsys == nil {
+		return os.Stat(name)
+	}
+	return fs.Stat(fsys, fsName(name))
+}
+
+// ReadDir reads the entries of a directory, sorted by filename.
+func ReadDir(fsys fs.FS, name string) ([]fs.DirEntry, error) {
+	if fsys == nil {
+		return os.ReadDir(name)
+	}
+	return fs.ReadDir(fsys, fsName(name))
+}
+
+// LocalPath returns the path in the filesystem of the OS of a file, so it can
+// be passed to other programs. Files in other filesystems are copied to a
+// temporary file, which is removed by calling release.
+func LocalPath(fsys fs.FS, name string) (local string, release func(), err error) {
+	if fsys == nil {
+		return name, func() {}, nil
+	}
+	in, err := OpenFile(fsys, name)
+	if err != nil {
+		return "", nil, err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp("", "shady-*"+filepath.Ext(name))
+	if err != nil {
+		return "", nil, err
+	}
+	release = func() { os.Remove(out.Name()) }
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		release()
+		return "", nil, err
+	}
+	if err := out.Close(); err != nil {
+		release()
+		return "", nil, err
+	}
+	return out.Name(), release, nil
+}
@@ -0,0 +1,64 @@
+package renderer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFSPreprocess(t *testing.T) {
+	fsys := fstest.MapFS{
+		"shaders/main.glsl":   {Data: []byte("#include \"common.glsl\"\n#pragma use <noise.glsl>\nvoid main() {}\n")},
+		"shaders/common.glsl": {Data: []byte("float common;\n")},
+		"lib/noise.glsl":      {Data: []byte("float noise;\n")},
+		"shaders/unused.glsl": {Data: []byte("float unused;\n")},
+	}
+
+	pp := Preprocessor{IncludePaths: []string{"lib"}, FS: fsys}
+	pre, err := pp.Process("shaders/main.glsl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{"/shaders/main.glsl", "/shaders/common.glsl", "/lib/noise.glsl"}
+	if !slices.Equal(pre.Files, exp) {
+		t.Fatalf("unexpected files: %q", pre.Files)
+	}
+	if dir := pre.Sources[0].Dir(); dir != "/shaders" {
+		t.Fatalf("unexpected dir: %q", dir)
+	}
+
+	c, err := SourceFile{Filename: "/shaders/common.glsl", FS: fsys}.Contents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(c) != "float common;\n" {
+		t.Fatalf("unexpected contents: %q", c)
+	}
+}
+
+func TestFSLocalPath(t *testing.T) {
+	fsys := fstest.MapFS{
+		"video.mp4": {Data: []byte("not really a video")},
+	}
+
+	local, release, err := LocalPath(fsys, "/video.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Ext(local) != ".mp4" {
+		t.Fatalf("unexpected extension: %q", local)
+	}
+	if c, err := os.ReadFile(local); err != nil || string(c) != "not really a video" {
+		t.Fatalf("unexpected contents: %q, %v", c, err)
+	}
+	release()
+	if _, err := os.Stat(local); !os.IsNotExist(err) {
+		t.Fatalf("expected the local copy to be removed: %v", err)
+	}
+
+	if local, _, err := LocalPath(nil, "video.mp4"); err != nil || local != "video.mp4" {
+		t.Fatalf("expected files of the OS to be used as is: %q, %v", local, err)
+	}
+}
@@ -0,0 +1,76 @@
+package renderer
+
+import (
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// The axes of a GamepadState. The layout is the standard gamepad layout used
+// by GLFW and SDL, which is modeled after an Xbox controller.
+const (
+	GamepadAxisLeftX = iota
+	GamepadAxisLeftY
+	GamepadAxisRightX
+	GamepadAxisRightY
+	GamepadAxisLeftTrigger
+	GamepadAxisRightTrigger
+	NumGamepadAxes
+)
+
+// The buttons of a GamepadState.
+const (
+	GamepadButtonA = iota
+	GamepadButtonB
+	GamepadButtonX
+	GamepadButtonY
+	GamepadButtonLeftBumper
+	GamepadButtonRightBumper
+	GamepadButtonBack
+	GamepadButtonStart
+	GamepadButtonGuide
+	GamepadButtonLeftThumb
+	GamepadButtonRightThumb
+	GamepadButtonDpadUp
+	GamepadButtonDpadRight
+	GamepadButtonDpadDown
+	GamepadButtonDpadLeft
+	NumGamepadButtons
+)
+
+// GamepadState is the state of a game controller.
+type GamepadState struct {
+	Name string
+	// Axes range from -1 to 1. The Y axes of the sticks point down and the
+	// triggers rest at -1.
+	Axes    [NumGamepadAxes]float32
+	Buttons [NumGamepadButtons]bool
+}
+
+// pollGamepads returns the state of the joysticks known to GLFW by their
+// number. Joysticks without a gamepad mapping have their axes and buttons
+// assigned in the order reported by the device.
+func pollGamepads() []*GamepadState {
+	pads := make([]*GamepadState, glfw.JoystickLast-glfw.Joystick1+1)
+	for joy := glfw.Joystick1; joy <= glfw.JoystickLast; joy++ {
+		if !joy.Present() {
+			continue
+		}
+		pad := &GamepadState{}
+		if gs := joy.GetGamepadState(); joy.IsGamepad() && gs != nil {
+			pad.Name = joy.GetGamepadName()
+			copy(pad.Axes[:], gs.Axes[:])
+			for i, action := range gs.Buttons {
+				pad.Buttons[i] = action == glfw.Press
+			}
+		} else {
+			pad.Name = joy.GetName()
+			copy(pad.Axes[:], joy.GetAxes())
+			for i, action := range joy.GetButtons() {
+				if i < len(pad.Buttons) {
+					pad.Buttons[i] = action == glfw.Press
+				}
+			}
+		}
+		pads[joy-glfw.Joystick1] = pad
+	}
+	return pads
+}
@@ -0,0 +1,125 @@
+package renderer
+
+import (
+	"unsafe"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/renderer/ui"
+)
+
+var (
+	overlayVert = SourceBuf(`#version 330 core
+		in vec2 pos;
+		in vec2 uv;
+		in vec4 color;
+		out vec2 fragUV;
+		out vec4 fragColor;
+		uniform vec2 viewport;
+
+		void main() {
+			vec2 p = pos / viewport * 2.0 - 1.0;
+			gl_Position = vec4(p.x, -p.y, 0.0, 1.0);
+			fragUV = uv;
+			fragColor = color;
+		}
+	`)
+	overlayFrag = SourceBuf(`#version 330 core
+		in vec2 fragUV;
+		in vec4 fragColor;
+		out vec4 outColor;
+		uniform sampler2D font;
+
+		void main() {
+			outColor = fragColor;
+			if (fragUV.x >= 0.0) {
+				outColor.a *= texture(font, fragUV).r;
+			}
+		}
+	`)
+)
+
+// overlay draws the triangles produced by the ui package on top of the
+// current framebuffer.
+type overlay struct {
+	program  uint32
+	vao, vbo uint32
+	font     uint32
+}
+
+func newOverlay() (*overlay, error) {
+	program, err := linkProgram(map[Stage][]Source{
+		StageVertex:   {overlayVert},
+		StageFragment: {overlayFrag},
+	})
+	if err != nil {
+		return nil, err
+	}
+	o := &overlay{program: program}
+
+	gl.GenVertexArrays(1, &o.vao)
+	gl.BindVertexArray(o.vao)
+	gl.GenBuffers(1, &o.vbo)
+	gl.BindBuffer(gl.ARRAY_BUFFER, o.vbo)
+	stride := int32(unsafe.Sizeof(ui.Vertex{}))
+	for _, attr := range []struct {
+		name   string
+		size   int32
+		offset uintptr
+	}{
+		{"pos", 2, unsafe.Offsetof(ui.Vertex{}.X)},
+		{"uv", 2, unsafe.Offsetof(ui.Vertex{}.U)},
+		{"color", 4, unsafe.Offsetof(ui.Vertex{}.Color)},
+	} {
+		loc := uint32(gl.GetAttribLocation(program, gl.Str(attr.name+"\x00")))
+		gl.EnableVertexAttribArray(loc)
+		gl.VertexAttribPointerWithOffset(loc, attr.size, gl.FLOAT, false, stride, attr.offset)
+	}
+	gl.BindVertexArray(0)
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+
+	pix, w, h := ui.FontAtlas()
+	gl.GenTextures(1, &o.font)
+	gl.BindTexture(gl.TEXTURE_2D, o.font)
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.R8, int32(w), int32(h), 0, gl.RED, gl.UNSIGNED_BYTE, gl.Ptr(&pix[0]))
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 4)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return o, nil
+}
+
+// draw renders a list on top of the currently bound framebuffer, which has
+// the specified size in pixels.
+func (o *overlay) draw(list *ui.List, width, height int) {
+	if len(list.Vertices) == 0 {
+		return
+	}
+	gl.UseProgram(o.program)
+	gl.BindVertexArray(o.vao)
+	gl.BindBuffer(gl.ARRAY_BUFFER, o.vbo)
+	gl.BufferData(gl.ARRAY_BUFFER, len(list.Vertices)*int(unsafe.Sizeof(ui.Vertex{})), gl.Ptr(&list.Vertices[0]), gl.STREAM_DRAW)
+
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, o.font)
+	gl.Uniform1i(gl.GetUniformLocation(o.program, gl.Str("font\x00")), 0)
+	gl.Uniform2f(gl.GetUniformLocation(o.program, gl.Str("viewport\x00")), float32(width), float32(height))
+
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	gl.DrawArrays(gl.TRIANGLES, 0, int32(len(list.Vertices)))
+	gl.Disable(gl.BLEND)
+
+	gl.BindVertexArray(0)
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+}
+
+func (o *overlay) Close() {
+	gl.DeleteTextures(1, &o.font)
+	gl.DeleteBuffers(1, &o.vbo)
+	gl.DeleteVertexArrays(1, &o.vao)
+	gl.DeleteProgram(o.program)
+}
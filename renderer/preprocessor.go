@@ -1,67 +1,664 @@
 package renderer
 
 import (
-	"io/ioutil"
+	"fmt"
+	"io/fs"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 )
 
-var ppIncludeRe = regexp.MustCompile(`(?im)^#pragma\s+use\s+"([^"]+)"$`)
+var (
+	ppDirectiveRe = regexp.MustCompile(`^\s*#\s*(\w*)\s*(.*)$`)
+	ppIncludeRe   = regexp.MustCompile(`^(?:"([^"]+)"|<([^>]+)>)$`)
+	ppPragmaUseRe = regexp.MustCompile(`^use\s+(?:"([^"]+)"|<([^>]+)>)$`)
+	ppDefineRe    = regexp.MustCompile(`^([A-Za-z_]\w*)(\([^)]*\))?\s*(.*)$`)
+	ppIdentRe     = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+)
+
+// A Preprocessor resolves the include directives of GLSL sources, which the
+// GLSL compiler does not support.
+//
+// Files are included with either `#include "file"` or `#pragma use "file"`.
+// Relative paths are resolved relative to the including file, or else looked
+// up in the include paths. Paths in angle brackets, like `#include <file>`,
+// are only looked up in the include paths. Every file is included at most
+// once. Conditional directives are evaluated, so includes in
+// blocks that are not compiled are skipped. The conditionals themselves and
+// macros remain to be handled by the compiler.
+type Preprocessor struct {
+	// Defines are macros that are defined before the first source, like the
+	// -D flag of C compilers.
+	Defines map[string]string
+	// Version is the value of __VERSION__ in conditional expressions.
+	Version string
+	// IncludePaths are the directories in which included files are looked
+	// up, in order of precedence.
+	IncludePaths []string
+	// FS is the filesystem from which the files are read, nil for that of
+	// the OS.
+	FS fs.FS
+}
+
+// Preprocessed is the output of the preprocessor.
+type Preprocessed struct {
+	// Sources are the parts of the files that remain after resolving
+	// includes, in the order in which they should be compiled.
+	Sources []Source
+	// Files holds the absolute paths of all files that were read, as returned
+	// by AbsPath.
+	Files []string
+}
+
+// A SourceSegment is a range of lines of a file that remains after
+// preprocessing. Includes and pragmas in blocks that are not compiled are left
+// empty, so the line numbers of the segment and the file stay aligned.
+// Segments are compiled as separate sources, which are preceded by a #line
+// directive.
+type SourceSegment struct {
+	Filename string
+	// Line is the line of the file at which the segment starts.
+	Line int
+	Text string
+}
+
+// Contents implements the Source interface.
+func (s SourceSegment) Contents() ([]byte, error) {
+	return []byte(s.Text), nil
+}
+
+// Dir implements the Source interface.
+func (s SourceSegment) Dir() string {
+	return filepath.Dir(s.Filename)
+}
+
+// SourceMap implements the SourceMapper interface.
+func (s SourceSegment) SourceMap() SourceMap {
+	return SourceMap{{Line: 1, Filename: s.Filename, FileLine: s.Line}}
+}
 
 // Includes recursively resolves dependencies in the specified file.
 //
 // The argument file is returned included in the returned list of files.
 func Includes(filenames ...string) ([]string, error) {
-	return processRecursive(filenames, []string{})
+	pre, err := Preprocessor{}.Process(filenames...)
+	if err != nil {
+		return nil, err
+	}
+	return pre.Files, nil
+}
+
+// ResolveInclude returns the absolute path of a file that is included by
+// another file. Angled reports whether the path is enclosed in angle brackets.
+func (pp Preprocessor) ResolveInclude(includingFile, name string, angled bool) (string, error) {
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name), nil
+	}
+	relative := filepath.Join(filepath.Dir(includingFile), name)
+	if !angled {
+		if _, err := StatFile(pp.FS, relative); err == nil {
+			return relative, nil
+		}
+	}
+	for _, dir := range pp.IncludePaths {
+		filename, err := AbsPath(pp.FS, filepath.Join(dir, name))
+		if err != nil {
+			return "", err
+		}
+		if _, err := StatFile(pp.FS, filename); err == nil {
+			return filename, nil
+		}
+	}
+	if !angled {
+		// Let reading the file fail with a sensible error.
+		return relative, nil
+	}
+	return "", fmt.Errorf("%s not found in include paths %q", name, pp.IncludePaths)
+}
+
+// A PreprocessError is an error in a directive of a source file, as opposed
+// to an error reading a file.
+type PreprocessError struct {
+	Filename string
+	Line     int
+	Message  string
+}
+
+func (err PreprocessError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", err.Filename, err.Line, err.Message)
 }
 
-func processRecursive(filenames []string, sources []string) ([]string, error) {
+// Diagnostic returns the error as a diagnostic, so it can be reported along
+// with those of the compiler.
+func (err PreprocessError) Diagnostic() Diagnostic {
+	return Diagnostic{
+		Filename: err.Filename,
+		Line:     err.Line,
+		Severity: SeverityError,
+		Message:  err.Message,
+	}
+}
+
+// Process preprocesses the specified files as if they were concatenated.
+// Errors in directives are returned as a PreprocessError.
+func (pp Preprocessor) Process(filenames ...string) (*Preprocessed, error) {
+	st := ppState{
+		pp:       pp,
+		macros:   map[string]ppMacro{},
+		included: map[string]bool{},
+		out:      &Preprocessed{},
+	}
+	if pp.Version != "" {
+		st.macros["__VERSION__"] = ppMacro{body: pp.Version}
+	}
+	if len(pp.Defines) > 0 {
+		names := make([]string, 0, len(pp.Defines))
+		for name := range pp.Defines {
+			if !ppIdentRe.MatchString(name) {
+				return nil, fmt.Errorf("invalid macro name: %q", name)
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var buf strings.Builder
+		for _, name := range names {
+			st.macros[name] = ppMacro{body: pp.Defines[name]}
+			fmt.Fprintf(&buf, "#define %s %s\n", name, pp.Defines[name])
+		}
+		st.out.Sources = append(st.out.Sources, MappedSource{
+			Source: SourceBuf(buf.String()),
+			Map:    SourceMap{{Line: 1, Filename: "<defines>", FileLine: 1}},
+		})
+	}
+
 	for _, filename := range filenames {
-		absFilename, err := filepath.Abs(filename)
+		absFilename, err := AbsPath(pp.FS, filename)
 		if err != nil {
 			return nil, err
 		}
-		currentFile := absFilename
-		shaderSource, err := ioutil.ReadFile(currentFile)
-		if err != nil {
+		if err := st.processFile(absFilename); err != nil {
 			return nil, err
 		}
+	}
+	return st.out, nil
+}
+
+type ppMacro struct {
+	// function is set for macros that take arguments.
+	function bool
+	body     string
+}
+
+// ppCond is the state of a conditional block.
+type ppCond struct {
+	// parent reports whether the block containing the conditional is active.
+	parent bool
+	// active reports whether the current branch is active.
+	active bool
+	// taken reports whether any branch so far has been active.
+	taken   bool
+	sawElse bool
+	line    int
+}
+
+type ppState struct {
+	pp       Preprocessor
+	macros   map[string]ppMacro
+	included map[string]bool
+	out      *Preprocessed
+}
+
+func (st *ppState) processFile(filename string) error {
+	// Including the same file more than once also stops infinite recursion.
+	if st.included[filename] {
+		return nil
+	}
+	st.included[filename] = true
+	st.out.Files = append(st.out.Files, filename)
+
+	data, err := ReadFile(st.pp.FS, filename)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(data), "\n")
+
+	var segment []string
+	segmentStart := 1
+	flush := func(next int) {
+		text := strings.Join(segment, "\n")
+		if strings.TrimSpace(text) != "" {
+			st.out.Sources = append(st.out.Sources, SourceSegment{
+				Filename: filename,
+				Line:     segmentStart,
+				Text:     text,
+			})
+		}
+		segment, segmentStart = nil, next
+	}
+
+	var conds []ppCond
+	active := func() bool {
+		return len(conds) == 0 || conds[len(conds)-1].active
+	}
+	inComment := false
+	for i := 0; i < len(lines); {
+		lineno := i + 1
+		// Directives may continue on the next line.
+		n := 1
+		logical := lines[i]
+		for strings.HasSuffix(strings.TrimRight(logical, "\r"), "\\") && i+n < len(lines) {
+			logical = strings.TrimSuffix(strings.TrimRight(logical, "\r"), "\\") + lines[i+n]
+			n++
+		}
+		original := lines[i : i+n]
+		i += n
+
+		startsInComment := inComment
+		var code string
+		code, inComment = stripComments(logical, inComment)
+		match := ppDirectiveRe.FindStringSubmatch(code)
+		if startsInComment || match == nil {
+			segment = append(segment, original...)
+			continue
+		}
+
+		errorf := func(format string, args ...any) error {
+			return PreprocessError{Filename: filename, Line: lineno, Message: fmt.Sprintf(format, args...)}
+		}
+		directive, args := match[1], strings.TrimSpace(match[2])
+		keep := true
+		switch directive {
+		case "ifdef", "ifndef":
+			if !ppIdentRe.MatchString(args) {
+				return errorf("#%s expects a macro name", directive)
+			}
+			_, defined := st.macros[args]
+			cond := defined == (directive == "ifdef")
+			conds = append(conds, ppCond{parent: active(), active: active() && cond, taken: cond, line: lineno})
+		case "if":
+			cond := false
+			if active() {
+				if cond, err = st.evaluate(args); err != nil {
+					return errorf("%v", err)
+				}
+			}
+			conds = append(conds, ppCond{parent: active(), active: active() && cond, taken: cond, line: lineno})
+		case "elif":
+			if len(conds) == 0 {
+				return errorf("#elif without #if")
+			}
+			c := &conds[len(conds)-1]
+			if c.sawElse {
+				return errorf("#elif after #else")
+			}
+			c.active = false
+			if c.parent && !c.taken {
+				cond, err := st.evaluate(args)
+				if err != nil {
+					return errorf("%v", err)
+				}
+				c.active, c.taken = cond, cond
+			}
+		case "else":
+			if len(conds) == 0 {
+				return errorf("#else without #if")
+			}
+			c := &conds[len(conds)-1]
+			if c.sawElse {
+				return errorf("#else after #else")
+			}
+			c.active = c.parent && !c.taken
+			c.taken, c.sawElse = true, true
+		case "endif":
+			if len(conds) == 0 {
+				return errorf("#endif without #if")
+			}
+			conds = conds[:len(conds)-1]
+		case "define":
+			if !active() {
+				break
+			}
+			m := ppDefineRe.FindStringSubmatch(args)
+			if m == nil {
+				return errorf("#define expects a macro name")
+			}
+			st.macros[m[1]] = ppMacro{function: m[2] != "", body: m[3]}
+		case "undef":
+			if active() {
+				delete(st.macros, args)
+			}
+		case "include", "pragma":
+			var include []string
+			if directive == "include" {
+				if include = ppIncludeRe.FindStringSubmatch(args); include == nil {
+					return errorf("#include expects \"filename\" or <filename>")
+				}
+			} else if include = ppPragmaUseRe.FindStringSubmatch(args); include == nil {
+				// Pragmas that are not compiled are removed so they are
+				// not picked up by environments. Files are never included
+				// twice anyway, so #pragma once is not needed.
+				keep = active() && args != "once"
+				break
+			}
+			keep = false
+			if !active() {
+				break
+			}
+			includedFile, err := st.pp.ResolveInclude(filename, include[1]+include[2], include[2] != "")
+			if err != nil {
+				return errorf("%v", err)
+			}
+			segment = append(segment, make([]string, n)...)
+			flush(i + 1)
+			if err := st.processFile(includedFile); err != nil {
+				return err
+			}
+			continue
+		}
+		if keep {
+			segment = append(segment, original...)
+		} else {
+			segment = append(segment, make([]string, n)...)
+		}
+	}
+	if len(conds) > 0 {
+		return PreprocessError{Filename: filename, Line: conds[len(conds)-1].line, Message: "unterminated conditional"}
+	}
+	flush(len(lines) + 1)
+	return nil
+}
+
+// stripComments replaces the comments in a line with spaces. inComment
+// reports whether the line starts inside a block comment, the returned bool
+// whether the next line does.
+func stripComments(line string, inComment bool) (string, bool) {
+	var buf strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case inComment:
+			if strings.HasPrefix(line[i:], "*/") {
+				inComment = false
+				i++
+				buf.WriteByte(' ')
+			}
+		case strings.HasPrefix(line[i:], "//"):
+			return buf.String(), false
+		case strings.HasPrefix(line[i:], "/*"):
+			inComment = true
+			i++
+		case line[i] == '"':
+			end := strings.IndexByte(line[i+1:], '"')
+			if end < 0 {
+				buf.WriteString(line[i:])
+				return buf.String(), false
+			}
+			buf.WriteString(line[i : i+end+2])
+			i += end + 1
+		default:
+			buf.WriteByte(line[i])
+		}
+	}
+	return buf.String(), inComment
+}
+
+// evaluate evaluates the expression of an #if or #elif directive. Identifiers
+// that are not macros evaluate to 0.
+func (st *ppState) evaluate(expr string) (bool, error) {
+	tokens, err := ppTokenize(expr)
+	if err != nil {
+		return false, err
+	}
+	tokens, err = st.expand(tokens, map[string]bool{})
+	if err != nil {
+		return false, err
+	}
+	if len(tokens) == 0 {
+		return false, fmt.Errorf("#if without expression")
+	}
+	p := ppExprParser{tokens: tokens}
+	v, err := p.parse(1)
+	if err != nil {
+		return false, err
+	}
+	if p.pos < len(p.tokens) {
+		return false, fmt.Errorf("unexpected %q in expression", p.tokens[p.pos])
+	}
+	return v != 0, nil
+}
 
-		// We need to check for recursion using a set that includes the current
-		// file. But we need to append the current file after all included sources
-		// in the list of files. Create a new temporary set of included source
-		// files for the recursion check.
-		checkset := append(sources, currentFile)
-
-		// Check for files being included in the current file so we can later
-		// recurse into all of them.
-		includeMatches := ppIncludeRe.FindAllSubmatch(shaderSource, -1)
-		includes := make([]string, 0, len(includeMatches))
-	outer:
-		for _, submatch := range includeMatches {
-			includedFile := string(submatch[1])
-			if !filepath.IsAbs(includedFile) {
-				includedFile = filepath.Join(filepath.Dir(absFilename), includedFile)
+// expand replaces the defined operator and macros in a tokenized expression.
+// The macros in hide are being expanded and are left alone to stop recursion.
+func (st *ppState) expand(tokens []string, hide map[string]bool) ([]string, error) {
+	var out []string
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		if tok == "defined" {
+			var name string
+			if i+3 < len(tokens) && tokens[i+1] == "(" && tokens[i+3] == ")" {
+				name, i = tokens[i+2], i+3
+			} else if i+1 < len(tokens) {
+				name, i = tokens[i+1], i+1
+			}
+			if !ppIdentRe.MatchString(name) {
+				return nil, fmt.Errorf("defined expects a macro name")
+			}
+			if _, ok := st.macros[name]; ok {
+				out = append(out, "1")
 			} else {
-				includedFile = filepath.Clean(includedFile)
+				out = append(out, "0")
 			}
+			continue
+		}
+		m, ok := st.macros[tok]
+		if !ok || hide[tok] {
+			out = append(out, tok)
+			continue
+		}
+		if m.function {
+			return nil, fmt.Errorf("macro %s with arguments can not be used in a conditional", tok)
+		}
+		body, err := ppTokenize(m.body)
+		if err != nil {
+			return nil, err
+		}
+		hide[tok] = true
+		expanded, err := st.expand(body, hide)
+		delete(hide, tok)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, expanded...)
+	}
+	return out, nil
+}
+
+var ppPunctuators = []string{
+	"&&", "||", "==", "!=", "<=", ">=", "<<", ">>",
+	"+", "-", "*", "/", "%", "<", ">", "&", "|", "^", "!", "~", "(", ")",
+}
 
-			// Check whether we have already included the referred file. This stops
-			// infinite recursions.
-			for _, inc := range checkset {
-				if inc == includedFile {
-					continue outer
+// ppTokenize splits an expression into identifiers, numbers and operators.
+func ppTokenize(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case isPPIdentChar(c):
+			j := i
+			for j < len(expr) && isPPIdentChar(expr[j]) {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		default:
+			found := false
+			for _, p := range ppPunctuators {
+				if strings.HasPrefix(expr[i:], p) {
+					tokens = append(tokens, p)
+					i += len(p)
+					found = true
+					break
 				}
 			}
-			includes = append(includes, includedFile)
+			if !found {
+				return nil, fmt.Errorf("unexpected %q in expression", c)
+			}
 		}
+	}
+	return tokens, nil
+}
+
+func isPPIdentChar(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// The precedence of the binary operators, higher binds tighter.
+var ppPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"|":  3,
+	"^":  4,
+	"&":  5,
+	"==": 6, "!=": 6,
+	"<": 7, ">": 7, "<=": 7, ">=": 7,
+	"<<": 8, ">>": 8,
+	"+": 9, "-": 9,
+	"*": 10, "/": 10, "%": 10,
+}
+
+type ppExprParser struct {
+	tokens []string
+	pos    int
+}
 
-		sources, err = processRecursive(includes, sources)
+func (p *ppExprParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+	return tok
+}
+
+// parse parses binary operators with at least the specified precedence.
+func (p *ppExprParser) parse(minPrec int) (int64, error) {
+	lhs, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	for p.pos < len(p.tokens) {
+		op := p.tokens[p.pos]
+		prec, ok := ppPrecedence[op]
+		if !ok || prec < minPrec {
+			break
+		}
+		p.pos++
+		rhs, err := p.parse(prec + 1)
 		if err != nil {
-			return nil, err
+			return 0, err
+		}
+		if lhs, err = ppBinary(op, lhs, rhs); err != nil {
+			return 0, err
 		}
-		sources = append(sources, currentFile)
 	}
+	return lhs, nil
+}
 
-	return sources, nil
+func (p *ppExprParser) unary() (int64, error) {
+	tok := p.next()
+	switch tok {
+	case "":
+		return 0, fmt.Errorf("unexpected end of expression")
+	case "+", "-", "~", "!":
+		v, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch tok {
+		case "-":
+			v = -v
+		case "~":
+			v = ^v
+		case "!":
+			v = ppBool(v == 0)
+		}
+		return v, nil
+	case "(":
+		v, err := p.parse(1)
+		if err != nil {
+			return 0, err
+		}
+		if p.next() != ")" {
+			return 0, fmt.Errorf("missing ) in expression")
+		}
+		return v, nil
+	}
+	if '0' <= tok[0] && tok[0] <= '9' {
+		v, err := strconv.ParseInt(strings.TrimRight(tok, "uU"), 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q in expression", tok)
+		}
+		return v, nil
+	}
+	if ppIdentRe.MatchString(tok) {
+		return 0, nil
+	}
+	return 0, fmt.Errorf("unexpected %q in expression", tok)
+}
+
+func ppBinary(op string, a, b int64) (int64, error) {
+	switch op {
+	case "||":
+		return ppBool(a != 0 || b != 0), nil
+	case "&&":
+		return ppBool(a != 0 && b != 0), nil
+	case "|":
+		return a | b, nil
+	case "^":
+		return a ^ b, nil
+	case "&":
+		return a & b, nil
+	case "==":
+		return ppBool(a == b), nil
+	case "!=":
+		return ppBool(a != b), nil
+	case "<":
+		return ppBool(a < b), nil
+	case ">":
+		return ppBool(a > b), nil
+	case "<=":
+		return ppBool(a <= b), nil
+	case ">=":
+		return ppBool(a >= b), nil
+	case "<<":
+		return a << uint64(b), nil
+	case ">>":
+		return a >> uint64(b), nil
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/", "%":
+		if b == 0 {
+			return 0, fmt.Errorf("division by zero in expression")
+		}
+		if op == "/" {
+			return a / b, nil
+		}
+		return a % b, nil
+	}
+	return 0, fmt.Errorf("unknown operator %q", op)
+}
+
+func ppBool(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
 }
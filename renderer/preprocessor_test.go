@@ -1,6 +1,11 @@
 package renderer
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -43,3 +48,152 @@ func TestStopRecursionCycle(t *testing.T) {
 		t.Fatalf("unexpected number of sources: exp %v, got %v", 1, len(sources))
 	}
 }
+
+func TestIncludeConditional(t *testing.T) {
+	sources, err := Includes("../testdata/preprocessor/include-ifdef.glsl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 1 {
+		t.Fatalf("unexpected number of sources: exp %v, got %v", 1, len(sources))
+	}
+
+	pp := Preprocessor{Defines: map[string]string{"USE_DEP": ""}}
+	pre, err := pp.Process("../testdata/preprocessor/include-ifdef.glsl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pre.Files) != 2 {
+		t.Fatalf("unexpected number of sources: exp %v, got %v", 2, len(pre.Files))
+	}
+	if c, _ := pre.Sources[0].Contents(); string(c) != "#define USE_DEP \n" {
+		t.Fatalf("unexpected defines: %q", c)
+	}
+}
+
+func TestSegments(t *testing.T) {
+	pre, err := Preprocessor{}.Process("../testdata/preprocessor/include-segments.glsl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []struct {
+		file string
+		line int
+		text string
+	}{
+		{"include-segments.glsl", 1, "float a;\n"},
+		{"include-segments-dep.glsl", 1, "\nfloat dep;\n"},
+		{"include-segments.glsl", 3, "float b;\n"},
+	}
+	if len(pre.Sources) != len(exp) {
+		t.Fatalf("unexpected number of segments: exp %v, got %v", len(exp), len(pre.Sources))
+	}
+	for i, e := range exp {
+		seg := pre.Sources[i].(SourceSegment)
+		if filepath.Base(seg.Filename) != e.file || seg.Line != e.line || seg.Text != e.text {
+			t.Errorf("unexpected segment %d: %+v", i, seg)
+		}
+		if _, line := seg.SourceMap().Lookup(2); line != e.line+1 {
+			t.Errorf("segment %d: unexpected mapped line: %d", i, line)
+		}
+	}
+}
+
+func TestConditionals(t *testing.T) {
+	pre, err := Preprocessor{}.Process("../testdata/preprocessor/conditionals.glsl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pre.Files) != 2 || filepath.Base(pre.Files[1]) != "include-single-dep.glsl" {
+		t.Fatalf("unexpected files: %q", pre.Files)
+	}
+	exp := []string{
+		"#define LEVEL 2\n#if LEVEL > 2\n\n\n#elif LEVEL == 2\n",
+		"#else\nfloat c;\n#endif\n",
+	}
+	if len(pre.Sources) != len(exp) {
+		t.Fatalf("unexpected number of segments: exp %v, got %v", len(exp), len(pre.Sources))
+	}
+	for i, e := range exp {
+		if c, _ := pre.Sources[i].Contents(); string(c) != e {
+			t.Errorf("unexpected segment %d: %q", i, c)
+		}
+	}
+}
+
+func TestUnterminatedConditional(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "shader.glsl")
+	if err := os.WriteFile(filename, []byte("void main() {}\n#ifdef FOO\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Includes(filename)
+	if err == nil || !strings.Contains(err.Error(), "shader.glsl:2:") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var perr PreprocessError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a PreprocessError, got %T", err)
+	}
+	d := perr.Diagnostic()
+	if d.Filename != filename || d.Line != 2 || d.Severity != SeverityError || d.Message != "unterminated conditional" {
+		t.Fatalf("unexpected diagnostic: %+v", d)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	st := ppState{macros: map[string]ppMacro{
+		"A":   {body: "2"},
+		"B":   {body: "A + 1"},
+		"R":   {body: "R"},
+		"F":   {function: true, body: "x"},
+		"ONE": {body: "1"},
+	}}
+	tests := []struct {
+		expr string
+		exp  bool
+		err  bool
+	}{
+		{expr: "1", exp: true},
+		{expr: "0", exp: false},
+		{expr: "A == 2", exp: true},
+		{expr: "B * 2 == 4", exp: true}, // Macros are expanded as text.
+		{expr: "defined(A) && !defined C", exp: true},
+		{expr: "(1 << 4) - 0x10", exp: false},
+		{expr: "-ONE + 2 * 3 > 4 || 0", exp: true},
+		{expr: "UNKNOWN", exp: false},
+		{expr: "R", exp: false},
+		{expr: "1 +", err: true},
+		{expr: "(1", err: true},
+		{expr: "1 / 0", err: true},
+		{expr: "F(1)", err: true},
+		{expr: "", err: true},
+	}
+	for _, tt := range tests {
+		v, err := st.evaluate(tt.expr)
+		if (err != nil) != tt.err {
+			t.Errorf("%q: unexpected error: %v", tt.expr, err)
+		} else if v != tt.exp {
+			t.Errorf("%q: exp %v, got %v", tt.expr, tt.exp, v)
+		}
+	}
+}
+
+func TestIncludePaths(t *testing.T) {
+	if _, err := Includes("../testdata/preprocessor/include-angled.glsl"); err == nil {
+		t.Fatalf("expected an error without include paths")
+	}
+
+	pp := Preprocessor{IncludePaths: []string{"../testdata/preprocessor/nonexistent", "../testdata/preprocessor/library"}}
+	pre, err := pp.Process("../testdata/preprocessor/include-angled.glsl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, f := range pre.Files {
+		files = append(files, filepath.Base(f))
+	}
+	exp := []string{"include-angled.glsl", "const.glsl", "util.glsl"}
+	if !slices.Equal(files, exp) {
+		t.Fatalf("unexpected files: %q", files)
+	}
+}
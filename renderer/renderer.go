@@ -7,6 +7,7 @@ import (
 	"image"
 	"io"
 	"log"
+	"math"
 	"os"
 	"regexp"
 	"strconv"
@@ -18,6 +19,7 @@ import (
 	"github.com/go-gl/glfw/v3.3/glfw"
 
 	"github.com/polyfloyd/shady/egl"
+	"github.com/polyfloyd/shady/renderer/ui"
 )
 
 const (
@@ -96,25 +98,25 @@ type Shader struct {
 	w, h      uint
 	glVersion OpenGLVersion
 
-	vertLoc uint32
-	vao     uint32
-	vbo     uint32
+	vao uint32
+	vbo uint32
 
-	uniforms map[string]Uniform
 	renderer imageRenderer
-	program  uint32
 
-	env     Environment
-	newEnvs chan Environment
-
-	subTargets map[string]*Shader
+	scene   *scene
+	fade    *fade
+	newEnvs chan envChange
 
+	// time is the animation time of the current scene.
 	time            time.Duration
 	frame           uint64
 	prevFrameHandle interface{}
+
+	Controls
 }
 
-func NewShader(width, height uint, glVersion OpenGLVersion) (*Shader, error) {
+// initHeadless initializes OpenGL with an offscreen EGL context.
+func initHeadless(glVersion OpenGLVersion) error {
 	// Hack: Unit tests require a different style of initialization. We'll
 	// detect whether we are running as a test for now.
 	var err error
@@ -131,7 +133,11 @@ func NewShader(width, height uint, glVersion OpenGLVersion) (*Shader, error) {
 			}
 		})
 	}
-	if err != nil {
+	return err
+}
+
+func NewShader(width, height uint, glVersion OpenGLVersion) (*Shader, error) {
+	if err := initHeadless(glVersion); err != nil {
 		return nil, err
 	}
 
@@ -140,7 +146,7 @@ func NewShader(width, height uint, glVersion OpenGLVersion) (*Shader, error) {
 		h:         height,
 		glVersion: glVersion,
 		renderer:  &pboRenderer{w: width, h: height},
-		newEnvs:   make(chan Environment, 1),
+		newEnvs:   make(chan envChange, 1),
 	}
 
 	// Set up the render targets.
@@ -155,88 +161,80 @@ func NewShader(width, height uint, glVersion OpenGLVersion) (*Shader, error) {
 // reloadEnvironment ensures that an environment is set and set up for
 // rendering.
 func (sh *Shader) reloadEnvironment(ctx context.Context) error {
-	var env Environment
-	if sh.env == nil {
-		// If no environment is set, block until it is set or the context is
-		// canceled.
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case env = <-sh.newEnvs:
-		}
-	} else {
-		// If an environment is already set, check if a newer environment is
-		// available or just exit.
-		select {
-		case env = <-sh.newEnvs:
-		default:
-			return nil
-		}
-	}
-
-	// Close the old environment if there is one.
-	if sh.env != nil {
-		sh.env.Close()
-		gl.DeleteProgram(sh.program)
-		sh.env = nil
-	}
-	if env == nil {
-		return nil
+	// If no environment is set, block until it is set or the context is
+	// canceled. If an environment is already set, check if a newer
+	// environment is available or just exit.
+	change, ok, err := receiveEnvironment(ctx, sh.newEnvs, sh.scene == nil)
+	if !ok {
+		return err
 	}
 
-	renderState := RenderState{
+	prevFade := sh.fade
+	sh.scene, sh.fade, err = changeScene(sh.scene, sh.fade, change, sh.glVersion, RenderState{
 		Time:            sh.time,
 		FramesProcessed: sh.frame,
 		CanvasWidth:     sh.w,
 		CanvasHeight:    sh.h,
-		Uniforms:        sh.uniforms,
-	}
-	if err := env.Setup(renderState); err != nil {
-		return fmt.Errorf("error setting up environment: %w", err)
-	}
-
-	subEnvs, err := env.SubEnvironments()
-	if err != nil {
+	})
+	if err != nil || sh.scene == nil {
 		return err
 	}
-	sh.subTargets = map[string]*Shader{}
-	for name, env := range subEnvs {
-		s, err := NewShader(env.Width, env.Height, sh.glVersion)
-		if err != nil {
-			return err
-		}
-		s.SetEnvironment(env.Environment)
-		if err := s.reloadEnvironment(context.Background()); err != nil {
-			return err
+	if sh.fade != nil && sh.fade != prevFade {
+		// Both scenes are rendered to textures while fading.
+		for i := range sh.fade.targets {
+			sh.fade.targets[i].resize(int(sh.w), int(sh.h))
 		}
-		sh.subTargets[name] = s
 	}
-
-	sources, err := env.Sources()
-	if err != nil {
-		return err
-	}
-	sh.program, err = linkProgram(sources)
-	if err != nil {
-		return err
-	}
-	gl.UseProgram(sh.program)
-	sh.uniforms = ListUniforms(sh.program)
-	sh.vertLoc = uint32(gl.GetAttribLocation(sh.program, gl.Str("vert\x00")))
-
-	sh.env = env
+	sh.time = sh.scene.time
+	sh.Controls.setProgram(sh.scene.uniforms)
+	sh.Controls.setError(nil)
 	return nil
 }
 
 func (sh *Shader) SetEnvironment(env Environment) {
-	sh.newEnvs <- env
+	sh.newEnvs <- envChange{env: env}
+}
+
+// TransitionTo switches to the specified environment by blending from the
+// current environment to the new one. Unlike with SetEnvironment, the new
+// environment starts at time zero.
+func (sh *Shader) TransitionTo(env Environment, tr Transition) {
+	sh.newEnvs <- envChange{env: env, transition: &tr}
+}
+
+// LoadEnvironment sets up the specified environment right away instead of
+// deferring this to the render loop like SetEnvironment does. Errors, e.g.
+// compilation errors, are returned.
+func (sh *Shader) LoadEnvironment(env Environment) error {
+	sh.newEnvs <- envChange{env: env}
+	return sh.reloadEnvironment(context.Background())
+}
+
+// RenderFrame synchronously renders the next frame and returns its image.
+func (sh *Shader) RenderFrame(interval time.Duration) image.Image {
+	return sh.renderer.Image(sh.nextHandle(interval))
 }
 
+// nextHandle advances the clock by interval, unless the clock is paused, and
+// renders the next frame.
 func (sh *Shader) nextHandle(interval time.Duration) interface{} {
+	if sh.frame > 0 {
+		sh.time, interval = sh.Controls.advance(sh.time, interval)
+	}
+	return sh.render(interval)
+}
+
+// render renders a frame at the current time.
+func (sh *Shader) render(interval time.Duration) interface{} {
 	if err := sh.reloadEnvironment(context.Background()); err != nil {
 		log.Printf("Error reloading environment: %v", err)
+		sh.Controls.setError(err)
+	}
+	if sh.scene == nil {
+		// There is no previous environment to fall back to.
 		return nil
 	}
+	sh.scene.time = sh.time
 
 	prevTexID, freePrevTexID := uint32(0), func() {}
 	getPrevTexID := func() uint32 {
@@ -247,48 +245,85 @@ func (sh *Shader) nextHandle(interval time.Duration) interface{} {
 	}
 	defer freePrevTexID()
 
-	subTextures := map[string]uint32{}
-	freeSubTextures := []func(){}
-	for name, s := range sh.subTargets {
-		h := s.nextHandle(interval)
-		textureID, free := s.renderer.Texture(h)
-		subTextures[name] = textureID
-		freeSubTextures = append(freeSubTextures, free)
-	}
-	defer func() {
-		for _, free := range freeSubTextures {
-			free()
+	state := RenderState{
+		Interval:     interval,
+		CanvasWidth:  sh.w,
+		CanvasHeight: sh.h,
+	}
+	var snapshot image.Image
+	wantSnapshot := sh.Controls.wantSnapshot()
+	var handle interface{}
+	if sh.fade == nil {
+		subTextures, freeSubTextures := sh.scene.renderSubTargets(interval)
+		defer freeSubTextures()
+
+		// Ensure that the render state is up to date.
+		gl.BindVertexArray(sh.vao)
+		gl.BindBuffer(gl.ARRAY_BUFFER, sh.vbo)
+		state.PreviousFrameTexID = getPrevTexID
+		state.SubBuffers = subTextures
+		sh.scene.prepare(state)
+		sh.Controls.apply(sh.scene.uniforms)
+
+		// Render the geometry.
+		handle = sh.renderer.Draw(func() {
+			sh.scene.draw()
+			if wantSnapshot {
+				snapshot = readFramebuffer(sh.w, sh.h)
+			}
+		})
+	} else {
+		// The outgoing scene continues from the last frame that was
+		// rendered, the incoming scene starts out blank.
+		fromTex := sh.renderToTarget(sh.fade.from, &sh.fade.targets[0], state, getPrevTexID)
+		toTex := sh.renderToTarget(sh.scene, &sh.fade.targets[1], state, nil)
+		gl.BindVertexArray(sh.vao)
+		gl.BindBuffer(gl.ARRAY_BUFFER, sh.vbo)
+		handle = sh.renderer.Draw(func() {
+			sh.fade.draw(fromTex, toTex, int(sh.w), int(sh.h), true)
+			if wantSnapshot {
+				snapshot = readFramebuffer(sh.w, sh.h)
+			}
+		})
+		sh.fade.frames++
+		sh.fade.from.time += interval
+		sh.fade.elapsed += interval
+		if sh.fade.done() {
+			sh.fade.close()
+			sh.fade = nil
 		}
-	}()
-
-	// Ensure that the render state is up to date.
-	gl.BindVertexArray(sh.vao)
-	gl.BindBuffer(gl.ARRAY_BUFFER, sh.vbo)
-	gl.UseProgram(sh.program)
-	gl.EnableVertexAttribArray(sh.vertLoc)
-	gl.VertexAttribPointer(sh.vertLoc, 3, gl.FLOAT, false, 0, nil)
-
-	sh.env.PreRender(RenderState{
-		Time:               sh.time,
-		Interval:           interval,
-		FramesProcessed:    sh.frame,
-		CanvasWidth:        sh.w,
-		CanvasHeight:       sh.h,
-		Uniforms:           sh.uniforms,
-		PreviousFrameTexID: getPrevTexID,
-		SubBuffers:         subTextures,
-	})
-	sh.time += interval
+	}
 	sh.frame++
-
-	// Render the geometry.
-	handle := sh.renderer.Draw(func() {
-		gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
-	})
+	sh.Controls.frameDone(sh.frame, sh.time, sh.w, sh.h, snapshot)
 	sh.prevFrameHandle = handle
 	return handle
 }
 
+// renderToTarget renders a frame of a scene that is part of a fade to the
+// next of its targets and returns the texture holding the frame. If firstPrev
+// is set, it provides the previous frame of the first frame of the fade.
+func (sh *Shader) renderToTarget(sc *scene, targets *frameTargets, state RenderState, firstPrev func() uint32) uint32 {
+	subTextures, freeSubTextures := sc.renderSubTargets(state.Interval)
+	defer freeSubTextures()
+
+	target, prev := targets.frame(sh.fade.frames)
+	state.PreviousFrameTexID = func() uint32 { return prev.tex }
+	if sh.fade.frames == 0 && firstPrev != nil {
+		state.PreviousFrameTexID = firstPrev
+	}
+	state.SubBuffers = subTextures
+
+	gl.BindVertexArray(sh.vao)
+	gl.BindBuffer(gl.ARRAY_BUFFER, sh.vbo)
+	sc.prepare(state)
+	sh.Controls.apply(sc.uniforms)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, target.fbo)
+	gl.Clear(gl.COLOR_BUFFER_BIT)
+	sc.draw()
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	return target.tex
+}
+
 func (sh *Shader) Animate(ctx context.Context, interval time.Duration, stream chan<- image.Image) {
 	buffer := make(chan interface{}, sh.renderer.NumBuffers())
 	for {
@@ -296,6 +331,10 @@ func (sh *Shader) Animate(ctx context.Context, interval time.Duration, stream ch
 			return
 		} else if err != nil {
 			log.Printf("Error reloading environment: %v", err)
+			sh.Controls.setError(err)
+			continue
+		}
+		if sh.scene == nil {
 			continue
 		}
 
@@ -318,13 +357,12 @@ func (sh *Shader) Animate(ctx context.Context, interval time.Duration, stream ch
 
 func (sh *Shader) Close() error {
 	var envErr error
-	if sh.env != nil {
-		envErr = sh.env.Close()
+	if sh.fade != nil {
+		sh.fade.close()
 	}
-	for _, s := range sh.subTargets {
-		s.Close()
+	if sh.scene != nil {
+		envErr = sh.scene.close()
 	}
-	gl.DeleteProgram(sh.program)
 	gl.DeleteVertexArrays(1, &sh.vao)
 	gl.DeleteBuffers(1, &sh.vbo)
 	if err := sh.renderer.Close(); err != nil {
@@ -340,28 +378,32 @@ func (sh *Shader) Close() error {
 // shaders. This texture is then immediately outputted to the window by drawing
 // a fullscreen quad.
 type OnScreenEngine struct {
-	env     Environment
-	newEnvs chan Environment
+	scene   *scene
+	fade    *fade
+	newEnvs chan envChange
 
 	glVersion OpenGLVersion
 
 	quadVAO     uint32
 	quadVBO     uint32
-	vertLoc     uint32
 	copyProgram uint32
 
-	targets [2]struct {
-		fbo, tex uint32
-	}
-
-	program    uint32
-	subTargets map[string]*Shader
-	uniforms   map[string]Uniform
+	targets frameTargets
+	// fadeTargets hold the frames of the outgoing scene during a fade.
+	fadeTargets frameTargets
 
+	// time is the animation time of the current scene.
 	time  time.Duration
 	frame uint64
 
-	window *glfw.Window
+	window  *glfw.Window
+	overlay *overlay
+	tweaks  tweakPanel
+	errors  errorPanel
+	// scroll accumulates the scroll offset between frames.
+	scroll float64
+
+	Controls
 }
 
 func NewOnScreenEngine(glVersion OpenGLVersion) (*OnScreenEngine, error) {
@@ -386,8 +428,9 @@ func NewOnScreenEngine(glVersion OpenGLVersion) (*OnScreenEngine, error) {
 	}
 
 	eng := &OnScreenEngine{
-		newEnvs: make(chan Environment, 1),
-		window:  window,
+		newEnvs:   make(chan envChange, 1),
+		glVersion: glVersion,
+		window:    window,
 	}
 
 	w, h := eng.window.GetFramebufferSize()
@@ -403,42 +446,56 @@ func NewOnScreenEngine(glVersion OpenGLVersion) (*OnScreenEngine, error) {
 	}
 
 	eng.quadVAO, eng.quadVBO = createGLQuad()
+
+	eng.overlay, err = newOverlay()
+	if err != nil {
+		return nil, err
+	}
+	eng.tweaks.copy = window.SetClipboardString
+	window.SetKeyCallback(eng.onKey)
+	window.SetScrollCallback(func(_ *glfw.Window, _, yoff float64) {
+		eng.scroll += yoff
+	})
 	return eng, nil
 }
 
-func (eng *OnScreenEngine) onResize(win *glfw.Window, width int, height int) {
-	for i := range eng.targets {
-		t := &eng.targets[i]
-		if t.fbo != 0 {
-			gl.DeleteFramebuffers(1, &t.fbo)
-		}
-		if t.tex != 0 {
-			gl.DeleteTextures(1, &t.tex)
-		}
-
-		gl.GenFramebuffers(1, &t.fbo)
-		gl.BindFramebuffer(gl.FRAMEBUFFER, t.fbo)
-		gl.GenTextures(1, &t.tex)
-		gl.BindTexture(gl.TEXTURE_2D, t.tex)
-		zeroes := make([]byte, width*height*3)
-		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGB, int32(width), int32(height), 0, gl.RGB, gl.UNSIGNED_BYTE, gl.Ptr(&zeroes[0]))
-		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
-		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
-		gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, t.tex, 0)
-		if gl.CheckFramebufferStatus(gl.FRAMEBUFFER) != gl.FRAMEBUFFER_COMPLETE {
-			panic(fmt.Errorf("incomplete framebuffer"))
-		}
+func (eng *OnScreenEngine) onKey(win *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+	if key == glfw.KeyF1 && action == glfw.Press {
+		eng.tweaks.visible = !eng.tweaks.visible
 	}
-	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
-	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+// uiInput returns the state of the mouse in framebuffer pixels and the scale
+// of the UI for the density of the screen.
+func (eng *OnScreenEngine) uiInput() (ui.Input, int) {
+	fbWidth, _ := eng.window.GetFramebufferSize()
+	winWidth, _ := eng.window.GetSize()
+	density := 1.0
+	if winWidth > 0 && fbWidth > 0 {
+		density = float64(fbWidth) / float64(winWidth)
+	}
+	x, y := eng.window.GetCursorPos()
+	in := ui.Input{
+		MouseX:  x * density,
+		MouseY:  y * density,
+		Down:    eng.window.GetMouseButton(glfw.MouseButtonLeft) == glfw.Press,
+		AltDown: eng.window.GetMouseButton(glfw.MouseButtonRight) == glfw.Press,
+		Scroll:  eng.scroll,
+	}
+	eng.scroll = 0
+	return in, max(int(math.Round(2*density)), 1)
+}
 
+func (eng *OnScreenEngine) onResize(win *glfw.Window, width int, height int) {
+	eng.targets.resize(width, height)
+	eng.fadeTargets.resize(width, height)
 	gl.Viewport(0, 0, int32(width), int32(height))
 }
 
 func (eng *OnScreenEngine) Animate(ctx context.Context) error {
 	lastFrame := time.Now()
 	interval := time.Second / 60
-	i := 0
+	i := uint64(0)
 	for {
 		if eng.window.ShouldClose() {
 			return ErrWindowClosed
@@ -451,54 +508,108 @@ func (eng *OnScreenEngine) Animate(ctx context.Context) error {
 			return err
 		} else if err != nil {
 			log.Printf("Error reloading environment: %v", err)
+			eng.Controls.setError(err)
+			eng.errors.err = err
+			continue
+		}
+		if eng.scene == nil {
+			// There is no previous environment to render, so only the error
+			// is shown until a working environment is set.
+			eng.drawErrorOnly()
 			continue
 		}
 
 		gl.BindVertexArray(eng.quadVAO)
 		gl.BindBuffer(gl.ARRAY_BUFFER, eng.quadVBO)
 
-		target := &eng.targets[i%len(eng.targets)]
-		prevTarget := &eng.targets[(i+len(eng.targets)-1)%len(eng.targets)]
+		target, prevTarget := eng.targets.frame(i)
+		fadeTarget, fadePrevTarget := eng.fadeTargets.frame(i)
 
 		// 1st pass: render the actual image.
 		w, h := eng.window.GetFramebufferSize()
+		state := RenderState{
+			Interval:     interval,
+			CanvasWidth:  uint(w),
+			CanvasHeight: uint(h),
+			SubBuffers:   nil, // TODO
+			Gamepads:     pollGamepads(),
+		}
+		if eng.fade != nil {
+			gl.BindFramebuffer(gl.FRAMEBUFFER, fadeTarget.fbo)
+			state.PreviousFrameTexID = func() uint32 { return fadePrevTarget.tex }
+			eng.fade.from.prepare(state)
+			eng.Controls.apply(eng.fade.from.uniforms)
+			eng.fade.from.draw()
+		}
+		eng.scene.time = eng.time
 		gl.BindFramebuffer(gl.FRAMEBUFFER, target.fbo)
-		gl.UseProgram(eng.program)
-		eng.env.PreRender(RenderState{
-			Time:               eng.time,
-			Interval:           interval,
-			FramesProcessed:    eng.frame,
-			CanvasWidth:        uint(w),
-			CanvasHeight:       uint(h),
-			Uniforms:           eng.uniforms,
-			PreviousFrameTexID: func() uint32 { return prevTarget.tex },
-			SubBuffers:         nil, // TODO
-		})
-
-		gl.EnableVertexAttribArray(eng.vertLoc)
-		gl.VertexAttribPointer(eng.vertLoc, 3, gl.FLOAT, false, 0, nil)
-		gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+		state.PreviousFrameTexID = func() uint32 { return prevTarget.tex }
+		eng.scene.prepare(state)
+		eng.Controls.apply(eng.scene.uniforms)
+		if eng.tweaks.stale {
+			eng.tweaks.load(eng.scene.program, eng.scene.uniforms, eng.scene.env)
+		}
+		eng.tweaks.apply()
+		eng.scene.draw()
+		var snapshot image.Image
+		wantSnapshot := eng.Controls.wantSnapshot()
+		if wantSnapshot && eng.fade == nil {
+			snapshot = readFramebuffer(uint(w), uint(h))
+		}
 
-		// 2nd pass: copy the rendered image to the on-screen framebuffer.
+		// 2nd pass: copy the rendered image to the on-screen framebuffer,
+		// blending it with the outgoing scene if there is one.
 		gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
-		gl.UseProgram(eng.copyProgram)
-		gl.ActiveTexture(gl.TEXTURE0)
-		gl.BindTexture(gl.TEXTURE_2D, target.tex)
-		gl.Uniform1i(
-			gl.GetUniformLocation(eng.copyProgram, gl.Str("screenTexture\x00")),
-			0,
-		)
-
-		loc := uint32(gl.GetAttribLocation(eng.copyProgram, gl.Str("pos\x00")))
-		gl.EnableVertexAttribArray(loc)
-		gl.VertexAttribPointer(loc, 3, gl.FLOAT, false, 0, nil)
-		gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+		if eng.fade != nil {
+			eng.fade.draw(fadeTarget.tex, target.tex, w, h, false)
+			if wantSnapshot {
+				// The window is not upside down like the framebuffers.
+				snapshot = flipVertical(readFramebuffer(uint(w), uint(h)))
+			}
+		} else {
+			gl.UseProgram(eng.copyProgram)
+			gl.ActiveTexture(gl.TEXTURE0)
+			gl.BindTexture(gl.TEXTURE_2D, target.tex)
+			gl.Uniform1i(
+				gl.GetUniformLocation(eng.copyProgram, gl.Str("screenTexture\x00")),
+				0,
+			)
+
+			loc := uint32(gl.GetAttribLocation(eng.copyProgram, gl.Str("pos\x00")))
+			gl.EnableVertexAttribArray(loc)
+			gl.VertexAttribPointer(loc, 3, gl.FLOAT, false, 0, nil)
+			gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+		}
+
+		// 3rd pass: draw the user interface on top.
+		in, scale := eng.uiInput()
+		eng.tweaks.ctx.Scale = scale
+		eng.tweaks.draw(in, w, h)
+		eng.overlay.draw(&eng.tweaks.ctx.List, w, h)
+		eng.errors.draw(scale, w, h)
+		eng.overlay.draw(&eng.errors.list, w, h)
 
 		now := time.Now()
 		interval = now.Sub(lastFrame)
 		lastFrame = now
-		eng.time += interval
+		prevTime := eng.time
+		eng.time, interval = eng.Controls.advance(eng.time, interval)
+		if clock, ok := eng.scene.env.(Clock); ok {
+			if t, ok := clock.Time(); ok {
+				eng.time = t
+				interval = max(t-prevTime, 0)
+			}
+		}
+		if eng.fade != nil {
+			eng.fade.from.time += interval
+			eng.fade.elapsed += interval
+			if eng.fade.done() {
+				eng.fade.close()
+				eng.fade = nil
+			}
+		}
 		eng.frame++
+		eng.Controls.frameDone(eng.frame, prevTime, uint(w), uint(h), snapshot)
 		i++
 
 		eng.window.SwapBuffers()
@@ -506,89 +617,81 @@ func (eng *OnScreenEngine) Animate(ctx context.Context) error {
 	}
 }
 
+// drawErrorOnly shows the error panel on an empty screen.
+func (eng *OnScreenEngine) drawErrorOnly() {
+	w, h := eng.window.GetFramebufferSize()
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	gl.Clear(gl.COLOR_BUFFER_BIT)
+	_, scale := eng.uiInput()
+	eng.errors.draw(scale, w, h)
+	eng.overlay.draw(&eng.errors.list, w, h)
+	eng.window.SwapBuffers()
+	glfw.PollEvents()
+}
+
 func (eng *OnScreenEngine) Close() error {
+	if eng.fade != nil {
+		eng.fade.close()
+	}
+	if eng.scene != nil {
+		eng.scene.close()
+	}
+	eng.targets.close()
+	eng.fadeTargets.close()
+	eng.overlay.Close()
 	eng.window.Destroy()
 	glfw.Terminate()
 	return nil
 }
 
 func (eng *OnScreenEngine) reloadEnvironment(ctx context.Context) error {
-	var env Environment
-	if eng.env == nil {
-		// If no environment is set, block until it is set or the context is
-		// canceled.
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case env = <-eng.newEnvs:
-		}
-	} else {
-		// If an environment is already set, check if a newer environment is
-		// available or just exit.
-		select {
-		case env = <-eng.newEnvs:
-		default:
-			return nil
-		}
-	}
-
-	// Close the old environment if there is one.
-	if eng.env != nil {
-		eng.env.Close()
-		gl.DeleteProgram(eng.program)
-		eng.env = nil
-	}
-	if env == nil {
-		return nil
+	// If no environment is set, block until it is set or the context is
+	// canceled. If an environment is already set, check if a newer
+	// environment is available or just exit.
+	// While an error is shown, the window is kept responsive.
+	change, ok, err := receiveEnvironment(ctx, eng.newEnvs, eng.scene == nil && eng.errors.err == nil)
+	if !ok {
+		return err
 	}
 
 	w, h := eng.window.GetFramebufferSize()
-	renderState := RenderState{
+	prevFade := eng.fade
+	eng.scene, eng.fade, err = changeScene(eng.scene, eng.fade, change, eng.glVersion, RenderState{
 		Time:            eng.time,
 		FramesProcessed: eng.frame,
 		CanvasWidth:     uint(w),
 		CanvasHeight:    uint(h),
-		Uniforms:        eng.uniforms,
-	}
-	if err := env.Setup(renderState); err != nil {
-		return fmt.Errorf("error setting up environment: %w", err)
-	}
-
-	subEnvs, err := env.SubEnvironments()
-	if err != nil {
-		return err
-	}
-	eng.subTargets = map[string]*Shader{}
-	for name, env := range subEnvs {
-		s, err := NewShader(env.Width, env.Height, eng.glVersion)
-		if err != nil {
-			return err
-		}
-		s.SetEnvironment(env.Environment)
-		if err := s.reloadEnvironment(context.Background()); err != nil {
-			return err
-		}
-		eng.subTargets[name] = s
-	}
-
-	sources, err := env.Sources()
+	})
 	if err != nil {
 		return err
 	}
-	eng.program, err = linkProgram(sources)
-	if err != nil {
-		return err
+	eng.errors.err = nil
+	if eng.scene == nil {
+		return nil
 	}
-	gl.UseProgram(eng.program)
-	eng.uniforms = ListUniforms(eng.program)
-	eng.vertLoc = uint32(gl.GetAttribLocation(eng.program, gl.Str("vert\x00")))
-
-	eng.env = env
+	if eng.fade != nil && eng.fade != prevFade {
+		// The frames of the outgoing scene are in the current targets, the
+		// incoming scene starts out blank.
+		eng.targets, eng.fadeTargets = eng.fadeTargets, eng.targets
+		eng.targets.resize(w, h)
+	}
+	eng.time = eng.scene.time
+	eng.Controls.setProgram(eng.scene.uniforms)
+	eng.Controls.setError(nil)
+	// The initial values of the uniforms are known after the first frame.
+	eng.tweaks.stale = true
 	return nil
 }
 
 func (eng *OnScreenEngine) SetEnvironment(env Environment) {
-	eng.newEnvs <- env
+	eng.newEnvs <- envChange{env: env}
+}
+
+// TransitionTo switches to the specified environment by blending from the
+// current environment to the new one. Unlike with SetEnvironment, the new
+// environment starts at time zero.
+func (eng *OnScreenEngine) TransitionTo(env Environment, tr Transition) {
+	eng.newEnvs <- envChange{env: env, transition: &tr}
 }
 
 type renderer interface {
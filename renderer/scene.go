@@ -0,0 +1,212 @@
+package renderer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+// A scene is an environment that has been set up for rendering together with
+// the program linked from its sources.
+type scene struct {
+	env        Environment
+	program    uint32
+	uniforms   map[string]Uniform
+	vertLoc    uint32
+	subTargets map[string]*Shader
+
+	// time and frame are the animation time and the number of frames
+	// rendered of this scene.
+	time  time.Duration
+	frame uint64
+}
+
+// newScene sets up an environment and links its program. The time and frame
+// of the state are those the scene starts at. The environment is closed if
+// it can not be set up.
+func newScene(env Environment, glVersion OpenGLVersion, state RenderState) (*scene, error) {
+	sc := &scene{
+		env:        env,
+		subTargets: map[string]*Shader{},
+		time:       state.Time,
+		frame:      state.FramesProcessed,
+	}
+	if err := env.Setup(state); err != nil {
+		env.Close()
+		return nil, fmt.Errorf("error setting up environment: %w", err)
+	}
+	if err := sc.link(glVersion); err != nil {
+		sc.close()
+		return nil, err
+	}
+	return sc, nil
+}
+
+func (sc *scene) link(glVersion OpenGLVersion) error {
+	subEnvs, err := sc.env.SubEnvironments()
+	if err != nil {
+		return err
+	}
+	for name, env := range subEnvs {
+		s, err := NewShader(env.Width, env.Height, glVersion)
+		if err != nil {
+			return err
+		}
+		sc.subTargets[name] = s
+		s.SetEnvironment(env.Environment)
+		if err := s.reloadEnvironment(context.Background()); err != nil {
+			return err
+		}
+	}
+
+	sources, err := sc.env.Sources()
+	if err != nil {
+		return err
+	}
+	sc.program, err = linkProgram(sources)
+	if err != nil {
+		return err
+	}
+	gl.UseProgram(sc.program)
+	sc.uniforms = ListUniforms(sc.program)
+	sc.vertLoc = uint32(gl.GetAttribLocation(sc.program, gl.Str("vert\x00")))
+	return nil
+}
+
+// renderSubTargets renders the sub environments of the scene and returns
+// their output as textures. The textures are deleted by calling free.
+func (sc *scene) renderSubTargets(interval time.Duration) (textures map[string]uint32, free func()) {
+	textures = map[string]uint32{}
+	frees := []func(){}
+	for name, s := range sc.subTargets {
+		s.scene.time = sc.time
+		h := s.render(interval)
+		textureID, free := s.renderer.Texture(h)
+		textures[name] = textureID
+		frees = append(frees, free)
+	}
+	return textures, func() {
+		for _, free := range frees {
+			free()
+		}
+	}
+}
+
+// prepare makes the program of the scene current and lets the environment
+// update the uniforms. The time, frame and uniforms of the state are set to
+// those of the scene.
+func (sc *scene) prepare(state RenderState) {
+	gl.UseProgram(sc.program)
+	state.Time = sc.time
+	state.FramesProcessed = sc.frame
+	state.Uniforms = sc.uniforms
+	sc.env.PreRender(state)
+}
+
+// draw draws the fullscreen quad that is bound to the array buffer using the
+// program of the scene.
+func (sc *scene) draw() {
+	gl.EnableVertexAttribArray(sc.vertLoc)
+	gl.VertexAttribPointer(sc.vertLoc, 3, gl.FLOAT, false, 0, nil)
+	gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+	sc.frame++
+}
+
+func (sc *scene) close() error {
+	for _, s := range sc.subTargets {
+		s.Close()
+	}
+	if sc.program != 0 {
+		gl.DeleteProgram(sc.program)
+	}
+	return sc.env.Close()
+}
+
+// An envChange is a request to an engine to switch to another environment.
+type envChange struct {
+	env Environment
+	// transition is nil to cut to the new environment right away, in which
+	// case the new environment continues at the time of the current one.
+	transition *Transition
+}
+
+// receiveEnvironment returns the next environment change that was sent to an
+// engine. If block is set, it waits until one is available or the context is
+// canceled. ok is false if there is no change.
+func receiveEnvironment(ctx context.Context, envs <-chan envChange, block bool) (change envChange, ok bool, err error) {
+	if block {
+		select {
+		case <-ctx.Done():
+			return envChange{}, false, ctx.Err()
+		case change = <-envs:
+			return change, true, nil
+		}
+	}
+	select {
+	case change = <-envs:
+		return change, true, nil
+	default:
+		return envChange{}, false, nil
+	}
+}
+
+// changeScene applies an environment change to the current scene and fade of
+// an engine and returns the new ones. The state holds the time and canvas of
+// the engine.
+//
+// The new environment is set up before the current scene is closed. If it can
+// not be set up, e.g. because of a compilation error, the current scene keeps
+// playing. On a cut, the new environment may take over resources of the
+// current one if it implements Reuser. Environments must therefore be able to
+// open devices that are still in use by the current scene.
+func changeScene(cur *scene, f *fade, change envChange, glVersion OpenGLVersion, state RenderState) (*scene, *fade, error) {
+	if change.transition != nil && cur != nil && change.env != nil {
+		state.Time, state.FramesProcessed = 0, 0
+		next, err := newScene(change.env, glVersion, state)
+		if err != nil {
+			return cur, f, err
+		}
+		nextFade, err := newFade(cur, *change.transition)
+		if err != nil {
+			log.Printf("Cutting to the next environment: %v", err)
+			if f != nil {
+				f.close()
+			}
+			cur.close()
+			return next, nil, nil
+		}
+		if f != nil {
+			// A transition is already in progress, the scene that was fading
+			// out is dropped.
+			f.close()
+		}
+		return next, nextFade, nil
+	}
+
+	if change.env == nil {
+		if f != nil {
+			f.close()
+		}
+		if cur != nil {
+			cur.close()
+		}
+		return nil, nil, nil
+	}
+	if reuser, ok := change.env.(Reuser); ok && cur != nil {
+		reuser.Reuse(cur.env)
+	}
+	next, err := newScene(change.env, glVersion, state)
+	if err != nil {
+		return cur, f, err
+	}
+	if f != nil {
+		f.close()
+	}
+	if cur != nil {
+		cur.close()
+	}
+	return next, nil, nil
+}
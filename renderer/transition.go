@@ -0,0 +1,218 @@
+package renderer
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+var (
+	transitionVert = SourceBuf(`#version 330 core
+		in vec2 pos;
+
+		void main() {
+			gl_Position = vec4(pos, 0.0, 1.0);
+		}
+	`)
+	transitionHeader = SourceBuf(`#version 330 core
+		out vec4 fragColor;
+		uniform sampler2D fromTexture;
+		uniform sampler2D toTexture;
+		uniform float progress;
+		uniform float ratio;
+		uniform vec2 resolution;
+		uniform bool flip;
+
+		vec4 getFromColor(vec2 uv) {
+			return texture(fromTexture, vec2(uv.x, 1.0 - uv.y));
+		}
+
+		vec4 getToColor(vec2 uv) {
+			return texture(toTexture, vec2(uv.x, 1.0 - uv.y));
+		}
+	`)
+	transitionMain = SourceBuf(`
+		void main() {
+			vec2 uv = gl_FragCoord.xy / resolution;
+			if (flip) {
+				uv.y = 1.0 - uv.y;
+			}
+			fragColor = transition(uv);
+		}
+	`)
+	// CrossfadeTransition blends linearly from one environment to the next.
+	CrossfadeTransition = SourceBuf(`
+		vec4 transition(vec2 uv) {
+			return mix(getFromColor(uv), getToColor(uv), progress);
+		}
+	`)
+)
+
+// A Transition describes how an engine blends from the current environment to
+// the next.
+//
+// The source defines a GLSL function with the signature
+// `vec4 transition(vec2 uv)` that is called for every pixel. The uv
+// coordinates range from (0, 0) in the bottom left to (1, 1) in the top
+// right. These are available to the function:
+//
+//	float progress          The progress from 0 to 1
+//	float ratio             The aspect ratio of the canvas
+//	vec2 resolution         The size of the canvas in pixels
+//	vec4 getFromColor(vec2) The color of the outgoing environment
+//	vec4 getToColor(vec2)   The color of the incoming environment
+//
+// This is compatible with the transitions of https://gl-transitions.com/,
+// though their parameters are uniforms that are not set.
+type Transition struct {
+	Duration time.Duration
+	// Source is the source of the transition function. If nil,
+	// CrossfadeTransition is used.
+	Source Source
+}
+
+func (tr Transition) sources() map[Stage][]Source {
+	source := tr.Source
+	if source == nil {
+		source = CrossfadeTransition
+	}
+	return map[Stage][]Source{
+		StageVertex:   {transitionVert},
+		StageFragment: {transitionHeader, source, transitionMain},
+	}
+}
+
+// A fade is a transition in progress from an outgoing scene to the current
+// scene of an engine.
+type fade struct {
+	from     *scene
+	program  uint32
+	duration time.Duration
+	elapsed  time.Duration
+	frames   uint64
+
+	// targets hold the frames of the outgoing and incoming scenes, if the
+	// engine does not render these to textures already.
+	targets [2]frameTargets
+}
+
+func newFade(from *scene, tr Transition) (*fade, error) {
+	program, err := linkProgram(tr.sources())
+	if err != nil {
+		return nil, fmt.Errorf("error compiling transition: %w", err)
+	}
+	return &fade{
+		from:     from,
+		program:  program,
+		duration: tr.Duration,
+	}, nil
+}
+
+// progress returns how far along the transition is, from 0 to 1.
+func (f *fade) progress() float64 {
+	if f.duration <= 0 {
+		return 1
+	}
+	return min(float64(f.elapsed)/float64(f.duration), 1)
+}
+
+// done reports whether the transition has completed.
+func (f *fade) done() bool {
+	return f.elapsed >= f.duration
+}
+
+// draw blends the frames of the outgoing and incoming scenes into the bound
+// framebuffer, which has the specified size. The fullscreen quad must be
+// bound to the array buffer. If flip is set, the framebuffer is upside down
+// like those of which the pixels are read into images.
+func (f *fade) draw(fromTex, toTex uint32, width, height int, flip bool) {
+	gl.UseProgram(f.program)
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, fromTex)
+	gl.ActiveTexture(gl.TEXTURE1)
+	gl.BindTexture(gl.TEXTURE_2D, toTex)
+	gl.Uniform1i(gl.GetUniformLocation(f.program, gl.Str("fromTexture\x00")), 0)
+	gl.Uniform1i(gl.GetUniformLocation(f.program, gl.Str("toTexture\x00")), 1)
+	gl.Uniform1f(gl.GetUniformLocation(f.program, gl.Str("progress\x00")), float32(f.progress()))
+	gl.Uniform1f(gl.GetUniformLocation(f.program, gl.Str("ratio\x00")), float32(width)/float32(height))
+	gl.Uniform2f(gl.GetUniformLocation(f.program, gl.Str("resolution\x00")), float32(width), float32(height))
+	flipInt := int32(0)
+	if flip {
+		flipInt = 1
+	}
+	gl.Uniform1i(gl.GetUniformLocation(f.program, gl.Str("flip\x00")), flipInt)
+
+	loc := uint32(gl.GetAttribLocation(f.program, gl.Str("pos\x00")))
+	gl.EnableVertexAttribArray(loc)
+	gl.VertexAttribPointer(loc, 3, gl.FLOAT, false, 0, nil)
+	gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+	gl.ActiveTexture(gl.TEXTURE0)
+}
+
+// close releases the transition program and targets. The outgoing scene is
+// closed as well.
+func (f *fade) close() {
+	f.from.close()
+	gl.DeleteProgram(f.program)
+	for i := range f.targets {
+		f.targets[i].close()
+	}
+}
+
+// frameTargets are a pair of framebuffers with a texture attached that are
+// rendered to in turn, so the previous frame is available as texture while
+// the next one is rendered.
+type frameTargets [2]frameTarget
+
+type frameTarget struct {
+	fbo, tex uint32
+}
+
+// resize (re)creates the framebuffers with the specified size. The textures
+// are cleared.
+func (ft *frameTargets) resize(width, height int) {
+	ft.close()
+	var zeroes unsafe.Pointer
+	if width > 0 && height > 0 {
+		zeroes = gl.Ptr(make([]byte, width*height*4))
+	}
+	for i := range ft {
+		t := &ft[i]
+		gl.GenFramebuffers(1, &t.fbo)
+		gl.BindFramebuffer(gl.FRAMEBUFFER, t.fbo)
+		gl.GenTextures(1, &t.tex)
+		gl.BindTexture(gl.TEXTURE_2D, t.tex)
+		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, int32(width), int32(height), 0, gl.RGBA, gl.UNSIGNED_BYTE, zeroes)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+		gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, t.tex, 0)
+		if gl.CheckFramebufferStatus(gl.FRAMEBUFFER) != gl.FRAMEBUFFER_COMPLETE {
+			panic(fmt.Errorf("incomplete framebuffer"))
+		}
+	}
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+// frame returns the target for the i-th frame and the one holding the frame
+// before it.
+func (ft *frameTargets) frame(i uint64) (target, prev *frameTarget) {
+	return &ft[i%2], &ft[(i+1)%2]
+}
+
+func (ft *frameTargets) close() {
+	for i := range ft {
+		t := &ft[i]
+		if t.fbo != 0 {
+			gl.DeleteFramebuffers(1, &t.fbo)
+		}
+		if t.tex != 0 {
+			gl.DeleteTextures(1, &t.tex)
+		}
+		t.fbo, t.tex = 0, 0
+	}
+}
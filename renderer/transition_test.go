@@ -0,0 +1,54 @@
+package renderer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTransitionCompile(t *testing.T) {
+	initTestGL(t)
+
+	for _, tr := range []Transition{
+		{},
+		{Source: SourceBuf(`
+			vec4 transition(vec2 uv) {
+				return uv.x < progress ? getToColor(uv) : getFromColor(uv);
+			}
+		`)},
+	} {
+		program, err := linkProgram(tr.sources())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := ListUniforms(program)["progress"]; !ok {
+			t.Fatalf("progress uniform is missing")
+		}
+	}
+
+	invalid := Transition{Source: SourceBuf(`vec4 transition() {}`)}
+	if _, err := linkProgram(invalid.sources()); err == nil {
+		t.Fatalf("expected an error for an invalid transition")
+	}
+}
+
+func TestFadeProgress(t *testing.T) {
+	f := fade{duration: time.Second}
+	for elapsed, exp := range map[time.Duration]float64{
+		0:                      0,
+		250 * time.Millisecond: 0.25,
+		time.Second:            1,
+		2 * time.Second:        1,
+	} {
+		f.elapsed = elapsed
+		if p := f.progress(); p != exp {
+			t.Errorf("%v: expected %v, got %v", elapsed, exp, p)
+		}
+		if f.done() != (elapsed >= time.Second) {
+			t.Errorf("%v: unexpected done: %v", elapsed, f.done())
+		}
+	}
+
+	if p := (&fade{}).progress(); p != 1 {
+		t.Errorf("expected an instant transition to be complete, got %v", p)
+	}
+}
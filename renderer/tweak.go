@@ -0,0 +1,339 @@
+package renderer
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/renderer/ui"
+)
+
+// colorNameRe matches the names of vec3 and vec4 uniforms that are edited
+// using a color picker.
+var colorNameRe = regexp.MustCompile(`(?i)colou?r|tint|rgb`)
+
+var componentNames = [4]string{"x", "y", "z", "w"}
+
+// tweakEntry is a uniform that is listed in the tweak panel.
+type tweakEntry struct {
+	uniform Uniform
+	hint    UniformHint
+	values  []float64
+	// initial holds the values set by the environment, which are restored by
+	// resetting the entry.
+	initial []float64
+	// min and max are the range of the sliders.
+	min, max float64
+	color    bool
+	changed  bool
+}
+
+func newTweakEntry(u Uniform, hint UniformHint, initial []float64) *tweakEntry {
+	e := &tweakEntry{
+		uniform: u,
+		hint:    hint,
+		values:  append([]float64(nil), initial...),
+		initial: initial,
+		color:   !u.IsInteger() && !u.IsBool() && (u.Type == gl.FLOAT_VEC3 || u.Type == gl.FLOAT_VEC4) && colorNameRe.MatchString(u.Name),
+	}
+	e.min, e.max = sliderRange(hint, initial, u.IsInteger(), e.color)
+	return e
+}
+
+// sliderRange determines the range of the sliders of a uniform. Without a
+// hint, the range is chosen to contain the initial values with some room to
+// spare.
+func sliderRange(hint UniformHint, initial []float64, integer, color bool) (lo, hi float64) {
+	if hint.Max > hint.Min {
+		return hint.Min, hint.Max
+	}
+	if color {
+		return 0, 1
+	}
+	hi = 1
+	if integer {
+		hi = 10
+	}
+	negative := false
+	for _, v := range initial {
+		hi = math.Max(hi, 2*math.Abs(v))
+		negative = negative || v < 0
+	}
+	if integer {
+		hi = math.Ceil(hi)
+	}
+	if negative {
+		return -hi, hi
+	}
+	return 0, hi
+}
+
+// isTweakable reports whether a uniform can be edited in the panel. Samplers,
+// matrices and array elements are not supported.
+func isTweakable(u Uniform) bool {
+	cols, _ := u.MatrixSize()
+	return u.Components() > 0 && cols == 0 && !strings.Contains(u.Name, "[")
+}
+
+// literal formats the values of an entry as a GLSL literal.
+func (e *tweakEntry) literal() string {
+	u := e.uniform
+	elems := make([]string, len(e.values))
+	for i, v := range e.values {
+		switch {
+		case u.IsBool():
+			elems[i] = fmt.Sprint(v != 0)
+		case u.IsInteger():
+			elems[i] = fmt.Sprint(int64(math.Round(v)))
+		default:
+			elems[i] = ui.FormatNumber(v)
+		}
+	}
+	if len(elems) == 1 {
+		return elems[0]
+	}
+	return fmt.Sprintf("%s(%s)", typeName(u), strings.Join(elems, ", "))
+}
+
+// typeName returns the name of the type of a uniform as used in declarations.
+func typeName(u Uniform) string {
+	if u.Type == gl.UNSIGNED_INT {
+		return "uint"
+	}
+	return u.TypeLiteral()
+}
+
+// tweakPanel is an overlay of the OnScreenEngine to edit the uniforms of the
+// program that are not driven by the environment. Values that are changed are
+// set after each call to Environment.PreRender.
+type tweakPanel struct {
+	visible bool
+	ctx     ui.Context
+	// stale is set when the program has changed and the entries need to be
+	// loaded again.
+	stale   bool
+	entries []*tweakEntry
+	scroll  float64
+	// copy is called with the text that is exported by the panel.
+	copy func(string)
+}
+
+// load lists the uniforms of a program after the environment has set their
+// initial values. Changes made to uniforms of the previous program are
+// retained if the type is the same.
+func (tp *tweakPanel) load(program uint32, uniforms map[string]Uniform, env Environment) {
+	previous := map[string]*tweakEntry{}
+	for _, e := range tp.entries {
+		if e.changed {
+			previous[e.uniform.Name] = e
+		}
+	}
+
+	tp.stale = false
+	tp.entries = tp.entries[:0]
+	hinter, _ := env.(UniformHinter)
+	for _, u := range uniforms {
+		if !isTweakable(u) {
+			continue
+		}
+		var hint UniformHint
+		if hinter != nil {
+			hint = hinter.UniformHint(u.Name)
+		}
+		if hint.Driven {
+			continue
+		}
+		e := newTweakEntry(u, hint, u.Get(program))
+		if prev, ok := previous[u.Name]; ok && prev.uniform.Type == u.Type {
+			e.values, e.changed = prev.values, true
+		}
+		tp.entries = append(tp.entries, e)
+	}
+	sort.Slice(tp.entries, func(i, j int) bool {
+		return tp.entries[i].uniform.Name < tp.entries[j].uniform.Name
+	})
+}
+
+// apply sets the changed values in the program that is currently in use.
+func (tp *tweakPanel) apply() {
+	for _, e := range tp.entries {
+		if e.changed {
+			e.uniform.Set(e.values...)
+		}
+	}
+}
+
+// changedEntries returns the entries that were changed by the user.
+func (tp *tweakPanel) changedEntries() []*tweakEntry {
+	var changed []*tweakEntry
+	for _, e := range tp.entries {
+		if e.changed {
+			changed = append(changed, e)
+		}
+	}
+	return changed
+}
+
+// pragmas exports the changed values as directives that declare the uniforms
+// with the values as their defaults.
+func (tp *tweakPanel) pragmas() string {
+	var buf strings.Builder
+	for _, e := range tp.changedEntries() {
+		fmt.Fprintf(&buf, "#pragma uniform %s %s = %s", typeName(e.uniform), e.uniform.Name, e.literal())
+		if e.hint.Max > e.hint.Min {
+			fmt.Fprintf(&buf, " [%s..%s]", ui.FormatNumber(e.hint.Min), ui.FormatNumber(e.hint.Max))
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// flags exports the changed values as command line arguments.
+func (tp *tweakPanel) flags() string {
+	var args []string
+	for _, e := range tp.changedEntries() {
+		args = append(args, fmt.Sprintf("-u '%s=%s'", e.uniform.Name, e.literal()))
+	}
+	return strings.Join(args, " ")
+}
+
+// export copies the exported values to the clipboard. They are logged as well,
+// for systems without a clipboard.
+func (tp *tweakPanel) export(text string) {
+	if text == "" {
+		log.Println("No uniforms were changed")
+		return
+	}
+	log.Printf("Exported uniforms:\n%s", text)
+	if tp.copy != nil {
+		tp.copy(text)
+	}
+}
+
+// draw lays out the panel on the right side of the screen and handles input.
+// It reports whether the mouse is over the panel.
+func (tp *tweakPanel) draw(in ui.Input, width, height int) bool {
+	c := &tp.ctx
+	c.Begin(in)
+	if !tp.visible {
+		return false
+	}
+	s := float64(c.Scale)
+	pad := 4 * s
+	rowHeight := 12 * s
+	panel := ui.Rect{W: math.Min(64*ui.GlyphWidth*s, float64(width)), H: float64(height)}
+	panel.X = float64(width) - panel.W
+	mouseOver := panel.Contains(in.MouseX, in.MouseY) || c.Active()
+	c.List.Rect(panel, ui.ColorPanel)
+
+	inner := panel.Inset(pad)
+	c.Label(ui.Rect{X: inner.X, Y: inner.Y, W: inner.W, H: rowHeight}, "Uniforms (F1 to hide)", ui.ColorTextDimmed)
+
+	// The buttons are fixed at the bottom, the entries are scrollable.
+	buttons := ui.Rect{X: inner.X, Y: inner.Y + inner.H - rowHeight, W: inner.W, H: rowHeight}
+	bw := (buttons.W - pad) / 2
+	if c.Button(ui.Rect{X: buttons.X, Y: buttons.Y, W: bw, H: buttons.H}, "Copy -u flags") {
+		tp.export(tp.flags())
+	}
+	if c.Button(ui.Rect{X: buttons.X + bw + pad, Y: buttons.Y, W: bw, H: buttons.H}, "Copy #pragmas") {
+		tp.export(tp.pragmas())
+	}
+
+	view := ui.Rect{X: inner.X, Y: inner.Y + rowHeight + pad, W: inner.W}
+	view.H = buttons.Y - pad - view.Y
+	if mouseOver {
+		tp.scroll -= in.Scroll * 3 * rowHeight
+	}
+	y := view.Y - tp.scroll
+	// row reserves an area of the specified height, which is only to be
+	// drawn if it is entirely visible.
+	row := func(h float64) (ui.Rect, bool) {
+		r := ui.Rect{X: view.X, Y: y, W: view.W, H: h}
+		y += h + pad
+		return r, r.Y >= view.Y && r.Y+r.H <= view.Y+view.H
+	}
+
+	if len(tp.entries) == 0 {
+		if r, ok := row(rowHeight); ok {
+			c.Label(r, "No tweakable uniforms", ui.ColorTextDimmed)
+		}
+	}
+	for _, e := range tp.entries {
+		if r, ok := row(rowHeight); ok {
+			label := fmt.Sprintf("%s %s", typeName(e.uniform), e.uniform.Name)
+			if e.changed {
+				label += " *"
+			}
+			c.Label(r, label, ui.ColorTextDimmed)
+		}
+		if tp.drawEntry(e, row, rowHeight) {
+			// Resetting an entry to its initial values hands control back
+			// to the environment.
+			e.changed = !slices.Equal(e.values, e.initial)
+		}
+	}
+
+	// Keep the content in view.
+	contentHeight := y + tp.scroll - view.Y
+	tp.scroll = math.Max(math.Min(tp.scroll, contentHeight-view.H), 0)
+	return mouseOver
+}
+
+func (tp *tweakPanel) drawEntry(e *tweakEntry, row func(float64) (ui.Rect, bool), rowHeight float64) bool {
+	c := &tp.ctx
+	id := e.uniform.Name
+	changed := false
+	if e.color {
+		if r, ok := row(6 * rowHeight); ok {
+			rgb := [3]float64{e.values[0], e.values[1], e.values[2]}
+			if c.ColorPicker(id, r, &rgb) {
+				copy(e.values, rgb[:])
+				changed = true
+			}
+		}
+		if len(e.values) == 4 {
+			if r, ok := row(rowHeight); ok {
+				changed = c.Slider(id+".w", r, "alpha", &e.values[3], 0, 1, 0, e.initial[3]) || changed
+			}
+		}
+		return changed
+	}
+
+	for i := range e.values {
+		label := e.uniform.Name
+		if len(e.values) > 1 {
+			label = componentNames[i]
+		}
+		r, ok := row(rowHeight)
+		if !ok {
+			continue
+		}
+		if e.uniform.IsBool() {
+			v := e.values[i] != 0
+			if c.Toggle(r, label, &v) {
+				e.values[i] = float64(btoi(v))
+				changed = true
+			}
+			continue
+		}
+		var step float64
+		if e.uniform.IsInteger() {
+			step = 1
+		}
+		changed = c.Slider(fmt.Sprintf("%s.%d", id, i), r, label, &e.values[i], e.min, e.max, step, e.initial[i]) || changed
+	}
+	return changed
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
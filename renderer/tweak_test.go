@@ -0,0 +1,85 @@
+package renderer
+
+import (
+	"testing"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+func TestTweakLiteral(t *testing.T) {
+	tests := []struct {
+		typ    uint32
+		values []float64
+		exp    string
+	}{
+		{gl.FLOAT, []float64{0.25}, "0.25"},
+		{gl.FLOAT_VEC3, []float64{1, 0.5, 1.0 / 3}, "vec3(1, 0.5, 0.3333)"},
+		{gl.INT_VEC2, []float64{-1.2, 3.6}, "ivec2(-1, 4)"},
+		{gl.UNSIGNED_INT, []float64{7}, "7"},
+		{gl.BOOL_VEC2, []float64{1, 0}, "bvec2(true, false)"},
+		{gl.BOOL, []float64{0}, "false"},
+	}
+	for _, tt := range tests {
+		e := newTweakEntry(Uniform{Name: "u", Type: tt.typ}, UniformHint{}, tt.values)
+		if lit := e.literal(); lit != tt.exp {
+			t.Errorf("expected %q, got %q", tt.exp, lit)
+		}
+	}
+}
+
+func TestTweakExport(t *testing.T) {
+	speed := newTweakEntry(Uniform{Name: "speed", Type: gl.FLOAT}, UniformHint{Min: 0, Max: 10}, []float64{1})
+	speed.values[0], speed.changed = 2.5, true
+	tint := newTweakEntry(Uniform{Name: "tint", Type: gl.FLOAT_VEC3}, UniformHint{}, []float64{1, 0, 0})
+	tint.values[1], tint.changed = 1, true
+	count := newTweakEntry(Uniform{Name: "count", Type: gl.UNSIGNED_INT}, UniformHint{}, []float64{3})
+	tp := &tweakPanel{entries: []*tweakEntry{speed, tint, count}}
+
+	expPragmas := "#pragma uniform float speed = 2.5 [0..10]\n#pragma uniform vec3 tint = vec3(1, 1, 0)\n"
+	if p := tp.pragmas(); p != expPragmas {
+		t.Errorf("unexpected pragmas:\n%s", p)
+	}
+	expFlags := "-u 'speed=2.5' -u 'tint=vec3(1, 1, 0)'"
+	if f := tp.flags(); f != expFlags {
+		t.Errorf("unexpected flags: %s", f)
+	}
+	if !tint.color || speed.color {
+		t.Errorf("expected only tint to use a color picker")
+	}
+}
+
+func TestSliderRange(t *testing.T) {
+	tests := []struct {
+		hint           UniformHint
+		initial        []float64
+		integer        bool
+		expMin, expMax float64
+	}{
+		{UniformHint{Min: -1, Max: 1}, []float64{5}, false, -1, 1},
+		{UniformHint{}, []float64{0.2}, false, 0, 1},
+		{UniformHint{}, []float64{3}, false, 0, 6},
+		{UniformHint{}, []float64{-0.5, 0.25}, false, -1, 1},
+		{UniformHint{}, []float64{2}, true, 0, 10},
+		{UniformHint{}, []float64{7.5}, true, 0, 15},
+	}
+	for _, tt := range tests {
+		lo, hi := sliderRange(tt.hint, tt.initial, tt.integer, false)
+		if lo != tt.expMin || hi != tt.expMax {
+			t.Errorf("%+v %v: expected [%v..%v], got [%v..%v]", tt.hint, tt.initial, tt.expMin, tt.expMax, lo, hi)
+		}
+	}
+}
+
+func TestIsTweakable(t *testing.T) {
+	for u, exp := range map[Uniform]bool{
+		{Name: "a", Type: gl.FLOAT}:         true,
+		{Name: "b", Type: gl.BOOL_VEC3}:     true,
+		{Name: "c", Type: gl.FLOAT_MAT4}:    false,
+		{Name: "d", Type: gl.SAMPLER_2D}:    false,
+		{Name: "e[1]", Type: gl.FLOAT_VEC2}: false,
+	} {
+		if isTweakable(u) != exp {
+			t.Errorf("%v: expected %v", u.Name, exp)
+		}
+	}
+}
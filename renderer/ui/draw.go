@@ -0,0 +1,100 @@
+// Package ui implements a small immediate mode user interface that is drawn
+// as an overlay on top of the rendered shader.
+//
+// Widgets are declared every frame and produce a list of triangles that are
+// either solid or sample the font atlas. Drawing the list is left to the user
+// of this package, which keeps it free of any OpenGL state.
+package ui
+
+// A Color holds the red, green, blue and alpha components ranging from 0 to 1.
+type Color [4]float32
+
+// RGB returns an opaque color.
+func RGB(r, g, b float64) Color {
+	return Color{float32(r), float32(g), float32(b), 1}
+}
+
+// A Rect is an area in pixels with the origin at the top left.
+type Rect struct {
+	X, Y, W, H float64
+}
+
+// Contains reports whether a point is inside the rectangle.
+func (r Rect) Contains(x, y float64) bool {
+	return x >= r.X && x < r.X+r.W && y >= r.Y && y < r.Y+r.H
+}
+
+// Inset returns the rectangle shrunk by d on all sides.
+func (r Rect) Inset(d float64) Rect {
+	return Rect{X: r.X + d, Y: r.Y + d, W: max(r.W-2*d, 0), H: max(r.H-2*d, 0)}
+}
+
+// A Vertex is a corner of a triangle. If U is negative, the vertex has a
+// solid color. Otherwise, U and V are the texture coordinates in the font
+// atlas of which the value is multiplied with the alpha of the color.
+type Vertex struct {
+	X, Y  float32
+	U, V  float32
+	Color Color
+}
+
+// A List holds triangles to be drawn in order.
+type List struct {
+	Vertices []Vertex
+}
+
+// Reset clears the list while retaining the allocated memory.
+func (l *List) Reset() {
+	l.Vertices = l.Vertices[:0]
+}
+
+func (l *List) quad(r Rect, u0, v0, u1, v1 float32, c00, c10, c01, c11 Color) {
+	x0, y0 := float32(r.X), float32(r.Y)
+	x1, y1 := float32(r.X+r.W), float32(r.Y+r.H)
+	tl := Vertex{X: x0, Y: y0, U: u0, V: v0, Color: c00}
+	tr := Vertex{X: x1, Y: y0, U: u1, V: v0, Color: c10}
+	bl := Vertex{X: x0, Y: y1, U: u0, V: v1, Color: c01}
+	br := Vertex{X: x1, Y: y1, U: u1, V: v1, Color: c11}
+	l.Vertices = append(l.Vertices, tl, tr, bl, tr, br, bl)
+}
+
+// Rect draws a solid rectangle.
+func (l *List) Rect(r Rect, c Color) {
+	l.quad(r, -1, 0, -1, 0, c, c, c, c)
+}
+
+// Gradient draws a rectangle of which the colors of the corners are
+// interpolated.
+func (l *List) Gradient(r Rect, topLeft, topRight, bottomLeft, bottomRight Color) {
+	l.quad(r, -1, 0, -1, 0, topLeft, topRight, bottomLeft, bottomRight)
+}
+
+// Border draws the outline of a rectangle with a width of w pixels.
+func (l *List) Border(r Rect, w float64, c Color) {
+	l.Rect(Rect{X: r.X, Y: r.Y, W: r.W, H: w}, c)
+	l.Rect(Rect{X: r.X, Y: r.Y + r.H - w, W: r.W, H: w}, c)
+	l.Rect(Rect{X: r.X, Y: r.Y + w, W: w, H: r.H - 2*w}, c)
+	l.Rect(Rect{X: r.X + r.W - w, Y: r.Y + w, W: w, H: r.H - 2*w}, c)
+}
+
+// Text draws a single line of text with its top left corner at x, y. The
+// glyphs are scaled by an integer factor to keep them sharp.
+func (l *List) Text(x, y float64, scale int, text string, c Color) {
+	s := float64(scale)
+	for _, r := range text {
+		i := glyphIndex(r)
+		u0 := float32(i) / numGlyphs
+		u1 := float32(i+1) / numGlyphs
+		l.quad(Rect{X: x, Y: y, W: GlyphWidth * s, H: GlyphHeight * s}, u0, 0, u1, 1, c, c, c, c)
+		x += GlyphWidth * s
+	}
+}
+
+// TextWidth returns the width in pixels of a line of text drawn by Text.
+func TextWidth(scale int, text string) float64 {
+	var n int
+	for range text {
+		n++
+	}
+	return float64(n * GlyphWidth * scale)
+}
@@ -0,0 +1,277 @@
+package ui
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	ColorPanel      = Color{0.08, 0.08, 0.1, 0.85}
+	ColorWidget     = Color{0.2, 0.2, 0.24, 1}
+	ColorWidgetHot  = Color{0.28, 0.28, 0.34, 1}
+	ColorAccent     = Color{0.25, 0.5, 0.9, 1}
+	ColorText       = Color{0.92, 0.92, 0.92, 1}
+	ColorTextDimmed = Color{0.6, 0.6, 0.65, 1}
+)
+
+// Input is the state of the mouse in the coordinates of the UI.
+type Input struct {
+	MouseX, MouseY float64
+	// Down is true while the primary button is held.
+	Down bool
+	// AltDown is true while the secondary button is held.
+	AltDown bool
+	// Scroll is the vertical distance scrolled since the previous frame.
+	Scroll float64
+}
+
+// A Context holds the state of the UI between frames.
+type Context struct {
+	// Scale is the size of a pixel of the font.
+	Scale int
+	List  List
+
+	input, prevInput Input
+	// active is the ID of the widget that is being dragged.
+	active string
+	// hues holds the hue of color pickers, which can not be derived from the
+	// color if it is a shade of grey.
+	hues map[string]float64
+}
+
+// Begin starts a new frame.
+func (c *Context) Begin(in Input) {
+	if c.Scale < 1 {
+		c.Scale = 1
+	}
+	c.prevInput, c.input = c.input, in
+	c.List.Reset()
+	if !in.Down {
+		c.active = ""
+	}
+}
+
+// Input returns the input of the current frame.
+func (c *Context) Input() Input {
+	return c.input
+}
+
+// Active reports whether a widget is being dragged.
+func (c *Context) Active() bool {
+	return c.active != ""
+}
+
+func (c *Context) pressed(r Rect) bool {
+	return c.input.Down && !c.prevInput.Down && r.Contains(c.input.MouseX, c.input.MouseY)
+}
+
+func (c *Context) altPressed(r Rect) bool {
+	return c.input.AltDown && !c.prevInput.AltDown && r.Contains(c.input.MouseX, c.input.MouseY)
+}
+
+func (c *Context) hot(r Rect) bool {
+	return c.active == "" && r.Contains(c.input.MouseX, c.input.MouseY)
+}
+
+// drag returns the position of the mouse relative to the area of a widget
+// while it is being dragged, clamped to the range of 0 to 1.
+func (c *Context) drag(id string, r Rect) (x, y float64, ok bool) {
+	if c.pressed(r) {
+		c.active = id
+	}
+	if c.active != id {
+		return 0, 0, false
+	}
+	x = min(max((c.input.MouseX-r.X)/r.W, 0), 1)
+	y = min(max((c.input.MouseY-r.Y)/r.H, 0), 1)
+	return x, y, true
+}
+
+func (c *Context) background(r Rect) {
+	if c.hot(r) {
+		c.List.Rect(r, ColorWidgetHot)
+	} else {
+		c.List.Rect(r, ColorWidget)
+	}
+}
+
+// Label draws text that is vertically centered in the area.
+func (c *Context) Label(r Rect, text string, color Color) {
+	y := r.Y + (r.H-GlyphHeight*float64(c.Scale))/2
+	c.List.Text(r.X, math.Round(y), c.Scale, text, color)
+}
+
+// Button draws a button and reports whether it was clicked.
+func (c *Context) Button(r Rect, label string) bool {
+	c.background(r)
+	x := r.X + (r.W-TextWidth(c.Scale, label))/2
+	c.Label(Rect{X: math.Round(x), Y: r.Y, W: r.W, H: r.H}, label, ColorText)
+	return c.pressed(r)
+}
+
+// Toggle draws a checkbox and reports whether the value was changed.
+func (c *Context) Toggle(r Rect, label string, v *bool) bool {
+	c.background(r)
+	box := Rect{X: r.X, Y: r.Y, W: r.H, H: r.H}.Inset(float64(2 * c.Scale))
+	if *v {
+		c.List.Rect(box, ColorAccent)
+	} else {
+		c.List.Border(box, float64(c.Scale), ColorTextDimmed)
+	}
+	c.Label(Rect{X: r.X + r.H + float64(2*c.Scale), Y: r.Y, W: r.W, H: r.H}, label, ColorText)
+	if c.pressed(r) {
+		*v = !*v
+		return true
+	}
+	return false
+}
+
+// Slider draws a horizontal slider for a value within min and max and
+// reports whether the value was changed. If step is positive, the value is
+// rounded to a multiple of it. The label is drawn on top of the slider
+// followed by the value. Clicking the slider with the secondary button resets
+// the value to reset.
+func (c *Context) Slider(id string, r Rect, label string, v *float64, min, max, step, reset float64) bool {
+	c.background(r)
+	old := *v
+	if x, _, ok := c.drag(id, r); ok {
+		*v = min + x*(max-min)
+		if step > 0 {
+			*v = math.Round(*v/step) * step
+		}
+	} else if c.altPressed(r) {
+		*v = reset
+	}
+
+	fill := r
+	if max > min {
+		fill.W = r.W * math.Min(math.Max((*v-min)/(max-min), 0), 1)
+	}
+	c.List.Rect(fill, ColorAccent)
+	pad := float64(3 * c.Scale)
+	c.Label(Rect{X: r.X + pad, Y: r.Y, W: r.W, H: r.H}, fmt.Sprintf("%s  %s", label, FormatNumber(*v)), ColorText)
+	return *v != old
+}
+
+// ColorPicker draws a saturation/value square next to a hue bar and reports
+// whether the color was changed.
+func (c *Context) ColorPicker(id string, r Rect, rgb *[3]float64) bool {
+	if c.hues == nil {
+		c.hues = map[string]float64{}
+	}
+	h, s, v := RGBToHSV(rgb[0], rgb[1], rgb[2])
+	if s == 0 || v == 0 {
+		h = c.hues[id]
+	}
+
+	barWidth := float64(12 * c.Scale)
+	gap := float64(3 * c.Scale)
+	sv := Rect{X: r.X, Y: r.Y, W: r.W - barWidth - gap, H: r.H}
+	hue := Rect{X: sv.X + sv.W + gap, Y: r.Y, W: barWidth, H: r.H}
+
+	changed := false
+	if x, y, ok := c.drag(id+"/sv", sv); ok {
+		s, v = x, 1-y
+		changed = true
+	}
+	if _, y, ok := c.drag(id+"/hue", hue); ok {
+		h = math.Min(y, 0.9999)
+		changed = true
+	}
+	c.hues[id] = h
+
+	// The saturation/value square is bilinear in its corners, which is
+	// approximated by a grid because triangles are interpolated linearly.
+	const grid = 8
+	for i := 0; i < grid; i++ {
+		for j := 0; j < grid; j++ {
+			cell := Rect{
+				X: sv.X + sv.W*float64(i)/grid,
+				Y: sv.Y + sv.H*float64(j)/grid,
+				W: sv.W / grid,
+				H: sv.H / grid,
+			}
+			s0, s1 := float64(i)/grid, float64(i+1)/grid
+			v0, v1 := 1-float64(j)/grid, 1-float64(j+1)/grid
+			c.List.Gradient(cell, hsvColor(h, s0, v0), hsvColor(h, s1, v0), hsvColor(h, s0, v1), hsvColor(h, s1, v1))
+		}
+	}
+	const segments = 6
+	for i := 0; i < segments; i++ {
+		h0, h1 := float64(i)/segments, float64(i+1)/segments
+		seg := Rect{X: hue.X, Y: hue.Y + hue.H*h0, W: hue.W, H: hue.H / segments}
+		c.List.Gradient(seg, hsvColor(h0, 1, 1), hsvColor(h0, 1, 1), hsvColor(h1, 1, 1), hsvColor(h1, 1, 1))
+	}
+
+	// Markers for the current color.
+	m := float64(2 * c.Scale)
+	c.List.Border(Rect{X: sv.X + s*sv.W - m, Y: sv.Y + (1-v)*sv.H - m, W: 2 * m, H: 2 * m}, float64(c.Scale), ColorText)
+	c.List.Rect(Rect{X: hue.X - float64(c.Scale), Y: hue.Y + h*hue.H - float64(c.Scale), W: hue.W + float64(2*c.Scale), H: float64(2 * c.Scale)}, ColorText)
+
+	if changed {
+		rgb[0], rgb[1], rgb[2] = HSVToRGB(h, s, v)
+	}
+	return changed
+}
+
+func hsvColor(h, s, v float64) Color {
+	return RGB(HSVToRGB(h, s, v))
+}
+
+// HSVToRGB converts a color from hue, saturation and value to RGB. All
+// components range from 0 to 1.
+func HSVToRGB(h, s, v float64) (r, g, b float64) {
+	h = math.Mod(h, 1) * 6
+	i := math.Floor(h)
+	f := h - i
+	p, q, t := v*(1-s), v*(1-s*f), v*(1-s*(1-f))
+	switch int(i) {
+	case 0:
+		return v, t, p
+	case 1:
+		return q, v, p
+	case 2:
+		return p, v, t
+	case 3:
+		return p, q, v
+	case 4:
+		return t, p, v
+	default:
+		return v, p, q
+	}
+}
+
+// RGBToHSV converts a color from RGB to hue, saturation and value.
+func RGBToHSV(r, g, b float64) (h, s, v float64) {
+	v = math.Max(r, math.Max(g, b))
+	d := v - math.Min(r, math.Min(g, b))
+	if v > 0 {
+		s = d / v
+	}
+	if d == 0 {
+		return 0, s, v
+	}
+	switch v {
+	case r:
+		h = (g - b) / d
+		if h < 0 {
+			h += 6
+		}
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	return h / 6, s, v
+}
+
+// FormatNumber formats a number with at most 4 decimals without trailing
+// zeroes.
+func FormatNumber(v float64) string {
+	str := strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.4f", v), "0"), ".")
+	if str == "-0" {
+		return "0"
+	}
+	return str
+}
@@ -0,0 +1,113 @@
+package ui
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHSV(t *testing.T) {
+	for _, rgb := range [][3]float64{
+		{1, 0, 0},
+		{0, 1, 0},
+		{0, 0, 1},
+		{1, 0.5, 0.25},
+		{0.2, 0.4, 0.6},
+		{0.5, 0.5, 0.5},
+	} {
+		r, g, b := HSVToRGB(RGBToHSV(rgb[0], rgb[1], rgb[2]))
+		if math.Abs(r-rgb[0]) > 1e-9 || math.Abs(g-rgb[1]) > 1e-9 || math.Abs(b-rgb[2]) > 1e-9 {
+			t.Errorf("%v converted to %v", rgb, [3]float64{r, g, b})
+		}
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	for in, exp := range map[float64]string{
+		1:         "1",
+		0.5:       "0.5",
+		-2.25:     "-2.25",
+		1.0 / 3:   "0.3333",
+		-0.00001:  "0",
+		100.00004: "100",
+	} {
+		if out := FormatNumber(in); out != exp {
+			t.Errorf("%v: expected %q, got %q", in, exp, out)
+		}
+	}
+}
+
+func TestSlider(t *testing.T) {
+	var c Context
+	r := Rect{X: 10, Y: 10, W: 100, H: 10}
+	v := 0.0
+	frame := func(in Input) bool {
+		c.Begin(in)
+		return c.Slider("s", r, "value", &v, 0, 10, 0, 5)
+	}
+
+	if frame(Input{MouseX: 60, MouseY: 15}) || v != 0 {
+		t.Fatalf("hovering changed the value")
+	}
+	if !frame(Input{MouseX: 60, MouseY: 15, Down: true}) || v != 5 {
+		t.Fatalf("unexpected value after pressing: %v", v)
+	}
+	// Dragging continues outside of the slider and is clamped.
+	if !frame(Input{MouseX: 500, MouseY: 100, Down: true}) || v != 10 {
+		t.Fatalf("unexpected value after dragging: %v", v)
+	}
+	frame(Input{MouseX: 500, MouseY: 100})
+	// Pressing outside of the slider does nothing.
+	if frame(Input{MouseX: 0, MouseY: 0, Down: true}) || v != 10 {
+		t.Fatalf("unexpected value after pressing outside: %v", v)
+	}
+	frame(Input{})
+	if !frame(Input{MouseX: 20, MouseY: 15, AltDown: true}) || v != 5 {
+		t.Fatalf("unexpected value after resetting: %v", v)
+	}
+	if len(c.List.Vertices) == 0 {
+		t.Fatalf("nothing was drawn")
+	}
+}
+
+func TestToggle(t *testing.T) {
+	var c Context
+	r := Rect{W: 100, H: 10}
+	v := false
+	c.Begin(Input{MouseX: 5, MouseY: 5, Down: true})
+	if !c.Toggle(r, "on", &v) || !v {
+		t.Fatalf("toggle was not switched on")
+	}
+	// Holding the button does not toggle again.
+	c.Begin(Input{MouseX: 5, MouseY: 5, Down: true})
+	if c.Toggle(r, "on", &v) || !v {
+		t.Fatalf("toggle switched while held")
+	}
+}
+
+func TestColorPicker(t *testing.T) {
+	var c Context
+	r := Rect{W: 100, H: 100}
+	rgb := [3]float64{0, 0, 0}
+	c.Begin(Input{MouseX: 50, MouseY: 50, Down: true})
+	if !c.ColorPicker("c", r, &rgb) {
+		t.Fatalf("color was not changed")
+	}
+	// Drag beyond the top right of the saturation/value square, which is the
+	// fully saturated color of the hue.
+	c.Begin(Input{MouseX: 200, MouseY: -50, Down: true})
+	c.ColorPicker("c", r, &rgb)
+	if rgb != [3]float64{1, 0, 0} {
+		t.Fatalf("unexpected color: %v", rgb)
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	if w := TextWidth(2, "abc"); w != 3*GlyphWidth*2 {
+		t.Errorf("unexpected width: %v", w)
+	}
+	var l List
+	l.Text(0, 0, 1, "abé", ColorText)
+	if len(l.Vertices) != 3*6 {
+		t.Errorf("unexpected number of vertices: %d", len(l.Vertices))
+	}
+}
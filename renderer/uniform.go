@@ -2,6 +2,7 @@ package renderer
 
 import (
 	"fmt"
+	"math"
 	"strings"
 
 	"github.com/go-gl/gl/v3.3-core/gl"
@@ -273,3 +274,229 @@ func (u Uniform) TypeLiteral() string {
 func (u Uniform) String() string {
 	return fmt.Sprintf("uniform %s %s (%x)", u.TypeLiteral(), u.Name, u.Location)
 }
+
+// valueTypes are the scalar, vector and matrix types of which the value can be
+// set using Set.
+var valueTypes = []uint32{
+	gl.FLOAT, gl.FLOAT_VEC2, gl.FLOAT_VEC3, gl.FLOAT_VEC4,
+	gl.DOUBLE, gl.DOUBLE_VEC2, gl.DOUBLE_VEC3, gl.DOUBLE_VEC4,
+	gl.INT, gl.INT_VEC2, gl.INT_VEC3, gl.INT_VEC4,
+	gl.UNSIGNED_INT, gl.UNSIGNED_INT_VEC2, gl.UNSIGNED_INT_VEC3, gl.UNSIGNED_INT_VEC4,
+	gl.BOOL, gl.BOOL_VEC2, gl.BOOL_VEC3, gl.BOOL_VEC4,
+	gl.FLOAT_MAT2, gl.FLOAT_MAT3, gl.FLOAT_MAT4,
+	gl.FLOAT_MAT2x3, gl.FLOAT_MAT2x4, gl.FLOAT_MAT3x2,
+	gl.FLOAT_MAT3x4, gl.FLOAT_MAT4x2, gl.FLOAT_MAT4x3,
+	gl.DOUBLE_MAT2, gl.DOUBLE_MAT3, gl.DOUBLE_MAT4,
+	gl.DOUBLE_MAT2x3, gl.DOUBLE_MAT2x4, gl.DOUBLE_MAT3x2,
+	gl.DOUBLE_MAT3x4, gl.DOUBLE_MAT4x2, gl.DOUBLE_MAT4x3,
+}
+
+// ParseTypeLiteral returns the type of a GLSL scalar, vector or matrix type
+// literal like "vec3". The matNxN and uint literals are also accepted.
+func ParseTypeLiteral(literal string) (uint32, bool) {
+	switch literal {
+	case "uint":
+		literal = "unsigned int"
+	case "mat2x2", "mat3x3", "mat4x4", "dmat2x2", "dmat3x3", "dmat4x4":
+		literal = literal[:len(literal)-2]
+	}
+	for _, typ := range valueTypes {
+		if (Uniform{Type: typ}).TypeLiteral() == literal {
+			return typ, true
+		}
+	}
+	return 0, false
+}
+
+// Components returns the number of scalar values that make up a value of the
+// uniform's type. It returns 0 for types that can not be set using Set, like
+// samplers.
+func (u Uniform) Components() int {
+	switch u.Type {
+	case gl.FLOAT, gl.DOUBLE, gl.INT, gl.UNSIGNED_INT, gl.BOOL:
+		return 1
+	case gl.FLOAT_VEC2, gl.DOUBLE_VEC2, gl.INT_VEC2, gl.UNSIGNED_INT_VEC2, gl.BOOL_VEC2:
+		return 2
+	case gl.FLOAT_VEC3, gl.DOUBLE_VEC3, gl.INT_VEC3, gl.UNSIGNED_INT_VEC3, gl.BOOL_VEC3:
+		return 3
+	case gl.FLOAT_VEC4, gl.DOUBLE_VEC4, gl.INT_VEC4, gl.UNSIGNED_INT_VEC4, gl.BOOL_VEC4,
+		gl.FLOAT_MAT2, gl.DOUBLE_MAT2:
+		return 4
+	case gl.FLOAT_MAT2x3, gl.FLOAT_MAT3x2, gl.DOUBLE_MAT2x3, gl.DOUBLE_MAT3x2:
+		return 6
+	case gl.FLOAT_MAT2x4, gl.FLOAT_MAT4x2, gl.DOUBLE_MAT2x4, gl.DOUBLE_MAT4x2:
+		return 8
+	case gl.FLOAT_MAT3, gl.DOUBLE_MAT3:
+		return 9
+	case gl.FLOAT_MAT3x4, gl.FLOAT_MAT4x3, gl.DOUBLE_MAT3x4, gl.DOUBLE_MAT4x3:
+		return 12
+	case gl.FLOAT_MAT4, gl.DOUBLE_MAT4:
+		return 16
+	}
+	return 0
+}
+
+// MatrixSize returns the number of columns and rows of matrix types. It
+// returns 0, 0 for other types.
+func (u Uniform) MatrixSize() (columns, rows int) {
+	lit := strings.TrimPrefix(u.TypeLiteral(), "d")
+	if !strings.HasPrefix(lit, "mat") {
+		return 0, 0
+	}
+	if len(lit) == len("mat2") {
+		n := int(lit[3] - '0')
+		return n, n
+	}
+	return int(lit[3] - '0'), int(lit[5] - '0')
+}
+
+// IsBool reports whether the type is a boolean scalar or vector.
+func (u Uniform) IsBool() bool {
+	return u.Type == gl.BOOL || u.Type == gl.BOOL_VEC2 || u.Type == gl.BOOL_VEC3 || u.Type == gl.BOOL_VEC4
+}
+
+// IsDouble reports whether the type is a double precision scalar, vector or
+// matrix.
+func (u Uniform) IsDouble() bool {
+	return strings.HasPrefix(u.TypeLiteral(), "d")
+}
+
+// IsInteger reports whether the type is a signed or unsigned integer scalar
+// or vector.
+func (u Uniform) IsInteger() bool {
+	switch u.Type {
+	case gl.INT, gl.INT_VEC2, gl.INT_VEC3, gl.INT_VEC4,
+		gl.UNSIGNED_INT, gl.UNSIGNED_INT_VEC2, gl.UNSIGNED_INT_VEC3, gl.UNSIGNED_INT_VEC4:
+		return true
+	}
+	return false
+}
+
+// Set sets the value of the uniform in the program that is currently in use.
+// The number of values must be equal to the number of components of the type.
+// Matrices are specified in column-major order. Values of integer types are
+// rounded and booleans are true if the value is not 0.
+func (u Uniform) Set(values ...float64) error {
+	if n := u.Components(); n == 0 || len(values) != n {
+		return fmt.Errorf("can not set %v to %d values", u, len(values))
+	}
+	f := make([]float32, len(values))
+	i := make([]int32, len(values))
+	ui := make([]uint32, len(values))
+	for j, v := range values {
+		f[j] = float32(v)
+		i[j] = int32(math.Round(v))
+		ui[j] = uint32(max(math.Round(v), 0))
+		if u.IsBool() {
+			i[j] = 0
+			if v != 0 {
+				i[j] = 1
+			}
+		}
+	}
+	d := &values[0]
+	switch u.Type {
+	case gl.FLOAT:
+		gl.Uniform1fv(u.Location, 1, &f[0])
+	case gl.FLOAT_VEC2:
+		gl.Uniform2fv(u.Location, 1, &f[0])
+	case gl.FLOAT_VEC3:
+		gl.Uniform3fv(u.Location, 1, &f[0])
+	case gl.FLOAT_VEC4:
+		gl.Uniform4fv(u.Location, 1, &f[0])
+	case gl.DOUBLE:
+		gl.Uniform1dv(u.Location, 1, d)
+	case gl.DOUBLE_VEC2:
+		gl.Uniform2dv(u.Location, 1, d)
+	case gl.DOUBLE_VEC3:
+		gl.Uniform3dv(u.Location, 1, d)
+	case gl.DOUBLE_VEC4:
+		gl.Uniform4dv(u.Location, 1, d)
+	case gl.INT, gl.BOOL:
+		gl.Uniform1iv(u.Location, 1, &i[0])
+	case gl.INT_VEC2, gl.BOOL_VEC2:
+		gl.Uniform2iv(u.Location, 1, &i[0])
+	case gl.INT_VEC3, gl.BOOL_VEC3:
+		gl.Uniform3iv(u.Location, 1, &i[0])
+	case gl.INT_VEC4, gl.BOOL_VEC4:
+		gl.Uniform4iv(u.Location, 1, &i[0])
+	case gl.UNSIGNED_INT:
+		gl.Uniform1uiv(u.Location, 1, &ui[0])
+	case gl.UNSIGNED_INT_VEC2:
+		gl.Uniform2uiv(u.Location, 1, &ui[0])
+	case gl.UNSIGNED_INT_VEC3:
+		gl.Uniform3uiv(u.Location, 1, &ui[0])
+	case gl.UNSIGNED_INT_VEC4:
+		gl.Uniform4uiv(u.Location, 1, &ui[0])
+	case gl.FLOAT_MAT2:
+		gl.UniformMatrix2fv(u.Location, 1, false, &f[0])
+	case gl.FLOAT_MAT3:
+		gl.UniformMatrix3fv(u.Location, 1, false, &f[0])
+	case gl.FLOAT_MAT4:
+		gl.UniformMatrix4fv(u.Location, 1, false, &f[0])
+	case gl.FLOAT_MAT2x3:
+		gl.UniformMatrix2x3fv(u.Location, 1, false, &f[0])
+	case gl.FLOAT_MAT2x4:
+		gl.UniformMatrix2x4fv(u.Location, 1, false, &f[0])
+	case gl.FLOAT_MAT3x2:
+		gl.UniformMatrix3x2fv(u.Location, 1, false, &f[0])
+	case gl.FLOAT_MAT3x4:
+		gl.UniformMatrix3x4fv(u.Location, 1, false, &f[0])
+	case gl.FLOAT_MAT4x2:
+		gl.UniformMatrix4x2fv(u.Location, 1, false, &f[0])
+	case gl.FLOAT_MAT4x3:
+		gl.UniformMatrix4x3fv(u.Location, 1, false, &f[0])
+	case gl.DOUBLE_MAT2:
+		gl.UniformMatrix2dv(u.Location, 1, false, d)
+	case gl.DOUBLE_MAT3:
+		gl.UniformMatrix3dv(u.Location, 1, false, d)
+	case gl.DOUBLE_MAT4:
+		gl.UniformMatrix4dv(u.Location, 1, false, d)
+	case gl.DOUBLE_MAT2x3:
+		gl.UniformMatrix2x3dv(u.Location, 1, false, d)
+	case gl.DOUBLE_MAT2x4:
+		gl.UniformMatrix2x4dv(u.Location, 1, false, d)
+	case gl.DOUBLE_MAT3x2:
+		gl.UniformMatrix3x2dv(u.Location, 1, false, d)
+	case gl.DOUBLE_MAT3x4:
+		gl.UniformMatrix3x4dv(u.Location, 1, false, d)
+	case gl.DOUBLE_MAT4x2:
+		gl.UniformMatrix4x2dv(u.Location, 1, false, d)
+	case gl.DOUBLE_MAT4x3:
+		gl.UniformMatrix4x3dv(u.Location, 1, false, d)
+	}
+	return nil
+}
+
+// Get returns the value of the uniform in a program in the same layout as
+// accepted by Set.
+func (u Uniform) Get(program uint32) []float64 {
+	n := u.Components()
+	if n == 0 {
+		return nil
+	}
+	values := make([]float64, n)
+	switch {
+	case u.IsBool(), u.Type == gl.INT, u.Type == gl.INT_VEC2, u.Type == gl.INT_VEC3, u.Type == gl.INT_VEC4:
+		buf := make([]int32, n)
+		gl.GetUniformiv(program, u.Location, &buf[0])
+		for i, v := range buf {
+			values[i] = float64(v)
+		}
+	case u.IsInteger():
+		buf := make([]uint32, n)
+		gl.GetUniformuiv(program, u.Location, &buf[0])
+		for i, v := range buf {
+			values[i] = float64(v)
+		}
+	case u.IsDouble():
+		gl.GetUniformdv(program, u.Location, &values[0])
+	default:
+		buf := make([]float32, n)
+		gl.GetUniformfv(program, u.Location, &buf[0])
+		for i, v := range buf {
+			values[i] = float64(v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,242 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+	"sort"
+
+	"github.com/mjibson/go-dsp/fft"
+)
+
+const (
+	// analysisWindow is the number of samples in the window that is analysed
+	// at once.
+	analysisWindow = 1024
+	// analysisHop is the number of samples between the start of two analysis
+	// windows.
+	analysisHop = 512
+
+	// pulseDecay is the time constant in seconds of the decay of the beat and
+	// onset pulses.
+	pulseDecay = 0.1
+	// thresholdHistory is the duration in seconds of the history of the onset
+	// detection functions that is used to compute the adaptive thresholds.
+	thresholdHistory = 1.0
+	// thresholdDeviations is the number of standard deviations the onset
+	// detection functions need to rise above their mean to be detected.
+	thresholdDeviations = 1.5
+
+	minOnsetInterval = 0.05
+	minBeatInterval  = 0.3
+	// numBeatIntervals is the number of recent beats that is used to
+	// estimate the tempo.
+	numBeatIntervals = 8
+
+	// The crossover frequencies of the low, mid and high energy bands.
+	lowMidCrossover  = 250.0
+	midHighCrossover = 4000.0
+
+	// loudnessFloor is the loudness in dBFS that is mapped to 0.
+	loudnessFloor = -60.0
+)
+
+// features describes the musical structure of the most recently analysed
+// audio.
+type features struct {
+	// Beat is 1 at the moment a beat is detected and decays to 0.
+	Beat float64
+	// BPM is the estimated tempo in beats per minute. It is 0 until enough
+	// beats have been detected.
+	BPM float64
+	// Onset is 1 at the moment any note onset is detected and decays to 0.
+	Onset float64
+	// Energy holds the RMS level of the low, mid and high frequency bands.
+	Energy [3]float64
+	// Loudness is the RMS level of the signal, mapped from [-60, 0] dBFS to
+	// [0, 1].
+	Loudness float64
+}
+
+// analyzer extracts features from a stream of audio.
+//
+// Analysis is performed in windows at fixed intervals of sample time, so the
+// results only depend on the samples and not on how they are read.
+type analyzer struct {
+	sampleRate int
+
+	pending  []float64
+	window   []float64
+	numHops  int64
+	prevMag  []float64
+	prevLow  float64
+	features features
+
+	fluxHistory    []float64
+	lowFluxHistory []float64
+	lastOnset      float64
+	lastBeat       float64
+	beats          []float64
+}
+
+func newAnalyzer(sampleRate int) *analyzer {
+	window := make([]float64, analysisWindow)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(analysisWindow-1))
+	}
+	return &analyzer{
+		sampleRate: sampleRate,
+		window:     window,
+		lastOnset:  math.Inf(-1),
+		lastBeat:   math.Inf(-1),
+	}
+}
+
+// Process analyses the specified samples following those passed in previous
+// calls and returns the features at the end of the audio analysed so far.
+func (a *analyzer) Process(samples []float64) features {
+	a.pending = append(a.pending, samples...)
+	for len(a.pending) >= analysisWindow {
+		a.analyse(a.pending[:analysisWindow])
+		a.pending = a.pending[analysisHop:]
+	}
+	// Copy the remaining samples to the start of the buffer to prevent it
+	// from growing indefinitely.
+	a.pending = append(a.pending[:0:0], a.pending...)
+
+	now := a.time()
+	f := a.features
+	f.Beat = math.Exp(-(now - a.lastBeat) / pulseDecay)
+	f.Onset = math.Exp(-(now - a.lastOnset) / pulseDecay)
+	return f
+}
+
+// time returns the time in seconds at the end of the last analysed window.
+func (a *analyzer) time() float64 {
+	if a.numHops == 0 {
+		return 0
+	}
+	return float64((a.numHops-1)*analysisHop+analysisWindow) / float64(a.sampleRate)
+}
+
+func (a *analyzer) analyse(samples []float64) {
+	a.numHops++
+	now := a.time()
+
+	windowed := make([]float64, len(samples))
+	sumSquares, windowPower := 0.0, 0.0
+	for i, s := range samples {
+		windowed[i] = s * a.window[i]
+		sumSquares += s * s
+		windowPower += a.window[i] * a.window[i]
+	}
+	rms := math.Sqrt(sumSquares / float64(len(samples)))
+	a.features.Loudness = clamp01((20*math.Log10(rms) - loudnessFloor) / -loudnessFloor)
+
+	spectrum := fft.FFTReal(windowed)
+	mag := make([]float64, len(spectrum)/2+1)
+	var bandPower [3]float64
+	binWidth := float64(a.sampleRate) / float64(len(samples))
+	for k := range mag {
+		mag[k] = cmplx.Abs(spectrum[k])
+		switch freq := float64(k) * binWidth; {
+		case freq < lowMidCrossover:
+			bandPower[0] += mag[k] * mag[k]
+		case freq < midHighCrossover:
+			bandPower[1] += mag[k] * mag[k]
+		default:
+			bandPower[2] += mag[k] * mag[k]
+		}
+	}
+	for i, p := range bandPower {
+		a.features.Energy[i] = math.Sqrt(2 * p / (float64(len(samples)) * windowPower))
+	}
+
+	// Onsets are detected using the spectral flux, which is the increase in
+	// magnitude over all frequencies. Beats are detected by the increase of
+	// energy in the low frequencies, where kick drums reside.
+	flux := 0.0
+	if a.prevMag != nil {
+		for k := range mag {
+			flux += math.Max(0, mag[k]-a.prevMag[k])
+		}
+	}
+	a.prevMag = mag
+	lowFlux := math.Max(0, a.features.Energy[0]-a.prevLow)
+	a.prevLow = a.features.Energy[0]
+
+	historyLen := int(thresholdHistory * float64(a.sampleRate) / analysisHop)
+	if a.isPeak(flux, &a.fluxHistory, historyLen) && now-a.lastOnset >= minOnsetInterval {
+		a.lastOnset = now
+	}
+	if a.isPeak(lowFlux, &a.lowFluxHistory, historyLen) && now-a.lastBeat >= minBeatInterval {
+		a.lastBeat = now
+		a.beats = append(a.beats, now)
+		if len(a.beats) > numBeatIntervals+1 {
+			a.beats = a.beats[1:]
+		}
+		a.features.BPM = estimateTempo(a.beats)
+	}
+}
+
+// isPeak adds the value to the history and reports whether it exceeds the
+// adaptive threshold computed from the previous values in the history.
+func (a *analyzer) isPeak(value float64, history *[]float64, historyLen int) bool {
+	h := *history
+	mean, variance := 0.0, 0.0
+	for _, v := range h {
+		mean += v
+	}
+	if len(h) > 0 {
+		mean /= float64(len(h))
+	}
+	for _, v := range h {
+		variance += (v - mean) * (v - mean)
+	}
+	if len(h) > 0 {
+		variance /= float64(len(h))
+	}
+	threshold := mean + thresholdDeviations*math.Sqrt(variance)
+
+	h = append(h, value)
+	if len(h) > historyLen {
+		h = h[1:]
+	}
+	*history = h
+	return len(h) > 1 && value > threshold && value > 1e-3
+}
+
+// estimateTempo computes the tempo from the intervals between the specified
+// beat times. Intervals that deviate too much from the median, e.g. because of
+// missed beats, are ignored. The remaining intervals are averaged, which
+// cancels out most of the quantization to analysis hops. The tempo is folded
+// into the range of [60, 180) BPM.
+func estimateTempo(beats []float64) float64 {
+	if len(beats) < 3 {
+		return 0
+	}
+	intervals := make([]float64, len(beats)-1)
+	for i := range intervals {
+		intervals[i] = beats[i+1] - beats[i]
+	}
+	sort.Float64s(intervals)
+	median := intervals[len(intervals)/2]
+	sum, n := 0.0, 0
+	for _, iv := range intervals {
+		if math.Abs(iv-median) <= median/4 {
+			sum += iv
+			n++
+		}
+	}
+	bpm := 60 / (sum / float64(n))
+	for bpm < 60 {
+		bpm *= 2
+	}
+	for bpm >= 180 {
+		bpm /= 2
+	}
+	return bpm
+}
+
+func clamp01(f float64) float64 {
+	return math.Max(0, math.Min(1, f))
+}
@@ -0,0 +1,85 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// kickTrack synthesizes a track with a decaying 60Hz kick at the specified
+// tempo.
+func kickTrack(sampleRate int, bpm, seconds float64) []float64 {
+	samples := make([]float64, int(float64(sampleRate)*seconds))
+	period := 60 / bpm
+	for i := range samples {
+		t := float64(i) / float64(sampleRate)
+		sinceKick := math.Mod(t, period)
+		samples[i] = math.Sin(2*math.Pi*60*sinceKick) * math.Exp(-sinceKick*20) * 0.8
+	}
+	return samples
+}
+
+func TestAnalyzerTempo(t *testing.T) {
+	const sampleRate = 22000
+	for _, bpm := range []float64{90, 120, 140} {
+		samples := kickTrack(sampleRate, bpm, 10)
+		a := newAnalyzer(sampleRate)
+
+		// Feed the samples at 60 frames per second and count the rising edges
+		// of the beat pulse.
+		numBeats := 0
+		prevBeat := 0.0
+		var f features
+		for i := 0; i < len(samples); i += sampleRate / 60 {
+			f = a.Process(samples[i:min(i+sampleRate/60, len(samples))])
+			if f.Beat > prevBeat {
+				numBeats++
+			}
+			prevBeat = f.Beat
+		}
+
+		if math.Abs(f.BPM-bpm) > 2 {
+			t.Errorf("unexpected tempo: exp %v, got %v", bpm, f.BPM)
+		}
+		if exp := int(bpm / 6); numBeats < exp-1 || numBeats > exp+1 {
+			t.Errorf("unexpected number of beats at %v BPM: exp %v, got %v", bpm, exp, numBeats)
+		}
+	}
+}
+
+func TestAnalyzerDeterministic(t *testing.T) {
+	const sampleRate = 22000
+	samples := kickTrack(sampleRate, 128, 4)
+
+	// The features should not depend on how the samples are chunked.
+	a1, a2 := newAnalyzer(sampleRate), newAnalyzer(sampleRate)
+	f1 := a1.Process(samples)
+	var f2 features
+	for i := 0; i < len(samples); i += 733 {
+		f2 = a2.Process(samples[i:min(i+733, len(samples))])
+	}
+	if f1 != f2 {
+		t.Fatalf("features differ:\n%+v\n%+v", f1, f2)
+	}
+}
+
+func TestAnalyzerEnergyBands(t *testing.T) {
+	const sampleRate = 22000
+	tones := map[int]float64{0: 100, 1: 1000, 2: 8000}
+	for band, freq := range tones {
+		samples := make([]float64, sampleRate)
+		for i := range samples {
+			samples[i] = math.Sin(2 * math.Pi * freq * float64(i) / sampleRate)
+		}
+		f := newAnalyzer(sampleRate).Process(samples)
+		for i, e := range f.Energy {
+			if i == band && math.Abs(e-math.Sqrt2/2) > 0.05 {
+				t.Errorf("unexpected energy in band %d for a %vHz tone: exp %v, got %v", i, freq, math.Sqrt2/2, e)
+			} else if i != band && e > 0.05 {
+				t.Errorf("unexpected energy in band %d for a %vHz tone: %v", i, freq, e)
+			}
+		}
+		if f.Loudness < 0.9 {
+			t.Errorf("unexpected loudness for a full scale tone: %v", f.Loudness)
+		}
+	}
+}
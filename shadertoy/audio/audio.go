@@ -2,7 +2,7 @@ package audio
 
 import (
 	"fmt"
-	"os"
+	"io/fs"
 	"regexp"
 	"strconv"
 	"time"
@@ -15,14 +15,24 @@ import (
 )
 
 func init() {
-	shadertoy.RegisterResourceType("audio", func(m shadertoy.Mapping, genTexID shadertoy.GenTexFunc, _ renderer.RenderState) (shadertoy.Resource, error) {
-		source, err := parseMappingValue(m.PWD, m.Value)
+	shadertoy.RegisterResourceType("audio", func(m shadertoy.Mapping, genTexID shadertoy.GenTexFunc, state renderer.RenderState) (shadertoy.Resource, error) {
+		source, err := parseMappingValue(state.FS, m.PWD, m.Value)
 		if err != nil {
 			return nil, err
 		}
-		r := newAudioTexture(m.Name, source, genTexID())
+		var player *Player
+		if newSink != nil {
+			if player, err = newPlayer(source, state.Time); err != nil {
+				return nil, err
+			}
+		}
+		r := newAudioTexture(m.Name, source, player, genTexID())
 		return r, nil
 	})
+	shadertoy.RegisterDeclareFunc("audio", func(m shadertoy.Mapping, _ renderer.RenderState) (string, error) {
+		return UniformSource(m.Name), nil
+	})
+	shadertoy.RegisterRelocateFunc("audio", shadertoy.RelocateLeadingPath)
 }
 
 const (
@@ -35,9 +45,23 @@ var (
 	pcmValueRe     = regexp.MustCompile(`^([^;]+);(\d+):(\d+):([su]\d{1,2}[lb]e)$`)
 )
 
-func parseMappingValue(pwd, value string) (*source, error) {
+func parseMappingValue(fsys fs.FS, pwd, value string) (*source, error) {
 	if match := genericValueRe.FindStringSubmatch(value); match != nil {
-		return newAudioFileSource(match[1])
+		filename, err := shadertoy.ResolvePath(pwd, match[1])
+		if err != nil {
+			return nil, err
+		}
+		local, release, err := renderer.LocalPath(fsys, filename)
+		if err != nil {
+			return nil, err
+		}
+		src, err := newAudioFileSource(local, 0, false)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		src.release = release
+		return src, nil
 	}
 
 	match := pcmValueRe.FindStringSubmatch(value)
@@ -61,7 +85,7 @@ func parseMappingValue(pwd, value string) (*source, error) {
 		return nil, fmt.Errorf("the number of PCM sample bits must be a multiple of 8, format: %q", format)
 	}
 
-	fd, err := os.Open(filename)
+	fd, err := renderer.OpenFile(fsys, filename)
 	if err != nil {
 		return nil, fmt.Errorf("could not open audio source: %w", err)
 	}
@@ -73,22 +97,29 @@ func parseMappingValue(pwd, value string) (*source, error) {
 	}, nil
 }
 
-// texture is a mapping of an audio stream.
+// texture holds the FFT and waveform of audio along with the uniforms that
+// describe its musical structure.
 type texture struct {
 	uniformName string
 	id          uint32
 	index       uint32
-	source      *source
+	sampleRate  int
+	// read returns the samples that were played since the previous frame.
+	read func(renderer.RenderState) []float64
+	// analyzer extracts the musical features that are exposed as uniforms.
+	analyzer *analyzer
 
 	prevPeriod     []float64
 	stabilizedWave []float64
 }
 
-func newAudioTexture(uniformName string, source *source, texIndex uint32) *texture {
+func newTexture(uniformName string, sampleRate int, read func(renderer.RenderState) []float64, texIndex uint32) *texture {
 	at := &texture{
 		uniformName:    uniformName,
 		index:          texIndex,
-		source:         source,
+		sampleRate:     sampleRate,
+		read:           read,
+		analyzer:       newAnalyzer(sampleRate),
 		prevPeriod:     make([]float64, texWidth),
 		stabilizedWave: make([]float64, texWidth),
 	}
@@ -115,18 +146,32 @@ func newAudioTexture(uniformName string, source *source, texIndex uint32) *textu
 }
 
 func (at *texture) UniformSource() string {
+	return UniformSource(at.uniformName)
+}
+
+// UniformSource returns the declarations of the uniforms of an audio texture.
+func UniformSource(uniformName string) string {
 	return fmt.Sprintf(`
 		uniform sampler2D %s;
 		uniform vec3 %sSize;
 		uniform float %sCurTime;
-	`, at.uniformName, at.uniformName, at.uniformName)
+		uniform float %sBeat;
+		uniform float %sBPM;
+		uniform float %sOnset;
+		uniform vec3 %sEnergy;
+		uniform float %sLoudness;
+	`, uniformName, uniformName, uniformName,
+		uniformName, uniformName, uniformName, uniformName, uniformName)
 }
 
 func (at *texture) PreRender(state renderer.RenderState) {
-	newPeriod := at.source.ReadSamples(state.Interval)
+	newPeriod := at.read(state)
 	prevPeriod := at.prevPeriod[len(at.prevPeriod)-texWidth:]
 	at.prevPeriod = append(at.prevPeriod, newPeriod...)[len(newPeriod):]
 	period := at.prevPeriod[len(at.prevPeriod)-texWidth:]
+	// The analysis must see all samples, regardless of whether the texture is
+	// used, to keep its results deterministic.
+	features := at.analyzer.Process(newPeriod)
 
 	if loc, ok := state.Uniforms[at.uniformName]; ok {
 		textureData := make([]uint8, texWidth*texHeight*3)
@@ -202,17 +247,72 @@ func (at *texture) PreRender(state renderer.RenderState) {
 	if loc, ok := state.Uniforms[fmt.Sprintf("%sCurTime", at.uniformName)]; ok {
 		gl.Uniform1f(loc.Location, float32(state.Time)/float32(time.Second))
 	}
+	if loc, ok := state.Uniforms[fmt.Sprintf("%sBeat", at.uniformName)]; ok {
+		gl.Uniform1f(loc.Location, float32(features.Beat))
+	}
+	if loc, ok := state.Uniforms[fmt.Sprintf("%sBPM", at.uniformName)]; ok {
+		gl.Uniform1f(loc.Location, float32(features.BPM))
+	}
+	if loc, ok := state.Uniforms[fmt.Sprintf("%sOnset", at.uniformName)]; ok {
+		gl.Uniform1f(loc.Location, float32(features.Onset))
+	}
+	if loc, ok := state.Uniforms[fmt.Sprintf("%sEnergy", at.uniformName)]; ok {
+		e := features.Energy
+		gl.Uniform3f(loc.Location, float32(e[0]), float32(e[1]), float32(e[2]))
+	}
+	if loc, ok := state.Uniforms[fmt.Sprintf("%sLoudness", at.uniformName)]; ok {
+		gl.Uniform1f(loc.Location, float32(features.Loudness))
+	}
 	if loc, ok := state.Uniforms["iSampleRate"]; ok {
-		gl.Uniform1f(loc.Location, float32(at.source.SampleRate))
+		gl.Uniform1f(loc.Location, float32(at.sampleRate))
 	}
 }
 
 func (at *texture) Close() error {
-	at.source.Close()
 	gl.DeleteTextures(1, &at.id)
 	return nil
 }
 
+// streamTexture is a mapping of an audio stream.
+type streamTexture struct {
+	*texture
+	source *source
+	// player is set if the audio is being played back. The samples are then
+	// read from the player instead of the source.
+	player *Player
+}
+
+func newAudioTexture(uniformName string, source *source, player *Player, texIndex uint32) *streamTexture {
+	st := &streamTexture{source: source, player: player}
+	st.texture = newTexture(uniformName, source.SampleRate, st.readPeriod, texIndex)
+	return st
+}
+
+func (st *streamTexture) readPeriod(state renderer.RenderState) []float64 {
+	if st.player != nil {
+		return st.player.ReadPlayed()
+	}
+	return st.source.ReadSamples(state.Interval)
+}
+
+// Time implements the renderer.Clock interface if the audio is being played
+// back.
+func (st *streamTexture) Time() (time.Duration, bool) {
+	if st.player == nil {
+		return 0, false
+	}
+	return st.player.Time()
+}
+
+func (st *streamTexture) Close() error {
+	if st.player != nil {
+		st.player.Close()
+	} else {
+		st.source.Close()
+	}
+	return st.texture.Close()
+}
+
 func correlate(a, b []float64) float64 {
 	if len(a) != len(b) {
 		panic("mismatched slice lengths")
@@ -0,0 +1,304 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// playbackChunk is the number of samples that is handed to a sink at once.
+// Smaller chunks improve the accuracy of the playback clock.
+const playbackChunk = 256
+
+var newSink func(sampleRate int) (Sink, error)
+
+// EnablePlayback causes the sound of audio and video mappings to be played
+// through sinks created by the specified function.
+//
+// While playback is enabled, the audio textures are filled with the samples
+// that were most recently played and the playback position drives the
+// animation time.
+func EnablePlayback(fn func(sampleRate int) (Sink, error)) {
+	newSink = fn
+}
+
+// PlaybackEnabled reports whether EnablePlayback has been called.
+func PlaybackEnabled() bool {
+	return newSink != nil
+}
+
+// A Sink consumes audio for playback.
+type Sink interface {
+	io.Closer
+
+	// Write queues mono samples in the range of [-1, 1] for playback. It may
+	// block until the device is ready to accept more audio.
+	Write(samples []float64) error
+
+	// Position returns how much of the written audio has been played back.
+	Position() time.Duration
+}
+
+// NullSink discards all audio written to it.
+//
+// It does not pace the writer, its position is the duration of all audio
+// written so far. This makes it useful in tests.
+type NullSink struct {
+	SampleRate int
+
+	lock    sync.Mutex
+	written int64
+}
+
+// Write implements the Sink interface.
+func (s *NullSink) Write(samples []float64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.written += int64(len(samples))
+	return nil
+}
+
+// Position implements the Sink interface.
+func (s *NullSink) Position() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return samplesToDuration(s.written, s.SampleRate)
+}
+
+// Close implements the Sink interface.
+func (s *NullSink) Close() error { return nil }
+
+// deviceSink plays audio on the default sound card using aplay from
+// alsa-utils.
+type deviceSink struct {
+	sampleRate int
+	cmd        *exec.Cmd
+	stdin      io.WriteCloser
+
+	lock    sync.Mutex
+	written int64
+	start   time.Time
+}
+
+// NewDeviceSink creates a sink that plays audio on the default sound card.
+func NewDeviceSink(sampleRate int) (Sink, error) {
+	cmd := exec.Command(
+		"aplay", "-q",
+		"-t", "raw",
+		"-f", "S16_LE",
+		"-c", "1",
+		"-r", strconv.Itoa(sampleRate),
+		"-",
+	)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("could not open audio device: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not open audio device: %w", err)
+	}
+	return &deviceSink{
+		sampleRate: sampleRate,
+		cmd:        cmd,
+		stdin:      stdin,
+	}, nil
+}
+
+func (s *deviceSink) Write(samples []float64) error {
+	buf := make([]byte, len(samples)*2)
+	for i, f := range samples {
+		if f < -1 {
+			f = -1
+		} else if f > 1 {
+			f = 1
+		}
+		v := int16(f * 0x7fff)
+		buf[i*2] = byte(v)
+		buf[i*2+1] = byte(v >> 8)
+	}
+
+	s.lock.Lock()
+	now := time.Now()
+	if s.start.IsZero() {
+		s.start = now
+	} else if w := samplesToDuration(s.written, s.sampleRate); now.Sub(s.start) > w {
+		// The device ran out of audio to play, shift the start of the
+		// playback so the stall is not counted as time played.
+		s.start = now.Add(-w)
+	}
+	s.written += int64(len(samples))
+	s.lock.Unlock()
+
+	_, err := s.stdin.Write(buf)
+	return err
+}
+
+// Position implements the Sink interface.
+//
+// aplay does not report its playback position, so it is estimated from the
+// time elapsed since the first samples were written, bounded by the amount of
+// audio that was written.
+func (s *deviceSink) Position() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.start.IsZero() {
+		return 0
+	}
+	elapsed := time.Since(s.start)
+	if w := samplesToDuration(s.written, s.sampleRate); elapsed > w {
+		return w
+	}
+	return elapsed
+}
+
+func (s *deviceSink) Close() error {
+	s.stdin.Close()
+	return s.cmd.Wait()
+}
+
+// A Player continuously reads audio from a source and writes it to a sink.
+//
+// The playback position of the sink can be used as a clock to synchronize the
+// animation with what is heard.
+type Player struct {
+	source *source
+	sink   Sink
+	// offset is the animation time at which playback started.
+	offset time.Duration
+
+	lock sync.Mutex
+	// history contains the most recently written samples, the last of which
+	// has index written-1.
+	history []float64
+	written int64
+	// readPos is the index of the sample up to which ReadPlayed has returned
+	// samples.
+	readPos int64
+	ended   bool
+
+	closed, loopClosed chan struct{}
+}
+
+// PlayFile creates a player for the sound of the specified media file in the
+// filesystem of the OS. If playback is not enabled, nil is returned.
+//
+// Playback starts at the seek offset into the file. The clock of the player
+// starts at the specified animation time. If loop is set, the sound is
+// repeated indefinitely.
+func PlayFile(filename string, start, seek time.Duration, loop bool) (*Player, error) {
+	if newSink == nil {
+		return nil, nil
+	}
+	src, err := newAudioFileSource(filename, seek, loop)
+	if err != nil {
+		return nil, err
+	}
+	return newPlayer(src, start)
+}
+
+// newPlayer starts playback of the specified source through a sink created by
+// the function set with EnablePlayback.
+func newPlayer(src *source, offset time.Duration) (*Player, error) {
+	sink, err := newSink(src.SampleRate)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	return startPlayer(src, sink, offset), nil
+}
+
+func startPlayer(src *source, sink Sink, offset time.Duration) *Player {
+	p := &Player{
+		source:     src,
+		sink:       sink,
+		offset:     offset,
+		history:    make([]float64, src.SampleRate*2),
+		closed:     make(chan struct{}),
+		loopClosed: make(chan struct{}),
+	}
+	go p.loop()
+	return p
+}
+
+func (p *Player) loop() {
+	defer close(p.loopClosed)
+	for {
+		select {
+		case <-p.closed:
+			return
+		default:
+		}
+
+		samples, err := p.source.readSamples(playbackChunk)
+		if err != nil {
+			p.lock.Lock()
+			p.ended = true
+			p.lock.Unlock()
+			return
+		}
+		p.lock.Lock()
+		p.history = append(p.history, samples...)[len(samples):]
+		p.written += int64(len(samples))
+		p.lock.Unlock()
+
+		if err := p.sink.Write(samples); err != nil {
+			p.lock.Lock()
+			p.ended = true
+			p.lock.Unlock()
+			return
+		}
+	}
+}
+
+// Time implements the renderer.Clock interface.
+//
+// Once all audio has been played, the clock is no longer valid.
+func (p *Player) Time() (time.Duration, bool) {
+	pos := p.sink.Position()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.ended && pos >= samplesToDuration(p.written, p.source.SampleRate) {
+		return p.offset + pos, false
+	}
+	return p.offset + pos, true
+}
+
+// ReadPlayed returns the samples that have been played since the previous
+// call.
+func (p *Player) ReadPlayed() []float64 {
+	played := int64(p.sink.Position()) * int64(p.source.SampleRate) / int64(time.Second)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if played > p.written {
+		played = p.written
+	}
+	from := p.readPos
+	if oldest := p.written - int64(len(p.history)); from < oldest {
+		from = oldest
+	}
+	if from >= played {
+		return nil
+	}
+	p.readPos = played
+	end := len(p.history) - int(p.written-played)
+	return append([]float64(nil), p.history[end-int(played-from):end]...)
+}
+
+// Close stops playback and releases the source and sink.
+func (p *Player) Close() error {
+	close(p.closed)
+	// Closing the source and sink unblocks the playback loop if it is
+	// waiting for either.
+	p.source.Close()
+	err := p.sink.Close()
+	<-p.loopClosed
+	return err
+}
+
+func samplesToDuration(n int64, sampleRate int) time.Duration {
+	return time.Duration(n) * time.Second / time.Duration(sampleRate)
+}
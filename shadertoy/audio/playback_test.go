@@ -0,0 +1,125 @@
+package audio
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func pcmSource(samples []int16) *source {
+	var buf bytes.Buffer
+	for _, s := range samples {
+		buf.WriteByte(byte(s))
+		buf.WriteByte(byte(s >> 8))
+	}
+	return &source{
+		SampleRate: 1000,
+		Channels:   1,
+		Format:     "s16le",
+		file:       io.NopCloser(&buf),
+	}
+}
+
+func TestPlayerClock(t *testing.T) {
+	samples := make([]int16, 1500)
+	for i := range samples {
+		samples[i] = int16(i)
+	}
+	sink := &NullSink{SampleRate: 1000}
+	p := startPlayer(pcmSource(samples), sink, time.Second)
+	<-p.loopClosed
+
+	tm, ok := p.Time()
+	if ok {
+		t.Fatalf("expected the clock to stop after the source ended")
+	}
+	if exp := time.Second + 1500*time.Millisecond; tm != exp {
+		t.Fatalf("unexpected time: exp %v, got %v", exp, tm)
+	}
+
+	played := p.ReadPlayed()
+	if len(played) != len(samples) {
+		t.Fatalf("unexpected number of played samples: exp %v, got %v", len(samples), len(played))
+	}
+	for i, s := range played {
+		if exp := float64(samples[i]) / 0x7fff; s != exp {
+			t.Fatalf("unexpected sample at %d: exp %v, got %v", i, exp, s)
+		}
+	}
+	if played := p.ReadPlayed(); len(played) != 0 {
+		t.Fatalf("expected no samples to be played since the last read, got %v", len(played))
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSourceMixesChannels(t *testing.T) {
+	src := pcmSource([]int16{0x1000, 0x3000, -0x2000, 0x2000})
+	src.Channels = 2
+	samples, err := src.readSamples(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []float64{float64(0x2000) / 0x7fff, 0}
+	if len(samples) != len(exp) {
+		t.Fatalf("unexpected number of samples: exp %v, got %v", len(exp), len(samples))
+	}
+	for i := range exp {
+		if samples[i] != exp[i] {
+			t.Fatalf("unexpected sample at %d: exp %v, got %v", i, exp[i], samples[i])
+		}
+	}
+}
+
+// unevenReader returns the data of a reader in small pieces of varying size,
+// like a pipe from a decoder.
+type unevenReader struct {
+	r io.Reader
+	n int
+}
+
+func (ur *unevenReader) Read(p []byte) (int, error) {
+	ur.n++
+	size := ur.n%7 + 1
+	if len(p) > size {
+		p = p[:size]
+	}
+	return ur.r.Read(p)
+}
+
+func TestSourceReadSamplesIsExact(t *testing.T) {
+	samples := make([]int16, 1000)
+	for i := range samples {
+		samples[i] = int16(i)
+	}
+	src := pcmSource(samples)
+	src.file = io.NopCloser(&unevenReader{r: src.file})
+
+	// At 1000Hz and 60fps, a frame spans 16.67 samples. The fractions must
+	// add up so that each second of frames reads exactly 1000 samples.
+	interval := time.Second / 60
+	var read []float64
+	for i := 0; i < 60; i++ {
+		period := src.ReadSamples(interval)
+		if len(period) != 16 && len(period) != 17 {
+			t.Fatalf("unexpected number of samples in frame %d: %d", i, len(period))
+		}
+		read = append(read, period...)
+	}
+	if len(read) != 999 {
+		t.Fatalf("unexpected number of samples: %d", len(read))
+	}
+	for i, s := range read {
+		if exp := float64(samples[i]) / 0x7fff; s != exp {
+			t.Fatalf("unexpected sample at %d: exp %v, got %v", i, exp, s)
+		}
+	}
+
+	// Reading past the end yields silence.
+	src.ReadSamples(interval)
+	if period := src.ReadSamples(interval); len(period) != 17 || period[0] != 0 {
+		t.Fatalf("unexpected samples past the end: %v", period)
+	}
+}
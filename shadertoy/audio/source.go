@@ -14,20 +14,43 @@ type source struct {
 	Channels   int
 	Format     format
 	file       io.ReadCloser
+	// release is called when the source is closed, it removes the copy of a
+	// file that was made for FFmpeg.
+	release func()
+
+	// pending holds the bytes of an incomplete sample frame from the previous
+	// read.
+	pending []byte
+	// remainder is the fraction of a sample that was not read by the previous
+	// call to ReadSamples, in samples times nanoseconds.
+	remainder int64
 }
 
-func newAudioFileSource(filename string) (*source, error) {
+// newAudioFileSource decodes the audio of a media file in the filesystem of the
+// OS using FFmpeg.
+//
+// Decoding starts at the specified offset. If loop is set, the audio is
+// repeated indefinitely.
+func newAudioFileSource(filename string, offset time.Duration, loop bool) (*source, error) {
+	args := []string{}
+	if loop {
+		args = append(args, "-stream_loop", "-1")
+	}
+	if offset > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(offset.Seconds(), 'f', -1, 64))
+	}
+	args = append(args,
+		"-i", filename,
+		"-f", "s16le",
+		"-acodec", "pcm_s16le",
+		"-ac", "1",
+		"-ar", "22000",
+		"-",
+	)
+
 	r, w := io.Pipe()
 	go func() {
-		cmd := exec.Command(
-			"ffmpeg",
-			"-i", filename,
-			"-f", "s16le",
-			"-acodec", "pcm_s16le",
-			"-ac", "1",
-			"-ar", "22000",
-			"-",
-		)
+		cmd := exec.Command("ffmpeg", args...)
 		cmd.Stdout = w
 		if err := cmd.Run(); err != nil {
 			if err := w.CloseWithError(err); err != nil {
@@ -45,22 +68,59 @@ func newAudioFileSource(filename string) (*source, error) {
 	}, nil
 }
 
+// ReadSamples reads the samples that span a period of time. Exactly as many
+// samples as fit in the period are read, the fraction of a sample that is left
+// is carried over to the next call. This keeps offline renders deterministic,
+// regardless of how fast the audio is decoded. Samples that could not be read
+// are silent.
 func (s *source) ReadSamples(period time.Duration) []float64 {
-	numBytes := s.Format.Bits() / 8
-	buf := make([]byte, s.SampleRate*s.Channels*int(period)/int(time.Second)*numBytes)
-	n, err := s.file.Read(buf)
+	s.remainder += int64(s.SampleRate) * int64(period)
+	n := int(s.remainder / int64(time.Second))
+	s.remainder %= int64(time.Second)
+
+	frameSize := s.Channels * s.Format.Bits() / 8
+	buf := make([]byte, n*frameSize)
+	np := copy(buf, s.pending)
+	s.pending = s.pending[np:]
+	nr, _ := io.ReadFull(s.file, buf[np:])
+	nr += np
+
+	samples := make([]float64, n)
+	copy(samples, s.decode(buf[:nr-nr%frameSize]))
+	return samples
+}
+
+// readSamples reads at most n samples from the source. Multiple channels are
+// mixed down to a single channel.
+func (s *source) readSamples(n int) ([]float64, error) {
+	frameSize := s.Channels * s.Format.Bits() / 8
+	buf := make([]byte, n*frameSize)
+	np := copy(buf, s.pending)
+	nr, err := io.ReadAtLeast(s.file, buf[np:], frameSize-np)
 	if err != nil {
-		return make([]float64, time.Duration(s.SampleRate)*period/time.Second)
+		return nil, err
 	}
+	nr += np
+	s.pending = append(s.pending[:0], buf[nr-nr%frameSize:nr]...)
+	return s.decode(buf[:nr-nr%frameSize]), nil
+}
 
-	samples := make([]float64, n/numBytes)
+// decode converts whole sample frames to samples, mixing down the channels.
+func (s *source) decode(buf []byte) []float64 {
+	numBytes := s.Format.Bits() / 8
+	frameSize := s.Channels * numBytes
+	samples := make([]float64, len(buf)/frameSize)
 	switch s.Format {
 	case "s16le":
 		for i := range samples {
-			offset := i * s.Channels * numBytes
-			bytes := buf[offset : offset+numBytes]
-			sample := int16(bytes[0]) | int16(bytes[1])<<8
-			samples[i] = float64(sample) / float64(0x7fff)
+			sum := 0.0
+			for c := 0; c < s.Channels; c++ {
+				offset := i*frameSize + c*numBytes
+				bytes := buf[offset : offset+numBytes]
+				sample := int16(bytes[0]) | int16(bytes[1])<<8
+				sum += float64(sample) / float64(0x7fff)
+			}
+			samples[i] = sum / float64(s.Channels)
 		}
 	default:
 		panic(fmt.Sprintf("Unimplemented format %q", s.Format))
@@ -69,7 +129,11 @@ func (s *source) ReadSamples(period time.Duration) []float64 {
 }
 
 func (s *source) Close() error {
-	return s.file.Close()
+	err := s.file.Close()
+	if s.release != nil {
+		s.release()
+	}
+	return err
 }
 
 type format string
@@ -0,0 +1,130 @@
+package audio
+
+import (
+	"sync"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// trackChunk is the number of samples that is decoded at once.
+const trackChunk = 4096
+
+// A Track is the sound of a media file that is decoded into memory, so it can
+// be accessed at any position.
+type Track struct {
+	SampleRate int
+	source     *source
+
+	lock    sync.Mutex
+	samples []float32
+
+	closed, loopClosed chan struct{}
+}
+
+// DecodeTrack starts decoding the sound of the specified media file in the
+// filesystem of the OS. The samples become available while decoding
+// progresses in the background.
+func DecodeTrack(filename string) (*Track, error) {
+	src, err := newAudioFileSource(filename, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	return newTrack(src), nil
+}
+
+func newTrack(src *source) *Track {
+	t := &Track{
+		SampleRate: src.SampleRate,
+		source:     src,
+		closed:     make(chan struct{}),
+		loopClosed: make(chan struct{}),
+	}
+	go t.decodeLoop()
+	return t
+}
+
+func (t *Track) decodeLoop() {
+	defer close(t.loopClosed)
+	for {
+		select {
+		case <-t.closed:
+			return
+		default:
+		}
+		samples, err := t.source.readSamples(trackChunk)
+		if err != nil {
+			return
+		}
+		t.lock.Lock()
+		for _, s := range samples {
+			t.samples = append(t.samples, float32(s))
+		}
+		t.lock.Unlock()
+	}
+}
+
+// Samples returns the samples in the range of [from, to). Samples that are
+// not decoded (yet) are silent.
+func (t *Track) Samples(from, to time.Duration) []float64 {
+	start := int(int64(from) * int64(t.SampleRate) / int64(time.Second))
+	end := int(int64(to) * int64(t.SampleRate) / int64(time.Second))
+	out := make([]float64, max(end-start, 0))
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for i := range out {
+		if j := start + i; 0 <= j && j < len(t.samples) {
+			out[i] = float64(t.samples[j])
+		}
+	}
+	return out
+}
+
+// Close stops decoding.
+func (t *Track) Close() error {
+	close(t.closed)
+	err := t.source.Close()
+	<-t.loopClosed
+	return err
+}
+
+// TrackTexture is an audio texture that shows a Track at a position that is
+// controlled by its owner, e.g. a video that is displayed along with it.
+type TrackTexture struct {
+	*texture
+	track *Track
+
+	pos, prevPos time.Duration
+}
+
+// NewTrackTexture creates an audio texture with the same layout and uniforms
+// as the audio loader. The track is closed along with the texture.
+func NewTrackTexture(uniformName string, track *Track, texIndex uint32) *TrackTexture {
+	tt := &TrackTexture{track: track}
+	tt.texture = newTexture(uniformName, track.SampleRate, tt.readPeriod, texIndex)
+	return tt
+}
+
+// SetPosition sets the position in the track that is shown by the next call to
+// PreRender.
+func (tt *TrackTexture) SetPosition(pos time.Duration) {
+	tt.pos = pos
+}
+
+// readPeriod returns the samples between the previous and the current
+// position. If the position jumped, e.g. because the video was looped, the
+// samples preceding the current position are returned instead.
+func (tt *TrackTexture) readPeriod(renderer.RenderState) []float64 {
+	from, to := tt.prevPos, tt.pos
+	tt.prevPos = tt.pos
+	if to <= from || to-from > time.Second {
+		from = to - time.Duration(texWidth)*time.Second/time.Duration(tt.track.SampleRate)
+	}
+	return tt.track.Samples(from, to)
+}
+
+func (tt *TrackTexture) Close() error {
+	tt.texture.Close()
+	return tt.track.Close()
+}
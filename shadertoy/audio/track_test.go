@@ -0,0 +1,46 @@
+package audio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+func TestTrackSamples(t *testing.T) {
+	samples := make([]int16, 2000)
+	for i := range samples {
+		samples[i] = int16(i)
+	}
+	track := newTrack(pcmSource(samples))
+	<-track.loopClosed // Wait for decoding to finish.
+	defer track.Close()
+
+	scale := 1 / float64(0x7fff)
+	got := track.Samples(500*time.Millisecond, 504*time.Millisecond)
+	for i, exp := range []float64{500, 501, 502, 503} {
+		if got[i] != float64(float32(exp*scale)) {
+			t.Fatalf("unexpected samples: %v", got)
+		}
+	}
+	// Samples outside of the track are silent.
+	got = track.Samples(1998*time.Millisecond, 2002*time.Millisecond)
+	if len(got) != 4 || got[1] == 0 || got[2] != 0 || got[3] != 0 {
+		t.Fatalf("unexpected samples at the end: %v", got)
+	}
+
+	tt := &TrackTexture{track: track}
+	tt.SetPosition(100 * time.Millisecond)
+	if n := len(tt.readPeriod(renderer.RenderState{})); n != 100 {
+		t.Errorf("unexpected number of samples in the first period: %d", n)
+	}
+	tt.SetPosition(116 * time.Millisecond)
+	if got := tt.readPeriod(renderer.RenderState{}); len(got) != 16 || got[0] != float64(float32(100*scale)) {
+		t.Errorf("unexpected period during regular playback: %v", got)
+	}
+	// Looping back to the start is a jump.
+	tt.SetPosition(10 * time.Millisecond)
+	if n := len(tt.readPeriod(renderer.RenderState{})); n != texWidth {
+		t.Errorf("expected a window of samples after looping, got %d", n)
+	}
+}
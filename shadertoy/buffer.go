@@ -30,20 +30,15 @@ func init() {
 			return nil, err
 		}
 
-		sources, err := renderer.Includes(filename)
-		if err != nil {
-			return nil, err
-		}
-
 		return &bufferImage{
 			name:     m.Name,
 			index:    genTexID(),
 			filename: filename,
 			width:    uint(width),
 			height:   uint(height),
-			sources:  renderer.SourceFiles(sources...),
 		}, nil
 	})
+	RegisterRelocateFunc("buffer", RelocateLeadingPath)
 }
 
 var bufferValueRe = regexp.MustCompile(`^([^;]+);(\d+)x(\d+)$`)
@@ -54,7 +49,6 @@ type bufferImage struct {
 
 	filename      string
 	width, height uint
-	sources       []renderer.SourceFile
 }
 
 func (tex *bufferImage) UniformSource() string {
@@ -0,0 +1,282 @@
+package camera
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+func init() {
+	shadertoy.RegisterResourceType("camera", func(m shadertoy.Mapping, genTexID shadertoy.GenTexFunc, _ renderer.RenderState) (shadertoy.Resource, error) {
+		path, resolution, err := parseMappingValue(m.PWD, m.Value)
+		if err != nil {
+			return nil, err
+		}
+		c, err := captures.Open(path, func() (*capture, error) {
+			dev, err := openDevice(path, resolution)
+			if err != nil {
+				return nil, err
+			}
+			return newCapture(path, dev), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return newCameraTexture(m.Name, c, genTexID()), nil
+	})
+	shadertoy.RegisterDeclareFunc("camera", func(m shadertoy.Mapping, _ renderer.RenderState) (string, error) {
+		if _, _, err := parseMappingValue(m.PWD, m.Value); err != nil {
+			return "", err
+		}
+		return uniformSource(m.Name), nil
+	})
+}
+
+// defaultResolution is the capture resolution if none is specified in the
+// mapping.
+var defaultResolution = image.Rect(0, 0, 640, 480)
+
+var cameraValueRe = regexp.MustCompile(`^([^;]+)(?:;(\d+)x(\d+))?$`)
+
+// errUnsupported is returned if a device can not be captured from natively.
+// FFmpeg is used instead in that case.
+var errUnsupported = errors.New("unsupported capture device")
+
+// A device captures frames from a camera.
+type device interface {
+	io.Closer
+
+	// Resolution returns the size of the captured frames.
+	Resolution() image.Rectangle
+
+	// ReadFrame blocks until the next frame has been captured and stores it
+	// in img, which has the size returned by Resolution.
+	ReadFrame(img *image.RGBA) error
+}
+
+func parseMappingValue(pwd, value string) (string, image.Rectangle, error) {
+	match := cameraValueRe.FindStringSubmatch(value)
+	if match == nil {
+		return "", image.Rectangle{}, fmt.Errorf("could not parse camera value: %q (format: %s)", value, cameraValueRe)
+	}
+	resolution := defaultResolution
+	if match[2] != "" {
+		w, _ := strconv.Atoi(match[2])
+		h, _ := strconv.Atoi(match[3])
+		if w == 0 || h == 0 {
+			return "", image.Rectangle{}, fmt.Errorf("invalid camera resolution: %dx%d", w, h)
+		}
+		resolution = image.Rect(0, 0, w, h)
+	}
+	path := match[1]
+	// Only paths that refer to files are resolved, so devices can also be
+	// referred to by the name used by FFmpeg on other platforms.
+	if p, err := shadertoy.ResolvePath(pwd, path); err == nil {
+		if _, err := os.Stat(p); err == nil {
+			path = p
+		}
+	}
+	return path, resolution, nil
+}
+
+// openDevice opens a camera for capturing at the requested resolution.
+//
+// Video devices are captured from using V4L2 on Linux if the device supports
+// an uncompressed format. Otherwise, FFmpeg is used. Regular files and pipes
+// are read as a stream of raw RGB24 frames, which is useful for testing.
+func openDevice(path string, resolution image.Rectangle) (device, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return newFFmpegDevice(path, resolution)
+	}
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return newRawDevice(path, resolution)
+	}
+	dev, err := newV4L2Device(path, resolution)
+	if errors.Is(err, errUnsupported) {
+		return newFFmpegDevice(path, resolution)
+	}
+	return dev, err
+}
+
+// captures holds the cameras that are captured from by path, so mappings of
+// the same camera can be used at the same time. A camera keeps the resolution
+// it was opened with until it is no longer used.
+var captures shadertoy.DevicePool[*capture]
+
+// A capture reads frames from a camera in the background.
+type capture struct {
+	path   string
+	device device
+	start  time.Time
+
+	lock sync.Mutex
+	// currentImage is the most recently captured frame and frame is its
+	// number.
+	currentImage *image.RGBA
+	frame        int
+	// captureTime is the time since the start of the capture at which the
+	// current frame was captured.
+	captureTime time.Duration
+
+	closed, loopClosed chan struct{}
+}
+
+func newCapture(path string, dev device) *capture {
+	c := &capture{
+		path:         path,
+		device:       dev,
+		start:        time.Now(),
+		currentImage: image.NewRGBA(dev.Resolution()),
+		closed:       make(chan struct{}),
+		loopClosed:   make(chan struct{}),
+	}
+	go c.captureLoop()
+	return c
+}
+
+func (c *capture) captureLoop() {
+	defer close(c.loopClosed)
+	back := image.NewRGBA(c.device.Resolution())
+	for {
+		select {
+		case <-c.closed:
+			return
+		default:
+		}
+		if err := c.device.ReadFrame(back); err != nil {
+			select {
+			case <-c.closed:
+			default:
+				log.Printf("Error capturing from camera %s: %v", c.path, err)
+			}
+			return
+		}
+		c.lock.Lock()
+		c.currentImage, back = back, c.currentImage
+		c.frame++
+		c.captureTime = time.Since(c.start)
+		c.lock.Unlock()
+	}
+}
+
+func (c *capture) Close() error {
+	close(c.closed)
+	// Closing the device unblocks the capture loop if it is waiting for a
+	// frame.
+	err := c.device.Close()
+	<-c.loopClosed
+	return err
+}
+
+// cameraTexture is a mapping of a live camera feed.
+type cameraTexture struct {
+	uniformName string
+	id          uint32
+	index       uint32
+	capture     *capture
+	// frame is the number of the frame that was last uploaded.
+	frame int
+}
+
+func newCameraTexture(uniformName string, c *capture, texIndex uint32) *cameraTexture {
+	ct := &cameraTexture{
+		uniformName: uniformName,
+		index:       texIndex,
+		capture:     c,
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	resolution := c.currentImage.Rect
+	gl.GenTextures(1, &ct.id)
+	gl.BindTexture(gl.TEXTURE_2D, ct.id)
+	gl.TexImage2D(
+		gl.TEXTURE_2D,              // target
+		0,                          // level
+		gl.RGBA,                    // internalFormat
+		int32(resolution.Dx()),     // width
+		int32(resolution.Dy()),     // height
+		0,                          // border
+		gl.RGBA,                    // format
+		gl.UNSIGNED_BYTE,           // type
+		gl.Ptr(c.currentImage.Pix), // data
+	)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	ct.frame = c.frame
+	return ct
+}
+
+func (ct *cameraTexture) UniformSource() string {
+	return uniformSource(ct.uniformName)
+}
+
+func uniformSource(uniformName string) string {
+	return fmt.Sprintf(`
+		uniform sampler2D %s;
+		uniform vec3 %sSize;
+		uniform float %sCurTime;
+	`, uniformName, uniformName, uniformName)
+}
+
+func (ct *cameraTexture) PreRender(state renderer.RenderState) {
+	c := ct.capture
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	resolution := c.currentImage.Rect
+
+	if loc, ok := state.Uniforms[ct.uniformName]; ok {
+		gl.ActiveTexture(gl.TEXTURE0 + ct.index)
+		gl.BindTexture(gl.TEXTURE_2D, ct.id)
+		if ct.frame != c.frame {
+			ct.frame = c.frame
+			gl.TexSubImage2D(
+				gl.TEXTURE_2D,              // target,
+				0,                          // level,
+				0,                          // xoffset,
+				0,                          // yoffset,
+				int32(resolution.Dx()),     // width,
+				int32(resolution.Dy()),     // height,
+				gl.RGBA,                    // format,
+				gl.UNSIGNED_BYTE,           // type,
+				gl.Ptr(c.currentImage.Pix), // data
+			)
+		}
+		gl.Uniform1i(loc.Location, int32(ct.index))
+	}
+	if m := shadertoy.IchannelNumRe.FindStringSubmatch(ct.uniformName); m != nil {
+		if loc, ok := state.Uniforms[fmt.Sprintf("iChannelResolution[%s]", m[1])]; ok {
+			gl.Uniform3f(loc.Location, float32(resolution.Dx()), float32(resolution.Dy()), 1.0)
+		}
+	}
+	if loc, ok := state.Uniforms[fmt.Sprintf("%sSize", ct.uniformName)]; ok {
+		gl.Uniform3f(loc.Location, float32(resolution.Dx()), float32(resolution.Dy()), 1.0)
+	}
+	if m := shadertoy.IchannelNumRe.FindStringSubmatch(ct.uniformName); m != nil {
+		if loc, ok := state.Uniforms[fmt.Sprintf("iChannelTime[%s]", m[1])]; ok {
+			gl.Uniform1f(loc.Location, float32(c.captureTime)/float32(time.Second))
+		}
+	}
+	if loc, ok := state.Uniforms[fmt.Sprintf("%sCurTime", ct.uniformName)]; ok {
+		gl.Uniform1f(loc.Location, float32(c.captureTime)/float32(time.Second))
+	}
+}
+
+func (ct *cameraTexture) Close() error {
+	gl.DeleteTextures(1, &ct.id)
+	return captures.Release(ct.capture.path)
+}
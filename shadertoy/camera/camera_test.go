@@ -0,0 +1,97 @@
+package camera
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseMappingValue(t *testing.T) {
+	tests := []struct {
+		value      string
+		path       string
+		resolution image.Rectangle
+	}{
+		{"/dev/video0", "/dev/video0", defaultResolution},
+		{"/dev/video1;1280x720", "/dev/video1", image.Rect(0, 0, 1280, 720)},
+		{"FaceTime HD Camera;320x240", "FaceTime HD Camera", image.Rect(0, 0, 320, 240)},
+	}
+	for _, tt := range tests {
+		path, resolution, err := parseMappingValue("/", tt.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path != tt.path || resolution != tt.resolution {
+			t.Errorf("unexpected result for %q: %q %v", tt.value, path, resolution)
+		}
+	}
+	for _, value := range []string{"/dev/video0;640", "/dev/video0;0x480"} {
+		if _, _, err := parseMappingValue("/", value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
+
+func TestFakeDevice(t *testing.T) {
+	resolution := image.Rect(0, 0, 4, 2)
+	colors := []color.RGBA{
+		{R: 0xff, A: 0xff},
+		{G: 0xff, A: 0xff},
+		{B: 0xff, A: 0xff},
+	}
+	var buf bytes.Buffer
+	for _, c := range colors {
+		for i := 0; i < resolution.Dx()*resolution.Dy(); i++ {
+			buf.Write([]byte{c.R, c.G, c.B})
+		}
+	}
+	filename := filepath.Join(t.TempDir(), "camera.rgb")
+	if err := os.WriteFile(filename, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dev, err := openDevice(filename, resolution)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dev.Close()
+	if r := dev.Resolution(); r != resolution {
+		t.Fatalf("unexpected resolution: %v", r)
+	}
+	img := image.NewRGBA(resolution)
+	// The file is repeated when its end is reached.
+	for i := 0; i < len(colors)*2; i++ {
+		if err := dev.ReadFrame(img); err != nil {
+			t.Fatal(err)
+		}
+		if got := img.RGBAAt(3, 1); got != colors[i%len(colors)] {
+			t.Errorf("unexpected color in frame %d: exp %v, got %v", i, colors[i%len(colors)], got)
+		}
+	}
+}
+
+func TestYUYVToRGBA(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	yuyv := []byte{
+		// White and black, followed by 4 bytes of padding.
+		0xff, 0x80, 0x00, 0x80, 0, 0, 0, 0,
+		// Two shades of red.
+		0x51, 0x5a, 0x40, 0xf0, 0, 0, 0, 0,
+	}
+	yuyvToRGBA(img, yuyv, 8)
+	exp := []color.RGBA{
+		{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+		{A: 0xff},
+	}
+	for x, c := range exp {
+		if got := img.RGBAAt(x, 0); got != c {
+			t.Errorf("unexpected color at (%d, 0): exp %v, got %v", x, c, got)
+		}
+	}
+	if c := img.RGBAAt(0, 1); c.R < 0xc0 || c.G > 0x20 || c.B > 0x20 {
+		t.Errorf("expected a red pixel, got %v", c)
+	}
+}
@@ -0,0 +1,33 @@
+package camera
+
+import (
+	"image"
+	"image/color"
+)
+
+// rgb24ToRGBA converts pixels of 3 bytes to opaque RGBA pixels.
+func rgb24ToRGBA(dst, src []byte) {
+	for i, j := 0, 0; j+2 < len(src) && i+3 < len(dst); i, j = i+4, j+3 {
+		dst[i+0] = src[j+0]
+		dst[i+1] = src[j+1]
+		dst[i+2] = src[j+2]
+		dst[i+3] = 0xff
+	}
+}
+
+// yuyvToRGBA converts a frame in which each pair of pixels is stored as Y0, U,
+// Y1, V.
+func yuyvToRGBA(img *image.RGBA, yuyv []byte, bytesPerLine int) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	for y := 0; y < h && (y+1)*bytesPerLine <= len(yuyv); y++ {
+		line := yuyv[y*bytesPerLine:]
+		pix := img.Pix[y*img.Stride:]
+		for x := 0; x+1 < w; x += 2 {
+			y0, cb, y1, cr := line[x*2], line[x*2+1], line[x*2+2], line[x*2+3]
+			r, g, b := color.YCbCrToRGB(y0, cb, cr)
+			pix[x*4+0], pix[x*4+1], pix[x*4+2], pix[x*4+3] = r, g, b, 0xff
+			r, g, b = color.YCbCrToRGB(y1, cb, cr)
+			pix[x*4+4], pix[x*4+5], pix[x*4+6], pix[x*4+7] = r, g, b, 0xff
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package camera
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os/exec"
+	"runtime"
+)
+
+// ffmpegDevice captures from a camera using FFmpeg.
+type ffmpegDevice struct {
+	cmd        *exec.Cmd
+	stdout     io.ReadCloser
+	resolution image.Rectangle
+}
+
+func newFFmpegDevice(path string, resolution image.Rectangle) (*ffmpegDevice, error) {
+	// The input format that captures from cameras differs per platform.
+	var inputFormat string
+	switch runtime.GOOS {
+	case "darwin":
+		inputFormat = "avfoundation"
+	case "windows":
+		inputFormat = "dshow"
+	default:
+		inputFormat = "v4l2"
+	}
+	size := fmt.Sprintf("%dx%d", resolution.Dx(), resolution.Dy())
+	cmd := exec.Command(
+		"ffmpeg",
+		"-loglevel", "error",
+		"-f", inputFormat,
+		"-video_size", size,
+		"-i", path,
+		// The camera may not support the requested size exactly.
+		"-vf", fmt.Sprintf("scale=%d:%d", resolution.Dx(), resolution.Dy()),
+		"-f", "rawvideo",
+		"-pix_fmt", "rgba",
+		"-",
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("could not open camera %q: %w", path, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not open camera %q: %w", path, err)
+	}
+	return &ffmpegDevice{
+		cmd:        cmd,
+		stdout:     stdout,
+		resolution: resolution,
+	}, nil
+}
+
+func (d *ffmpegDevice) Resolution() image.Rectangle {
+	return d.resolution
+}
+
+func (d *ffmpegDevice) ReadFrame(img *image.RGBA) error {
+	_, err := io.ReadFull(d.stdout, img.Pix)
+	return err
+}
+
+func (d *ffmpegDevice) Close() error {
+	d.cmd.Process.Kill()
+	d.cmd.Wait()
+	return nil
+}
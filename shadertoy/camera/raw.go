@@ -0,0 +1,86 @@
+package camera
+
+import (
+	"errors"
+	"image"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// rawFrameRate is the rate at which frames are read from regular files to
+// emulate a camera.
+const rawFrameRate = 30
+
+// rawDevice reads a stream of raw RGB24 frames from a file or pipe, such as
+// the output of `ffmpeg -f rawvideo -pix_fmt rgb24`.
+//
+// Regular files act as a fake camera: frames are read at rawFrameRate and the
+// file is repeated when its end is reached. Pipes are read as fast as frames
+// are written to them.
+type rawDevice struct {
+	file       *os.File
+	resolution image.Rectangle
+	regular    bool
+	buf        []byte
+
+	next      time.Time
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newRawDevice(path string, resolution image.Rectangle) (*rawDevice, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return &rawDevice{
+		file:       fd,
+		resolution: resolution,
+		regular:    info.Mode().IsRegular(),
+		buf:        make([]byte, resolution.Dx()*resolution.Dy()*3),
+		closed:     make(chan struct{}),
+	}, nil
+}
+
+func (d *rawDevice) Resolution() image.Rectangle {
+	return d.resolution
+}
+
+func (d *rawDevice) ReadFrame(img *image.RGBA) error {
+	if d.regular {
+		if !d.next.IsZero() {
+			select {
+			case <-time.After(time.Until(d.next)):
+			case <-d.closed:
+				return os.ErrClosed
+			}
+		}
+		d.next = time.Now().Add(time.Second / rawFrameRate)
+	}
+
+	_, err := io.ReadFull(d.file, d.buf)
+	if d.regular && (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) {
+		// Loop the file like a camera that keeps on recording.
+		if _, err = d.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		_, err = io.ReadFull(d.file, d.buf)
+	}
+	if err != nil {
+		return err
+	}
+	rgb24ToRGBA(img.Pix, d.buf)
+	return nil
+}
+
+func (d *rawDevice) Close() error {
+	d.closeOnce.Do(func() { close(d.closed) })
+	return d.file.Close()
+}
@@ -0,0 +1,275 @@
+package camera
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// The subset of the V4L2 API that is needed to capture frames using memory
+// mapped buffers, see linux/videodev2.h.
+const (
+	v4l2BufTypeVideoCapture = 1
+	v4l2MemoryMmap          = 1
+	v4l2FieldNone           = 1
+	v4l2CapVideoCapture     = 0x00000001
+	v4l2CapStreaming        = 0x04000000
+
+	// v4l2PixFmtYUYV is the packed 4:2:2 YUV format that is supported by
+	// practically all webcams.
+	v4l2PixFmtYUYV = 'Y' | 'U'<<8 | 'Y'<<16 | 'V'<<24
+
+	// numV4L2Buffers is the number of buffers that are queued for capturing.
+	numV4L2Buffers = 4
+	// v4l2PollInterval is the time between attempts to dequeue a frame.
+	v4l2PollInterval = 5 * time.Millisecond
+)
+
+type v4l2Capability struct {
+	Driver       [16]uint8
+	Card         [32]uint8
+	BusInfo      [32]uint8
+	Version      uint32
+	Capabilities uint32
+	DeviceCaps   uint32
+	Reserved     [3]uint32
+}
+
+type v4l2PixFormat struct {
+	Width        uint32
+	Height       uint32
+	PixelFormat  uint32
+	Field        uint32
+	BytesPerLine uint32
+	SizeImage    uint32
+	Colorspace   uint32
+	Priv         uint32
+	Flags        uint32
+	YcbcrEnc     uint32
+	Quantization uint32
+	XferFunc     uint32
+}
+
+type v4l2Format struct {
+	Type uint32
+	// Fmt is a union that contains pointers, so it is aligned like one.
+	Fmt [200 / unsafe.Sizeof(uintptr(0))]uintptr
+}
+
+type v4l2RequestBuffers struct {
+	Count        uint32
+	Type         uint32
+	Memory       uint32
+	Capabilities uint32
+	Flags        uint8
+	Reserved     [3]uint8
+}
+
+type v4l2Timecode struct {
+	Type     uint32
+	Flags    uint32
+	Frames   uint8
+	Seconds  uint8
+	Minutes  uint8
+	Hours    uint8
+	Userbits [4]uint8
+}
+
+type v4l2Buffer struct {
+	Index     uint32
+	Type      uint32
+	BytesUsed uint32
+	Flags     uint32
+	Field     uint32
+	Timestamp syscall.Timeval
+	Timecode  v4l2Timecode
+	Sequence  uint32
+	Memory    uint32
+	// M is a union of which only the offset of mmap buffers is used.
+	M         uintptr
+	Length    uint32
+	Reserved2 uint32
+	RequestFD int32
+}
+
+// ioc encodes an ioctl request number like the _IOC macro.
+func ioc(dir, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | 'V'<<8 | nr
+}
+
+const (
+	iocWrite = 1
+	iocRead  = 2
+)
+
+var (
+	vidiocQueryCap  = ioc(iocRead, 0, unsafe.Sizeof(v4l2Capability{}))
+	vidiocSetFmt    = ioc(iocRead|iocWrite, 5, unsafe.Sizeof(v4l2Format{}))
+	vidiocReqBufs   = ioc(iocRead|iocWrite, 8, unsafe.Sizeof(v4l2RequestBuffers{}))
+	vidiocQueryBuf  = ioc(iocRead|iocWrite, 9, unsafe.Sizeof(v4l2Buffer{}))
+	vidiocQBuf      = ioc(iocRead|iocWrite, 15, unsafe.Sizeof(v4l2Buffer{}))
+	vidiocDQBuf     = ioc(iocRead|iocWrite, 17, unsafe.Sizeof(v4l2Buffer{}))
+	vidiocStreamOn  = ioc(iocWrite, 18, unsafe.Sizeof(int32(0)))
+	vidiocStreamOff = ioc(iocWrite, 19, unsafe.Sizeof(int32(0)))
+)
+
+func ioctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	for {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(arg))
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	}
+}
+
+// v4l2Device captures YUYV frames from a Video4Linux2 device.
+type v4l2Device struct {
+	fd           int
+	resolution   image.Rectangle
+	bytesPerLine int
+	buffers      [][]byte
+
+	// lock is held while a buffer is accessed, so the buffers are not
+	// unmapped while in use.
+	lock      sync.Mutex
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// newV4L2Device opens a capture device. If it does not support capturing
+// uncompressed frames at the requested resolution, errUnsupported is returned.
+func newV4L2Device(path string, resolution image.Rectangle) (*v4l2Device, error) {
+	fd, err := syscall.Open(path, syscall.O_RDWR|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not open camera %q: %w", path, err)
+	}
+	d := &v4l2Device{fd: fd, closed: make(chan struct{})}
+	if err := d.init(resolution); err != nil {
+		d.release()
+		if errors.Is(err, errUnsupported) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("could not open camera %q: %w", path, err)
+	}
+	return d, nil
+}
+
+func (d *v4l2Device) init(resolution image.Rectangle) error {
+	var caps v4l2Capability
+	if err := ioctl(d.fd, vidiocQueryCap, unsafe.Pointer(&caps)); err != nil {
+		return errUnsupported
+	}
+	c := caps.Capabilities
+	if caps.DeviceCaps != 0 {
+		c = caps.DeviceCaps
+	}
+	if c&v4l2CapVideoCapture == 0 || c&v4l2CapStreaming == 0 {
+		return errUnsupported
+	}
+
+	format := v4l2Format{Type: v4l2BufTypeVideoCapture}
+	pix := (*v4l2PixFormat)(unsafe.Pointer(&format.Fmt))
+	pix.Width = uint32(resolution.Dx())
+	pix.Height = uint32(resolution.Dy())
+	pix.PixelFormat = v4l2PixFmtYUYV
+	pix.Field = v4l2FieldNone
+	if err := ioctl(d.fd, vidiocSetFmt, unsafe.Pointer(&format)); err != nil {
+		return err
+	}
+	// The driver adjusts the format to what the device supports. Anything
+	// else than what was requested is left to FFmpeg.
+	if pix.PixelFormat != v4l2PixFmtYUYV || int(pix.Width) != resolution.Dx() || int(pix.Height) != resolution.Dy() {
+		return errUnsupported
+	}
+	d.resolution = resolution
+	d.bytesPerLine = int(pix.BytesPerLine)
+	if d.bytesPerLine < resolution.Dx()*2 {
+		d.bytesPerLine = resolution.Dx() * 2
+	}
+
+	req := v4l2RequestBuffers{
+		Count:  numV4L2Buffers,
+		Type:   v4l2BufTypeVideoCapture,
+		Memory: v4l2MemoryMmap,
+	}
+	if err := ioctl(d.fd, vidiocReqBufs, unsafe.Pointer(&req)); err != nil {
+		return err
+	}
+	for i := uint32(0); i < req.Count; i++ {
+		buf := v4l2Buffer{Index: i, Type: v4l2BufTypeVideoCapture, Memory: v4l2MemoryMmap}
+		if err := ioctl(d.fd, vidiocQueryBuf, unsafe.Pointer(&buf)); err != nil {
+			return err
+		}
+		mem, err := syscall.Mmap(d.fd, int64(uint32(buf.M)), int(buf.Length), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+		if err != nil {
+			return err
+		}
+		d.buffers = append(d.buffers, mem)
+		if err := ioctl(d.fd, vidiocQBuf, unsafe.Pointer(&buf)); err != nil {
+			return err
+		}
+	}
+
+	typ := int32(v4l2BufTypeVideoCapture)
+	return ioctl(d.fd, vidiocStreamOn, unsafe.Pointer(&typ))
+}
+
+func (d *v4l2Device) Resolution() image.Rectangle {
+	return d.resolution
+}
+
+func (d *v4l2Device) ReadFrame(img *image.RGBA) error {
+	for {
+		select {
+		case <-d.closed:
+			return os.ErrClosed
+		default:
+		}
+
+		d.lock.Lock()
+		buf := v4l2Buffer{Type: v4l2BufTypeVideoCapture, Memory: v4l2MemoryMmap}
+		err := ioctl(d.fd, vidiocDQBuf, unsafe.Pointer(&buf))
+		if err == syscall.EAGAIN {
+			d.lock.Unlock()
+			time.Sleep(v4l2PollInterval)
+			continue
+		}
+		if err != nil {
+			d.lock.Unlock()
+			return err
+		}
+		yuyvToRGBA(img, d.buffers[buf.Index][:buf.BytesUsed], d.bytesPerLine)
+		err = ioctl(d.fd, vidiocQBuf, unsafe.Pointer(&buf))
+		d.lock.Unlock()
+		return err
+	}
+}
+
+func (d *v4l2Device) Close() error {
+	d.closeOnce.Do(func() {
+		close(d.closed)
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		typ := int32(v4l2BufTypeVideoCapture)
+		ioctl(d.fd, vidiocStreamOff, unsafe.Pointer(&typ))
+		d.release()
+	})
+	return nil
+}
+
+func (d *v4l2Device) release() {
+	for _, b := range d.buffers {
+		syscall.Munmap(b)
+	}
+	d.buffers = nil
+	syscall.Close(d.fd)
+}
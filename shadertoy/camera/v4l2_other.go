@@ -0,0 +1,11 @@
+//go:build !linux
+
+package camera
+
+import "image"
+
+// newV4L2Device always returns errUnsupported as V4L2 is only available on
+// Linux.
+func newV4L2Device(path string, resolution image.Rectangle) (device, error) {
+	return nil, errUnsupported
+}
@@ -0,0 +1,61 @@
+package shadertoy
+
+import (
+	"io"
+	"sync"
+)
+
+// A DevicePool shares devices that can only be opened once, like sockets,
+// MIDI controllers and cameras, between the resources that use them.
+//
+// An environment is set up before the one it replaces is closed. Resources
+// with the same mapping are reused, but a mapping that changed while it still
+// refers to the same device would otherwise fail to open the device.
+type DevicePool[T io.Closer] struct {
+	lock    sync.Mutex
+	devices map[string]*pooledDevice[T]
+}
+
+type pooledDevice[T io.Closer] struct {
+	device T
+	refs   int
+}
+
+// Open returns the device with the specified key, like the address of a socket
+// or the path of a device. If it is not in use, it is opened by calling open.
+// Each successful call must be paired with a call to Release.
+func (p *DevicePool[T]) Open(key string, open func() (T, error)) (T, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if pd, ok := p.devices[key]; ok {
+		pd.refs++
+		return pd.device, nil
+	}
+	dev, err := open()
+	if err != nil {
+		return dev, err
+	}
+	if p.devices == nil {
+		p.devices = map[string]*pooledDevice[T]{}
+	}
+	p.devices[key] = &pooledDevice[T]{device: dev, refs: 1}
+	return dev, nil
+}
+
+// Release gives up a reference to the device with the specified key. The
+// device is closed once it is no longer used.
+func (p *DevicePool[T]) Release(key string) error {
+	p.lock.Lock()
+	pd, ok := p.devices[key]
+	if !ok {
+		p.lock.Unlock()
+		return nil
+	}
+	if pd.refs--; pd.refs > 0 {
+		p.lock.Unlock()
+		return nil
+	}
+	delete(p.devices, key)
+	p.lock.Unlock()
+	return pd.device.Close()
+}
@@ -0,0 +1,59 @@
+package shadertoy
+
+import (
+	"errors"
+	"testing"
+)
+
+type fakeDevice struct {
+	closed int
+}
+
+func (d *fakeDevice) Close() error {
+	d.closed++
+	return nil
+}
+
+func TestDevicePool(t *testing.T) {
+	var pool DevicePool[*fakeDevice]
+	opened := 0
+	open := func() (*fakeDevice, error) {
+		opened++
+		return &fakeDevice{}, nil
+	}
+
+	a, err := pool.Open("/dev/a", open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := pool.Open("/dev/a", open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b || opened != 1 {
+		t.Fatalf("expected the device to be shared, opened %d times", opened)
+	}
+	if _, err := pool.Open("/dev/b", open); err != nil || opened != 2 {
+		t.Fatalf("expected another device to be opened: %v", err)
+	}
+
+	pool.Release("/dev/a")
+	if a.closed != 0 {
+		t.Fatal("the device was closed while in use")
+	}
+	pool.Release("/dev/a")
+	if a.closed != 1 {
+		t.Fatalf("unexpected number of closes: %d", a.closed)
+	}
+	if c, _ := pool.Open("/dev/a", open); c == a || opened != 3 {
+		t.Fatal("expected the device to be opened again")
+	}
+
+	errOpen := errors.New("busy")
+	if _, err := pool.Open("/dev/c", func() (*fakeDevice, error) { return nil, errOpen }); err != errOpen {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := pool.Open("/dev/c", open); err != nil || opened != 4 {
+		t.Fatal("a failed open should not be remembered")
+	}
+}
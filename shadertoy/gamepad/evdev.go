@@ -0,0 +1,272 @@
+package gamepad
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// errUnsupported is returned if evdev is not available on this platform.
+var errUnsupported = errors.New("evdev is not supported on this platform")
+
+// reconnectInterval is the time between attempts to open a gamepad that is not
+// connected.
+const reconnectInterval = time.Second
+
+// The subset of the Linux input event codes that is used by gamepads, see
+// linux/input-event-codes.h.
+const (
+	evKey = 0x01
+	evAbs = 0x03
+
+	absX     = 0x00
+	absY     = 0x01
+	absZ     = 0x02
+	absRX    = 0x03
+	absRY    = 0x04
+	absRZ    = 0x05
+	absHat0X = 0x10
+	absHat0Y = 0x11
+
+	btnSouth     = 0x130
+	btnEast      = 0x131
+	btnNorth     = 0x133
+	btnWest      = 0x134
+	btnTL        = 0x136
+	btnTR        = 0x137
+	btnTL2       = 0x138
+	btnTR2       = 0x139
+	btnSelect    = 0x13a
+	btnStart     = 0x13b
+	btnMode      = 0x13c
+	btnThumbL    = 0x13d
+	btnThumbR    = 0x13e
+	btnDpadUp    = 0x220
+	btnDpadDown  = 0x221
+	btnDpadLeft  = 0x222
+	btnDpadRight = 0x223
+)
+
+// evdevAxes maps the absolute axes of a Linux gamepad to the standard layout.
+var evdevAxes = map[uint16]int{
+	absX:  renderer.GamepadAxisLeftX,
+	absY:  renderer.GamepadAxisLeftY,
+	absRX: renderer.GamepadAxisRightX,
+	absRY: renderer.GamepadAxisRightY,
+	absZ:  renderer.GamepadAxisLeftTrigger,
+	absRZ: renderer.GamepadAxisRightTrigger,
+}
+
+// evdevButtons maps the buttons of a Linux gamepad to the standard layout.
+var evdevButtons = map[uint16]int{
+	btnSouth:     renderer.GamepadButtonA,
+	btnEast:      renderer.GamepadButtonB,
+	btnWest:      renderer.GamepadButtonX,
+	btnNorth:     renderer.GamepadButtonY,
+	btnTL:        renderer.GamepadButtonLeftBumper,
+	btnTR:        renderer.GamepadButtonRightBumper,
+	btnSelect:    renderer.GamepadButtonBack,
+	btnStart:     renderer.GamepadButtonStart,
+	btnMode:      renderer.GamepadButtonGuide,
+	btnThumbL:    renderer.GamepadButtonLeftThumb,
+	btnThumbR:    renderer.GamepadButtonRightThumb,
+	btnDpadUp:    renderer.GamepadButtonDpadUp,
+	btnDpadDown:  renderer.GamepadButtonDpadDown,
+	btnDpadLeft:  renderer.GamepadButtonDpadLeft,
+	btnDpadRight: renderer.GamepadButtonDpadRight,
+}
+
+// evdevDigitalTriggers maps the buttons of gamepads that only have digital
+// triggers to the axes of analog triggers.
+var evdevDigitalTriggers = map[uint16]uint16{
+	btnTL2: absZ,
+	btnTR2: absRZ,
+}
+
+type inputEvent struct {
+	Type, Code uint16
+	Value      int32
+}
+
+type absRange struct {
+	Min, Max int32
+}
+
+// evdevMapper converts the events of an evdev device to the state of a
+// gamepad in the standard layout.
+type evdevMapper struct {
+	ranges map[uint16]absRange
+	state  renderer.GamepadState
+}
+
+func newEvdevMapper(name string, ranges map[uint16]absRange) *evdevMapper {
+	m := &evdevMapper{ranges: ranges}
+	m.state.Name = name
+	m.state.Axes[renderer.GamepadAxisLeftTrigger] = -1
+	m.state.Axes[renderer.GamepadAxisRightTrigger] = -1
+	return m
+}
+
+func (m *evdevMapper) handle(ev inputEvent) {
+	switch ev.Type {
+	case evKey:
+		pressed := ev.Value != 0
+		if i, ok := evdevButtons[ev.Code]; ok {
+			m.state.Buttons[i] = pressed
+		}
+		if axis, ok := evdevDigitalTriggers[ev.Code]; ok {
+			if _, analog := m.ranges[axis]; !analog {
+				m.state.Axes[evdevAxes[axis]] = -1
+				if pressed {
+					m.state.Axes[evdevAxes[axis]] = 1
+				}
+			}
+		}
+	case evAbs:
+		switch ev.Code {
+		case absHat0X:
+			m.state.Buttons[renderer.GamepadButtonDpadLeft] = ev.Value < 0
+			m.state.Buttons[renderer.GamepadButtonDpadRight] = ev.Value > 0
+		case absHat0Y:
+			m.state.Buttons[renderer.GamepadButtonDpadUp] = ev.Value < 0
+			m.state.Buttons[renderer.GamepadButtonDpadDown] = ev.Value > 0
+		default:
+			if i, ok := evdevAxes[ev.Code]; ok {
+				m.state.Axes[i] = m.normalize(ev.Code, ev.Value)
+			}
+		}
+	}
+}
+
+// normalize scales the value of an axis to the range of -1 to 1.
+func (m *evdevMapper) normalize(code uint16, value int32) float32 {
+	r, ok := m.ranges[code]
+	if !ok || r.Max <= r.Min {
+		r = absRange{Min: -32768, Max: 32767}
+	}
+	f := 2*float32(value-r.Min)/float32(r.Max-r.Min) - 1
+	return min(max(f, -1), 1)
+}
+
+// evdevGamepad reads the state of a gamepad using the Linux evdev interface,
+// so gamepads can be used without a window. The device is reopened if it is
+// disconnected.
+type evdevGamepad struct {
+	// path is the device to open. If empty, number is the index of the
+	// gamepad among the joysticks that are connected.
+	path   string
+	number int
+
+	lock  sync.Mutex
+	state *renderer.GamepadState
+	dev   *evdevDevice
+
+	closed, loopClosed chan struct{}
+}
+
+func newEvdevGamepad(path string, number int) *evdevGamepad {
+	g := &evdevGamepad{
+		path:       path,
+		number:     number,
+		closed:     make(chan struct{}),
+		loopClosed: make(chan struct{}),
+	}
+	go g.loop()
+	return g
+}
+
+func (g *evdevGamepad) loop() {
+	defer close(g.loopClosed)
+	var prevErr string
+	for {
+		err := g.run()
+		select {
+		case <-g.closed:
+			return
+		default:
+		}
+		if errors.Is(err, errUnsupported) {
+			log.Printf("Gamepads are not available: %v", err)
+			return
+		}
+		// Only log changes, so a gamepad that is not connected does not
+		// flood the log.
+		if err != nil && err.Error() != prevErr {
+			log.Printf("Gamepad: %v", err)
+			prevErr = err.Error()
+		}
+		select {
+		case <-g.closed:
+			return
+		case <-time.After(reconnectInterval):
+		}
+	}
+}
+
+func (g *evdevGamepad) run() error {
+	path := g.path
+	if path == "" {
+		var err error
+		if path, err = findJoystick(g.number); err != nil {
+			return err
+		}
+	}
+	dev, err := openEvdev(path)
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+
+	mapper := newEvdevMapper(dev.name, dev.ranges)
+	g.lock.Lock()
+	select {
+	case <-g.closed:
+		g.lock.Unlock()
+		return nil
+	default:
+	}
+	g.dev = dev
+	state := mapper.state
+	g.state = &state
+	g.lock.Unlock()
+	defer func() {
+		g.lock.Lock()
+		g.dev, g.state = nil, nil
+		g.lock.Unlock()
+	}()
+
+	for {
+		ev, err := dev.readEvent()
+		if err != nil {
+			return err
+		}
+		mapper.handle(ev)
+		state := mapper.state
+		g.lock.Lock()
+		g.state = &state
+		g.lock.Unlock()
+	}
+}
+
+// State returns the current state of the gamepad or nil if it is not
+// connected.
+func (g *evdevGamepad) State() *renderer.GamepadState {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.state
+}
+
+func (g *evdevGamepad) Close() error {
+	close(g.closed)
+	g.lock.Lock()
+	if g.dev != nil {
+		// Closing the device unblocks the read loop.
+		g.dev.Close()
+	}
+	g.lock.Unlock()
+	<-g.loopClosed
+	return nil
+}
@@ -0,0 +1,122 @@
+package gamepad
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"unsafe"
+)
+
+// inputAbsinfo is struct input_absinfo of linux/input.h.
+type inputAbsinfo struct {
+	Value      int32
+	Minimum    int32
+	Maximum    int32
+	Fuzz       int32
+	Flat       int32
+	Resolution int32
+}
+
+// eventSize is the size of struct input_event, which starts with a timeval.
+var eventSize = int(unsafe.Sizeof(syscall.Timeval{})) + 8
+
+// ioc encodes an ioctl request number like the _IOC macro.
+func ioc(dir, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | 'E'<<8 | nr
+}
+
+const iocRead = 2
+
+func eviocgname(size uintptr) uintptr {
+	return ioc(iocRead, 0x06, size)
+}
+
+func eviocgabs(abs uint16) uintptr {
+	return ioc(iocRead, 0x40+uintptr(abs), unsafe.Sizeof(inputAbsinfo{}))
+}
+
+func ioctl(fd, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// findJoystick returns the path of the event device of the n-th joystick
+// ordered by the ID of the device.
+func findJoystick(n int) (string, error) {
+	paths, err := filepath.Glob("/dev/input/by-id/*-event-joystick")
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(paths)
+	if n >= len(paths) {
+		return "", fmt.Errorf("gamepad %d is not connected, %d joysticks found", n, len(paths))
+	}
+	return paths[n], nil
+}
+
+// evdevDevice is an opened Linux input device.
+type evdevDevice struct {
+	file   *os.File
+	name   string
+	ranges map[uint16]absRange
+	buf    []byte
+}
+
+func openEvdev(path string) (*evdevDevice, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	d := &evdevDevice{
+		file:   file,
+		name:   filepath.Base(path),
+		ranges: map[uint16]absRange{},
+		buf:    make([]byte, eventSize),
+	}
+	// The file descriptor is accessed using SyscallConn so it stays in
+	// non-blocking mode and Close is able to interrupt reads.
+	conn, err := file.SyscallConn()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	conn.Control(func(fd uintptr) {
+		var name [256]byte
+		if ioctl(fd, eviocgname(uintptr(len(name))), unsafe.Pointer(&name[0])) == nil {
+			if i := bytes.IndexByte(name[:], 0); i > 0 {
+				d.name = string(name[:i])
+			}
+		}
+		for code := range evdevAxes {
+			var info inputAbsinfo
+			if ioctl(fd, eviocgabs(code), unsafe.Pointer(&info)) == nil {
+				d.ranges[code] = absRange{Min: info.Minimum, Max: info.Maximum}
+			}
+		}
+	})
+	return d, nil
+}
+
+func (d *evdevDevice) readEvent() (inputEvent, error) {
+	if _, err := io.ReadFull(d.file, d.buf); err != nil {
+		return inputEvent{}, err
+	}
+	b := d.buf[eventSize-8:]
+	return inputEvent{
+		Type:  binary.NativeEndian.Uint16(b[0:]),
+		Code:  binary.NativeEndian.Uint16(b[2:]),
+		Value: int32(binary.NativeEndian.Uint32(b[4:])),
+	}, nil
+}
+
+func (d *evdevDevice) Close() error {
+	return d.file.Close()
+}
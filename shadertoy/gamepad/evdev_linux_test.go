@@ -0,0 +1,48 @@
+package gamepad
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+func encodeEvent(ev inputEvent) []byte {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, eventSize-8)) // Timestamp.
+	binary.Write(&buf, binary.NativeEndian, ev)
+	return buf.Bytes()
+}
+
+func TestEvdevGamepad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "event0")
+	if err := syscall.Mkfifo(path, 0o600); err != nil {
+		t.Skipf("could not create a FIFO: %v", err)
+	}
+	g := newEvdevGamepad(path, 0)
+	defer g.Close()
+
+	w, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Write(encodeEvent(inputEvent{Type: evKey, Code: btnStart, Value: 1}))
+	w.Write(encodeEvent(inputEvent{Type: evAbs, Code: absRX, Value: -32768}))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if s := g.State(); s != nil && s.Buttons[renderer.GamepadButtonStart] && s.Axes[renderer.GamepadAxisRightX] == -1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected state: %+v", g.State())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
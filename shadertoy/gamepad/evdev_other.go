@@ -0,0 +1,24 @@
+//go:build !linux
+
+package gamepad
+
+type evdevDevice struct {
+	name   string
+	ranges map[uint16]absRange
+}
+
+func findJoystick(n int) (string, error) {
+	return "", errUnsupported
+}
+
+func openEvdev(path string) (*evdevDevice, error) {
+	return nil, errUnsupported
+}
+
+func (d *evdevDevice) readEvent() (inputEvent, error) {
+	return inputEvent{}, errUnsupported
+}
+
+func (d *evdevDevice) Close() error {
+	return nil
+}
@@ -0,0 +1,54 @@
+package gamepad
+
+import (
+	"testing"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+func TestEvdevMapper(t *testing.T) {
+	m := newEvdevMapper("pad", map[uint16]absRange{
+		absX:  {Min: -32768, Max: 32767},
+		absY:  {Min: -32768, Max: 32767},
+		absRZ: {Min: 0, Max: 255},
+	})
+	for _, ev := range []inputEvent{
+		{Type: evAbs, Code: absX, Value: 32767},
+		{Type: evAbs, Code: absY, Value: -32768},
+		{Type: evAbs, Code: absRZ, Value: 255},
+		{Type: evAbs, Code: absHat0X, Value: -1},
+		{Type: evKey, Code: btnSouth, Value: 1},
+		{Type: evKey, Code: btnWest, Value: 1},
+		{Type: evKey, Code: btnWest, Value: 0},
+		// The left trigger is digital, the right one is analog.
+		{Type: evKey, Code: btnTL2, Value: 1},
+		{Type: evKey, Code: btnTR2, Value: 0},
+	} {
+		m.handle(ev)
+	}
+
+	exp := [renderer.NumGamepadAxes]float32{1, -1, 0, 0, 1, 1}
+	if m.state.Axes != exp {
+		t.Errorf("unexpected axes: %v", m.state.Axes)
+	}
+	var expButtons [renderer.NumGamepadButtons]bool
+	expButtons[renderer.GamepadButtonA] = true
+	expButtons[renderer.GamepadButtonDpadLeft] = true
+	if m.state.Buttons != expButtons {
+		t.Errorf("unexpected buttons: %v", m.state.Buttons)
+	}
+
+	sticks, triggers, buttons, dpad := uniformValues(&m.state)
+	if sticks != [4]float32{1, 1, 0, 0} {
+		t.Errorf("unexpected sticks: %v", sticks)
+	}
+	if triggers != [4]float32{1, 1, 0, 0} {
+		t.Errorf("unexpected triggers: %v", triggers)
+	}
+	if buttons != [4]float32{1, 0, 0, 0} {
+		t.Errorf("unexpected buttons: %v", buttons)
+	}
+	if dpad != [4]float32{0, 0, 0, 1} {
+		t.Errorf("unexpected dpad: %v", dpad)
+	}
+}
@@ -0,0 +1,193 @@
+package gamepad
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+func init() {
+	shadertoy.RegisterResourceType("gamepad", func(m shadertoy.Mapping, genTexID shadertoy.GenTexFunc, _ renderer.RenderState) (shadertoy.Resource, error) {
+		gt := &gamepadTexture{uniformName: m.Name}
+		if strings.HasPrefix(m.Value, "/") {
+			gt.path = m.Value
+		} else {
+			n, err := strconv.Atoi(m.Value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid gamepad %q, expected a number or the path of an evdev device", m.Value)
+			}
+			gt.number = n
+		}
+		gt.init(genTexID())
+		return gt, nil
+	})
+	shadertoy.RegisterDeclareFunc("gamepad", func(m shadertoy.Mapping, _ renderer.RenderState) (string, error) {
+		return uniformSource(m.Name), nil
+	})
+}
+
+// texWidth is the width of the texture, which has a row for the axes and a
+// row for the buttons.
+const texWidth = 16
+
+// gamepadTexture is a mapping of the state of a gamepad.
+//
+// The state is provided by the engine if it has access to gamepads. Otherwise,
+// or if the path of a device is specified, it is read using evdev.
+type gamepadTexture struct {
+	uniformName string
+	number      int
+	path        string
+	evdev       *evdevGamepad
+
+	id    uint32
+	index uint32
+	pix   [texWidth * 2]float32
+}
+
+func (gt *gamepadTexture) init(texIndex uint32) {
+	gt.index = texIndex
+	gl.GenTextures(1, &gt.id)
+	gl.BindTexture(gl.TEXTURE_2D, gt.id)
+	gl.TexImage2D(
+		gl.TEXTURE_2D,      // target
+		0,                  // level
+		gl.R32F,            // internalFormat
+		texWidth,           // width
+		2,                  // height
+		0,                  // border
+		gl.RED,             // format
+		gl.FLOAT,           // type
+		gl.Ptr(&gt.pix[0]), // data
+	)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+}
+
+func (gt *gamepadTexture) UniformSource() string {
+	return uniformSource(gt.uniformName)
+}
+
+func uniformSource(uniformName string) string {
+	return fmt.Sprintf(`
+		uniform sampler2D %s;
+		uniform vec4 %sSticks;
+		uniform vec4 %sTriggers;
+		uniform vec4 %sButtons;
+		uniform vec4 %sDpad;
+		uniform float %sConnected;
+	`, uniformName, uniformName, uniformName, uniformName, uniformName, uniformName)
+}
+
+// state returns the state of the gamepad or nil if it is not connected.
+func (gt *gamepadTexture) state(state renderer.RenderState) *renderer.GamepadState {
+	if gt.path == "" && state.Gamepads != nil {
+		if gt.number < len(state.Gamepads) {
+			return state.Gamepads[gt.number]
+		}
+		return nil
+	}
+	if gt.evdev == nil {
+		gt.evdev = newEvdevGamepad(gt.path, gt.number)
+	}
+	return gt.evdev.State()
+}
+
+// uniformValues derives the values of the vec4 uniforms from the state of a
+// gamepad. The Y axes of the sticks are flipped, so up is positive like in
+// OpenGL and the triggers range from 0 to 1.
+func uniformValues(pad *renderer.GamepadState) (sticks, triggers, buttons, dpad [4]float32) {
+	if pad == nil {
+		return
+	}
+	b := func(i int) float32 {
+		if pad.Buttons[i] {
+			return 1
+		}
+		return 0
+	}
+	sticks = [4]float32{
+		pad.Axes[renderer.GamepadAxisLeftX],
+		-pad.Axes[renderer.GamepadAxisLeftY],
+		pad.Axes[renderer.GamepadAxisRightX],
+		-pad.Axes[renderer.GamepadAxisRightY],
+	}
+	triggers = [4]float32{
+		pad.Axes[renderer.GamepadAxisLeftTrigger]*0.5 + 0.5,
+		pad.Axes[renderer.GamepadAxisRightTrigger]*0.5 + 0.5,
+		b(renderer.GamepadButtonLeftBumper),
+		b(renderer.GamepadButtonRightBumper),
+	}
+	buttons = [4]float32{
+		b(renderer.GamepadButtonA),
+		b(renderer.GamepadButtonB),
+		b(renderer.GamepadButtonX),
+		b(renderer.GamepadButtonY),
+	}
+	dpad = [4]float32{
+		b(renderer.GamepadButtonDpadUp),
+		b(renderer.GamepadButtonDpadRight),
+		b(renderer.GamepadButtonDpadDown),
+		b(renderer.GamepadButtonDpadLeft),
+	}
+	return
+}
+
+func (gt *gamepadTexture) PreRender(state renderer.RenderState) {
+	pad := gt.state(state)
+
+	if loc, ok := state.Uniforms[gt.uniformName]; ok {
+		gt.pix = [texWidth * 2]float32{}
+		if pad != nil {
+			copy(gt.pix[:texWidth], pad.Axes[:])
+			for i, pressed := range pad.Buttons {
+				if pressed {
+					gt.pix[texWidth+i] = 1
+				}
+			}
+		}
+		gl.ActiveTexture(gl.TEXTURE0 + gt.index)
+		gl.BindTexture(gl.TEXTURE_2D, gt.id)
+		gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, texWidth, 2, gl.RED, gl.FLOAT, gl.Ptr(&gt.pix[0]))
+		gl.Uniform1i(loc.Location, int32(gt.index))
+	}
+	if m := shadertoy.IchannelNumRe.FindStringSubmatch(gt.uniformName); m != nil {
+		if loc, ok := state.Uniforms[fmt.Sprintf("iChannelResolution[%s]", m[1])]; ok {
+			gl.Uniform3f(loc.Location, texWidth, 2, 1.0)
+		}
+	}
+
+	sticks, triggers, buttons, dpad := uniformValues(pad)
+	for suffix, v := range map[string][4]float32{
+		"Sticks":   sticks,
+		"Triggers": triggers,
+		"Buttons":  buttons,
+		"Dpad":     dpad,
+	} {
+		if loc, ok := state.Uniforms[gt.uniformName+suffix]; ok {
+			gl.Uniform4f(loc.Location, v[0], v[1], v[2], v[3])
+		}
+	}
+	if loc, ok := state.Uniforms[gt.uniformName+"Connected"]; ok {
+		var connected float32
+		if pad != nil {
+			connected = 1
+		}
+		gl.Uniform1f(loc.Location, connected)
+	}
+}
+
+func (gt *gamepadTexture) Close() error {
+	gl.DeleteTextures(1, &gt.id)
+	if gt.evdev != nil {
+		return gt.evdev.Close()
+	}
+	return nil
+}
@@ -5,7 +5,6 @@ import (
 	"image"
 	"image/draw"
 	"math/rand"
-	"os"
 
 	"github.com/go-gl/gl/v3.3-core/gl"
 
@@ -32,12 +31,12 @@ func init() {
 			return nil, fmt.Errorf("unknown builtin mapping %q", m.Value)
 		}
 	})
-	shadertoy.RegisterResourceType("image", func(m shadertoy.Mapping, genTexID shadertoy.GenTexFunc, _ renderer.RenderState) (shadertoy.Resource, error) {
+	shadertoy.RegisterResourceType("image", func(m shadertoy.Mapping, genTexID shadertoy.GenTexFunc, state renderer.RenderState) (shadertoy.Resource, error) {
 		path, err := shadertoy.ResolvePath(m.PWD, m.Value)
 		if err != nil {
 			return nil, err
 		}
-		fd, err := os.Open(path)
+		fd, err := renderer.OpenFile(state.FS, path)
 		if err != nil {
 			return nil, err
 		}
@@ -49,6 +48,25 @@ func init() {
 		r := newImageTexture(img, m.Name, genTexID())
 		return r, nil
 	})
+	shadertoy.RegisterDeclareFunc("builtin", func(m shadertoy.Mapping, _ renderer.RenderState) (string, error) {
+		switch m.Value {
+		case "Back Buffer", "RGBA Noise Small", "RGBA Noise Medium":
+			return uniformSource(m.Name), nil
+		default:
+			return "", fmt.Errorf("unknown builtin mapping %q", m.Value)
+		}
+	})
+	shadertoy.RegisterDeclareFunc("image", func(m shadertoy.Mapping, _ renderer.RenderState) (string, error) {
+		return uniformSource(m.Name), nil
+	})
+	shadertoy.RegisterRelocateFunc("image", func(m shadertoy.Mapping, relocate func(string) string) (shadertoy.Mapping, error) {
+		path, err := shadertoy.ResolvePath(m.PWD, m.Value)
+		if err != nil {
+			return m, err
+		}
+		m.Value = relocate(path)
+		return m, nil
+	})
 }
 
 // imageTexture is a mapping of a static image texture.
@@ -96,10 +114,14 @@ func newImageTexture(img image.Image, uniformName string, texID uint32) *imageTe
 }
 
 func (tex *imageTexture) UniformSource() string {
+	return uniformSource(tex.uniformName)
+}
+
+func uniformSource(uniformName string) string {
 	return fmt.Sprintf(`
 		uniform sampler2D %s;
 		uniform vec3 %sSize;
-	`, tex.uniformName, tex.uniformName)
+	`, uniformName, uniformName)
 }
 
 func (tex *imageTexture) PreRender(state renderer.RenderState) {
@@ -136,10 +158,7 @@ type backBufferImage struct {
 }
 
 func (tex *backBufferImage) UniformSource() string {
-	return fmt.Sprintf(`
-		uniform sampler2D %s;
-		uniform vec3 %sSize;
-	`, tex.uniformName, tex.uniformName)
+	return uniformSource(tex.uniformName)
 }
 
 func (tex *backBufferImage) PreRender(state renderer.RenderState) {
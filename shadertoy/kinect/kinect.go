@@ -47,6 +47,9 @@ func init() {
 		}
 		return kin, nil
 	})
+	shadertoy.RegisterDeclareFunc("kinect", func(m shadertoy.Mapping, _ renderer.RenderState) (string, error) {
+		return uniformSource(m.Name), nil
+	})
 }
 
 type kinect struct {
@@ -130,11 +133,15 @@ func (kin *kinect) Close() error {
 }
 
 func (kin *kinect) UniformSource() string {
+	return uniformSource(kin.uniformName)
+}
+
+func uniformSource(uniformName string) string {
 	return fmt.Sprintf(`
 		uniform sampler2D %s;
 		uniform vec3 %sSize;
 		uniform float %sCurTime;
-	`, kin.uniformName, kin.uniformName, kin.uniformName)
+	`, uniformName, uniformName, uniformName)
 }
 
 func (kin *kinect) PreRender(state renderer.RenderState) {
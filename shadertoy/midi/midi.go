@@ -0,0 +1,318 @@
+package midi
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+func init() {
+	shadertoy.RegisterResourceType("midi", func(m shadertoy.Mapping, genTexID shadertoy.GenTexFunc, _ renderer.RenderState) (shadertoy.Resource, error) {
+		path, bindings, err := parseMappingValue(m.PWD, m.Value)
+		if err != nil {
+			return nil, err
+		}
+		c, err := controllers.Open(path, func() (*controller, error) {
+			fd, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			return newController(fd), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return newMidiTexture(m.Name, path, c, bindings, genTexID()), nil
+	})
+	shadertoy.RegisterDeclareFunc("midi", func(m shadertoy.Mapping, _ renderer.RenderState) (string, error) {
+		_, bindings, err := parseMappingValue(m.PWD, m.Value)
+		if err != nil {
+			return "", err
+		}
+		return uniformSource(m.Name, bindings), nil
+	})
+}
+
+const (
+	numChannels = 16
+	numControls = 128
+)
+
+var (
+	midiValueRe = regexp.MustCompile(`^\s*([^{]*?)\s*(?:\{(.*)\})?\s*$`)
+	midiCCRe    = regexp.MustCompile(`^cc(\d+)(?:@(\d+))?$`)
+)
+
+// A binding sets a float uniform to the value of a control change.
+type binding struct {
+	uniformName string
+	channel     int
+	control     int
+}
+
+// parseMappingValue parses a value of the form
+// `<path> [{float <name> cc<number>[@<channel>]; ...}]`.
+func parseMappingValue(pwd, value string) (string, []binding, error) {
+	match := midiValueRe.FindStringSubmatch(value)
+	if match == nil || match[1] == "" {
+		return "", nil, fmt.Errorf("could not parse midi value: %q", value)
+	}
+	path, err := shadertoy.ResolvePath(pwd, match[1])
+	if err != nil {
+		return "", nil, err
+	}
+
+	var bindings []binding
+	for _, decl := range strings.Split(match[2], ";") {
+		fields := strings.Fields(decl)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 || fields[0] != "float" {
+			return "", nil, fmt.Errorf("invalid midi binding %q, expected float <name> cc<number>[@<channel>]", strings.TrimSpace(decl))
+		}
+		m := midiCCRe.FindStringSubmatch(fields[2])
+		if m == nil {
+			return "", nil, fmt.Errorf("invalid control %q, expected cc<number>[@<channel>]", fields[2])
+		}
+		b := binding{uniformName: fields[1], channel: 1}
+		b.control, _ = strconv.Atoi(m[1])
+		if m[2] != "" {
+			b.channel, _ = strconv.Atoi(m[2])
+		}
+		if b.control >= numControls || b.channel < 1 || b.channel > numChannels {
+			return "", nil, fmt.Errorf("control %q is out of range", fields[2])
+		}
+		b.channel--
+		for _, other := range bindings {
+			if other.uniformName == b.uniformName {
+				return "", nil, fmt.Errorf("uniform %q is bound more than once", b.uniformName)
+			}
+		}
+		bindings = append(bindings, b)
+	}
+	return path, bindings, nil
+}
+
+// controllers holds the opened devices by path, so mappings of the same device
+// can be used at the same time.
+var controllers shadertoy.DevicePool[*controller]
+
+// controller holds the state of the controls and notes of a MIDI device,
+// which is read in the background.
+type controller struct {
+	reader io.ReadCloser
+
+	lock sync.Mutex
+	// cc holds the value of each control change.
+	cc [numChannels][numControls]byte
+	// velocity holds the velocity with which each note was last pressed.
+	// held indicates which notes are currently pressed.
+	velocity [numChannels][numControls]byte
+	held     [numChannels][numControls]bool
+	// version is incremented each time the state changes.
+	version int
+
+	loopClosed chan struct{}
+}
+
+func newController(reader io.ReadCloser) *controller {
+	c := &controller{
+		reader:     reader,
+		version:    1,
+		loopClosed: make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+func (c *controller) readLoop() {
+	defer close(c.loopClosed)
+	var p parser
+	buf := make([]byte, 256)
+	for {
+		n, err := c.reader.Read(buf)
+		c.lock.Lock()
+		for _, b := range buf[:n] {
+			if ev, ok := p.feed(b); ok {
+				c.handle(ev)
+			}
+		}
+		c.lock.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handle updates the state with an event, the lock must be held.
+func (c *controller) handle(ev event) {
+	ch := ev.channel()
+	switch ev.kind() {
+	case statusNoteOn:
+		if ev.data[1] == 0 {
+			// A velocity of 0 is a common way to release a note.
+			c.held[ch][ev.data[0]] = false
+			break
+		}
+		c.held[ch][ev.data[0]] = true
+		c.velocity[ch][ev.data[0]] = ev.data[1]
+	case statusNoteOff:
+		c.held[ch][ev.data[0]] = false
+	case statusControlChange:
+		c.cc[ch][ev.data[0]] = ev.data[1]
+		// All Sound Off and All Notes Off.
+		if ev.data[0] == 120 || ev.data[0] == 123 {
+			c.held[ch] = [numControls]bool{}
+		}
+	default:
+		return
+	}
+	c.version++
+}
+
+// control returns the value of a control change in the range of 0 to 1.
+func (c *controller) control(channel, number int) float32 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return float32(c.cc[channel][number]) / 127
+}
+
+// pixels writes the state as RGBA texels to buf if it has changed since the
+// version, which is then updated. The texture has a row for each channel and
+// a column for each control and note. R holds the value of the control
+// change, G is 1 while the note is held and B is the velocity of the note.
+func (c *controller) pixels(buf []byte, version *int) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.version == *version {
+		return false
+	}
+	*version = c.version
+	for ch := 0; ch < numChannels; ch++ {
+		for i := 0; i < numControls; i++ {
+			px := buf[(ch*numControls+i)*4:]
+			px[0] = scale7(c.cc[ch][i])
+			px[1] = 0
+			if c.held[ch][i] {
+				px[1] = 0xff
+			}
+			px[2] = scale7(c.velocity[ch][i])
+			px[3] = 0xff
+		}
+	}
+	return true
+}
+
+// scale7 scales a 7-bit MIDI value to the full range of a byte.
+func scale7(v byte) byte {
+	return byte((int(v)*0xff + 63) / 127)
+}
+
+func (c *controller) Close() error {
+	// Closing the device unblocks the read loop.
+	err := c.reader.Close()
+	<-c.loopClosed
+	return err
+}
+
+// midiTexture is a mapping of the state of a MIDI device.
+type midiTexture struct {
+	uniformName string
+	id          uint32
+	index       uint32
+	path        string
+	controller  *controller
+	bindings    []binding
+	pix         []byte
+	// version is the version of the state of the controller in pix.
+	version int
+}
+
+func newMidiTexture(uniformName, path string, c *controller, bindings []binding, texIndex uint32) *midiTexture {
+	mt := &midiTexture{
+		uniformName: uniformName,
+		index:       texIndex,
+		path:        path,
+		controller:  c,
+		bindings:    bindings,
+		pix:         make([]byte, numChannels*numControls*4),
+	}
+	c.pixels(mt.pix, &mt.version)
+	gl.GenTextures(1, &mt.id)
+	gl.BindTexture(gl.TEXTURE_2D, mt.id)
+	gl.TexImage2D(
+		gl.TEXTURE_2D,    // target
+		0,                // level
+		gl.RGBA,          // internalFormat
+		numControls,      // width
+		numChannels,      // height
+		0,                // border
+		gl.RGBA,          // format
+		gl.UNSIGNED_BYTE, // type
+		gl.Ptr(mt.pix),   // data
+	)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	return mt
+}
+
+func (mt *midiTexture) UniformSource() string {
+	return uniformSource(mt.uniformName, mt.bindings)
+}
+
+func uniformSource(uniformName string, bindings []binding) string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "uniform sampler2D %s;\n", uniformName)
+	for _, b := range bindings {
+		fmt.Fprintf(&buf, "uniform float %s;\n", b.uniformName)
+	}
+	return buf.String()
+}
+
+func (mt *midiTexture) PreRender(state renderer.RenderState) {
+	if loc, ok := state.Uniforms[mt.uniformName]; ok {
+		gl.ActiveTexture(gl.TEXTURE0 + mt.index)
+		gl.BindTexture(gl.TEXTURE_2D, mt.id)
+		if mt.controller.pixels(mt.pix, &mt.version) {
+			gl.TexSubImage2D(
+				gl.TEXTURE_2D,    // target,
+				0,                // level,
+				0,                // xoffset,
+				0,                // yoffset,
+				numControls,      // width,
+				numChannels,      // height,
+				gl.RGBA,          // format,
+				gl.UNSIGNED_BYTE, // type,
+				gl.Ptr(mt.pix),   // data
+			)
+		}
+		gl.Uniform1i(loc.Location, int32(mt.index))
+	}
+	if m := shadertoy.IchannelNumRe.FindStringSubmatch(mt.uniformName); m != nil {
+		if loc, ok := state.Uniforms[fmt.Sprintf("iChannelResolution[%s]", m[1])]; ok {
+			gl.Uniform3f(loc.Location, numControls, numChannels, 1.0)
+		}
+	}
+	for _, b := range mt.bindings {
+		if loc, ok := state.Uniforms[b.uniformName]; ok {
+			gl.Uniform1f(loc.Location, mt.controller.control(b.channel, b.control))
+		}
+	}
+}
+
+func (mt *midiTexture) Close() error {
+	gl.DeleteTextures(1, &mt.id)
+	return controllers.Release(mt.path)
+}
@@ -0,0 +1,117 @@
+package midi
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParser(t *testing.T) {
+	stream := []byte{
+		0x90, 60, 100, // Note on, channel 1.
+		62, 90, // Running status.
+		0xf8,               // A clock tick.
+		0xb3, 7, 0xfe, 127, // A CC on channel 4, interrupted by active sensing.
+		0xf0, 0x7e, 1, 2, 0xf7, // SysEx.
+		20, 30, // Data without status after SysEx is ignored.
+		0x81, 60, 0, // Note off, channel 2.
+		0xc0, 5, // Program change.
+	}
+	var p parser
+	var events []event
+	for _, b := range stream {
+		if ev, ok := p.feed(b); ok {
+			events = append(events, ev)
+		}
+	}
+	exp := []event{
+		{status: 0x90, data: [2]byte{60, 100}},
+		{status: 0x90, data: [2]byte{62, 90}},
+		{status: 0xb3, data: [2]byte{7, 127}},
+		{status: 0x81, data: [2]byte{60, 0}},
+		{status: 0xc0, data: [2]byte{5, 0}},
+	}
+	if !reflect.DeepEqual(events, exp) {
+		t.Errorf("unexpected events: %v", events)
+	}
+}
+
+func TestParseMappingValue(t *testing.T) {
+	path, bindings, err := parseMappingValue("/", "/dev/snd/midiC1D0 {float cutoff cc74; float volume cc7@16}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []binding{
+		{uniformName: "cutoff", channel: 0, control: 74},
+		{uniformName: "volume", channel: 15, control: 7},
+	}
+	if path != "/dev/snd/midiC1D0" || !reflect.DeepEqual(bindings, exp) {
+		t.Errorf("unexpected result: %q %v", path, bindings)
+	}
+	if _, bindings, err := parseMappingValue("/", "/dev/snd/midiC1D0"); err != nil || bindings != nil {
+		t.Errorf("unexpected result without bindings: %v %v", bindings, err)
+	}
+
+	for _, value := range []string{
+		"",
+		"/dev/midi {int cutoff cc74}",
+		"/dev/midi {float cutoff 74}",
+		"/dev/midi {float cutoff cc128}",
+		"/dev/midi {float cutoff cc1@0}",
+		"/dev/midi {float cutoff cc1@17}",
+		"/dev/midi {float a cc1; float a cc2}",
+	} {
+		if _, _, err := parseMappingValue("/", value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
+
+func TestController(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "midi")
+	stream := []byte{
+		0xb0, 74, 127, // Cutoff, channel 1.
+		0xb1, 7, 64, // Volume, channel 2.
+		0x92, 60, 127, 64, 10, // Two notes on channel 3.
+		0x92, 64, 0, // Release the second using a note on.
+	}
+	if err := os.WriteFile(filename, stream, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fd, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newController(fd)
+	<-c.loopClosed // Wait until the whole file has been read.
+	defer c.Close()
+
+	if v := c.control(0, 74); v != 1 {
+		t.Errorf("unexpected value for cc74: %v", v)
+	}
+	if v := c.control(1, 7); v != 64.0/127 {
+		t.Errorf("unexpected value for cc7: %v", v)
+	}
+
+	pix := make([]byte, numChannels*numControls*4)
+	var version int
+	if !c.pixels(pix, &version) {
+		t.Fatal("expected the state to have changed")
+	}
+	texel := func(ch, i int) []byte {
+		return pix[(ch*numControls+i)*4:][:4]
+	}
+	if px := texel(0, 74); !reflect.DeepEqual(px, []byte{0xff, 0, 0, 0xff}) {
+		t.Errorf("unexpected texel for cc74: %v", px)
+	}
+	if px := texel(2, 60); !reflect.DeepEqual(px, []byte{0, 0xff, 0xff, 0xff}) {
+		t.Errorf("unexpected texel for a held note: %v", px)
+	}
+	if px := texel(2, 64); !reflect.DeepEqual(px, []byte{0, 0, scale7(10), 0xff}) {
+		t.Errorf("unexpected texel for a released note: %v", px)
+	}
+	if c.pixels(pix, &version) {
+		t.Error("expected the state to be unchanged")
+	}
+}
@@ -0,0 +1,93 @@
+package midi
+
+// MIDI status bytes without the channel.
+const (
+	statusNoteOff       = 0x80
+	statusNoteOn        = 0x90
+	statusControlChange = 0xb0
+	statusSysEx         = 0xf0
+	statusSysExEnd      = 0xf7
+	statusRealtime      = 0xf8
+)
+
+// An event is a MIDI channel or system common message.
+type event struct {
+	status byte
+	data   [2]byte
+}
+
+// channel returns the zero based channel of a channel message.
+func (e event) channel() int {
+	return int(e.status & 0x0f)
+}
+
+// kind returns the status byte without the channel of a channel message.
+func (e event) kind() byte {
+	if e.status >= 0xf0 {
+		return e.status
+	}
+	return e.status & 0xf0
+}
+
+// parser decodes a stream of MIDI bytes as it is produced by a raw MIDI
+// device, which may use running status and interleave realtime messages with
+// other messages.
+type parser struct {
+	status byte
+	data   [2]byte
+	n      int
+	sysex  bool
+}
+
+// dataLength returns the number of data bytes that follow a status byte.
+func dataLength(status byte) int {
+	switch {
+	case status >= 0xf0:
+		switch status {
+		case 0xf1, 0xf3:
+			return 1
+		case 0xf2:
+			return 2
+		}
+		return 0
+	case status&0xf0 == 0xc0, status&0xf0 == 0xd0:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// feed processes the next byte of the stream and returns a message once it is
+// complete. System exclusive and realtime messages are skipped.
+func (p *parser) feed(b byte) (event, bool) {
+	switch {
+	case b >= statusRealtime:
+		// Realtime messages may appear anywhere, even within other
+		// messages, and do not affect the running status.
+		return event{}, false
+	case b == statusSysEx:
+		p.sysex, p.status = true, 0
+		return event{}, false
+	case b >= 0x80:
+		p.sysex, p.status, p.n = false, b, 0
+		if b == statusSysExEnd || dataLength(b) == 0 {
+			p.status = 0
+		}
+		return event{}, false
+	case p.sysex || p.status == 0:
+		return event{}, false
+	}
+
+	p.data[p.n] = b
+	p.n++
+	if p.n < dataLength(p.status) {
+		return event{}, false
+	}
+	ev := event{status: p.status, data: p.data}
+	p.n = 0
+	if p.status >= 0xf0 {
+		// Only channel messages can use running status.
+		p.status = 0
+	}
+	return ev, true
+}
@@ -0,0 +1,162 @@
+package osc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+)
+
+var errTruncated = errors.New("truncated packet")
+
+// A message is a decoded OSC message. The arguments are of type int32, int64,
+// float32, float64, string, []byte, bool, nil, color.RGBA or rune.
+type message struct {
+	Address string
+	Args    []any
+}
+
+// decodePacket decodes an OSC packet, which is either a single message or a
+// bundle of packets. The messages of bundles are returned immediately
+// regardless of their time tag.
+func decodePacket(b []byte) ([]message, error) {
+	if len(b) == 0 {
+		return nil, errTruncated
+	}
+	if b[0] == '/' {
+		msg, err := decodeMessage(b)
+		if err != nil {
+			return nil, err
+		}
+		return []message{msg}, nil
+	}
+
+	name, b, err := readString(b)
+	if err != nil {
+		return nil, err
+	}
+	if name != "#bundle" {
+		return nil, fmt.Errorf("invalid packet starting with %q", name)
+	}
+	if len(b) < 8 {
+		return nil, errTruncated
+	}
+	b = b[8:] // Time tag.
+	var messages []message
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return nil, errTruncated
+		}
+		size := int(binary.BigEndian.Uint32(b))
+		if size > len(b)-4 {
+			return nil, errTruncated
+		}
+		elem, err := decodePacket(b[4 : 4+size])
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, elem...)
+		b = b[4+size:]
+	}
+	return messages, nil
+}
+
+func decodeMessage(b []byte) (message, error) {
+	address, b, err := readString(b)
+	if err != nil {
+		return message{}, err
+	}
+	msg := message{Address: address}
+	if len(b) == 0 {
+		// Very old implementations omit the type tags of messages without
+		// arguments.
+		return msg, nil
+	}
+	tags, b, err := readString(b)
+	if err != nil {
+		return message{}, err
+	}
+	if tags == "" || tags[0] != ',' {
+		return message{}, fmt.Errorf("%s: invalid type tags %q", address, tags)
+	}
+
+	for _, tag := range tags[1:] {
+		var arg any
+		switch tag {
+		case 'i', 'f', 'r', 'c', 'm':
+			if len(b) < 4 {
+				return message{}, errTruncated
+			}
+			v := binary.BigEndian.Uint32(b)
+			b = b[4:]
+			switch tag {
+			case 'i':
+				arg = int32(v)
+			case 'f':
+				arg = math.Float32frombits(v)
+			case 'r':
+				arg = color.RGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}
+			case 'c':
+				arg = rune(v)
+			case 'm':
+				arg = int32(v) // MIDI messages are passed as a number.
+			}
+		case 'h', 'd', 't':
+			if len(b) < 8 {
+				return message{}, errTruncated
+			}
+			v := binary.BigEndian.Uint64(b)
+			b = b[8:]
+			switch tag {
+			case 'h', 't':
+				arg = int64(v)
+			case 'd':
+				arg = math.Float64frombits(v)
+			}
+		case 's', 'S':
+			arg, b, err = readString(b)
+			if err != nil {
+				return message{}, err
+			}
+		case 'b':
+			if len(b) < 4 {
+				return message{}, errTruncated
+			}
+			size := int(binary.BigEndian.Uint32(b))
+			if size > len(b)-4 {
+				return message{}, errTruncated
+			}
+			arg = b[4 : 4+size]
+			b = b[min(4+pad(size), len(b)):]
+		case 'T':
+			arg = true
+		case 'F':
+			arg = false
+		case 'N', 'I':
+			arg = nil
+		case '[', ']':
+			// Arrays are flattened.
+			continue
+		default:
+			return message{}, fmt.Errorf("%s: unknown type tag %q", address, tag)
+		}
+		msg.Args = append(msg.Args, arg)
+	}
+	return msg, nil
+}
+
+// readString reads a null terminated string that is padded to a multiple of 4
+// bytes.
+func readString(b []byte) (string, []byte, error) {
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return "", nil, errTruncated
+	}
+	return string(b[:i]), b[min(pad(i+1), len(b)):], nil
+}
+
+func pad(n int) int {
+	return (n + 3) &^ 3
+}
@@ -0,0 +1,351 @@
+package osc
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"log"
+	"math"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+func init() {
+	shadertoy.RegisterResourceType("osc", func(m shadertoy.Mapping, _ shadertoy.GenTexFunc, _ renderer.RenderState) (shadertoy.Resource, error) {
+		return newReceiver(m.Name, m.Value)
+	})
+	shadertoy.RegisterDeclareFunc("osc", func(m shadertoy.Mapping, _ renderer.RenderState) (string, error) {
+		r, _, err := parseReceiver(m.Name, m.Value)
+		if err != nil {
+			return "", err
+		}
+		return r.UniformSource(), nil
+	})
+}
+
+// maxPacketSize is the largest UDP datagram that can be received.
+const maxPacketSize = 65536
+
+var valueRe = regexp.MustCompile(`^\s*([^{]*?)\s*\{(.*)\}\s*$`)
+
+// A binding maps an OSC address to a uniform.
+type binding struct {
+	address string
+	uniform renderer.Uniform
+	// color indicates that the uniform is a vec4 that accepts OSC colors
+	// and RGB values.
+	color bool
+}
+
+// listeners holds the sockets that are listened on by address, so mappings
+// that listen on the same address can be used at the same time.
+var listeners shadertoy.DevicePool[*listener]
+
+// A listener receives OSC messages on a UDP socket and passes them to the
+// receivers that use it.
+type listener struct {
+	addr string
+	conn net.PacketConn
+
+	lock      sync.Mutex
+	receivers map[*receiver]bool
+
+	loopClosed chan struct{}
+}
+
+func listen(addr string) (*listener, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("osc: %w", err)
+	}
+	l := &listener{
+		addr:       addr,
+		conn:       conn,
+		receivers:  map[*receiver]bool{},
+		loopClosed: make(chan struct{}),
+	}
+	go l.receiveLoop()
+	return l, nil
+}
+
+func (l *listener) receiveLoop() {
+	defer close(l.loopClosed)
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := l.conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			log.Printf("osc %s: %v", l.addr, err)
+			continue
+		}
+		messages, err := decodePacket(buf[:n])
+		if err != nil {
+			log.Printf("osc %s: invalid packet from %v: %v", l.addr, from, err)
+			continue
+		}
+		for _, msg := range messages {
+			l.dispatch(msg)
+		}
+	}
+}
+
+// dispatch passes a message to the receivers.
+func (l *listener) dispatch(msg message) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	bound := false
+	for r := range l.receivers {
+		bound = r.handle(msg) || bound
+	}
+	if !bound && shadertoy.Verbose {
+		log.Printf("osc %s: unknown address %s %v", l.addr, msg.Address, msg.Args)
+	}
+}
+
+func (l *listener) setReceiving(r *receiver, receiving bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if receiving {
+		l.receivers[r] = true
+	} else {
+		delete(l.receivers, r)
+	}
+}
+
+func (l *listener) Close() error {
+	err := l.conn.Close()
+	<-l.loopClosed
+	return err
+}
+
+// receiver sets uniforms to the values of the OSC messages that are sent to
+// bound addresses.
+type receiver struct {
+	name     string
+	bindings map[string]binding
+	// smoothing is the time constant in seconds of the exponential
+	// smoothing that is applied to float values. Values are set
+	// immediately if it is 0.
+	smoothing float64
+	// addr is the address of the listener.
+	addr     string
+	listener *listener
+
+	lock sync.Mutex
+	// targets holds the most recently received values by address.
+	targets map[string][]float64
+	// current holds the smoothed values by uniform name, it is only
+	// accessed from the render thread.
+	current map[string][]float64
+}
+
+// newReceiver creates a receiver from a mapping value of the form
+// `[host:]port[;smooth=seconds] {<type> <name> <address>; ...}` and starts
+// listening. The socket is shared with other receivers on the same address.
+func newReceiver(name, value string) (*receiver, error) {
+	r, addr, err := parseReceiver(name, value)
+	if err != nil {
+		return nil, err
+	}
+	l, err := listeners.Open(addr, func() (*listener, error) { return listen(addr) })
+	if err != nil {
+		return nil, err
+	}
+	r.addr, r.listener = addr, l
+	l.setReceiving(r, true)
+	return r, nil
+}
+
+// parseReceiver creates a receiver that is not listening yet from a mapping
+// value and returns the address to listen on.
+func parseReceiver(name, value string) (*receiver, string, error) {
+	match := valueRe.FindStringSubmatch(value)
+	if match == nil {
+		return nil, "", fmt.Errorf("osc: expected a list of bindings like {float speed /1/fader1} after %q", value)
+	}
+	r := &receiver{
+		name:    name,
+		targets: map[string][]float64{},
+		current: map[string][]float64{},
+	}
+	options := strings.Split(match[1], ";")
+	for _, opt := range options[1:] {
+		key, val, _ := strings.Cut(opt, "=")
+		switch key {
+		case "smooth":
+			f, err := strconv.ParseFloat(val, 64)
+			if err != nil || f < 0 {
+				return nil, "", fmt.Errorf("osc: invalid smoothing time %q", val)
+			}
+			r.smoothing = f
+		default:
+			return nil, "", fmt.Errorf("osc: unknown option %q", opt)
+		}
+	}
+	var err error
+	if r.bindings, err = parseBindings(match[2]); err != nil {
+		return nil, "", fmt.Errorf("osc: %w", err)
+	}
+
+	addr := options[0]
+	if _, err := strconv.Atoi(addr); err == nil {
+		addr = ":" + addr
+	}
+	return r, addr, nil
+}
+
+func parseBindings(str string) (map[string]binding, error) {
+	bindings := map[string]binding{}
+	names := map[string]bool{}
+	for _, decl := range strings.Split(str, ";") {
+		fields := strings.Fields(decl)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid binding %q, expected <type> <name> <address>", strings.TrimSpace(decl))
+		}
+		b := binding{
+			uniform: renderer.Uniform{Name: fields[1]},
+			address: fields[2],
+		}
+		switch fields[0] {
+		case "float", "int", "vec2", "vec3", "vec4":
+			b.uniform.Type, _ = renderer.ParseTypeLiteral(fields[0])
+		case "color":
+			b.uniform.Type, b.color = gl.FLOAT_VEC4, true
+		default:
+			return nil, fmt.Errorf("unsupported type %q in binding of %q", fields[0], fields[1])
+		}
+		if !strings.HasPrefix(b.address, "/") {
+			return nil, fmt.Errorf("invalid OSC address %q", b.address)
+		}
+		if names[b.uniform.Name] {
+			return nil, fmt.Errorf("uniform %q is bound more than once", b.uniform.Name)
+		}
+		if _, ok := bindings[b.address]; ok {
+			return nil, fmt.Errorf("address %q is bound more than once", b.address)
+		}
+		names[b.uniform.Name] = true
+		bindings[b.address] = b
+	}
+	if len(bindings) == 0 {
+		return nil, fmt.Errorf("no addresses are bound")
+	}
+	return bindings, nil
+}
+
+// handle stores the value of a message. It reports whether the address of
+// the message is bound.
+func (r *receiver) handle(msg message) bool {
+	b, ok := r.bindings[msg.Address]
+	if !ok {
+		return false
+	}
+	values, err := b.values(msg.Args)
+	if err != nil {
+		log.Printf("osc %s: %s: %v", r.name, msg.Address, err)
+		return true
+	}
+	r.lock.Lock()
+	r.targets[msg.Address] = values
+	r.lock.Unlock()
+	return true
+}
+
+// values converts the arguments of a message to the value of the uniform.
+func (b binding) values(args []any) ([]float64, error) {
+	if b.color && len(args) == 1 {
+		if c, ok := args[0].(color.RGBA); ok {
+			return []float64{
+				float64(c.R) / 0xff,
+				float64(c.G) / 0xff,
+				float64(c.B) / 0xff,
+				float64(c.A) / 0xff,
+			}, nil
+		}
+	}
+	n := b.uniform.Components()
+	if b.color && len(args) == 3 {
+		args = append(args, float32(1))
+	}
+	if len(args) != n {
+		return nil, fmt.Errorf("%s %s takes %d arguments, got %d", b.uniform.TypeLiteral(), b.uniform.Name, n, len(args))
+	}
+	values := make([]float64, n)
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case int32:
+			values[i] = float64(v)
+		case int64:
+			values[i] = float64(v)
+		case float32:
+			values[i] = float64(v)
+		case float64:
+			values[i] = v
+		case bool:
+			if v {
+				values[i] = 1
+			}
+		default:
+			return nil, fmt.Errorf("argument %d of type %T is not a number", i, arg)
+		}
+	}
+	return values, nil
+}
+
+func (r *receiver) UniformSource() string {
+	var decls []string
+	for _, b := range r.bindings {
+		decls = append(decls, fmt.Sprintf("uniform %s %s;\n", b.uniform.TypeLiteral(), b.uniform.Name))
+	}
+	sort.Strings(decls)
+	return strings.Join(decls, "")
+}
+
+// advance moves the current values towards the received values by the
+// specified number of seconds.
+func (r *receiver) advance(interval float64) {
+	var a float64 = 1
+	if r.smoothing > 0 {
+		a = 1 - math.Exp(-interval/r.smoothing)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for address, target := range r.targets {
+		name := r.bindings[address].uniform.Name
+		cur, ok := r.current[name]
+		// Integers are not smoothed, they are set immediately.
+		if !ok || a == 1 || r.bindings[address].uniform.Type == gl.INT {
+			r.current[name] = append([]float64(nil), target...)
+			continue
+		}
+		for i := range cur {
+			cur[i] += (target[i] - cur[i]) * a
+		}
+	}
+}
+
+func (r *receiver) PreRender(state renderer.RenderState) {
+	r.advance(state.Interval.Seconds())
+	for name, values := range r.current {
+		if u, ok := state.Uniforms[name]; ok {
+			u.Set(values...)
+		}
+	}
+}
+
+func (r *receiver) Close() error {
+	r.listener.setReceiving(r, false)
+	return listeners.Release(r.addr)
+}
@@ -0,0 +1,215 @@
+package osc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"math"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// encodeMessage encodes an OSC message with int32, float32, string and
+// color.RGBA arguments.
+func encodeMessage(address string, args ...any) []byte {
+	var buf bytes.Buffer
+	writeString := func(s string) {
+		buf.WriteString(s)
+		buf.Write(make([]byte, pad(len(s)+1)-len(s)))
+	}
+	writeString(address)
+	tags := ","
+	for _, arg := range args {
+		switch arg.(type) {
+		case int32:
+			tags += "i"
+		case float32:
+			tags += "f"
+		case string:
+			tags += "s"
+		case color.RGBA:
+			tags += "r"
+		}
+	}
+	writeString(tags)
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case int32:
+			binary.Write(&buf, binary.BigEndian, v)
+		case float32:
+			binary.Write(&buf, binary.BigEndian, math.Float32bits(v))
+		case string:
+			writeString(v)
+		case color.RGBA:
+			buf.Write([]byte{v.R, v.G, v.B, v.A})
+		}
+	}
+	return buf.Bytes()
+}
+
+func encodeBundle(messages ...[]byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("#bundle\x00")
+	buf.Write([]byte{0, 0, 0, 0, 0, 0, 0, 1}) // Immediately.
+	for _, msg := range messages {
+		binary.Write(&buf, binary.BigEndian, uint32(len(msg)))
+		buf.Write(msg)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodePacket(t *testing.T) {
+	packet := encodeBundle(
+		encodeMessage("/1/fader1", float32(0.5)),
+		encodeMessage("/label", "hi", int32(-3)),
+	)
+	messages, err := decodePacket(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []message{
+		{Address: "/1/fader1", Args: []any{float32(0.5)}},
+		{Address: "/label", Args: []any{"hi", int32(-3)}},
+	}
+	if !reflect.DeepEqual(messages, exp) {
+		t.Errorf("unexpected messages: %#v", messages)
+	}
+
+	msg := encodeMessage("/label", "hi", int32(-3))
+	// The first 8 bytes are a message without type tags, which is valid.
+	for i := 9; i < len(msg); i++ {
+		if _, err := decodePacket(msg[:i]); err == nil {
+			t.Errorf("expected an error for a message truncated to %d bytes", i)
+		}
+	}
+}
+
+func TestParseBindings(t *testing.T) {
+	for _, str := range []string{
+		"",
+		"float speed",
+		"mat4 view /view",
+		"float speed 1/fader",
+		"float a /x; float b /x",
+		"float a /x; vec2 a /y",
+	} {
+		if _, err := parseBindings(str); err == nil {
+			t.Errorf("expected an error for %q", str)
+		}
+	}
+}
+
+func TestReceiver(t *testing.T) {
+	r, err := newReceiver("ctl", "127.0.0.1:0 {float speed /1/fader1; int mode /mode; vec2 pos /xy; color tint /tint; color bg /bg}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	conn, err := net.Dial("udp", r.listener.conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, packet := range [][]byte{
+		encodeMessage("/1/fader1", float32(0.25)),
+		encodeMessage("/mode", int32(3)),
+		encodeMessage("/xy", float32(1)), // Missing an argument.
+		encodeMessage("/xy", float32(1), int32(2)),
+		encodeMessage("/unknown", float32(1)),
+		encodeBundle(
+			encodeMessage("/tint", color.RGBA{R: 0xff, B: 0x33, A: 0xff}),
+			encodeMessage("/bg", float32(0.5), float32(0.5), float32(0.5)),
+		),
+	} {
+		if _, err := conn.Write(packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exp := map[string][]float64{
+		"speed": {0.25},
+		"mode":  {3},
+		"pos":   {1, 2},
+		"tint":  {1, 0, 0.2, 1},
+		"bg":    {0.5, 0.5, 0.5, 1},
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		r.advance(0)
+		if reflect.DeepEqual(r.current, exp) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected values: %v", r.current)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReceiverSharesSocket(t *testing.T) {
+	probe, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := probe.LocalAddr().String()
+	probe.Close()
+
+	a, err := newReceiver("a", addr+" {float speed /speed}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A changed mapping on the same address is opened while the previous one
+	// is still in use, like when the shader is reloaded.
+	b, err := newReceiver("b", addr+" {float speed /speed; int mode /mode}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(encodeMessage("/mode", int32(2))); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b.advance(0)
+		if reflect.DeepEqual(b.current, map[string][]float64{"mode": {2}}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected values: %v", b.current)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReceiverSmoothing(t *testing.T) {
+	r, err := newReceiver("ctl", "127.0.0.1:0;smooth=0.5 {float speed /speed; int mode /mode}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	r.handle(message{Address: "/speed", Args: []any{float32(0)}})
+	r.handle(message{Address: "/mode", Args: []any{int32(0)}})
+	r.advance(0.1)
+	r.handle(message{Address: "/speed", Args: []any{float32(1)}})
+	r.handle(message{Address: "/mode", Args: []any{int32(4)}})
+	r.advance(0.5)
+	if v := r.current["speed"][0]; math.Abs(v-(1-math.Exp(-1))) > 1e-9 {
+		t.Errorf("unexpected smoothed value: %v", v)
+	}
+	if v := r.current["mode"][0]; v != 4 {
+		t.Errorf("integers should not be smoothed, got %v", v)
+	}
+}
@@ -4,10 +4,10 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"regexp"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
@@ -19,123 +19,274 @@ import (
 )
 
 func init() {
+	shadertoy.RegisterResourceType("perip", func(m shadertoy.Mapping, _ shadertoy.GenTexFunc, _ renderer.RenderState) (shadertoy.Resource, error) {
+		source, schema, err := parseMappingValue(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		return newPeripheral(m.Name, m.PWD, source, schema)
+	})
+	shadertoy.RegisterDeclareFunc("perip", func(m shadertoy.Mapping, _ renderer.RenderState) (string, error) {
+		_, schema, err := parseMappingValue(m.Value)
+		if err != nil {
+			return "", err
+		}
+		return schema.UniformSource(), nil
+	})
 	shadertoy.RegisterResourceType("perip_mat4", func(m shadertoy.Mapping, _ shadertoy.GenTexFunc, _ renderer.RenderState) (shadertoy.Resource, error) {
-		return newMat4Peripheral(m.Name, m.PWD, m.Value)
+		schema := Schema{{Name: m.Name, Type: gl.FLOAT_MAT4}}
+		return newPeripheral(m.Name, m.PWD, m.Value, schema)
+	})
+	shadertoy.RegisterDeclareFunc("perip_mat4", func(m shadertoy.Mapping, _ renderer.RenderState) (string, error) {
+		return Schema{{Name: m.Name, Type: gl.FLOAT_MAT4}}.UniformSource(), nil
 	})
 }
 
+// parseMappingValue parses a value of the form `<source> {<schema>}`.
+func parseMappingValue(value string) (string, Schema, error) {
+	match := periphSchema.FindStringSubmatch(value)
+	if match == nil {
+		return "", nil, fmt.Errorf("perip: expected a schema like {float speed; vec3 color} after %q", value)
+	}
+	schema, err := ParseSchema(match[2])
+	if err != nil {
+		return "", nil, fmt.Errorf("perip: %w", err)
+	}
+	return match[1], schema, nil
+}
+
 var (
 	periphFile   = regexp.MustCompile(`^([^;]+)(\??)$`)
 	periphSerial = regexp.MustCompile(`^([^;]+);(\d+)(\??)$`)
+	periphSchema = regexp.MustCompile(`^\s*(.*?)\s*\{(.*)\}\s*$`)
 )
 
-type periphMat4 struct {
-	uniformName        string
-	currentValue       [16]float32
-	currentValueLock   sync.Mutex
-	closed, loopClosed chan struct{}
+// periph sets the uniforms of the schema to the values of the lines of the
+// protocol described by ParseLine that are read from a file or serial device.
+type periph struct {
+	name   string
+	schema Schema
+	values *Values
+
+	// path is the key of the device in devices. The device is nil if it is
+	// optional and could not be opened.
+	path   string
+	device *device
 }
 
-func newMat4Peripheral(uniformName, pwd, value string) (shadertoy.Resource, error) {
-	var reader io.ReadCloser
-	var err error
-	var failSilent bool
-	if match := periphFile.FindStringSubmatch(value); match != nil {
-		failSilent = match[2] != ""
-		path, err := shadertoy.ResolvePath(pwd, match[1])
+func newPeripheral(name, pwd, source string, schema Schema) (shadertoy.Resource, error) {
+	path, baudrate, optional, err := parseSource(pwd, source)
+	if err != nil {
+		return nil, err
+	}
+	pr := &periph{
+		name:   name,
+		schema: schema,
+		values: NewValues(schema),
+	}
+	dev, err := devices.Open(path, func() (*device, error) {
+		reader, err := openSource(path, baudrate)
 		if err != nil {
 			return nil, err
 		}
-		var fd *os.File
-		fd, err = os.Open(path)
-		if err == nil {
-			reader = fd
+		// The first peripheral is added before reading starts, so no lines
+		// of a file are missed.
+		return newDevice(reader, pr), nil
+	})
+	if err != nil {
+		if optional {
+			return pr, nil
 		}
+		return nil, err
+	}
+	pr.path, pr.device = path, dev
+	dev.setReading(pr, true)
+	return pr, nil
+}
+
+// handle sets the values of a line that was read.
+func (pr *periph) handle(lineNum int, line string) {
+	name, values, err := pr.schema.ParseLine(line)
+	if err != nil {
+		log.Printf("perip %s: line %d: %v", pr.name, lineNum, err)
+		return
+	}
+	if name != "" {
+		pr.values.Set(name, values)
+	}
+}
 
-	} else if match := periphSerial.FindStringSubmatch(value); match != nil {
-		failSilent = match[3] != ""
+// parseSource parses the file or serial device of a mapping value, of which
+// the baudrate is 0 if it is a file. A trailing ? indicates that the
+// peripheral is optional.
+func parseSource(pwd, source string) (path string, baudrate int, optional bool, err error) {
+	if match := periphFile.FindStringSubmatch(source); match != nil {
+		path, err := shadertoy.ResolvePath(pwd, match[1])
+		return path, 0, match[2] != "", err
+	} else if match := periphSerial.FindStringSubmatch(source); match != nil {
 		baudrate, _ := strconv.Atoi(match[2])
-		var ser *serial.Port
-		ser, err = serial.OpenPort(&serial.Config{
-			Name:        match[1],
-			Baud:        baudrate,
-			ReadTimeout: time.Second * 10,
-		})
-		if err == nil {
-			reader = ser
-		} else if ser == nil {
-			err = fmt.Errorf("Serial device %q not found", match[1])
+		return match[1], baudrate, match[3] != "", nil
+	}
+	return "", 0, false, fmt.Errorf("unable to parse peripheral %q, expected <path>[;<baudrate>][?]", source)
+}
+
+// openSource opens a file or, if the baudrate is not 0, a serial device.
+func openSource(path string, baudrate int) (io.ReadCloser, error) {
+	if baudrate == 0 {
+		fd, err := os.Open(path)
+		if err != nil {
+			return nil, err
 		}
+		return fd, nil
 	}
-	if err != nil && !failSilent {
+	ser, err := serial.OpenPort(&serial.Config{
+		Name:        path,
+		Baud:        baudrate,
+		ReadTimeout: time.Second * 10,
+	})
+	if ser == nil && err != nil {
+		return nil, fmt.Errorf("Serial device %q not found", path)
+	} else if err != nil {
 		return nil, err
 	}
+	return ser, nil
+}
 
-	pr := &periphMat4{
-		uniformName: uniformName,
-		currentValue: [16]float32{
-			1, 0, 0, 0,
-			0, 1, 0, 0,
-			0, 0, 1, 0,
-			0, 0, 0, 1,
-		},
-	}
-	if reader == nil {
-		return pr, nil
-	}
-
-	pr.closed = make(chan struct{})
-	pr.loopClosed = make(chan struct{})
-	go func() {
-		defer reader.Close()
-		defer close(pr.loopClosed)
-		br := bufio.NewReader(reader)
-		for {
-			select {
-			case <-pr.closed:
-				break
-			default:
-			}
-
-			line, err := br.ReadBytes('\n')
-			if err != nil {
-				break
-			}
-			spl := strings.Split(string(line), " ")
-			if len(spl) != 17 || spl[0] != "mat4" {
-				continue
-			}
-			var out [16]float32
-			for i, v := range spl[1:] {
-				f, _ := strconv.ParseFloat(v, 32)
-				out[i] = float32(f)
-			}
-			pr.currentValueLock.Lock()
-			pr.currentValue = out
-			pr.currentValueLock.Unlock()
+func (pr *periph) UniformSource() string {
+	return pr.schema.UniformSource()
+}
+
+func (pr *periph) PreRender(state renderer.RenderState) {
+	pr.values.Apply(state)
+}
+
+func (pr *periph) Close() error {
+	if pr.device == nil {
+		return nil
+	}
+	pr.device.setReading(pr, false)
+	return devices.Release(pr.path)
+}
+
+// devices holds the opened files and serial devices by path, so mappings of
+// the same device can be used at the same time.
+var devices shadertoy.DevicePool[*device]
+
+// A device reads lines from a file or serial device in the background and
+// passes them to the peripherals that use it.
+type device struct {
+	reader io.ReadCloser
+
+	lock        sync.Mutex
+	peripherals map[*periph]bool
+
+	loopClosed chan struct{}
+}
+
+func newDevice(reader io.ReadCloser, first *periph) *device {
+	d := &device{
+		reader:      reader,
+		peripherals: map[*periph]bool{first: true},
+		loopClosed:  make(chan struct{}),
+	}
+	go d.readLoop()
+	return d
+}
+
+func (d *device) readLoop() {
+	defer close(d.loopClosed)
+	br := bufio.NewReader(d.reader)
+	for lineNum := 1; ; lineNum++ {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return
 		}
-	}()
+		d.lock.Lock()
+		for pr := range d.peripherals {
+			pr.handle(lineNum, line)
+		}
+		d.lock.Unlock()
+	}
+}
 
-	return pr, nil
+func (d *device) setReading(pr *periph, reading bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if reading {
+		d.peripherals[pr] = true
+	} else {
+		delete(d.peripherals, pr)
+	}
+}
+
+// Close closes the reader, which stops a read that is blocked waiting for a
+// line, and waits for the read loop to finish.
+func (d *device) Close() error {
+	err := d.reader.Close()
+	<-d.loopClosed
+	return err
 }
 
-func (pr *periphMat4) UniformSource() string {
-	return fmt.Sprintf("uniform mat4 %s;", pr.uniformName)
+// Values holds the most recent values of the uniforms of a schema. It is safe
+// for concurrent use, so values can be received in the background and applied
+// while rendering.
+type Values struct {
+	schema Schema
+	lock   sync.Mutex
+	values map[string][]float64
 }
 
-func (pr *periphMat4) PreRender(state renderer.RenderState) {
-	if loc, ok := state.Uniforms[pr.uniformName]; ok {
-		pr.currentValueLock.Lock()
-		gl.UniformMatrix4fv(loc.Location, 1, false, &pr.currentValue[0])
-		pr.currentValueLock.Unlock()
+// NewValues creates a value store for the specified schema. Square matrices
+// are initialized to the identity matrix, other uniforms are left at their
+// default value until they are set.
+func NewValues(schema Schema) *Values {
+	v := &Values{schema: schema, values: map[string][]float64{}}
+	for _, u := range schema {
+		var n int
+		switch u.Type {
+		case gl.FLOAT_MAT2:
+			n = 2
+		case gl.FLOAT_MAT3:
+			n = 3
+		case gl.FLOAT_MAT4:
+			n = 4
+		default:
+			continue
+		}
+		identity := make([]float64, n*n)
+		for i := 0; i < n; i++ {
+			identity[i*n+i] = 1
+		}
+		v.values[u.Name] = identity
 	}
+	return v
 }
 
-func (pr *periphMat4) Close() error {
-	if pr.closed == nil {
-		return nil
+// Set stores the value of a uniform.
+func (v *Values) Set(name string, values []float64) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.values[name] = values
+}
+
+// Get returns the stored value of a uniform or nil if it has not been set.
+func (v *Values) Get(name string) []float64 {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.values[name]
+}
+
+// Apply sets the stored values on the uniforms of the program that is in use.
+func (v *Values) Apply(state renderer.RenderState) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	for name, values := range v.values {
+		u, ok := state.Uniforms[name]
+		if !ok {
+			continue
+		}
+		if err := u.Set(values...); err != nil {
+			log.Println(err)
+		}
 	}
-	close(pr.closed)
-	<-pr.loopClosed
-	return nil
 }
@@ -0,0 +1,141 @@
+package peripheral
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSchema(t *testing.T) {
+	schema, err := ParseSchema(" float speed; vec3 color ;mat4 view; ivec2 cell; ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := "uniform float speed;\nuniform vec3 color;\nuniform mat4 view;\nuniform ivec2 cell;\n"
+	if src := schema.UniformSource(); src != exp {
+		t.Errorf("unexpected uniform source:\n%s", src)
+	}
+
+	for _, str := range []string{
+		"",
+		"float",
+		"sampler2D tex",
+		"float speed; vec2 speed",
+		"float 2fast",
+		"vec3 a b",
+	} {
+		if _, err := ParseSchema(str); err == nil {
+			t.Errorf("expected an error for %q", str)
+		}
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	schema, err := ParseSchema("float speed; vec3 color; ivec2 cell; mat2 rot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		line   string
+		name   string
+		values []float64
+	}{
+		{"float speed 2.5\n", "speed", []float64{2.5}},
+		{"vec3 color 1 0.5 0", "color", []float64{1, 0.5, 0}},
+		{"ivec2  cell -3 7\r\n", "cell", []float64{-3, 7}},
+		{"mat2 rot 0 1 -1 0", "rot", []float64{0, 1, -1, 0}},
+		{"\n", "", nil},
+		{"# a comment", "", nil},
+	}
+	for _, tt := range tests {
+		name, values, err := schema.ParseLine(tt.line)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %v", tt.line, err)
+			continue
+		}
+		if name != tt.name || !reflect.DeepEqual(values, tt.values) {
+			t.Errorf("unexpected result for %q: %q %v", tt.line, name, values)
+		}
+	}
+
+	for _, line := range []string{
+		"speed 2",
+		"float velocity 2",
+		"vec2 color 1 0",
+		"vec3 color 1 0",
+		"vec3 color 1 0 0 1",
+		"float speed fast",
+		"ivec2 cell 1.5 2",
+		"dvec2 cell 1 2",
+	} {
+		if _, _, err := schema.ParseLine(line); err == nil {
+			t.Errorf("expected an error for %q", line)
+		}
+	}
+}
+
+func TestPeripheralFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "input")
+	input := "float speed 2\nvec3 color 1 2\nvec3 color 1 2 3\nfloat speed 4\n"
+	if err := os.WriteFile(filename, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	schema, _ := ParseSchema("float speed; vec3 color; mat3 view")
+	res, err := newPeripheral("ctl", "/", filename, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr := res.(*periph)
+	<-pr.device.loopClosed // Wait until the whole file has been read.
+	defer pr.Close()
+
+	if v := pr.values.Get("speed"); !reflect.DeepEqual(v, []float64{4}) {
+		t.Errorf("unexpected speed: %v", v)
+	}
+	if v := pr.values.Get("color"); !reflect.DeepEqual(v, []float64{1, 2, 3}) {
+		t.Errorf("unexpected color: %v", v)
+	}
+	if v := pr.values.Get("view"); !reflect.DeepEqual(v, []float64{1, 0, 0, 0, 1, 0, 0, 0, 1}) {
+		t.Errorf("expected an identity matrix, got %v", v)
+	}
+}
+
+func TestLegacyMat4(t *testing.T) {
+	// Lines of the perip_mat4 loader omit the name of the uniform.
+	schema, _ := ParseSchema("mat4 transform")
+	name, values, err := schema.ParseLine("mat4 1 0 0 0 0 1 0 0 0 0 1 0 0.5 0 0 1\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "transform" || len(values) != 16 || values[12] != 0.5 {
+		t.Errorf("unexpected result: %q %v", name, values)
+	}
+}
+
+func TestDeviceClose(t *testing.T) {
+	schema, _ := ParseSchema("float speed")
+	pr := &periph{name: "ctl", schema: schema, values: NewValues(schema)}
+	r, w := io.Pipe()
+	defer w.Close()
+	dev := newDevice(r, pr)
+	if _, err := io.WriteString(w, "float speed 2\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		dev.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("close blocked while waiting for a line")
+	}
+	if v := pr.values.Get("speed"); !reflect.DeepEqual(v, []float64{2}) {
+		t.Errorf("unexpected speed: %v", v)
+	}
+}
@@ -0,0 +1,137 @@
+package peripheral
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// A Schema is the list of uniforms that can be driven by a peripheral.
+type Schema []renderer.Uniform
+
+// ParseSchema parses a list of declarations like "float speed; vec3 color".
+// The types are limited to float, int, vectors and matrices of floats.
+func ParseSchema(str string) (Schema, error) {
+	var schema Schema
+	for _, decl := range strings.Split(str, ";") {
+		fields := strings.Fields(decl)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid declaration %q, expected <type> <name>", strings.TrimSpace(decl))
+		}
+		typ, ok := parseType(fields[0])
+		if !ok {
+			return nil, fmt.Errorf("unsupported type %q in declaration of %q", fields[0], fields[1])
+		}
+		if !isIdentifier(fields[1]) {
+			return nil, fmt.Errorf("invalid uniform name %q", fields[1])
+		}
+		if _, ok := schema.Lookup(fields[1]); ok {
+			return nil, fmt.Errorf("uniform %q is declared more than once", fields[1])
+		}
+		schema = append(schema, renderer.Uniform{Name: fields[1], Type: typ})
+	}
+	if len(schema) == 0 {
+		return nil, fmt.Errorf("the schema does not declare any uniforms")
+	}
+	return schema, nil
+}
+
+// parseType parses the type literals that are supported by peripherals.
+func parseType(literal string) (uint32, bool) {
+	switch literal {
+	case "float", "vec2", "vec3", "vec4",
+		"int", "ivec2", "ivec3", "ivec4",
+		"mat2", "mat3", "mat4":
+		return renderer.ParseTypeLiteral(literal)
+	}
+	return 0, false
+}
+
+func isIdentifier(s string) bool {
+	for i, c := range s {
+		if c != '_' && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && (i == 0 || !('0' <= c && c <= '9')) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Lookup returns the declaration of the uniform with the specified name.
+func (s Schema) Lookup(name string) (renderer.Uniform, bool) {
+	for _, u := range s {
+		if u.Name == name {
+			return u, true
+		}
+	}
+	return renderer.Uniform{}, false
+}
+
+// UniformSource returns the GLSL declarations of the uniforms.
+func (s Schema) UniformSource() string {
+	var buf strings.Builder
+	for _, u := range s {
+		fmt.Fprintf(&buf, "uniform %s %s;\n", u.TypeLiteral(), u.Name)
+	}
+	return buf.String()
+}
+
+// ParseLine parses a line of the form "<type> <name> <values...>" and checks
+// it against the schema, e.g.:
+//
+//	vec3 color 1.0 0.5 0.0
+//
+// Matrices are specified in column-major order. If the schema declares a
+// single uniform, its name may be omitted. Empty lines and lines starting with
+// # are ignored, for which an empty name is returned.
+func (s Schema) ParseLine(line string) (string, []float64, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return "", nil, nil
+	}
+	if len(fields) < 2 {
+		return "", nil, fmt.Errorf("expected <type> <name> <values...>, got %q", strings.TrimSpace(line))
+	}
+	typ := fields[0]
+	if _, ok := parseType(typ); !ok {
+		return "", nil, fmt.Errorf("unsupported type %q", typ)
+	}
+
+	var u renderer.Uniform
+	var ok bool
+	if len(s) == 1 && !isIdentifier(fields[1]) {
+		u, ok, fields = s[0], true, fields[1:]
+	} else {
+		u, ok = s.Lookup(fields[1])
+		if !ok {
+			return "", nil, fmt.Errorf("unknown uniform %q", fields[1])
+		}
+		fields = fields[2:]
+	}
+	if lit := u.TypeLiteral(); lit != typ {
+		return "", nil, fmt.Errorf("uniform %q is declared as %s, got %s", u.Name, lit, typ)
+	}
+	if n := u.Components(); len(fields) != n {
+		return "", nil, fmt.Errorf("%s %s takes %d values, got %d", typ, u.Name, n, len(fields))
+	}
+
+	values := make([]float64, len(fields))
+	for i, f := range fields {
+		var err error
+		if typ[0] == 'i' {
+			var n int64
+			n, err = strconv.ParseInt(f, 10, 32)
+			values[i] = float64(n)
+		} else {
+			values[i], err = strconv.ParseFloat(f, 32)
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid value %q for %s %s", f, typ, u.Name)
+		}
+	}
+	return u.Name, values, nil
+}
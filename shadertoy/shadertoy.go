@@ -2,6 +2,7 @@ package shadertoy
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -17,10 +18,15 @@ var (
 	inputMappingSourceRe = regexp.MustCompile(`(?m)^#pragma\s+map\s+(\w+)=([^:]+):(.+)$`)
 	inputMappingRe       = regexp.MustCompile(`^(\w+)=([^:]+):(.+)$`)
 	IchannelNumRe        = regexp.MustCompile(`^iChannel(\d+)$`)
+	uniformDeclRe        = regexp.MustCompile(`\buniform\s+\w+\s+(\w+)`)
 )
 
 var texIndexEnum uint32
 
+// Verbose enables the logging of information that helps to debug mappings,
+// like input that is received by a resource but not used.
+var Verbose bool
+
 // A resource builder function a resource from instantiates a mapping
 // definition that can offer additional functionality to the renderer.
 //
@@ -40,19 +46,116 @@ func RegisterResourceType(name string, fn ResourceBuildFunc) {
 	resourceBuilders[name] = fn
 }
 
+// declarers holds the functions that declare the uniforms of the mappings of a
+// namespace without instantiating a resource.
+var declarers = map[string]DeclareFunc{}
+
+// A DeclareFunc returns the GLSL declarations of the uniforms of a mapping
+// without opening the devices it refers to. Files are read from state.FS.
+type DeclareFunc func(Mapping, renderer.RenderState) (string, error)
+
+// RegisterDeclareFunc registers how the uniforms of the mappings of a resource
+// type are declared, so shaders can be checked without instantiating the
+// resources.
+func RegisterDeclareFunc(name string, fn DeclareFunc) {
+	if _, ok := declarers[name]; ok {
+		panic(name + " already has a declare function")
+	}
+	declarers[name] = fn
+}
+
+// relocators holds the functions that rewrite the paths of the files that the
+// mappings of a namespace refer to. Namespaces without one do not refer to
+// files, or only to devices.
+var relocators = map[string]RelocateFunc{}
+
+// A RelocateFunc calls relocate with the resolved path of each file that a
+// mapping refers to and returns the mapping with the paths replaced by the
+// results.
+type RelocateFunc func(m Mapping, relocate func(path string) string) (Mapping, error)
+
+// RegisterRelocateFunc registers how the files of the mappings of a resource
+// type are found, so they can be packed with the shader.
+func RegisterRelocateFunc(name string, fn RelocateFunc) {
+	if _, ok := relocators[name]; ok {
+		panic(name + " already has a relocate function")
+	}
+	relocators[name] = fn
+}
+
+// RelocateLeadingPath is a RelocateFunc for values that consist of a path that
+// is optionally followed by a semicolon and options.
+func RelocateLeadingPath(m Mapping, relocate func(path string) string) (Mapping, error) {
+	p, options, hasOptions := strings.Cut(m.Value, ";")
+	path, err := ResolvePath(m.PWD, p)
+	if err != nil {
+		return m, err
+	}
+	m.Value = relocate(path)
+	if hasOptions {
+		m.Value += ";" + options
+	}
+	return m, nil
+}
+
+const imageMainSource = `
+	void main(void) {
+		vec2 pos = gl_FragCoord.xy;
+		pos.y = iResolution.y - pos.y - 1;
+		mainImage(gl_FragColor, pos);
+	}
+`
+
 // ShaderToy implements a shader environment similar to the one on
 // shadertoy.com.
 type ShaderToy struct {
-	shaderSources []renderer.SourceFile
+	// Preprocessor is used to preprocess the sources of buffers. It should
+	// be the same as the one used for the sources of the environment.
+	Preprocessor renderer.Preprocessor
+	// FS is the filesystem from which the files of mappings are read, that
+	// of the OS if nil. Resources obtain it through RenderState.FS.
+	FS fs.FS
+
+	shaderSources []renderer.Source
 	mappings      []Mapping
-	glslVersion   string
+	uniforms      []UniformValue
+	// overrideUniforms holds the values that were set when the environment
+	// was created, which also apply to the uniforms of buffers.
+	overrideUniforms []UniformValue
+	glslVersion      string
+	// mainSource is the entrypoint of the fragment shader which calls the
+	// user's main function.
+	mainSource string
 
 	resources []Resource
+	// mapped holds the resources instantiated from mappings, in the same
+	// order as they appear in resources.
+	mapped []*sharedResource
+	// prev is the environment that is replaced by this one, set by Reuse.
+	prev *ShaderToy
+}
+
+// A sharedResource is a resource instantiated from a mapping. It is shared
+// with the environment that replaces the one that created it if the mapping
+// did not change.
+type sharedResource struct {
+	mapping  Mapping
+	resource Resource
+	// refs is the number of environments using the resource. Environments
+	// are set up and closed by the render loop, so no locking is required.
+	refs int
+}
+
+// Mappings returns the mappings of the environment, those that override the
+// mappings declared in the sources first.
+func (st *ShaderToy) Mappings() []Mapping {
+	return st.mappings
 }
 
 func NewShaderToy(
-	shaderSources []renderer.SourceFile,
+	shaderSources []renderer.Source,
 	overrideMappings []Mapping,
+	overrideUniforms []UniformValue,
 	glslVersion string,
 ) (*ShaderToy, error) {
 	sourceMappings, err := extractMappings(shaderSources)
@@ -61,17 +164,33 @@ func NewShaderToy(
 	}
 	mappings := deduplicateMappings(append(overrideMappings, sourceMappings...)...)
 
+	sourceUniforms, err := extractUniforms(shaderSources)
+	if err != nil {
+		return nil, err
+	}
+	types, err := declaredUniformTypes(shaderSources)
+	if err != nil {
+		return nil, err
+	}
+	uniforms, err := mergeUniforms(sourceUniforms, overrideUniforms, types)
+	if err != nil {
+		return nil, err
+	}
+
 	return &ShaderToy{
-		shaderSources: shaderSources,
-		mappings:      mappings,
-		glslVersion:   glslVersion,
+		shaderSources:    shaderSources,
+		mappings:         mappings,
+		uniforms:         uniforms,
+		overrideUniforms: overrideUniforms,
+		glslVersion:      glslVersion,
+		mainSource:       imageMainSource,
 		// resources is populated by Setup().
 	}, nil
 }
 
 func (st ShaderToy) Sources() (map[renderer.Stage][]renderer.Source, error) {
 	return map[renderer.Stage][]renderer.Source{
-		renderer.StageVertex: {renderer.SourceBuf(fmt.Sprintf(`
+		renderer.StageVertex: {generatedSource("<shadertoy vertex>", fmt.Sprintf(`
 			#version %s
 			attribute vec3 vert;
 			void main(void) {
@@ -80,7 +199,7 @@ func (st ShaderToy) Sources() (map[renderer.Stage][]renderer.Source, error) {
 		`, st.glslVersion))},
 		renderer.StageFragment: func() []renderer.Source {
 			ss := []renderer.Source{}
-			ss = append(ss, renderer.SourceBuf(fmt.Sprintf(`
+			ss = append(ss, generatedSource("<shadertoy preamble>", fmt.Sprintf(`
 				#version %s
 				uniform vec3 iResolution;
 				uniform float iTime;
@@ -92,48 +211,143 @@ func (st ShaderToy) Sources() (map[renderer.Stage][]renderer.Source, error) {
 				uniform float iSampleRate;
 				uniform vec3 iChannelResolution[4];
 			`, st.glslVersion)))
-			for _, res := range st.resources {
-				ss = append(ss, renderer.SourceBuf(res.UniformSource()))
+			for i, res := range st.resources {
+				name := "<uniforms>"
+				if i < len(st.mapped) {
+					m := st.mapped[i].mapping
+					name = fmt.Sprintf("<map %s=%s:%s>", m.Name, m.Namespace, m.Value)
+				}
+				ss = append(ss, generatedSource(name, res.UniformSource()))
 			}
 			for _, s := range st.shaderSources {
 				ss = append(ss, s)
 			}
-			ss = append(ss, renderer.SourceBuf(`
-				void main(void) {
-					vec2 pos = gl_FragCoord.xy;
-					pos.y = iResolution.y - pos.y - 1;
-					mainImage(gl_FragColor, pos);
-				}
-			`))
+			ss = append(ss, generatedSource("<shadertoy main>", st.mainSource))
 			return ss
 		}(),
 	}, nil
 }
 
+// generatedSource returns a source of which diagnostics are attributed to the
+// specified name.
+func generatedSource(name, src string) renderer.Source {
+	return renderer.MappedSource{
+		Source: renderer.SourceBuf(src),
+		Map:    renderer.SourceMap{{Line: 1, Filename: name, FileLine: 1}},
+	}
+}
+
 func (st *ShaderToy) Setup(state renderer.RenderState) error {
 	if st.resources != nil {
 		return fmt.Errorf("double call to ShaderToy.Setup")
 	}
+	state.FS = st.FS
+	prev := st.prev
+	st.prev = nil
 	for _, mapping := range st.mappings {
-		res, err := mapping.resource(state)
-		if err != nil {
-			return err
+		shared := prev.takeResource(mapping)
+		if shared == nil {
+			res, err := mapping.resource(state)
+			if err != nil {
+				return err
+			}
+			shared = &sharedResource{mapping: mapping, resource: res, refs: 1}
 		}
-		st.resources = append(st.resources, res)
+		st.mapped = append(st.mapped, shared)
+		st.resources = append(st.resources, shared.resource)
+	}
+	if len(st.uniforms) > 0 {
+		st.resources = append(st.resources, &customUniforms{uniforms: st.uniforms})
 	}
 	// If no mappings are found, we're good to go. If iChannels are referenced
 	// anyway we'll let OpenGL decide if we should abort.
 	return nil
 }
 
+// Declare implements the renderer.Declarer interface. The uniforms of the
+// mappings are declared without instantiating the resources, so the
+// environment can be compiled but not rendered. Resources of types without a
+// DeclareFunc, like buffers, are instantiated as usual.
+func (st *ShaderToy) Declare(state renderer.RenderState) error {
+	if st.resources != nil {
+		return fmt.Errorf("double call to ShaderToy.Declare")
+	}
+	state.FS = st.FS
+	for _, mapping := range st.mappings {
+		var res Resource
+		if fn, ok := declarers[mapping.Namespace]; ok {
+			src, err := fn(mapping, state)
+			if err != nil {
+				return err
+			}
+			res = declaration(src)
+		} else {
+			var err error
+			if res, err = mapping.resource(state); err != nil {
+				return err
+			}
+		}
+		shared := &sharedResource{mapping: mapping, resource: res, refs: 1}
+		st.mapped = append(st.mapped, shared)
+		st.resources = append(st.resources, shared.resource)
+	}
+	if len(st.uniforms) > 0 {
+		st.resources = append(st.resources, &customUniforms{uniforms: st.uniforms})
+	}
+	return nil
+}
+
+// declaration is a resource that only declares uniforms.
+type declaration string
+
+func (d declaration) UniformSource() string              { return string(d) }
+func (declaration) PreRender(state renderer.RenderState) {}
+func (declaration) Close() error                         { return nil }
+
+// Reuse implements the renderer.Reuser interface. Resources of the previous
+// environment with the same mapping are used instead of instantiating new
+// ones, so videos, audio streams and devices continue uninterrupted. Buffers
+// are always instantiated anew because their sources may have changed.
+func (st *ShaderToy) Reuse(prev renderer.Environment) {
+	if prev, ok := prev.(*ShaderToy); ok {
+		st.prev = prev
+	}
+}
+
+// takeResource returns the resource of the environment that was instantiated
+// from the specified mapping and acquires a reference to it. Nil is returned
+// if there is no such resource.
+func (st *ShaderToy) takeResource(m Mapping) *sharedResource {
+	if st == nil || m.Namespace == "buffer" {
+		return nil
+	}
+	for _, shared := range st.mapped {
+		if shared.mapping == m {
+			shared.refs++
+			return shared
+		}
+	}
+	return nil
+}
+
 func (st ShaderToy) SubEnvironments() (map[string]renderer.SubEnvironment, error) {
 	envs := map[string]renderer.SubEnvironment{}
 	for _, res := range st.resources {
 		if bi, ok := res.(*bufferImage); ok {
-			env, err := NewShaderToy(bi.sources, nil, st.glslVersion)
+			pre, err := st.Preprocessor.Process(bi.filename)
+			if err != nil {
+				return nil, err
+			}
+			uniforms, err := declaredOverrides(pre.Sources, st.overrideUniforms)
+			if err != nil {
+				return nil, err
+			}
+			env, err := NewShaderToy(pre.Sources, nil, uniforms, st.glslVersion)
 			if err != nil {
 				return nil, err
 			}
+			env.Preprocessor = st.Preprocessor
+			env.FS = st.FS
 			envs[bi.name] = renderer.SubEnvironment{
 				Environment: env,
 				Width:       bi.width,
@@ -168,14 +382,82 @@ func (st ShaderToy) PreRender(state renderer.RenderState) {
 	if loc, ok := state.Uniforms["iFrame"]; ok {
 		gl.Uniform1f(loc.Location, float32(state.FramesProcessed))
 	}
+	if loc, ok := state.Uniforms["iSampleRate"]; ok {
+		gl.Uniform1f(loc.Location, SoundSampleRate)
+	}
+	if loc, ok := state.Uniforms["iSampleOffset"]; ok {
+		gl.Uniform1i(loc.Location, int32(state.FramesProcessed*SoundBlockSize))
+	}
 	for _, resource := range st.resources {
 		resource.PreRender(state)
 	}
 }
 
+// Time implements the renderer.Clock interface by forwarding to the first
+// resource that has a running clock.
+func (st ShaderToy) Time() (time.Duration, bool) {
+	for _, res := range st.resources {
+		if clock, ok := res.(renderer.Clock); ok {
+			if t, ok := clock.Time(); ok {
+				return t, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// builtinUniforms are the uniforms of Shadertoy that are declared in every
+// shader.
+var builtinUniforms = map[string]bool{
+	"iResolution":        true,
+	"iTime":              true,
+	"iTimeDelta":         true,
+	"iFrame":             true,
+	"iChannelTime":       true,
+	"iMouse":             true,
+	"iDate":              true,
+	"iSampleRate":        true,
+	"iChannelResolution": true,
+}
+
+// UniformHint implements the renderer.UniformHinter interface. Builtin
+// uniforms and those declared by mappings are driven by the environment,
+// custom uniforms report the range of their directive.
+func (st ShaderToy) UniformHint(name string) renderer.UniformHint {
+	name, _, _ = strings.Cut(name, "[")
+	if builtinUniforms[name] {
+		return renderer.UniformHint{Driven: true}
+	}
+	for _, res := range st.resources {
+		if _, ok := res.(*customUniforms); ok {
+			continue
+		}
+		for _, match := range uniformDeclRe.FindAllStringSubmatch(res.UniformSource(), -1) {
+			if match[1] == name {
+				return renderer.UniformHint{Driven: true}
+			}
+		}
+	}
+	for _, uv := range st.uniforms {
+		if uv.Name == name {
+			return renderer.UniformHint{Min: uv.Min, Max: uv.Max}
+		}
+	}
+	return renderer.UniformHint{}
+}
+
 func (st *ShaderToy) Close() error {
 	var errors []string
-	for _, res := range st.resources {
+	for _, shared := range st.mapped {
+		if shared.refs--; shared.refs > 0 {
+			continue
+		}
+		if err := shared.resource.Close(); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+	// The remaining resources are not shared.
+	for _, res := range st.resources[len(st.mapped):] {
 		if err := res.Close(); err != nil {
 			errors = append(errors, err.Error())
 		}
@@ -214,7 +496,7 @@ func ParseMapping(str, pwd string) (Mapping, error) {
 	return Mapping{}, fmt.Errorf("unable to parse mapping from %q", str)
 }
 
-func extractMappings(shaderSources []renderer.SourceFile) ([]Mapping, error) {
+func extractMappings(shaderSources []renderer.Source) ([]Mapping, error) {
 	mappings := []Mapping{}
 	for _, s := range shaderSources {
 		src, err := s.Contents()
@@ -250,6 +532,16 @@ func deduplicateMappings(inMappings ...Mapping) []Mapping {
 	return outMappings
 }
 
+// Relocate rewrites the paths of the files that the mapping refers to. See
+// RelocateFunc.
+func (m Mapping) Relocate(relocate func(path string) string) (Mapping, error) {
+	fn, ok := relocators[m.Namespace]
+	if !ok {
+		return m, nil
+	}
+	return fn(m, relocate)
+}
+
 func (m Mapping) resource(state renderer.RenderState) (Resource, error) {
 	fn, ok := resourceBuilders[m.Namespace]
 	if !ok {
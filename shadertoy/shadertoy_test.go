@@ -0,0 +1,105 @@
+package shadertoy
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+type countingResource struct {
+	closed int
+}
+
+func (r *countingResource) UniformSource() string                { return "" }
+func (r *countingResource) PreRender(state renderer.RenderState) {}
+func (r *countingResource) Close() error {
+	r.closed++
+	return nil
+}
+
+func init() {
+	RegisterResourceType("counting", func(Mapping, GenTexFunc, renderer.RenderState) (Resource, error) {
+		return &countingResource{}, nil
+	})
+	RegisterResourceType("device", func(Mapping, GenTexFunc, renderer.RenderState) (Resource, error) {
+		return nil, fmt.Errorf("the device is not connected")
+	})
+	RegisterDeclareFunc("device", func(m Mapping, _ renderer.RenderState) (string, error) {
+		return "uniform float " + m.Name + ";\n", nil
+	})
+}
+
+func TestShaderToyReuse(t *testing.T) {
+	kept := Mapping{Name: "a", Namespace: "counting", Value: "1", PWD: "."}
+	changed := Mapping{Name: "b", Namespace: "counting", Value: "1", PWD: "."}
+
+	prev := &ShaderToy{mappings: []Mapping{kept, changed}}
+	if err := prev.Setup(renderer.RenderState{}); err != nil {
+		t.Fatal(err)
+	}
+	changed.Value = "2"
+	next := &ShaderToy{mappings: []Mapping{kept, changed}}
+	next.Reuse(prev)
+	if err := next.Setup(renderer.RenderState{}); err != nil {
+		t.Fatal(err)
+	}
+	if next.resources[0] != prev.resources[0] {
+		t.Errorf("the resource of an unchanged mapping was not reused")
+	}
+	if next.resources[1] == prev.resources[1] {
+		t.Errorf("the resource of a changed mapping was reused")
+	}
+
+	if err := prev.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := prev.resources[0].(*countingResource).closed; n != 0 {
+		t.Errorf("a resource in use was closed %d times", n)
+	}
+	if n := prev.resources[1].(*countingResource).closed; n != 1 {
+		t.Errorf("an unused resource was closed %d times", n)
+	}
+	if err := next.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i, res := range next.resources {
+		if n := res.(*countingResource).closed; n != 1 {
+			t.Errorf("resource %d was closed %d times", i, n)
+		}
+	}
+}
+
+func TestShaderToyDeclare(t *testing.T) {
+	st := &ShaderToy{mappings: []Mapping{
+		{Name: "dev", Namespace: "device", Value: "/dev/null", PWD: "."},
+		{Name: "count", Namespace: "counting", Value: "1", PWD: "."},
+	}}
+	if err := st.Declare(renderer.RenderState{}); err != nil {
+		t.Fatal(err)
+	}
+	if src := st.resources[0].UniformSource(); src != "uniform float dev;\n" {
+		t.Errorf("unexpected declaration: %q", src)
+	}
+	// Types without a declare function are instantiated.
+	if _, ok := st.resources[1].(*countingResource); !ok {
+		t.Errorf("unexpected resource: %T", st.resources[1])
+	}
+	sources, err := st.Sources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := sources[renderer.StageFragment][1].Contents()
+	if err != nil || !strings.Contains(string(c), "uniform float dev;") {
+		t.Errorf("the declaration is not in the sources: %q, %v", c, err)
+	}
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	st = &ShaderToy{mappings: []Mapping{{Name: "dev", Namespace: "device", Value: "/dev/null", PWD: "."}}}
+	if err := st.Setup(renderer.RenderState{}); err == nil {
+		t.Errorf("expected setting up the device to fail")
+	}
+}
@@ -0,0 +1,129 @@
+package shadertoy
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"regexp"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+const (
+	// SoundSampleRate is the number of samples per second generated by
+	// sound shaders.
+	SoundSampleRate = 44100
+
+	// soundTexSize is the width and height of the texture that a block of
+	// sound is rendered to.
+	soundTexSize = 512
+	// SoundBlockSize is the number of stereo samples rendered in one frame.
+	SoundBlockSize = soundTexSize * soundTexSize
+)
+
+// mainSoundRe matches the declaration of a ShaderToy mainSound function.
+// Submatch 1 is set if the function accepts the sample index as its first
+// argument.
+var mainSoundRe = regexp.MustCompile(`\bvec2\s+mainSound\s*\(\s*(int\s+\w+\s*,\s*)?float\s+\w+\s*\)`)
+
+// soundMainSource renders a block of samples. Each pixel holds one stereo
+// sample, counting from the bottom left. The left and right channels are
+// stored as 16-bit values in the RG and BA components respectively.
+const soundMainSource = `
+	uniform int iSampleOffset;
+
+	void main(void) {
+		int samp = iSampleOffset + int(gl_FragCoord.y) * %d + int(gl_FragCoord.x);
+		float t = float(samp) / iSampleRate;
+		vec2 y = clamp(%s, -1.0, 1.0);
+		vec2 v = floor((0.5 + 0.5 * y) * 65535.0);
+		vec2 vl = mod(v, 256.0) / 255.0;
+		vec2 vh = floor(v / 256.0) / 255.0;
+		gl_FragColor = vec4(vl.x, vh.x, vl.y, vh.y);
+	}
+`
+
+// HasMainSound reports whether any of the specified sources declares a
+// mainSound function.
+func HasMainSound(shaderSources []renderer.Source) (bool, error) {
+	for _, s := range shaderSources {
+		src, err := s.Contents()
+		if err != nil {
+			return false, err
+		}
+		if mainSoundRe.Match(src) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// NewSoundShaderToy creates an environment that renders the audio produced by
+// the mainSound function of the specified sources, like the Sound tab on
+// shadertoy.com.
+//
+// Both `vec2 mainSound(int samp, float time)` and the older
+// `vec2 mainSound(float time)` are supported. Each rendered frame contains
+// SoundBlockSize samples, use RenderSound to obtain them.
+func NewSoundShaderToy(
+	shaderSources []renderer.Source,
+	overrideMappings []Mapping,
+	overrideUniforms []UniformValue,
+	glslVersion string,
+) (*ShaderToy, error) {
+	call := ""
+	for _, s := range shaderSources {
+		src, err := s.Contents()
+		if err != nil {
+			return nil, err
+		}
+		if m := mainSoundRe.FindSubmatch(src); m != nil {
+			if len(m[1]) > 0 {
+				call = "mainSound(samp, t)"
+			} else {
+				call = "mainSound(t)"
+			}
+			break
+		}
+	}
+	if call == "" {
+		return nil, fmt.Errorf("no mainSound function found")
+	}
+
+	st, err := NewShaderToy(shaderSources, overrideMappings, overrideUniforms, glslVersion)
+	if err != nil {
+		return nil, err
+	}
+	st.mainSource = fmt.Sprintf(soundMainSource, soundTexSize, call)
+	return st, nil
+}
+
+// RenderSound renders the specified duration of audio using an environment
+// created by NewSoundShaderToy.
+//
+// The returned samples are interleaved stereo pairs at SoundSampleRate.
+func RenderSound(ctx context.Context, glVersion renderer.OpenGLVersion, env *ShaderToy, duration time.Duration) ([]int16, error) {
+	engine, err := renderer.NewShader(soundTexSize, soundTexSize, glVersion)
+	if err != nil {
+		return nil, err
+	}
+	defer engine.Close()
+	if err := engine.LoadEnvironment(env); err != nil {
+		return nil, err
+	}
+
+	numValues := int(duration*SoundSampleRate/time.Second) * 2
+	samples := make([]int16, 0, numValues)
+	for len(samples) < numValues {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		pix := engine.RenderFrame(time.Second * SoundBlockSize / SoundSampleRate).(*image.RGBA).Pix
+		for i := 0; i < len(pix) && len(samples) < numValues; i += 2 {
+			v := int(pix[i]) | int(pix[i+1])<<8
+			samples = append(samples, int16(v-0x8000))
+		}
+	}
+	return samples, nil
+}
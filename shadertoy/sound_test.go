@@ -0,0 +1,59 @@
+package shadertoy
+
+import (
+	"testing"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+func TestMainSoundRe(t *testing.T) {
+	tests := []struct {
+		src         string
+		match, samp bool
+	}{
+		{src: "vec2 mainSound(float time) {", match: true},
+		{src: "vec2 mainSound( float t )", match: true},
+		{src: "vec2 mainSound(int samp, float time) {", match: true, samp: true},
+		{src: "vec2  mainSound (int s,float t)", match: true, samp: true},
+		{src: "vec3 mainSound(float time) {"},
+		{src: "vec2 mainSounds(float time) {"},
+		{src: "vec2 mainSound(int samp) {"},
+		{src: "void mainImage(out vec4 c, in vec2 p) {"},
+	}
+	for _, tt := range tests {
+		m := mainSoundRe.FindStringSubmatch(tt.src)
+		if (m != nil) != tt.match {
+			t.Errorf("%q: expected match to be %v", tt.src, tt.match)
+			continue
+		}
+		if m != nil && (m[1] != "") != tt.samp {
+			t.Errorf("%q: expected the sample argument to be %v", tt.src, tt.samp)
+		}
+	}
+}
+
+func TestHasMainSound(t *testing.T) {
+	image := renderer.SourceBuf("void mainImage(out vec4 c, in vec2 p) {}\n")
+	sound := renderer.SourceBuf("vec2 mainSound(int samp, float time) { return vec2(0); }\n")
+	tests := []struct {
+		sources []renderer.Source
+		exp     bool
+	}{
+		{sources: nil, exp: false},
+		{sources: []renderer.Source{image}, exp: false},
+		{sources: []renderer.Source{sound}, exp: true},
+		{sources: []renderer.Source{image, sound}, exp: true},
+	}
+	for i, tt := range tests {
+		ok, err := HasMainSound(tt.sources)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.exp {
+			t.Errorf("%d: expected %v, got %v", i, tt.exp, ok)
+		}
+	}
+	if _, err := HasMainSound([]renderer.Source{renderer.SourceFile{Filename: "does-not-exist.glsl"}}); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
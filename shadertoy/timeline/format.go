@@ -0,0 +1,247 @@
+package timeline
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+var (
+	trackRe    = regexp.MustCompile(`^(\w+)\s+(\w+)$`)
+	keyframeRe = regexp.MustCompile(`^(\S+)\s+(.*?)(?:\s+(step|linear|smoothstep|bezier\(.*\)))?$`)
+	bezierRe   = regexp.MustCompile(`^bezier\(([^,]+),([^,]+),([^,]+),([^,]+)\)$`)
+)
+
+// Interpolation is a function that maps the progress between two keyframes to
+// the weight of the next keyframe. Both range from 0 to 1.
+type Interpolation func(float64) float64
+
+// A Keyframe is the value of a track at a point in time. The interpolation
+// determines the transition from this keyframe to the next.
+type Keyframe struct {
+	Time          float64
+	Values        []float64
+	Interpolation Interpolation
+}
+
+// A Track animates a single uniform.
+type Track struct {
+	Uniform   renderer.Uniform
+	Keyframes []Keyframe
+}
+
+// A Timeline is a set of tracks that is read from a file in the format below.
+// Lines starting with # are comments.
+//
+//	float speed
+//	    0     1.0                linear
+//	    4.5   3.0                smoothstep
+//	    1:08  0.0                bezier(0.42, 0, 0.58, 1)
+//	vec3 tint
+//	    0     vec3(1, 0, 0)      step
+//	    2     0, 1, 0
+//
+// A track starts with the type and name of a uniform, followed by indented
+// keyframes. A keyframe has a time in seconds or minutes:seconds, a value in
+// the same format as custom uniforms and an optional interpolation towards
+// the next keyframe, which defaults to linear.
+type Timeline struct {
+	Tracks []Track
+}
+
+// Parse reads a timeline.
+func Parse(r io.Reader) (*Timeline, error) {
+	tl := &Timeline{}
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			track, err := parseTrack(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			tl.Tracks = append(tl.Tracks, track)
+			continue
+		}
+		if len(tl.Tracks) == 0 {
+			return nil, fmt.Errorf("line %d: keyframe without a track, expected <type> <name>", lineNum)
+		}
+		track := &tl.Tracks[len(tl.Tracks)-1]
+		kf, err := parseKeyframe(trimmed, track.Uniform)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		track.Keyframes = append(track.Keyframes, kf)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for i, track := range tl.Tracks {
+		if len(track.Keyframes) == 0 {
+			return nil, fmt.Errorf("track %q has no keyframes", track.Uniform.Name)
+		}
+		for j := range i {
+			if tl.Tracks[j].Uniform.Name == track.Uniform.Name {
+				return nil, fmt.Errorf("track %q is declared more than once", track.Uniform.Name)
+			}
+		}
+		sort.SliceStable(track.Keyframes, func(a, b int) bool {
+			return track.Keyframes[a].Time < track.Keyframes[b].Time
+		})
+	}
+	return tl, nil
+}
+
+func parseTrack(str string) (Track, error) {
+	match := trackRe.FindStringSubmatch(str)
+	if match == nil {
+		return Track{}, fmt.Errorf("unable to parse track %q, expected <type> <name>", str)
+	}
+	typ, ok := renderer.ParseTypeLiteral(match[1])
+	u := renderer.Uniform{Name: match[2], Type: typ}
+	if !ok || u.Components() == 0 {
+		return Track{}, fmt.Errorf("unsupported type %q for track %q", match[1], u.Name)
+	}
+	return Track{Uniform: u}, nil
+}
+
+func parseKeyframe(str string, u renderer.Uniform) (Keyframe, error) {
+	match := keyframeRe.FindStringSubmatch(str)
+	if match == nil {
+		return Keyframe{}, fmt.Errorf("unable to parse keyframe %q, expected <time> <value> [<interpolation>]", str)
+	}
+	t, err := parseTime(match[1])
+	if err != nil {
+		return Keyframe{}, err
+	}
+	values, err := shadertoy.UniformValue{Name: u.Name, Value: match[2]}.Resolve(u)
+	if err != nil {
+		return Keyframe{}, err
+	}
+	interp, err := parseInterpolation(match[3])
+	if err != nil {
+		return Keyframe{}, err
+	}
+	if u.IsBool() {
+		interp = Step
+	}
+	return Keyframe{Time: t, Values: values, Interpolation: interp}, nil
+}
+
+// parseTime parses a time in seconds, optionally prefixed by minutes.
+func parseTime(str string) (float64, error) {
+	var minutes float64
+	secStr := str
+	if i := strings.IndexByte(str, ':'); i >= 0 {
+		m, err := strconv.ParseUint(str[:i], 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %q", str)
+		}
+		minutes, secStr = float64(m), str[i+1:]
+	}
+	sec, err := strconv.ParseFloat(secStr, 64)
+	if err != nil || sec < 0 || math.IsInf(sec, 0) {
+		return 0, fmt.Errorf("invalid time %q", str)
+	}
+	return minutes*60 + sec, nil
+}
+
+func parseInterpolation(str string) (Interpolation, error) {
+	switch str {
+	case "", "linear":
+		return Linear, nil
+	case "step":
+		return Step, nil
+	case "smoothstep":
+		return Smoothstep, nil
+	}
+	match := bezierRe.FindStringSubmatch(strings.ReplaceAll(str, " ", ""))
+	if match == nil {
+		return nil, fmt.Errorf("unable to parse interpolation %q, expected bezier(<x1>, <y1>, <x2>, <y2>)", str)
+	}
+	var p [4]float64
+	for i := range p {
+		var err error
+		if p[i], err = strconv.ParseFloat(match[i+1], 64); err != nil {
+			return nil, fmt.Errorf("invalid number %q in %q", match[i+1], str)
+		}
+	}
+	if p[0] < 0 || p[0] > 1 || p[2] < 0 || p[2] > 1 {
+		return nil, fmt.Errorf("the x coordinates of %q must be within 0 and 1", str)
+	}
+	return CubicBezier(p[0], p[1], p[2], p[3]), nil
+}
+
+// Step holds the value of a keyframe until the next keyframe.
+func Step(float64) float64 { return 0 }
+
+// Linear interpolates linearly between two keyframes.
+func Linear(x float64) float64 { return x }
+
+// Smoothstep eases in and out like the GLSL function of the same name.
+func Smoothstep(x float64) float64 { return x * x * (3 - 2*x) }
+
+// CubicBezier returns a timing function like the one of CSS, which is a cubic
+// Bézier curve from (0, 0) to (1, 1) with the specified control points.
+func CubicBezier(x1, y1, x2, y2 float64) Interpolation {
+	bezier := func(t, p1, p2 float64) float64 {
+		u := 1 - t
+		return 3*u*u*t*p1 + 3*u*t*t*p2 + t*t*t
+	}
+	return func(x float64) float64 {
+		// The curve is monotonic in x because the x coordinates of the
+		// control points are within 0 and 1, so bisection always converges.
+		lo, hi := 0.0, 1.0
+		t := x
+		for range 32 {
+			if bezier(t, x1, x2) < x {
+				lo = t
+			} else {
+				hi = t
+			}
+			t = (lo + hi) / 2
+		}
+		return bezier(t, y1, y2)
+	}
+}
+
+// Duration returns the time of the last keyframe of all tracks.
+func (tl *Timeline) Duration() float64 {
+	var d float64
+	for _, track := range tl.Tracks {
+		d = max(d, track.Keyframes[len(track.Keyframes)-1].Time)
+	}
+	return d
+}
+
+// Eval returns the values of the track at the specified time. The first and
+// last keyframes are held before and after the track.
+func (track *Track) Eval(t float64) []float64 {
+	kfs := track.Keyframes
+	i := sort.Search(len(kfs), func(i int) bool { return kfs[i].Time > t })
+	if i == 0 {
+		return kfs[0].Values
+	}
+	if i == len(kfs) {
+		return kfs[len(kfs)-1].Values
+	}
+	a, b := kfs[i-1], kfs[i]
+	w := a.Interpolation((t - a.Time) / (b.Time - a.Time))
+	values := make([]float64, len(a.Values))
+	for j := range values {
+		values[j] = a.Values[j] + (b.Values[j]-a.Values[j])*w
+	}
+	return values
+}
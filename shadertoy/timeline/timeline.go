@@ -0,0 +1,145 @@
+package timeline
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+	"github.com/polyfloyd/shady/shadertoy"
+)
+
+func init() {
+	shadertoy.RegisterResourceType("timeline", func(m shadertoy.Mapping, _ shadertoy.GenTexFunc, state renderer.RenderState) (shadertoy.Resource, error) {
+		return newTimelineResource(m, state.FS)
+	})
+	// The tracks of the timeline determine the uniforms, so the file is read
+	// to declare them.
+	shadertoy.RegisterDeclareFunc("timeline", func(m shadertoy.Mapping, state renderer.RenderState) (string, error) {
+		tr, err := newTimelineResource(m, state.FS)
+		if err != nil {
+			return "", err
+		}
+		return tr.UniformSource(), nil
+	})
+	shadertoy.RegisterRelocateFunc("timeline", shadertoy.RelocateLeadingPath)
+}
+
+var timelineValue = regexp.MustCompile(`^([^;]+?)(;loop)?$`)
+
+// reloadInterval is the interval at which the file is checked for changes.
+const reloadInterval = time.Second / 2
+
+// timelineResource sets the uniforms of the tracks of a timeline file to
+// their values at the current time.
+//
+// The file is reloaded when it is modified. The uniforms are declared when the
+// shader is compiled, so changes to the tracks require the shader to be
+// reloaded.
+type timelineResource struct {
+	uniformName string
+	fsys        fs.FS
+	path        string
+	loop        bool
+
+	timeline  *Timeline
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+func newTimelineResource(m shadertoy.Mapping, fsys fs.FS) (*timelineResource, error) {
+	match := timelineValue.FindStringSubmatch(m.Value)
+	if match == nil {
+		return nil, fmt.Errorf("timeline: unable to parse %q, expected <path>[;loop]", m.Value)
+	}
+	path, err := shadertoy.ResolvePath(m.PWD, match[1])
+	if err != nil {
+		return nil, err
+	}
+	tr := &timelineResource{
+		uniformName: m.Name,
+		fsys:        fsys,
+		path:        path,
+		loop:        match[2] != "",
+	}
+	if err := tr.load(); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+func (tr *timelineResource) load() error {
+	fd, err := renderer.OpenFile(tr.fsys, tr.path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	info, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	tl, err := Parse(fd)
+	if err != nil {
+		return fmt.Errorf("timeline %s: %w", tr.path, err)
+	}
+	tr.timeline, tr.modTime = tl, info.ModTime()
+	return nil
+}
+
+func (tr *timelineResource) reloadIfModified() {
+	if time.Since(tr.lastCheck) < reloadInterval {
+		return
+	}
+	tr.lastCheck = time.Now()
+	info, err := renderer.StatFile(tr.fsys, tr.path)
+	if err != nil || info.ModTime().Equal(tr.modTime) {
+		return
+	}
+	if err := tr.load(); err != nil {
+		log.Println(err)
+		// Do not retry until the file is modified again.
+		tr.modTime = info.ModTime()
+	}
+}
+
+func (tr *timelineResource) UniformSource() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "uniform float %s;\n", tr.uniformName)
+	for _, track := range tr.timeline.Tracks {
+		fmt.Fprintf(&buf, "uniform %s %s;\n", track.Uniform.TypeLiteral(), track.Uniform.Name)
+	}
+	return buf.String()
+}
+
+// position returns the time within the timeline in seconds.
+func (tr *timelineResource) position(t time.Duration) float64 {
+	pos := t.Seconds()
+	if d := tr.timeline.Duration(); tr.loop && d > 0 {
+		pos = math.Mod(pos, d)
+	}
+	return pos
+}
+
+func (tr *timelineResource) PreRender(state renderer.RenderState) {
+	tr.reloadIfModified()
+
+	pos := tr.position(state.Time)
+	if u, ok := state.Uniforms[tr.uniformName]; ok {
+		u.Set(pos)
+	}
+	for _, track := range tr.timeline.Tracks {
+		u, ok := state.Uniforms[track.Uniform.Name]
+		if !ok || u.Type != track.Uniform.Type {
+			continue
+		}
+		u.Set(track.Eval(pos)...)
+	}
+}
+
+func (tr *timelineResource) Close() error {
+	return nil
+}
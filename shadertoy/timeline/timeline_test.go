@@ -0,0 +1,131 @@
+package timeline
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+const testTimeline = `
+# A comment.
+float speed
+    0     1.0   linear
+    4     3.0   smoothstep
+    1:00  0.0   bezier(0.42, 0, 0.58, 1)
+    1:04  2.0
+vec3 tint
+    2     0, 1, 0
+    0     vec3(1, 0, 0)   step
+bool strobe
+    0     false
+    1     true
+`
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestParse(t *testing.T) {
+	tl, err := Parse(strings.NewReader(testTimeline))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tl.Tracks) != 3 {
+		t.Fatalf("unexpected number of tracks: %d", len(tl.Tracks))
+	}
+	speed, tint := tl.Tracks[0], tl.Tracks[1]
+	if speed.Uniform.Name != "speed" || speed.Uniform.Type != gl.FLOAT || len(speed.Keyframes) != 4 {
+		t.Errorf("unexpected track: %+v", speed)
+	}
+	if speed.Keyframes[2].Time != 60 {
+		t.Errorf("unexpected time: %v", speed.Keyframes[2].Time)
+	}
+	if tint.Uniform.Type != gl.FLOAT_VEC3 || tint.Keyframes[0].Time != 0 {
+		t.Errorf("keyframes are not sorted: %+v", tint)
+	}
+	if tl.Duration() != 64 {
+		t.Errorf("unexpected duration: %v", tl.Duration())
+	}
+
+	for _, str := range []string{
+		"    0 1.0",
+		"sampler2D tex\n    0 1",
+		"float speed",
+		"float speed\n    x 1.0",
+		"float speed\n    0 1.0 bounce",
+		"float speed\n    0 vec2(1, 0)",
+		"float speed\n    0 1.0 bezier(2, 0, 0, 1)",
+		"float speed\n    0 1\nfloat speed\n    0 1",
+	} {
+		if _, err := Parse(strings.NewReader(str)); err == nil {
+			t.Errorf("expected an error for %q", str)
+		}
+	}
+}
+
+func TestTrackEval(t *testing.T) {
+	tl, err := Parse(strings.NewReader(testTimeline))
+	if err != nil {
+		t.Fatal(err)
+	}
+	speed, tint, strobe := &tl.Tracks[0], &tl.Tracks[1], &tl.Tracks[2]
+
+	for _, tt := range []struct {
+		time, value float64
+	}{
+		{-1, 1},
+		{0, 1},
+		{2, 2},
+		{4, 3},
+		{32, 1.5},
+		{62, 1},
+		{64, 2},
+		{100, 2},
+	} {
+		if v := speed.Eval(tt.time)[0]; !approx(v, tt.value) {
+			t.Errorf("speed at %v: expected %v, got %v", tt.time, tt.value, v)
+		}
+	}
+	if v := tint.Eval(1.9); v[0] != 1 || v[1] != 0 {
+		t.Errorf("step interpolation changed the value: %v", v)
+	}
+	if v := tint.Eval(2); v[0] != 0 || v[1] != 1 {
+		t.Errorf("unexpected value after the last keyframe: %v", v)
+	}
+	if v := strobe.Eval(0.5); v[0] != 0 {
+		t.Errorf("booleans must not be interpolated: %v", v)
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	ease := CubicBezier(0.42, 0, 0.58, 1)
+	for _, f := range []Interpolation{Linear, Smoothstep, ease} {
+		if !approx(f(0), 0) || !approx(f(1), 1) || !approx(f(0.5), 0.5) {
+			t.Errorf("unexpected endpoints: %v %v %v", f(0), f(0.5), f(1))
+		}
+	}
+	if v := ease(0.25); v >= 0.25 {
+		t.Errorf("expected ease-in-out to start slow: %v", v)
+	}
+	if v := CubicBezier(0, 0, 1, 1)(0.3); !approx(v, 0.3) {
+		t.Errorf("a linear curve should be the identity: %v", v)
+	}
+}
+
+func TestPosition(t *testing.T) {
+	tl, err := Parse(strings.NewReader("float x\n    0 0\n    4 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &timelineResource{timeline: tl}
+	if p := tr.position(5 * time.Second); p != 5 {
+		t.Errorf("unexpected position: %v", p)
+	}
+	tr.loop = true
+	if p := tr.position(5 * time.Second); p != 1 {
+		t.Errorf("unexpected looped position: %v", p)
+	}
+}
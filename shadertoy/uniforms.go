@@ -0,0 +1,338 @@
+package shadertoy
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+var (
+	uniformPragmaSourceRe = regexp.MustCompile(`(?m)^#pragma\s+uniform\s+(.*)$`)
+	uniformPragmaRe       = regexp.MustCompile(`^(\w+)\s+(\w+)\s*(?:=\s*(.*?))?\s*(?:\[\s*(\S+?)\s*\.\.\s*(\S+?)\s*\])?\s*$`)
+	uniformValueRe        = regexp.MustCompile(`^(\w+)=(.+)$`)
+	uniformDeclSourceRe   = regexp.MustCompile(`(?m)^\s*uniform\s+(\w+)\s+(\w+)\s*;`)
+	constructorRe         = regexp.MustCompile(`^(\w+)\s*\((.*)\)$`)
+)
+
+// A UniformValue is a value that is assigned to a uniform by a
+// "#pragma uniform <type> <name> = <value> [<min>..<max>]" directive or a
+// "<name>=<value>" override on the command line.
+type UniformValue struct {
+	Name string
+	// Type is the GLSL type of uniforms that are declared by a directive. It
+	// is empty for overrides of uniforms that are declared in the shader.
+	Type string
+	// Value is a GLSL literal like "1.0" or "vec3(1.0, 0.5, 0.0)". A list of
+	// numbers separated by commas is also accepted. It is empty if the
+	// directive does not declare a default value.
+	Value string
+	// Min and Max limit the range of the value if Max is larger than Min.
+	Min, Max float64
+
+	// filename and line locate the directive, if any.
+	filename string
+	line     int
+}
+
+// ParseUniformValue parses a "<name>=<value>" override.
+func ParseUniformValue(str string) (UniformValue, error) {
+	match := uniformValueRe.FindStringSubmatch(str)
+	if match == nil {
+		return UniformValue{}, fmt.Errorf("unable to parse uniform value from %q, expected <name>=<value>", str)
+	}
+	uv := UniformValue{Name: match[1], Value: strings.TrimSpace(match[2])}
+	if _, _, err := parseLiteral(uv.Value); err != nil {
+		return UniformValue{}, fmt.Errorf("invalid value for uniform %q: %w", uv.Name, err)
+	}
+	return uv, nil
+}
+
+func parseUniformPragma(str string) (UniformValue, error) {
+	match := uniformPragmaRe.FindStringSubmatch(strings.TrimSpace(str))
+	if match == nil {
+		return UniformValue{}, fmt.Errorf("unable to parse uniform directive %q, expected <type> <name> [= <value>] [[<min>..<max>]]", str)
+	}
+	uv := UniformValue{Type: match[1], Name: match[2], Value: match[3]}
+	typ, ok := renderer.ParseTypeLiteral(uv.Type)
+	if !ok {
+		return UniformValue{}, fmt.Errorf("unsupported type %q in uniform directive for %q", uv.Type, uv.Name)
+	}
+	if match[4] != "" {
+		var err1, err2 error
+		uv.Min, err1 = strconv.ParseFloat(match[4], 64)
+		uv.Max, err2 = strconv.ParseFloat(match[5], 64)
+		if err1 != nil || err2 != nil || uv.Max <= uv.Min {
+			return UniformValue{}, fmt.Errorf("invalid range [%s..%s] for uniform %q", match[4], match[5], uv.Name)
+		}
+	}
+	if uv.Value != "" {
+		if _, err := uv.Resolve(renderer.Uniform{Name: uv.Name, Type: typ}); err != nil {
+			return UniformValue{}, err
+		}
+	}
+	return uv, nil
+}
+
+// parseLiteral parses a GLSL literal into the type of its constructor, if
+// any, and its values.
+func parseLiteral(lit string) (string, []float64, error) {
+	var typ string
+	args := lit
+	if match := constructorRe.FindStringSubmatch(strings.TrimSpace(lit)); match != nil {
+		typ, args = match[1], match[2]
+	}
+	fields := strings.FieldsFunc(args, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	if len(fields) == 0 {
+		return "", nil, fmt.Errorf("no value in %q", lit)
+	}
+	values := make([]float64, len(fields))
+	for i, f := range fields {
+		switch f {
+		case "true":
+			values[i] = 1
+		case "false":
+			values[i] = 0
+		default:
+			var err error
+			values[i], err = strconv.ParseFloat(strings.TrimRight(f, "fFuU"), 64)
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid number %q in %q", f, lit)
+			}
+		}
+	}
+	return typ, values, nil
+}
+
+// Resolve returns the values for a uniform of the specified type. Like GLSL
+// constructors, a single value is expanded to all components of vectors or
+// the diagonal of matrices.
+func (uv UniformValue) Resolve(u renderer.Uniform) ([]float64, error) {
+	typ, values, err := parseLiteral(uv.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for uniform %q: %w", uv.Name, err)
+	}
+	if typ != "" {
+		if t, ok := renderer.ParseTypeLiteral(typ); !ok || t != u.Type {
+			return nil, fmt.Errorf("uniform %q is a %s, can not assign %s", uv.Name, u.TypeLiteral(), uv.Value)
+		}
+	}
+	n := u.Components()
+	if n == 0 {
+		return nil, fmt.Errorf("uniform %q is a %s, which can not be assigned a value", uv.Name, u.TypeLiteral())
+	}
+	if len(values) == 1 && n > 1 {
+		v := values[0]
+		values = make([]float64, n)
+		if cols, rows := u.MatrixSize(); cols > 0 {
+			for i := 0; i < min(cols, rows); i++ {
+				values[i*rows+i] = v
+			}
+		} else {
+			for i := range values {
+				values[i] = v
+			}
+		}
+	}
+	if len(values) != n {
+		return nil, fmt.Errorf("uniform %q is a %s of %d components, got %d values", uv.Name, u.TypeLiteral(), n, len(values))
+	}
+	for i, v := range values {
+		if u.IsInteger() && v != math.Trunc(v) {
+			return nil, fmt.Errorf("uniform %q is a %s, %v is not an integer", uv.Name, u.TypeLiteral(), v)
+		}
+		if uv.Max > uv.Min {
+			values[i] = min(max(v, uv.Min), uv.Max)
+		}
+	}
+	return values, nil
+}
+
+// extractUniforms returns the uniforms declared by directives in the sources.
+func extractUniforms(shaderSources []renderer.Source) ([]UniformValue, error) {
+	var uniforms []UniformValue
+	seen := map[string]bool{}
+	for _, s := range shaderSources {
+		src, err := s.Contents()
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range uniformPragmaSourceRe.FindAllSubmatchIndex(src, -1) {
+			filename, line := sourceLine(s, src, match[0])
+			uv, err := parseUniformPragma(string(src[match[2]:match[3]]))
+			if err != nil {
+				return nil, directiveError(filename, line, err)
+			}
+			uv.filename, uv.line = filename, line
+			if !seen[uv.Name] {
+				seen[uv.Name] = true
+				uniforms = append(uniforms, uv)
+			}
+		}
+	}
+	return uniforms, nil
+}
+
+// sourceLine returns the file and line from which the byte at an offset in
+// the contents of a source originates.
+func sourceLine(s renderer.Source, src []byte, offset int) (string, int) {
+	return renderer.SourceMapOf(s).Lookup(1 + bytes.Count(src[:offset], []byte("\n")))
+}
+
+// directiveError attributes an error to a line of a file, if it is known.
+func directiveError(filename string, line int, err error) error {
+	if filename == "" {
+		return err
+	}
+	return renderer.PreprocessError{Filename: filename, Line: line, Message: err.Error()}
+}
+
+// A uniformDecl is a regular declaration of a uniform in a source.
+type uniformDecl struct {
+	typ      uint32
+	filename string
+	line     int
+}
+
+// declaredUniformTypes returns the regular declarations of uniforms in the
+// sources, by name.
+func declaredUniformTypes(shaderSources []renderer.Source) (map[string]uniformDecl, error) {
+	types := map[string]uniformDecl{}
+	for _, s := range shaderSources {
+		src, err := s.Contents()
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range uniformDeclSourceRe.FindAllSubmatchIndex(src, -1) {
+			if typ, ok := renderer.ParseTypeLiteral(string(src[match[2]:match[3]])); ok {
+				filename, line := sourceLine(s, src, match[0])
+				types[string(src[match[4]:match[5]])] = uniformDecl{typ: typ, filename: filename, line: line}
+			}
+		}
+	}
+	return types, nil
+}
+
+// declaredOverrides returns the overrides of the uniforms that are declared in
+// the sources, by a directive or a regular declaration. The overrides of an
+// environment apply to its buffers through these.
+func declaredOverrides(shaderSources []renderer.Source, overrides []UniformValue) ([]UniformValue, error) {
+	declared, err := extractUniforms(shaderSources)
+	if err != nil {
+		return nil, err
+	}
+	types, err := declaredUniformTypes(shaderSources)
+	if err != nil {
+		return nil, err
+	}
+	var applied []UniformValue
+	for _, o := range overrides {
+		_, ok := types[o.Name]
+		for _, d := range declared {
+			ok = ok || d.Name == o.Name
+		}
+		if ok {
+			applied = append(applied, o)
+		}
+	}
+	return applied, nil
+}
+
+// mergeUniforms applies overrides to the uniforms declared by directives.
+// Overrides of uniforms that are not declared by a directive are appended.
+// Their values are checked against the types of the directives or, if there
+// is none, of the declarations in types. Errors are attributed to the
+// directive or declaration.
+func mergeUniforms(declared, overrides []UniformValue, types map[string]uniformDecl) ([]UniformValue, error) {
+	merged := append([]UniformValue(nil), declared...)
+outer:
+	for _, o := range overrides {
+		for i, d := range merged {
+			if d.Name != o.Name {
+				continue
+			}
+			// The type is known, so the value can be checked right away.
+			typ, _ := renderer.ParseTypeLiteral(d.Type)
+			d.Value = o.Value
+			if _, err := d.Resolve(renderer.Uniform{Name: d.Name, Type: typ}); err != nil {
+				return nil, directiveError(d.filename, d.line, err)
+			}
+			merged[i] = d
+			continue outer
+		}
+		if decl, ok := types[o.Name]; ok {
+			if _, err := o.Resolve(renderer.Uniform{Name: o.Name, Type: decl.typ}); err != nil {
+				return nil, directiveError(decl.filename, decl.line, err)
+			}
+		}
+		merged = append(merged, o)
+	}
+	return merged, nil
+}
+
+// customUniforms is a resource that declares the uniforms of directives and
+// sets the values of those and the overrides.
+type customUniforms struct {
+	uniforms []UniformValue
+	// values holds the resolved values by uniform name. It is populated
+	// once the types of the uniforms are known.
+	values map[string][]float64
+}
+
+func (cu *customUniforms) UniformSource() string {
+	var buf strings.Builder
+	for _, uv := range cu.uniforms {
+		if uv.Type != "" {
+			fmt.Fprintf(&buf, "uniform %s %s;\n", uv.Type, uv.Name)
+		}
+	}
+	return buf.String()
+}
+
+// resolve validates the values against the types of the uniforms that are
+// reported by the linked program. Most mismatches are reported by
+// NewShaderToy already, this catches declarations it could not find, like
+// those produced by macros.
+func (cu *customUniforms) resolve(uniforms map[string]renderer.Uniform) {
+	cu.values = map[string][]float64{}
+	for _, uv := range cu.uniforms {
+		if uv.Value == "" {
+			continue
+		}
+		u, ok := uniforms[uv.Name]
+		if !ok {
+			// Uniforms that are declared by a directive may be unused and
+			// thus optimized out by the compiler.
+			if uv.Type == "" {
+				log.Printf("Uniform %q is not used by the shader", uv.Name)
+			}
+			continue
+		}
+		values, err := uv.Resolve(u)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		cu.values[uv.Name] = values
+	}
+}
+
+func (cu *customUniforms) PreRender(state renderer.RenderState) {
+	if cu.values == nil {
+		cu.resolve(state.Uniforms)
+	}
+	for name, values := range cu.values {
+		state.Uniforms[name].Set(values...)
+	}
+}
+
+func (cu *customUniforms) Close() error {
+	return nil
+}
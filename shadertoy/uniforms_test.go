@@ -0,0 +1,184 @@
+package shadertoy
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+func TestParseUniformPragma(t *testing.T) {
+	uv, err := parseUniformPragma("float speed = 1.0 [0..10]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := UniformValue{Name: "speed", Type: "float", Value: "1.0", Min: 0, Max: 10}
+	if uv != exp {
+		t.Errorf("unexpected value: %+v", uv)
+	}
+	uv, err = parseUniformPragma("vec3 tint = vec3(1.0, 0.5, 0.0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uv.Value != "vec3(1.0, 0.5, 0.0)" || uv.Max != 0 {
+		t.Errorf("unexpected value: %+v", uv)
+	}
+	if uv, err = parseUniformPragma("mat4 view"); err != nil || uv.Value != "" {
+		t.Errorf("unexpected result for a directive without a value: %+v, %v", uv, err)
+	}
+
+	for _, str := range []string{
+		"float",
+		"sampler2D tex",
+		"float speed = fast",
+		"float speed = 1 [10..0]",
+		"vec3 tint = vec2(1, 0)",
+		"int count = 1.5",
+	} {
+		if _, err := parseUniformPragma(str); err == nil {
+			t.Errorf("expected an error for %q", str)
+		}
+	}
+}
+
+func TestUniformValueResolve(t *testing.T) {
+	tests := []struct {
+		uv     UniformValue
+		typ    uint32
+		values []float64
+	}{
+		{UniformValue{Value: "2"}, gl.FLOAT, []float64{2}},
+		{UniformValue{Value: "12", Min: 0, Max: 10}, gl.FLOAT, []float64{10}},
+		{UniformValue{Value: "1,0.5,0"}, gl.FLOAT_VEC3, []float64{1, 0.5, 0}},
+		{UniformValue{Value: "vec2(0.5)"}, gl.FLOAT_VEC2, []float64{0.5, 0.5}},
+		{UniformValue{Value: "ivec2(-1, 3)"}, gl.INT_VEC2, []float64{-1, 3}},
+		{UniformValue{Value: "7u"}, gl.UNSIGNED_INT, []float64{7}},
+		{UniformValue{Value: "bvec2(true, false)"}, gl.BOOL_VEC2, []float64{1, 0}},
+		{UniformValue{Value: "mat2(2)"}, gl.FLOAT_MAT2, []float64{2, 0, 0, 2}},
+		{UniformValue{Value: "mat2x3(1)"}, gl.FLOAT_MAT2x3, []float64{1, 0, 0, 0, 1, 0}},
+		{UniformValue{Value: "dvec2(1, 2)"}, gl.DOUBLE_VEC2, []float64{1, 2}},
+	}
+	for _, tt := range tests {
+		values, err := tt.uv.Resolve(renderer.Uniform{Type: tt.typ})
+		if err != nil {
+			t.Errorf("unexpected error for %q: %v", tt.uv.Value, err)
+			continue
+		}
+		if !reflect.DeepEqual(values, tt.values) {
+			t.Errorf("unexpected values for %q: %v", tt.uv.Value, values)
+		}
+	}
+
+	for _, tt := range []struct {
+		value string
+		typ   uint32
+	}{
+		{"vec3(1)", gl.FLOAT_VEC2},
+		{"1, 2", gl.FLOAT_VEC3},
+		{"1.5", gl.INT},
+		{"1", gl.SAMPLER_2D},
+	} {
+		if _, err := (UniformValue{Value: tt.value}).Resolve(renderer.Uniform{Type: tt.typ}); err == nil {
+			t.Errorf("expected an error for %q", tt.value)
+		}
+	}
+}
+
+func TestMergeUniforms(t *testing.T) {
+	declared := []UniformValue{
+		{Name: "speed", Type: "float", Value: "1.0", Min: 0, Max: 10},
+	}
+	override, err := ParseUniformValue("speed=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ParseUniformValue("tint=vec3(1, 0, 0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, err := mergeUniforms(declared, []UniformValue{override, other}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []UniformValue{
+		{Name: "speed", Type: "float", Value: "4", Min: 0, Max: 10},
+		{Name: "tint", Value: "vec3(1, 0, 0)"},
+	}
+	if !reflect.DeepEqual(merged, exp) {
+		t.Errorf("unexpected uniforms: %+v", merged)
+	}
+
+	bad, _ := ParseUniformValue("speed=vec2(1)")
+	if _, err := mergeUniforms(declared, []UniformValue{bad}, nil); err == nil {
+		t.Error("expected an error for an override of the wrong type")
+	}
+	badTint, _ := ParseUniformValue("tint=2.0, 1.0")
+	if _, err := mergeUniforms(declared, []UniformValue{badTint}, map[string]uniformDecl{"tint": {typ: gl.FLOAT_VEC3}}); err == nil {
+		t.Error("expected an error for an override of a declaration of the wrong type")
+	}
+}
+
+func TestNewShaderToyChecksOverrides(t *testing.T) {
+	src := renderer.SourceBuf("uniform vec3 tint;\nuniform float speed;\nvoid mainImage(out vec4 c, in vec2 p) {}\n")
+	good, _ := ParseUniformValue("tint=vec3(1, 0, 0)")
+	if _, err := NewShaderToy([]renderer.Source{src}, nil, []UniformValue{good}, "330"); err != nil {
+		t.Fatal(err)
+	}
+	bad, _ := ParseUniformValue("speed=vec2(1, 2)")
+	if _, err := NewShaderToy([]renderer.Source{src}, nil, []UniformValue{bad}, "330"); err == nil {
+		t.Error("expected an error for an override of the wrong type")
+	}
+}
+
+func TestUniformErrorLocation(t *testing.T) {
+	mapped := func(src string) renderer.Source {
+		return renderer.MappedSource{
+			Source: renderer.SourceBuf(src),
+			Map:    renderer.SourceMap{{Line: 1, Filename: "lib.glsl", FileLine: 1}, {Line: 3, Filename: "main.glsl", FileLine: 10}},
+		}
+	}
+	speed, _ := ParseUniformValue("speed=vec2(1, 2)")
+	tests := []struct {
+		src       string
+		overrides []UniformValue
+		filename  string
+		line      int
+	}{
+		{src: "void f() {}\n\n\n#pragma uniform float speed = fast\n", filename: "main.glsl", line: 11},
+		{src: "\n\n#pragma uniform float speed = 1.0\n", overrides: []UniformValue{speed}, filename: "main.glsl", line: 10},
+		{src: "uniform float speed;\n", overrides: []UniformValue{speed}, filename: "lib.glsl", line: 1},
+	}
+	for _, tt := range tests {
+		_, err := NewShaderToy([]renderer.Source{mapped(tt.src)}, nil, tt.overrides, "330")
+		var perr renderer.PreprocessError
+		if !errors.As(err, &perr) {
+			t.Errorf("%q: expected a preprocess error, got %v", tt.src, err)
+			continue
+		}
+		if perr.Filename != tt.filename || perr.Line != tt.line {
+			t.Errorf("%q: expected %s:%d, got %s:%d", tt.src, tt.filename, tt.line, perr.Filename, perr.Line)
+		}
+	}
+}
+
+func TestDeclaredOverrides(t *testing.T) {
+	src := renderer.SourceBuf("#pragma uniform float speed = 1.0\nuniform vec3 tint;\nvoid mainImage(out vec4 c, in vec2 p) {}\n")
+	var overrides []UniformValue
+	for _, str := range []string{"speed=2", "tint=vec3(1)", "other=3"} {
+		uv, err := ParseUniformValue(str)
+		if err != nil {
+			t.Fatal(err)
+		}
+		overrides = append(overrides, uv)
+	}
+	applied, err := declaredOverrides([]renderer.Source{src}, overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(applied, overrides[:2]) {
+		t.Errorf("unexpected overrides: %+v", applied)
+	}
+}
@@ -0,0 +1,218 @@
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// The dispose and blend operations of APNG frames.
+const (
+	apngDisposeNone       = 0
+	apngDisposeBackground = 1
+	apngDisposePrevious   = 2
+
+	apngBlendSource = 0
+	apngBlendOver   = 1
+)
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// apngFrame is the frame control chunk of an APNG frame along with its image
+// data.
+type apngFrame struct {
+	width, height    uint32
+	xOffset, yOffset uint32
+	delayNum         uint16
+	delayDen         uint16
+	disposeOp        uint8
+	blendOp          uint8
+
+	data []byte
+}
+
+// newAPNGDecoder decodes all frames of an animated PNG. If the file is a
+// regular PNG, errUnsupported is returned.
+//
+// The standard library does not support APNG, but the frames are regular PNG
+// streams split over different chunks. These are reassembled into standalone
+// PNG images that are then decoded using image/png.
+func newAPNGDecoder(fsys fs.FS, filename string) (*animation, error) {
+	fd, err := renderer.OpenFile(fsys, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	chunks, err := readPNGChunks(fd)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode %q: %w", filename, err)
+	}
+
+	var ihdr []byte
+	var shared []pngChunk
+	var frames []*apngFrame
+	animated := false
+	for _, c := range chunks {
+		switch c.typ {
+		case "IHDR":
+			ihdr = c.data
+		case "acTL":
+			animated = true
+		case "fcTL":
+			if len(c.data) < 26 {
+				return nil, fmt.Errorf("could not decode %q: short fcTL chunk", filename)
+			}
+			frames = append(frames, &apngFrame{
+				width:     binary.BigEndian.Uint32(c.data[4:]),
+				height:    binary.BigEndian.Uint32(c.data[8:]),
+				xOffset:   binary.BigEndian.Uint32(c.data[12:]),
+				yOffset:   binary.BigEndian.Uint32(c.data[16:]),
+				delayNum:  binary.BigEndian.Uint16(c.data[20:]),
+				delayDen:  binary.BigEndian.Uint16(c.data[22:]),
+				disposeOp: c.data[24],
+				blendOp:   c.data[25],
+			})
+		case "IDAT":
+			// The default image is only part of the animation if it is
+			// preceded by a frame control chunk.
+			if len(frames) > 0 {
+				f := frames[len(frames)-1]
+				f.data = append(f.data, c.data...)
+			}
+		case "fdAT":
+			if len(frames) == 0 || len(c.data) < 4 {
+				return nil, fmt.Errorf("could not decode %q: unexpected fdAT chunk", filename)
+			}
+			f := frames[len(frames)-1]
+			f.data = append(f.data, c.data[4:]...)
+		case "IEND":
+		default:
+			// Chunks such as the palette and transparency apply to all frames.
+			shared = append(shared, c)
+		}
+	}
+	if !animated || len(frames) == 0 {
+		return nil, errUnsupported
+	}
+	if len(ihdr) < 13 {
+		return nil, fmt.Errorf("could not decode %q: missing IHDR chunk", filename)
+	}
+
+	resolution := image.Rect(0, 0, int(binary.BigEndian.Uint32(ihdr[0:])), int(binary.BigEndian.Uint32(ihdr[4:])))
+	canvas := image.NewRGBA(resolution)
+	images := make([]*image.RGBA, len(frames))
+	delays := make([]time.Duration, len(frames))
+	for i, f := range frames {
+		img, err := f.decode(ihdr, shared)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode frame %d of %q: %w", i, filename, err)
+		}
+		rect := img.Bounds().Add(image.Pt(int(f.xOffset), int(f.yOffset)))
+
+		disposeOp := f.disposeOp
+		if i == 0 && disposeOp == apngDisposePrevious {
+			disposeOp = apngDisposeBackground
+		}
+		var previous *image.RGBA
+		if disposeOp == apngDisposePrevious {
+			previous = cloneRGBA(canvas)
+		}
+
+		op := draw.Over
+		if f.blendOp == apngBlendSource {
+			op = draw.Src
+		}
+		draw.Draw(canvas, rect, img, img.Bounds().Min, op)
+		images[i] = cloneRGBA(canvas)
+
+		den := time.Duration(f.delayDen)
+		if den == 0 {
+			den = 100
+		}
+		delays[i] = time.Duration(f.delayNum) * time.Second / den
+		if delays[i] <= 0 {
+			delays[i] = minFrameDelay
+		}
+
+		switch disposeOp {
+		case apngDisposeBackground:
+			draw.Draw(canvas, rect, image.Transparent, image.Point{}, draw.Src)
+		case apngDisposePrevious:
+			canvas = previous
+		}
+	}
+	return &animation{
+		frameTimes: newFrameTimes(delays),
+		resolution: resolution,
+		frames:     images,
+	}, nil
+}
+
+// decode reassembles the frame into a PNG stream and decodes it.
+func (f *apngFrame) decode(ihdr []byte, shared []pngChunk) (image.Image, error) {
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+	header := append([]byte(nil), ihdr...)
+	binary.BigEndian.PutUint32(header[0:], f.width)
+	binary.BigEndian.PutUint32(header[4:], f.height)
+	writePNGChunk(&buf, "IHDR", header)
+	for _, c := range shared {
+		writePNGChunk(&buf, c.typ, c.data)
+	}
+	writePNGChunk(&buf, "IDAT", f.data)
+	writePNGChunk(&buf, "IEND", nil)
+	return png.Decode(&buf)
+}
+
+func readPNGChunks(r io.Reader) ([]pngChunk, error) {
+	var sig [8]byte
+	if _, err := io.ReadFull(r, sig[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(sig[:], pngSignature) {
+		return nil, fmt.Errorf("not a PNG file")
+	}
+	var chunks []pngChunk
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, err
+		}
+		length := binary.BigEndian.Uint32(header[:4])
+		data := make([]byte, length+4) // Includes the CRC.
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		c := pngChunk{typ: string(header[4:8]), data: data[:length]}
+		chunks = append(chunks, c)
+		if c.typ == "IEND" {
+			return chunks, nil
+		}
+	}
+}
+
+func writePNGChunk(w io.Writer, typ string, data []byte) {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], typ)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	w.Write(header[:])
+	w.Write(data)
+	binary.Write(w, binary.BigEndian, crc.Sum32())
+}
@@ -0,0 +1,393 @@
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// mjpegDecoder decodes Motion JPEG streams from AVI files.
+//
+// The file is indexed when it is opened, frames are read and decoded on
+// demand.
+type mjpegDecoder struct {
+	constantRate
+	*prefetcher
+	file       aviFile
+	resolution image.Rectangle
+	hasAudio   bool
+
+	// frames holds the location of each JPEG image in the file.
+	frames []aviChunk
+}
+
+type aviChunk struct {
+	id           string
+	offset, size int64
+}
+
+// aviStream is the relevant subset of the stream header and format of a
+// stream in an AVI file.
+type aviStream struct {
+	typ         string
+	handler     string
+	scale, rate uint32
+	compression string
+}
+
+// aviFile is an AVI file that is opened for random access.
+type aviFile interface {
+	io.ReaderAt
+	io.Closer
+	Stat() (fs.FileInfo, error)
+}
+
+// memFile is a file that has been read into memory.
+type memFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (f memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f memFile) Close() error { return nil }
+
+// openAVIFile opens a file for random access. Files that do not support it,
+// like those in zip archives, are read into memory.
+func openAVIFile(fsys fs.FS, filename string) (aviFile, error) {
+	fd, err := renderer.OpenFile(fsys, filename)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := fd.(aviFile); ok {
+		return f, nil
+	}
+	defer fd.Close()
+	info, err := fd.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(fd)
+	if err != nil {
+		return nil, err
+	}
+	return memFile{Reader: bytes.NewReader(data), info: info}, nil
+}
+
+func newMJPEGDecoder(fsys fs.FS, filename string) (*mjpegDecoder, error) {
+	fd, err := openAVIFile(fsys, filename)
+	if err != nil {
+		return nil, err
+	}
+	d := &mjpegDecoder{file: fd}
+	if err := d.index(); err != nil {
+		fd.Close()
+		if err == errUnsupported {
+			return nil, err
+		}
+		return nil, fmt.Errorf("could not decode %q: %w", filename, err)
+	}
+	d.prefetcher = &prefetcher{decode: d.decode, numFrames: len(d.frames)}
+	return d, nil
+}
+
+// index reads the headers of the AVI file and locates all video frames.
+func (d *mjpegDecoder) index() error {
+	info, err := d.file.Stat()
+	if err != nil {
+		return err
+	}
+	var streams []aviStream
+	videoStream := -1
+	var movi []aviChunk
+
+	// An AVI file is a tree of RIFF chunks. Lists contain other chunks. Files
+	// larger than 1GiB are continued in additional RIFF AVIX lists.
+	var walk func(offset, end int64) error
+	walk = func(offset, end int64) error {
+		for offset+8 <= end {
+			var header [12]byte
+			if _, err := d.file.ReadAt(header[:8], offset); err != nil {
+				return err
+			}
+			id := string(header[:4])
+			size := int64(binary.LittleEndian.Uint32(header[4:8]))
+			data := offset + 8
+			next := data + size + size&1
+			if next > end {
+				// Tolerate truncated files, like those of an interrupted
+				// recording.
+				size = end - data
+				next = end
+			}
+
+			switch id {
+			case "RIFF", "LIST":
+				if _, err := d.file.ReadAt(header[8:12], data); err != nil {
+					return err
+				}
+				if typ := string(header[8:12]); typ == "movi" {
+					if err := d.walkMovi(data+4, data+size, &movi); err != nil {
+						return err
+					}
+				} else if err := walk(data+4, data+size); err != nil {
+					return err
+				}
+			case "strh":
+				buf := make([]byte, min(size, 28))
+				if _, err := d.file.ReadAt(buf, data); err != nil {
+					return err
+				}
+				if len(buf) < 28 {
+					return fmt.Errorf("short strh chunk")
+				}
+				streams = append(streams, aviStream{
+					typ:     string(buf[0:4]),
+					handler: string(buf[4:8]),
+					scale:   binary.LittleEndian.Uint32(buf[20:]),
+					rate:    binary.LittleEndian.Uint32(buf[24:]),
+				})
+			case "strf":
+				if len(streams) == 0 {
+					break
+				}
+				s := &streams[len(streams)-1]
+				if s.typ != "vids" {
+					break
+				}
+				buf := make([]byte, min(size, 20))
+				if _, err := d.file.ReadAt(buf, data); err != nil {
+					return err
+				}
+				if len(buf) < 20 {
+					return fmt.Errorf("short strf chunk")
+				}
+				width := int32(binary.LittleEndian.Uint32(buf[4:]))
+				height := int32(binary.LittleEndian.Uint32(buf[8:]))
+				s.compression = string(buf[16:20])
+				if videoStream == -1 {
+					videoStream = len(streams) - 1
+					d.resolution = image.Rect(0, 0, int(abs(width)), int(abs(height)))
+				}
+			}
+			offset = next
+		}
+		return nil
+	}
+	if err := walk(0, info.Size()); err != nil {
+		return err
+	}
+
+	if videoStream == -1 {
+		return fmt.Errorf("no video stream found")
+	}
+	vs := streams[videoStream]
+	if !isMJPEG(vs.handler) && !isMJPEG(vs.compression) {
+		return errUnsupported
+	}
+	if vs.scale == 0 || vs.rate == 0 {
+		return fmt.Errorf("invalid frame rate")
+	}
+	for _, s := range streams {
+		d.hasAudio = d.hasAudio || s.typ == "auds"
+	}
+
+	// Only keep the chunks of the video stream. Empty chunks signal that the
+	// previous frame is repeated.
+	prefix := fmt.Sprintf("%02d", videoStream)
+	for _, c := range movi {
+		if typ := c.id[2:]; c.id[:2] != prefix || (typ != "dc" && typ != "db") {
+			continue
+		}
+		if c.size == 0 {
+			if len(d.frames) == 0 {
+				continue
+			}
+			c = d.frames[len(d.frames)-1]
+		}
+		d.frames = append(d.frames, c)
+	}
+	if len(d.frames) == 0 {
+		return fmt.Errorf("no video frames found")
+	}
+	d.constantRate = constantRate{
+		interval:  time.Duration(uint64(time.Second) * uint64(vs.scale) / uint64(vs.rate)),
+		numFrames: len(d.frames),
+	}
+	return nil
+}
+
+// walkMovi collects the data chunks of a movi list.
+func (d *mjpegDecoder) walkMovi(offset, end int64, chunks *[]aviChunk) error {
+	for offset+8 <= end {
+		var header [12]byte
+		if _, err := d.file.ReadAt(header[:8], offset); err != nil {
+			return err
+		}
+		size := int64(binary.LittleEndian.Uint32(header[4:8]))
+		data := offset + 8
+		if data+size > end {
+			break
+		}
+		if string(header[:4]) == "LIST" {
+			// Chunks may be grouped in "rec " lists.
+			if err := d.walkMovi(data+4, data+size, chunks); err != nil {
+				return err
+			}
+		} else {
+			*chunks = append(*chunks, aviChunk{id: string(header[:4]), offset: data, size: size})
+		}
+		offset = data + size + size&1
+	}
+	return nil
+}
+
+func (d *mjpegDecoder) decode(i int) (*image.RGBA, error) {
+	c := d.frames[i]
+	buf := make([]byte, c.size)
+	if _, err := d.file.ReadAt(buf, c.offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	img, err := jpeg.Decode(bytes.NewReader(withHuffmanTables(buf)))
+	if err != nil {
+		return nil, fmt.Errorf("could not decode frame %d: %w", i, err)
+	}
+	return toRGBA(img), nil
+}
+
+func (d *mjpegDecoder) Resolution() image.Rectangle { return d.resolution }
+
+func (d *mjpegDecoder) HasAudio() bool { return d.hasAudio }
+
+func (d *mjpegDecoder) Close() error {
+	return d.file.Close()
+}
+
+func isMJPEG(fourcc string) bool {
+	switch fourcc {
+	case "MJPG", "mjpg", "AVRn", "AVDJ", "dmb1", "JPEG", "jpeg":
+		return true
+	}
+	return false
+}
+
+func abs(i int32) int32 {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// withHuffmanTables inserts the standard Huffman tables into a JPEG image if
+// it does not define any. Many MJPEG encoders omit these tables to save space,
+// but they are required by image/jpeg.
+func withHuffmanTables(img []byte) []byte {
+	for i := 2; i+4 <= len(img) && img[i] == 0xff; {
+		marker := img[i+1]
+		if marker == 0xc4 { // DHT
+			return img
+		}
+		if marker == 0xda { // SOS, the image data follows.
+			break
+		}
+		i += 2 + int(binary.BigEndian.Uint16(img[i+2:]))
+	}
+	if len(img) < 2 {
+		return img
+	}
+	out := make([]byte, 0, len(img)+len(standardHuffmanTables))
+	out = append(out, img[:2]...) // SOI
+	out = append(out, standardHuffmanTables...)
+	return append(out, img[2:]...)
+}
+
+// standardHuffmanTables is a DHT segment holding the example tables from
+// Annex K.3 of the JPEG specification, which are assumed by the MJPEG format.
+var standardHuffmanTables = func() []byte {
+	tables := []struct {
+		class  byte
+		counts [16]byte
+		values []byte
+	}{
+		{
+			class:  0x00, // DC, luminance.
+			counts: [16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1},
+			values: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+		},
+		{
+			class:  0x01, // DC, chrominance.
+			counts: [16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+			values: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+		},
+		{
+			class:  0x10, // AC, luminance.
+			counts: [16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 0x7d},
+			values: []byte{
+				0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+				0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+				0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+				0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+				0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+				0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+				0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+				0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+				0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+				0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+				0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+				0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+				0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+				0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+				0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+				0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+				0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+				0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+				0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+				0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+				0xf9, 0xfa,
+			},
+		},
+		{
+			class:  0x11, // AC, chrominance.
+			counts: [16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 0x77},
+			values: []byte{
+				0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+				0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+				0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+				0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+				0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+				0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+				0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+				0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+				0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+				0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+				0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+				0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+				0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+				0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+				0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+				0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+				0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+				0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+				0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+				0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+				0xf9, 0xfa,
+			},
+		},
+	}
+	var body []byte
+	for _, t := range tables {
+		body = append(body, t.class)
+		body = append(body, t.counts[:]...)
+		body = append(body, t.values...)
+	}
+	seg := []byte{0xff, 0xc4, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(body)+2))
+	return append(seg, body...)
+}()
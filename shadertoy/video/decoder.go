@@ -0,0 +1,206 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// errUnsupported is returned by the native decoders if they recognize a file
+// but can not decode it. Such files are decoded using ffmpeg instead.
+var errUnsupported = errors.New("unsupported video format")
+
+// A decoder provides random access to the frames of a video.
+type decoder interface {
+	io.Closer
+
+	// Resolution returns the size of all frames.
+	Resolution() image.Rectangle
+
+	// Duration returns the length of the video. It is 0 if the duration is
+	// not known (yet).
+	Duration() time.Duration
+
+	// FrameIndex returns the index of the frame that is displayed at the
+	// specified time. t should be in the range of [0, Duration).
+	FrameIndex(t time.Duration) int
+
+	// Frame decodes the frame with the specified index.
+	Frame(i int) (*image.RGBA, error)
+
+	// HasAudio reports whether the file has a sound track.
+	HasAudio() bool
+}
+
+// A mediaFile is a video file in a filesystem. Programs like ffmpeg can only
+// read files of the OS, so files in other filesystems are copied to a
+// temporary file the first time it is needed and reused after that.
+type mediaFile struct {
+	fsys fs.FS
+	name string
+
+	local   string
+	release func()
+}
+
+// localPath returns the path of the file in the filesystem of the OS.
+func (f *mediaFile) localPath() (string, error) {
+	if f.release == nil {
+		local, release, err := renderer.LocalPath(f.fsys, f.name)
+		if err != nil {
+			return "", err
+		}
+		f.local, f.release = local, release
+	}
+	return f.local, nil
+}
+
+// Close removes the copy of the file, if any.
+func (f *mediaFile) Close() error {
+	if f.release != nil {
+		f.release()
+		f.release = nil
+	}
+	return nil
+}
+
+// decodeVideoFile opens a video for decoding.
+//
+// Directories are treated as image sequences. Animated GIF and PNG files and
+// Motion JPEG AVI files are decoded natively with exact frame timing. All
+// other formats are decoded by ffmpeg.
+func decodeVideoFile(ctx context.Context, file *mediaFile) (decoder, error) {
+	fsys, filename := file.fsys, file.name
+	info, err := renderer.StatFile(fsys, filename)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return newImageSequenceDecoder(fsys, filename)
+	}
+
+	var header [16]byte
+	fd, err := renderer.OpenFile(fsys, filename)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := io.ReadFull(fd, header[:])
+	fd.Close()
+
+	var dec decoder
+	switch h := header[:n]; {
+	case bytes.HasPrefix(h, []byte("GIF8")):
+		dec, err = newGIFDecoder(fsys, filename)
+	case bytes.HasPrefix(h, pngSignature):
+		dec, err = newAPNGDecoder(fsys, filename)
+	case len(h) >= 12 && bytes.Equal(h[0:4], []byte("RIFF")) && bytes.Equal(h[8:12], []byte("AVI ")):
+		dec, err = newMJPEGDecoder(fsys, filename)
+	default:
+		err = errUnsupported
+	}
+	if errors.Is(err, errUnsupported) {
+		local, err := file.localPath()
+		if err != nil {
+			return nil, err
+		}
+		return newFFmpegDecoder(ctx, local)
+	}
+	return dec, err
+}
+
+// frameTimes maps time to frame indices for videos with a variable frame rate.
+type frameTimes struct {
+	// starts holds the time at which each frame starts to be displayed.
+	starts   []time.Duration
+	duration time.Duration
+}
+
+func newFrameTimes(delays []time.Duration) frameTimes {
+	ft := frameTimes{starts: make([]time.Duration, len(delays))}
+	for i, d := range delays {
+		ft.starts[i] = ft.duration
+		ft.duration += d
+	}
+	return ft
+}
+
+func (ft frameTimes) Duration() time.Duration {
+	return ft.duration
+}
+
+func (ft frameTimes) FrameIndex(t time.Duration) int {
+	i := sort.Search(len(ft.starts), func(i int) bool { return ft.starts[i] > t }) - 1
+	return max(i, 0)
+}
+
+// constantRate maps time to frame indices for videos with a constant frame
+// rate.
+type constantRate struct {
+	interval  time.Duration
+	numFrames int
+}
+
+func (cr constantRate) Duration() time.Duration {
+	return time.Duration(cr.numFrames) * cr.interval
+}
+
+func (cr constantRate) FrameIndex(t time.Duration) int {
+	i := int(t / cr.interval)
+	if cr.numFrames > 0 {
+		i = min(i, cr.numFrames-1)
+	}
+	return max(i, 0)
+}
+
+// prefetcher decodes frames on demand. After a frame has been requested, the
+// frame after it is decoded in the background, so it is ready by the time it
+// is needed during regular playback.
+type prefetcher struct {
+	decode    func(i int) (*image.RGBA, error)
+	numFrames int
+
+	pendingIndex int
+	pending      chan decodedFrame
+}
+
+type decodedFrame struct {
+	img *image.RGBA
+	err error
+}
+
+func (p *prefetcher) Frame(i int) (*image.RGBA, error) {
+	var f decodedFrame
+	if p.pending != nil && p.pendingIndex == i {
+		f = <-p.pending
+	} else {
+		f.img, f.err = p.decode(i)
+	}
+
+	next := (i + 1) % p.numFrames
+	ch := make(chan decodedFrame, 1)
+	go func() {
+		img, err := p.decode(next)
+		ch <- decodedFrame{img: img, err: err}
+	}()
+	p.pendingIndex, p.pending = next, ch
+	return f.img, f.err
+}
+
+// toRGBA converts an image to RGBA with its origin at (0, 0).
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	return rgba
+}
@@ -0,0 +1,323 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testColors = []color.RGBA{
+	{R: 0xff, A: 0xff},
+	{G: 0xff, A: 0xff},
+	{B: 0xff, A: 0xff},
+}
+
+func solidImage(r image.Rectangle, c color.Color) *image.RGBA {
+	img := image.NewRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// checkFrames asserts that the frame shown at each of the specified times has
+// the expected color at point p.
+func checkFrames(t *testing.T, dec decoder, p image.Point, times []time.Duration, expected []color.RGBA) {
+	t.Helper()
+	for i, ts := range times {
+		frame, err := dec.Frame(dec.FrameIndex(ts))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := frame.RGBAAt(p.X, p.Y)
+		if !similarColor(got, expected[i]) {
+			t.Errorf("unexpected color at %v: exp %v, got %v", ts, expected[i], got)
+		}
+	}
+}
+
+func similarColor(a, b color.RGBA) bool {
+	d := func(x, y uint8) bool { return abs(int32(x)-int32(y)) < 8 }
+	return d(a.R, b.R) && d(a.G, b.G) && d(a.B, b.B) && d(a.A, b.A)
+}
+
+func TestDecodeGIF(t *testing.T) {
+	bounds := image.Rect(0, 0, 4, 4)
+	g := &gif.GIF{Config: image.Config{Width: 4, Height: 4}}
+	for i, c := range testColors {
+		img := image.NewPaletted(bounds, palette.Plan9)
+		for j := range img.Pix {
+			img.Pix[j] = uint8(img.Palette.Index(c))
+		}
+		g.Image = append(g.Image, img)
+		g.Delay = append(g.Delay, (i+1)*10)
+	}
+	filename := filepath.Join(t.TempDir(), "anim.gif")
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dec, err := decodeVideoFile(context.Background(), &mediaFile{name: filename})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+	if d := dec.Duration(); d != 600*time.Millisecond {
+		t.Fatalf("unexpected duration: %v", d)
+	}
+	if r := dec.Resolution(); r != bounds {
+		t.Fatalf("unexpected resolution: %v", r)
+	}
+	checkFrames(t, dec, image.Pt(1, 1),
+		[]time.Duration{0, 99 * time.Millisecond, 100 * time.Millisecond, 299 * time.Millisecond, 300 * time.Millisecond},
+		[]color.RGBA{testColors[0], testColors[0], testColors[1], testColors[1], testColors[2]},
+	)
+}
+
+// encodeAPNG builds an APNG with the first image as default image and the
+// others as subsequent frames that are blended over it at the specified
+// offsets.
+func encodeAPNG(t *testing.T, images []image.Image, offsets []image.Point, delayMillis []uint16) []byte {
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	seq := uint32(0)
+	for i, img := range images {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		chunks, err := readPNGChunks(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			writePNGChunk(&out, "IHDR", chunks[0].data)
+			actl := make([]byte, 8)
+			binary.BigEndian.PutUint32(actl, uint32(len(images)))
+			writePNGChunk(&out, "acTL", actl)
+		}
+
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:], seq)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(img.Bounds().Dx()))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(img.Bounds().Dy()))
+		binary.BigEndian.PutUint32(fctl[12:], uint32(offsets[i].X))
+		binary.BigEndian.PutUint32(fctl[16:], uint32(offsets[i].Y))
+		binary.BigEndian.PutUint16(fctl[20:], delayMillis[i])
+		binary.BigEndian.PutUint16(fctl[22:], 1000)
+		fctl[24] = apngDisposeNone
+		fctl[25] = apngBlendOver
+		writePNGChunk(&out, "fcTL", fctl)
+		seq++
+
+		for _, c := range chunks {
+			if c.typ != "IDAT" {
+				continue
+			}
+			if i == 0 {
+				writePNGChunk(&out, "IDAT", c.data)
+				continue
+			}
+			fdat := make([]byte, 4, 4+len(c.data))
+			binary.BigEndian.PutUint32(fdat, seq)
+			writePNGChunk(&out, "fdAT", append(fdat, c.data...))
+			seq++
+		}
+	}
+	writePNGChunk(&out, "IEND", nil)
+	return out.Bytes()
+}
+
+func TestDecodeAPNG(t *testing.T) {
+	bounds := image.Rect(0, 0, 4, 4)
+	data := encodeAPNG(t,
+		[]image.Image{
+			solidImage(bounds, testColors[0]),
+			solidImage(image.Rect(0, 0, 2, 2), testColors[1]),
+			solidImage(image.Rect(0, 0, 1, 1), testColors[2]),
+		},
+		[]image.Point{{}, {2, 2}, {0, 0}},
+		[]uint16{40, 40, 20},
+	)
+	filename := filepath.Join(t.TempDir(), "anim.png")
+	if err := os.WriteFile(filename, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dec, err := decodeVideoFile(context.Background(), &mediaFile{name: filename})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+	if d := dec.Duration(); d != 100*time.Millisecond {
+		t.Fatalf("unexpected duration: %v", d)
+	}
+	// The second frame is only drawn over the bottom right corner.
+	checkFrames(t, dec, image.Pt(0, 0),
+		[]time.Duration{0, 40 * time.Millisecond},
+		[]color.RGBA{testColors[0], testColors[0]},
+	)
+	checkFrames(t, dec, image.Pt(3, 3),
+		[]time.Duration{39 * time.Millisecond, 40 * time.Millisecond, 80 * time.Millisecond},
+		[]color.RGBA{testColors[0], testColors[1], testColors[1]},
+	)
+	// The third frame only covers the top left pixel.
+	checkFrames(t, dec, image.Pt(0, 0),
+		[]time.Duration{80 * time.Millisecond},
+		[]color.RGBA{testColors[2]},
+	)
+	checkFrames(t, dec, image.Pt(1, 1),
+		[]time.Duration{80 * time.Millisecond},
+		[]color.RGBA{testColors[0]},
+	)
+}
+
+// riffChunk encodes a RIFF chunk. If listType is set, the chunk is a list.
+func riffChunk(id, listType string, data ...[]byte) []byte {
+	var body bytes.Buffer
+	body.WriteString(listType)
+	for _, d := range data {
+		body.Write(d)
+	}
+	out := []byte(id)
+	out = binary.LittleEndian.AppendUint32(out, uint32(body.Len()))
+	out = append(out, body.Bytes()...)
+	if body.Len()%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
+
+// stripHuffmanTables removes the DHT segments from a JPEG image, like many
+// MJPEG encoders do.
+func stripHuffmanTables(img []byte) []byte {
+	out := append([]byte(nil), img[:2]...)
+	i := 2
+	for img[i+1] != 0xda {
+		n := 2 + int(binary.BigEndian.Uint16(img[i+2:]))
+		if img[i+1] != 0xc4 {
+			out = append(out, img[i:i+n]...)
+		}
+		i += n
+	}
+	return append(out, img[i:]...)
+}
+
+func TestDecodeMJPEG(t *testing.T) {
+	const fps = 30
+	bounds := image.Rect(0, 0, 16, 16)
+	var movi [][]byte
+	for i, c := range testColors {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, solidImage(bounds, c), nil); err != nil {
+			t.Fatal(err)
+		}
+		frame := buf.Bytes()
+		if i == 1 {
+			frame = stripHuffmanTables(frame)
+		}
+		movi = append(movi, riffChunk("00dc", "", frame))
+		if i == 1 {
+			// An empty chunk repeats the previous frame.
+			movi = append(movi, riffChunk("00dc", ""))
+		}
+		movi = append(movi, riffChunk("01wb", "", []byte{0, 0, 0, 0}))
+	}
+
+	strh := make([]byte, 56)
+	copy(strh[0:], "vids")
+	copy(strh[4:], "MJPG")
+	binary.LittleEndian.PutUint32(strh[20:], 1)
+	binary.LittleEndian.PutUint32(strh[24:], fps)
+	strf := make([]byte, 40)
+	binary.LittleEndian.PutUint32(strf[0:], 40)
+	binary.LittleEndian.PutUint32(strf[4:], uint32(bounds.Dx()))
+	binary.LittleEndian.PutUint32(strf[8:], uint32(bounds.Dy()))
+	copy(strf[16:], "MJPG")
+	audioStrh := make([]byte, 56)
+	copy(audioStrh[0:], "auds")
+	data := riffChunk("RIFF", "AVI ",
+		riffChunk("LIST", "hdrl",
+			riffChunk("avih", "", make([]byte, 56)),
+			riffChunk("LIST", "strl", riffChunk("strh", "", strh), riffChunk("strf", "", strf)),
+			riffChunk("LIST", "strl", riffChunk("strh", "", audioStrh), riffChunk("strf", "", make([]byte, 16))),
+		),
+		riffChunk("LIST", "movi", movi...),
+	)
+	filename := filepath.Join(t.TempDir(), "video.avi")
+	if err := os.WriteFile(filename, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dec, err := decodeVideoFile(context.Background(), &mediaFile{name: filename})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+	if !dec.HasAudio() {
+		t.Errorf("the audio stream was not detected")
+	}
+	if r := dec.Resolution(); r != bounds {
+		t.Fatalf("unexpected resolution: %v", r)
+	}
+	interval := time.Second / fps
+	if d := dec.Duration(); d != 4*interval {
+		t.Fatalf("unexpected duration: %v", d)
+	}
+	for i, exp := range []int{0, 1, 2, 3} {
+		if got := dec.FrameIndex(time.Duration(i) * interval); got != exp {
+			t.Errorf("unexpected frame index at %v: exp %d, got %d", time.Duration(i)*interval, exp, got)
+		}
+	}
+	checkFrames(t, dec, image.Pt(8, 8),
+		[]time.Duration{0, interval, 2 * interval, 3 * interval, 0},
+		[]color.RGBA{testColors[0], testColors[1], testColors[1], testColors[2], testColors[0]},
+	)
+}
+
+func TestDecodeImageSequence(t *testing.T) {
+	dir := t.TempDir()
+	bounds := image.Rect(0, 0, 4, 4)
+	for i, c := range testColors {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, solidImage(bounds, c)); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("frame%03d.png", i)), buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dec, err := decodeVideoFile(context.Background(), &mediaFile{name: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+	if d := dec.Duration(); d != 3*sequenceFrameInterval {
+		t.Fatalf("unexpected duration: %v", d)
+	}
+	checkFrames(t, dec, image.Pt(0, 0),
+		[]time.Duration{0, sequenceFrameInterval, 2 * sequenceFrameInterval, 10 * sequenceFrameInterval},
+		[]color.RGBA{testColors[0], testColors[1], testColors[2], testColors[2]},
+	)
+}
@@ -0,0 +1,250 @@
+package video
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSkipFrames is the maximum number of frames that the ffmpeg decoder reads
+// and discards to reach a frame ahead of the current one. Seeking further
+// restarts ffmpeg.
+const maxSkipFrames = 50
+
+// ffmpegDecoder decodes videos by streaming frames from ffmpeg.
+//
+// Frames are only decoded efficiently in order, jumping back in time requires
+// ffmpeg to be restarted.
+type ffmpegDecoder struct {
+	ctx        context.Context
+	filename   string
+	resolution image.Rectangle
+	hasAudio   bool
+	rate       constantRate
+
+	cancel func()
+	stream <-chan interface{}
+	// pos is the index of the frame in last.
+	pos  int
+	last *image.RGBA
+}
+
+// newFFmpegDecoder creates a decoder for a file in the filesystem of the OS.
+func newFFmpegDecoder(ctx context.Context, filename string) (*ffmpegDecoder, error) {
+	info, err := ffprobe(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	resolution, err := info.VideoResolution()
+	if err != nil {
+		return nil, err
+	}
+	interval := time.Second
+	if iv, err := info.VideoFrameInterval(); err == nil {
+		interval = iv
+	}
+	rate := constantRate{interval: interval}
+	if duration, err := info.Duration(); err == nil {
+		rate.numFrames = int((duration + interval - 1) / interval)
+	}
+	_, audioErr := info.firstStreamByType("audio")
+	return &ffmpegDecoder{
+		ctx:        ctx,
+		filename:   filename,
+		resolution: resolution,
+		hasAudio:   audioErr == nil,
+		rate:       rate,
+		pos:        -1,
+	}, nil
+}
+
+func (d *ffmpegDecoder) Resolution() image.Rectangle { return d.resolution }
+
+func (d *ffmpegDecoder) Duration() time.Duration { return d.rate.Duration() }
+
+func (d *ffmpegDecoder) FrameIndex(t time.Duration) int { return d.rate.FrameIndex(t) }
+
+func (d *ffmpegDecoder) HasAudio() bool { return d.hasAudio }
+
+func (d *ffmpegDecoder) Frame(i int) (*image.RGBA, error) {
+	if d.stream == nil || i < d.pos || i > d.pos+maxSkipFrames {
+		d.start(i)
+	}
+	for d.pos < i {
+		switch val := <-d.stream; t := val.(type) {
+		case error:
+			d.stop()
+			return nil, t
+		case *image.RGBA:
+			d.pos++
+			d.last = t
+		case nil:
+			// The video is shorter than reported, or its duration was not
+			// known at all. Now it is.
+			d.stop()
+			d.rate.numFrames = d.pos + 1
+			if d.last == nil {
+				return nil, io.EOF
+			}
+			return d.last, nil
+		default:
+			panic(fmt.Sprintf("unreachable (%#v)", val))
+		}
+	}
+	return d.last, nil
+}
+
+// start (re)starts ffmpeg so that the next frame read from the stream is the
+// one with the specified index.
+func (d *ffmpegDecoder) start(i int) {
+	d.stop()
+	ctx, cancel := context.WithCancel(d.ctx)
+	out := make(chan interface{}, 4)
+	seek := time.Duration(i) * d.rate.interval
+	go func() {
+		defer close(out)
+		cmd := exec.CommandContext(
+			ctx,
+			"ffmpeg",
+			// Seeking before the input is both fast and frame accurate.
+			"-ss", strconv.FormatFloat(seek.Seconds(), 'f', -1, 64),
+			"-i", d.filename,
+			"-f", "rawvideo",
+			"-pix_fmt", "rgba",
+			"-",
+		)
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			out <- err
+			return
+		}
+		if err := cmd.Start(); err != nil {
+			out <- err
+			return
+		}
+		for {
+			img := image.NewRGBA(d.resolution)
+			if _, err := io.ReadFull(stdout, img.Pix); err != nil {
+				if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+					out <- err
+				}
+				break
+			}
+			select {
+			case out <- img:
+			case <-ctx.Done():
+			}
+		}
+		cmd.Wait()
+	}()
+	d.cancel = cancel
+	d.stream = out
+	d.pos = i - 1
+}
+
+func (d *ffmpegDecoder) stop() {
+	if d.cancel != nil {
+		d.cancel()
+		d.cancel = nil
+	}
+	d.stream = nil
+}
+
+func (d *ffmpegDecoder) Close() error {
+	d.stop()
+	return nil
+}
+
+type mediaInfo struct {
+	Streams []struct {
+		CodecType    string `json:"codec_type"`
+		AvgFrameRate string `json:"avg_frame_rate"`
+		Width        int    `json:"width"`
+		Heigth       int    `json:"height"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+func ffprobe(ctx context.Context, filename string) (*mediaInfo, error) {
+	cmd := exec.CommandContext(
+		ctx,
+		"ffprobe", filename,
+		"-print_format", "json",
+		"-show_format", "-show_streams",
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get media info: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("unable to get media info: %w", err)
+	}
+
+	var data mediaInfo
+	if err := json.NewDecoder(stdout).Decode(&data); err != nil {
+		return nil, fmt.Errorf("unable to get media info: %w", err)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("unable to get media info: %w", err)
+	}
+	return &data, nil
+}
+
+func (info *mediaInfo) firstStreamByType(typ string) (int, error) {
+	for i, stream := range info.Streams {
+		if stream.CodecType == typ {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("no stream with type %q found", typ)
+}
+
+func (info *mediaInfo) Duration() (time.Duration, error) {
+	f, err := strconv.ParseFloat(info.Format.Duration, 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse video duration: %w", err)
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+func (info *mediaInfo) VideoFrameInterval() (time.Duration, error) {
+	streamIndex, err := info.firstStreamByType("video")
+	if err != nil {
+		return -1, err
+	}
+	videoInfo := &info.Streams[streamIndex]
+
+	s := strings.Split(videoInfo.AvgFrameRate, "/")
+	nu, err := strconv.Atoi(s[0])
+	if err != nil {
+		return -1, fmt.Errorf("could not determine video frame interval: %w", err)
+	}
+	de, err := strconv.Atoi(s[1])
+	if err != nil {
+		return -1, fmt.Errorf("could not determine video frame interval: %w", err)
+	}
+
+	if nu == 0 || de == 0 {
+		return -1, fmt.Errorf("could not determine video frame interval")
+	}
+	return time.Duration(float64(time.Second) / (float64(nu) / float64(de))), nil
+}
+
+func (info *mediaInfo) VideoResolution() (image.Rectangle, error) {
+	streamIndex, err := info.firstStreamByType("video")
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	videoInfo := &info.Streams[streamIndex]
+	return image.Rect(0, 0, videoInfo.Width, videoInfo.Heigth), nil
+}
@@ -0,0 +1,89 @@
+package video
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io/fs"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+const (
+	// minFrameDelay is the shortest time that a frame of an animation is
+	// displayed.
+	minFrameDelay = 10 * time.Millisecond
+	// defaultGIFDelay replaces the delay of GIF frames with a delay of
+	// minFrameDelay or less, which is what web browsers do as well.
+	defaultGIFDelay = 100 * time.Millisecond
+)
+
+// animation is a decoded animation that is held in memory.
+type animation struct {
+	frameTimes
+	resolution image.Rectangle
+	frames     []*image.RGBA
+}
+
+func (a *animation) Resolution() image.Rectangle { return a.resolution }
+
+func (a *animation) Frame(i int) (*image.RGBA, error) { return a.frames[i], nil }
+
+func (a *animation) HasAudio() bool { return false }
+
+func (a *animation) Close() error { return nil }
+
+// newGIFDecoder decodes all frames of an animated GIF.
+func newGIFDecoder(fsys fs.FS, filename string) (*animation, error) {
+	fd, err := renderer.OpenFile(fsys, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	g, err := gif.DecodeAll(fd)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode %q: %w", filename, err)
+	}
+
+	resolution := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	canvas := image.NewRGBA(resolution)
+	frames := make([]*image.RGBA, len(g.Image))
+	delays := make([]time.Duration, len(g.Image))
+	for i, img := range g.Image {
+		disposal := byte(0)
+		if g.Disposal != nil {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = cloneRGBA(canvas)
+		}
+
+		draw.Draw(canvas, img.Bounds(), img, img.Bounds().Min, draw.Over)
+		frames[i] = cloneRGBA(canvas)
+		delays[i] = time.Duration(g.Delay[i]) * 10 * time.Millisecond
+		if delays[i] <= minFrameDelay {
+			delays[i] = defaultGIFDelay
+		}
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, img.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return &animation{
+		frameTimes: newFrameTimes(delays),
+		resolution: resolution,
+		frames:     frames,
+	}, nil
+}
+
+func cloneRGBA(img *image.RGBA) *image.RGBA {
+	c := *img
+	c.Pix = append([]uint8(nil), img.Pix...)
+	return &c
+}
@@ -0,0 +1,90 @@
+package video
+
+import (
+	"fmt"
+	"image"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/polyfloyd/shady/renderer"
+)
+
+// sequenceFrameInterval is the frame interval of image sequences, which
+// matches the default of ffmpeg.
+const sequenceFrameInterval = time.Second / 25
+
+// imageSequenceDecoder decodes a directory of images as a video. The frames
+// are sorted by their filenames.
+type imageSequenceDecoder struct {
+	constantRate
+	*prefetcher
+	resolution image.Rectangle
+	fsys       fs.FS
+	files      []string
+}
+
+func newImageSequenceDecoder(fsys fs.FS, dir string) (*imageSequenceDecoder, error) {
+	entries, err := renderer.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".png", ".jpg", ".jpeg", ".gif":
+			if !e.IsDir() {
+				files = append(files, filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no images found in %q", dir)
+	}
+	sort.Strings(files)
+
+	d := &imageSequenceDecoder{
+		constantRate: constantRate{interval: sequenceFrameInterval, numFrames: len(files)},
+		fsys:         fsys,
+		files:        files,
+	}
+	first, err := d.decodeFile(files[0])
+	if err != nil {
+		return nil, err
+	}
+	d.resolution = first.Bounds()
+	d.prefetcher = &prefetcher{decode: d.decode, numFrames: len(files)}
+	return d, nil
+}
+
+func (d *imageSequenceDecoder) decode(i int) (*image.RGBA, error) {
+	img, err := d.decodeFile(d.files[i])
+	if err != nil {
+		return nil, err
+	}
+	if img.Bounds() != d.resolution {
+		return nil, fmt.Errorf("the size of %q differs from that of the first image", d.files[i])
+	}
+	return img, nil
+}
+
+func (d *imageSequenceDecoder) decodeFile(filename string) (*image.RGBA, error) {
+	fd, err := renderer.OpenFile(d.fsys, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	img, _, err := image.Decode(fd)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode %q: %w", filename, err)
+	}
+	return toRGBA(img), nil
+}
+
+func (d *imageSequenceDecoder) Resolution() image.Rectangle { return d.resolution }
+
+func (d *imageSequenceDecoder) HasAudio() bool { return false }
+
+func (d *imageSequenceDecoder) Close() error { return nil }
@@ -0,0 +1,156 @@
+package video
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// playMode determines what happens when the playhead reaches the end of a
+// clip.
+type playMode string
+
+const (
+	// modeLoop restarts the clip from the beginning.
+	modeLoop playMode = "loop"
+	// modePingPong reverses the direction of playback at either end.
+	modePingPong playMode = "pingpong"
+	// modeOnce stops playback at the last frame.
+	modeOnce playMode = "once"
+)
+
+// playbackOptions are the options that can be appended to the value of a video
+// mapping as `;key=value` pairs.
+type playbackOptions struct {
+	// speed is the playback rate, negative values play the clip in reverse.
+	speed float64
+	mode  playMode
+	// in and out delimit the clip within the video. If out is 0, the clip
+	// runs until the end of the video.
+	in, out time.Duration
+	// pauseUniform is the name of a uniform that pauses playback while its
+	// value is larger than 0.5.
+	pauseUniform string
+	// seekUniform is the name of a uniform that holds a position in seconds
+	// in the clip. The playhead jumps to it whenever it changes.
+	seekUniform string
+	// audio enables the texture holding the sound track.
+	audio bool
+}
+
+var defaultPlaybackOptions = playbackOptions{
+	speed: 1,
+	mode:  modeLoop,
+}
+
+// isDefault reports whether the clip is played like a regular video.
+func (o playbackOptions) isDefault() bool {
+	o.audio = defaultPlaybackOptions.audio
+	return o == defaultPlaybackOptions
+}
+
+// parseVideoValue splits the value of a video mapping into the filename and
+// the playback options.
+func parseVideoValue(value string) (string, playbackOptions, error) {
+	fields := strings.Split(value, ";")
+	opts := defaultPlaybackOptions
+	for _, field := range fields[1:] {
+		key, val, ok := strings.Cut(field, "=")
+		if !ok {
+			return "", opts, fmt.Errorf("could not parse video option %q, expected key=value", field)
+		}
+		var err error
+		switch key {
+		case "speed":
+			opts.speed, err = strconv.ParseFloat(val, 64)
+		case "mode":
+			opts.mode = playMode(val)
+			if opts.mode != modeLoop && opts.mode != modePingPong && opts.mode != modeOnce {
+				err = fmt.Errorf("unknown mode, expected one of loop, pingpong or once")
+			}
+		case "in":
+			opts.in, err = parseSeconds(val)
+		case "out":
+			opts.out, err = parseSeconds(val)
+		case "pause":
+			opts.pauseUniform = val
+		case "seek":
+			opts.seekUniform = val
+		case "audio":
+			opts.audio, err = strconv.ParseBool(val)
+		default:
+			err = fmt.Errorf("unknown option")
+		}
+		if err != nil {
+			return "", opts, fmt.Errorf("invalid video option %q: %w", field, err)
+		}
+	}
+	if opts.out != 0 && opts.out <= opts.in {
+		return "", opts, fmt.Errorf("the out point (%v) must be after the in point (%v)", opts.out, opts.in)
+	}
+	return fields[0], opts, nil
+}
+
+func parseSeconds(s string) (time.Duration, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if f < 0 {
+		return 0, fmt.Errorf("negative time")
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+// playhead tracks the position in a clip of a video.
+type playhead struct {
+	playbackOptions
+	// pos is the amount of clip time that has been played. It is not bounded
+	// by the length of the clip, that is handled by the play mode.
+	pos time.Duration
+}
+
+func newPlayhead(opts playbackOptions, start time.Duration) *playhead {
+	p := &playhead{playbackOptions: opts}
+	p.Advance(start)
+	return p
+}
+
+// Advance moves the playhead forward by an interval of animation time.
+func (p *playhead) Advance(interval time.Duration) {
+	p.pos += time.Duration(float64(interval) * p.speed)
+}
+
+// Seek moves the playhead to the specified position in the clip.
+func (p *playhead) Seek(t time.Duration) {
+	p.pos = t
+}
+
+// VideoTime returns the position in the video for the current position of the
+// playhead. The duration of the video is 0 if not known.
+func (p *playhead) VideoTime(duration time.Duration) time.Duration {
+	out := p.out
+	if out == 0 || (duration > 0 && out > duration) {
+		out = duration
+	}
+	length := out - p.in
+	if length <= 0 {
+		// The length of the clip is not known, so it can only be played
+		// forward until the end is reached.
+		return p.in + max(p.pos, 0)
+	}
+
+	switch p.mode {
+	case modePingPong:
+		t := wrapTime(p.pos, 2*length)
+		if t >= length {
+			t = 2*length - t
+		}
+		return p.in + min(t, length-1)
+	case modeOnce:
+		return p.in + min(max(p.pos, 0), length-1)
+	default:
+		return p.in + wrapTime(p.pos, length)
+	}
+}
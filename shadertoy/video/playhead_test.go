@@ -0,0 +1,106 @@
+package video
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseVideoValue(t *testing.T) {
+	filename, opts, err := parseVideoValue("clip.mkv;speed=-0.5;mode=pingpong;in=1.5;out=4;pause=stop;seek=scrub;audio=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filename != "clip.mkv" {
+		t.Errorf("unexpected filename: %q", filename)
+	}
+	exp := playbackOptions{
+		speed:        -0.5,
+		mode:         modePingPong,
+		in:           1500 * time.Millisecond,
+		out:          4 * time.Second,
+		pauseUniform: "stop",
+		seekUniform:  "scrub",
+		audio:        true,
+	}
+	if opts != exp {
+		t.Errorf("unexpected options: exp %+v, got %+v", exp, opts)
+	}
+
+	for _, value := range []string{
+		"clip.mkv;speed",
+		"clip.mkv;speed=fast",
+		"clip.mkv;mode=shuffle",
+		"clip.mkv;in=-1",
+		"clip.mkv;in=4;out=2",
+		"clip.mkv;volume=11",
+		"clip.mkv;audio=maybe",
+	} {
+		if _, _, err := parseVideoValue(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
+
+func TestPlayhead(t *testing.T) {
+	const s = time.Second
+	const duration = 10 * s
+	tests := []struct {
+		name  string
+		opts  playbackOptions
+		steps []time.Duration
+		exp   []time.Duration
+	}{
+		{
+			name:  "loop",
+			opts:  defaultPlaybackOptions,
+			steps: []time.Duration{0, 4 * s, 6 * s, 3 * s},
+			exp:   []time.Duration{0, 4 * s, 0, 3 * s},
+		},
+		{
+			name:  "loop clip at double speed",
+			opts:  playbackOptions{speed: 2, mode: modeLoop, in: 2 * s, out: 5 * s},
+			steps: []time.Duration{0, s, s, s},
+			exp:   []time.Duration{2 * s, 4 * s, 3 * s, 2 * s},
+		},
+		{
+			name:  "reverse",
+			opts:  playbackOptions{speed: -1, mode: modeLoop},
+			steps: []time.Duration{0, s, 2 * s},
+			exp:   []time.Duration{0, 9 * s, 7 * s},
+		},
+		{
+			name:  "pingpong",
+			opts:  playbackOptions{speed: 1, mode: modePingPong, in: 1 * s, out: 4 * s},
+			steps: []time.Duration{0, 2 * s, 2 * s, 2 * s, 2 * s},
+			exp:   []time.Duration{1 * s, 3 * s, 3 * s, 1 * s, 3 * s},
+		},
+		{
+			name:  "once",
+			opts:  playbackOptions{speed: 1, mode: modeOnce, in: 8 * s},
+			steps: []time.Duration{0, s, 5 * s},
+			exp:   []time.Duration{8 * s, 9 * s, 10*s - 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPlayhead(tt.opts, 0)
+			for i, step := range tt.steps {
+				p.Advance(step)
+				if got := p.VideoTime(duration); got != tt.exp[i] {
+					t.Errorf("unexpected time after step %d: exp %v, got %v", i, tt.exp[i], got)
+				}
+			}
+		})
+	}
+
+	p := newPlayhead(playbackOptions{speed: 1, mode: modeOnce, in: 2 * s}, 0)
+	p.Advance(5 * s)
+	p.Seek(s)
+	if got := p.VideoTime(duration); got != 3*s {
+		t.Errorf("unexpected time after seeking: %v", got)
+	}
+	// The length of the clip is not known yet.
+	if got := p.VideoTime(0); got != 3*s {
+		t.Errorf("unexpected time without duration: %v", got)
+	}
+}
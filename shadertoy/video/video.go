@@ -2,31 +2,37 @@ package video
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"image"
-	"io"
-	"os/exec"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/go-gl/gl/v3.3-core/gl"
 
 	"github.com/polyfloyd/shady/renderer"
 	"github.com/polyfloyd/shady/shadertoy"
+	"github.com/polyfloyd/shady/shadertoy/audio"
 )
 
 func init() {
 	shadertoy.RegisterResourceType("video", func(m shadertoy.Mapping, genTexID shadertoy.GenTexFunc, state renderer.RenderState) (shadertoy.Resource, error) {
-		path, err := shadertoy.ResolvePath(m.PWD, m.Value)
+		filename, opts, err := parseVideoValue(m.Value)
 		if err != nil {
 			return nil, err
 		}
-		r, err := newVideoTexture(m.Name, path, genTexID(), state.Time)
+		path, err := shadertoy.ResolvePath(m.PWD, filename)
+		if err != nil {
+			return nil, err
+		}
+		r, err := newVideoTexture(m.Name, &mediaFile{fsys: state.FS, name: path}, opts, genTexID, state.Time)
 		return r, err
 	})
+	shadertoy.RegisterDeclareFunc("video", func(m shadertoy.Mapping, _ renderer.RenderState) (string, error) {
+		_, opts, err := parseVideoValue(m.Value)
+		if err != nil {
+			return "", err
+		}
+		return uniformSource(m.Name, opts.audio), nil
+	})
+	shadertoy.RegisterRelocateFunc("video", shadertoy.RelocateLeadingPath)
 }
 
 type videoTexture struct {
@@ -34,38 +40,91 @@ type videoTexture struct {
 	id          uint32
 	index       uint32
 
-	resolution        image.Rectangle
-	frameInterval     time.Duration
-	stream            <-chan interface{}
-	currentVideoFrame int
+	decoder decoder
+	// currentFrame is the index of the frame that is currently uploaded to
+	// the texture, -1 if none has been uploaded yet.
+	currentFrame int
 
+	playhead *playhead
+	// prevTime is the animation time of the previous frame.
+	prevTime time.Duration
+	// prevSeek is the previous value of the seek uniform.
+	prevSeek float32
+
+	// player plays the soundtrack of the video if audio playback is enabled.
+	player *audio.Player
+	// audio is the texture holding the sound track if enabled by the audio
+	// option.
+	audio *audio.TrackTexture
+
+	file   *mediaFile
 	cancel func()
 }
 
-func newVideoTexture(uniformName, filename string, texIndex uint32, currentTime time.Duration) (*videoTexture, error) {
+func newVideoTexture(uniformName string, file *mediaFile, opts playbackOptions, genTexID shadertoy.GenTexFunc, currentTime time.Duration) (*videoTexture, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	resolution, interval, stream, err := decodeVideoFile(ctx, filename, currentTime)
+	dec, err := decodeVideoFile(ctx, file)
 	if err != nil {
+		file.Close()
 		cancel()
 		return nil, err
 	}
+	// The sound track can only be kept in sync with the frames if the video
+	// is played like a regular video.
+	var player *audio.Player
+	if dec.HasAudio() && opts.isDefault() {
+		player, err = playFile(file, currentTime, wrapTime(currentTime, dec.Duration()))
+		if err != nil {
+			dec.Close()
+			file.Close()
+			cancel()
+			return nil, err
+		}
+	}
 
-	vt := &videoTexture{
-		uniformName: uniformName,
-		index:       texIndex,
-
-		resolution:        resolution,
-		frameInterval:     interval,
-		stream:            stream,
-		currentVideoFrame: int(currentTime/interval) - 1,
+	var audioTexture *audio.TrackTexture
+	if opts.audio {
+		if !dec.HasAudio() {
+			dec.Close()
+			file.Close()
+			cancel()
+			return nil, fmt.Errorf("%q has no sound track", file.name)
+		}
+		local, err := file.localPath()
+		if err != nil {
+			dec.Close()
+			file.Close()
+			cancel()
+			return nil, err
+		}
+		track, err := audio.DecodeTrack(local)
+		if err != nil {
+			dec.Close()
+			file.Close()
+			cancel()
+			return nil, err
+		}
+		audioTexture = audio.NewTrackTexture(uniformName+"Audio", track, genTexID())
+	}
 
-		cancel: cancel,
+	vt := &videoTexture{
+		uniformName:  uniformName,
+		index:        genTexID(),
+		decoder:      dec,
+		currentFrame: -1,
+		playhead:     newPlayhead(opts, currentTime),
+		prevTime:     currentTime,
+		player:       player,
+		audio:        audioTexture,
+		file:         file,
+		cancel:       cancel,
 	}
+	resolution := dec.Resolution()
 	gl.GenTextures(1, &vt.id)
 	gl.BindTexture(gl.TEXTURE_2D, vt.id)
 
-	initialData := make([]byte, resolution.Dx()*resolution.Dy()*3)
+	initialData := make([]byte, resolution.Dx()*resolution.Dy()*4)
 	gl.TexImage2D(
 		gl.TEXTURE_2D,          // target
 		0,                      // level
@@ -73,7 +132,7 @@ func newVideoTexture(uniformName, filename string, texIndex uint32, currentTime
 		int32(resolution.Dx()), // width
 		int32(resolution.Dy()), // height
 		0,                      // border
-		gl.RGB,                 // format
+		gl.RGBA,                // format
 		gl.UNSIGNED_BYTE,       // type
 		gl.Ptr(initialData[:]), // data
 	)
@@ -84,221 +143,140 @@ func newVideoTexture(uniformName, filename string, texIndex uint32, currentTime
 	return vt, nil
 }
 
+// playFile plays the sound track of a video file, if playback is enabled.
+func playFile(file *mediaFile, start, seek time.Duration) (*audio.Player, error) {
+	if !audio.PlaybackEnabled() {
+		return nil, nil
+	}
+	local, err := file.localPath()
+	if err != nil {
+		return nil, err
+	}
+	return audio.PlayFile(local, start, seek, true)
+}
+
 func (vt *videoTexture) UniformSource() string {
-	return fmt.Sprintf(`
+	return uniformSource(vt.uniformName, vt.audio != nil)
+}
+
+// uniformSource returns the declarations of the uniforms of a video texture,
+// including those of the sound track if withAudio is set.
+func uniformSource(uniformName string, withAudio bool) string {
+	src := fmt.Sprintf(`
 		uniform sampler2D %s;
 		uniform vec3 %sSize;
 		uniform float %sCurTime;
-	`, vt.uniformName, vt.uniformName, vt.uniformName)
+	`, uniformName, uniformName, uniformName)
+	if withAudio {
+		src += audio.UniformSource(uniformName + "Audio")
+	}
+	return src
 }
 
 func (vt *videoTexture) PreRender(state renderer.RenderState) {
-	nextFrameTime := time.Duration(vt.currentVideoFrame+1) * vt.frameInterval
-	if state.Time < nextFrameTime {
-		return
+	if v, ok := uniformValue(state, vt.playhead.seekUniform); ok && v != vt.prevSeek {
+		vt.prevSeek = v
+		vt.playhead.Seek(time.Duration(float64(v) * float64(time.Second)))
+	} else if v, ok := uniformValue(state, vt.playhead.pauseUniform); !ok || v <= 0.5 {
+		vt.playhead.Advance(state.Time - vt.prevTime)
 	}
-	vt.currentVideoFrame++
+	vt.prevTime = state.Time
 
-	var frame []byte
-	switch val := <-vt.stream; t := val.(type) {
-	case error:
-		return // TODO: Maybe do something with the error?
-	case []byte:
-		frame = t
-	case nil:
-		return // EOF
-	default:
-		panic(fmt.Sprintf("unreachable (%#v)", val))
-	}
+	resolution := vt.decoder.Resolution()
+	videoTime := vt.playhead.VideoTime(vt.decoder.Duration())
 
 	if loc, ok := state.Uniforms[vt.uniformName]; ok {
 		gl.ActiveTexture(gl.TEXTURE0 + vt.index)
 		gl.BindTexture(gl.TEXTURE_2D, vt.id)
-		gl.TexSubImage2D(
-			gl.TEXTURE_2D,             // target,
-			0,                         // level,
-			0,                         // xoffset,
-			0,                         // yoffset,
-			int32(vt.resolution.Dx()), // width,
-			int32(vt.resolution.Dy()), // height,
-			gl.RGB,                    // format,
-			gl.UNSIGNED_BYTE,          // type,
-			gl.Ptr(frame),             // data
-		)
+		if i := vt.decoder.FrameIndex(videoTime); i != vt.currentFrame {
+			// Keep showing the previous frame if the next one can not be
+			// decoded.
+			if frame, err := vt.decoder.Frame(i); err == nil {
+				vt.currentFrame = i
+				gl.TexSubImage2D(
+					gl.TEXTURE_2D,          // target,
+					0,                      // level,
+					0,                      // xoffset,
+					0,                      // yoffset,
+					int32(resolution.Dx()), // width,
+					int32(resolution.Dy()), // height,
+					gl.RGBA,                // format,
+					gl.UNSIGNED_BYTE,       // type,
+					gl.Ptr(frame.Pix),      // data
+				)
+			}
+		}
 		gl.Uniform1i(loc.Location, int32(vt.index))
 	}
 	if m := shadertoy.IchannelNumRe.FindStringSubmatch(vt.uniformName); m != nil {
 		if loc, ok := state.Uniforms[fmt.Sprintf("iChannelResolution[%s]", m[1])]; ok {
-			gl.Uniform3f(loc.Location, float32(vt.resolution.Dx()), float32(vt.resolution.Dy()), 1.0)
+			gl.Uniform3f(loc.Location, float32(resolution.Dx()), float32(resolution.Dy()), 1.0)
 		}
 	}
 	if loc, ok := state.Uniforms[fmt.Sprintf("%sSize", vt.uniformName)]; ok {
-		gl.Uniform3f(loc.Location, float32(vt.resolution.Dx()), float32(vt.resolution.Dy()), 1.0)
+		gl.Uniform3f(loc.Location, float32(resolution.Dx()), float32(resolution.Dy()), 1.0)
 	}
 	if m := shadertoy.IchannelNumRe.FindStringSubmatch(vt.uniformName); m != nil {
 		if loc, ok := state.Uniforms[fmt.Sprintf("iChannelTime[%s]", m[1])]; ok {
-			gl.Uniform1f(loc.Location, float32(state.Time)/float32(time.Second))
+			gl.Uniform1f(loc.Location, float32(videoTime)/float32(time.Second))
 		}
 	}
 	if loc, ok := state.Uniforms[fmt.Sprintf("%sCurTime", vt.uniformName)]; ok {
-		gl.Uniform1f(loc.Location, float32(state.Time)/float32(time.Second))
+		gl.Uniform1f(loc.Location, float32(videoTime)/float32(time.Second))
 	}
-}
-
-func (vt *videoTexture) Close() error {
-	vt.cancel()
-	gl.DeleteTextures(1, &vt.id)
-	return nil
-}
-
-func decodeVideoFile(ctx context.Context, filename string, currentTime time.Duration) (image.Rectangle, time.Duration, <-chan interface{}, error) {
-	info, err := ffprobe(ctx, filename)
-	if err != nil {
-		return image.Rectangle{}, 0, nil, err
-	}
-	resolution, err := info.VideoResolution()
-	if err != nil {
-		return image.Rectangle{}, 0, nil, err
-	}
-	interval := time.Second
-	if iv, err := info.VideoFrameInterval(); err == nil {
-		interval = iv
-	}
-
-	seekToOffset := time.Duration(0)
-	if duration, err := info.Duration(); err == nil {
-		seekToOffset = currentTime % duration
+	if vt.audio != nil {
+		vt.audio.SetPosition(videoTime)
+		vt.audio.PreRender(state)
 	}
-
-	out := make(chan interface{}, 4)
-	go func() {
-		defer close(out)
-		for ctx.Err() == nil {
-			cmd := exec.CommandContext(
-				ctx,
-				"ffmpeg",
-				"-i", filename,
-				"-ss", fmt.Sprintf("%.2f", seekToOffset.Seconds()),
-				"-f", "rawvideo",
-				"-pix_fmt", "rgb24",
-				"-",
-			)
-			stdout, err := cmd.StdoutPipe()
-			if err != nil {
-				out <- err
-				return
-			}
-			if err := cmd.Start(); err != nil {
-				out <- err
-				return
-			}
-
-			for {
-				imgBuf := make([]byte, resolution.Dx()*resolution.Dy()*3)
-				if _, err := io.ReadFull(stdout, imgBuf); err != nil {
-					if errors.Is(err, io.EOF) {
-						out <- err
-					}
-					break
-				}
-				out <- imgBuf
-			}
-
-			if err := cmd.Wait(); err != nil {
-				out <- err
-				return
-			}
-
-			// Restart the next playback at the beginning.
-			seekToOffset = 0
-		}
-	}()
-	return resolution, interval, out, nil
-}
-
-type mediaInfo struct {
-	Streams []struct {
-		CodecType    string `json:"codec_type"`
-		AvgFrameRate string `json:"avg_frame_rate"`
-		Width        int    `json:"width"`
-		Heigth       int    `json:"height"`
-	} `json:"streams"`
-	Format struct {
-		Duration string `json:"duration"`
-	} `json:"format"`
 }
 
-func ffprobe(ctx context.Context, filename string) (*mediaInfo, error) {
-	cmd := exec.CommandContext(
-		ctx,
-		"ffprobe", filename,
-		"-print_format", "json",
-		"-show_format", "-show_streams",
-	)
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, fmt.Errorf("unable to get media info: %w", err)
-	}
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("unable to get media info: %w", err)
-	}
-
-	var data mediaInfo
-	if err := json.NewDecoder(stdout).Decode(&data); err != nil {
-		return nil, fmt.Errorf("unable to get media info: %w", err)
-	}
-
-	if err := cmd.Wait(); err != nil {
-		return nil, fmt.Errorf("unable to get media info: %w", err)
+// Time implements the renderer.Clock interface if the soundtrack of the video
+// is being played back.
+func (vt *videoTexture) Time() (time.Duration, bool) {
+	if vt.player == nil {
+		return 0, false
 	}
-	return &data, nil
+	return vt.player.Time()
 }
 
-func (info *mediaInfo) firstStreamByType(typ string) (int, error) {
-	for i, stream := range info.Streams {
-		if stream.CodecType == typ {
-			return i, nil
-		}
+func (vt *videoTexture) Close() error {
+	if vt.player != nil {
+		vt.player.Close()
 	}
-	return -1, fmt.Errorf("no stream with type %q found", typ)
-}
-
-func (info *mediaInfo) Duration() (time.Duration, error) {
-	f, err := strconv.ParseFloat(info.Format.Duration, 64)
-	if err != nil {
-		return 0, fmt.Errorf("could not parse video duration: %w", err)
+	if vt.audio != nil {
+		vt.audio.Close()
 	}
-	return time.Duration(f * float64(time.Second)), nil
+	vt.decoder.Close()
+	vt.file.Close()
+	vt.cancel()
+	gl.DeleteTextures(1, &vt.id)
+	return nil
 }
 
-func (info *mediaInfo) VideoFrameInterval() (time.Duration, error) {
-	streamIndex, err := info.firstStreamByType("video")
-	if err != nil {
-		return -1, err
-	}
-	videoInfo := &info.Streams[streamIndex]
-
-	s := strings.Split(videoInfo.AvgFrameRate, "/")
-	nu, err := strconv.Atoi(s[0])
-	if err != nil {
-		return -1, fmt.Errorf("could not determine video frame interval: %w", err)
-	}
-	de, err := strconv.Atoi(s[1])
-	if err != nil {
-		return -1, fmt.Errorf("could not determine video frame interval: %w", err)
-	}
-
-	if nu == 0 || de == 0 {
-		return -1, fmt.Errorf("could not determine video frame interval")
+// uniformValue reads the current value of a scalar uniform of the active
+// program. This allows uniforms that are set by other resources to control
+// playback.
+func uniformValue(state renderer.RenderState, name string) (float32, bool) {
+	u, ok := state.Uniforms[name]
+	if !ok || name == "" {
+		return 0, false
 	}
-	return time.Duration(float64(time.Second) / (float64(nu) / float64(de))), nil
+	var program int32
+	gl.GetIntegerv(gl.CURRENT_PROGRAM, &program)
+	var v float32
+	gl.GetUniformfv(uint32(program), u.Location, &v)
+	return v, true
 }
 
-func (info *mediaInfo) VideoResolution() (image.Rectangle, error) {
-	streamIndex, err := info.firstStreamByType("video")
-	if err != nil {
-		return image.Rectangle{}, err
+// wrapTime maps t into [0, duration) so the video loops. If the duration is
+// not known, t is returned as is.
+func wrapTime(t, duration time.Duration) time.Duration {
+	if duration <= 0 {
+		return t
+	}
+	t %= duration
+	if t < 0 {
+		t += duration
 	}
-	videoInfo := &info.Streams[streamIndex]
-	return image.Rect(0, 0, videoInfo.Width, videoInfo.Heigth), nil
+	return t
 }
@@ -0,0 +1,9 @@
+#define LEVEL 2
+#if LEVEL > 2
+#pragma map iChannel0=image:a.png
+#include "include-none.glsl"
+#elif LEVEL == 2
+#include "include-single-dep.glsl"
+#else
+float c;
+#endif
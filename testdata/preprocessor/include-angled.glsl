@@ -0,0 +1,2 @@
+#pragma use <common/const.glsl>
+#include "common/util.glsl"
@@ -0,0 +1,3 @@
+#ifdef USE_DEP
+#include "include-single-dep.glsl"
+#endif
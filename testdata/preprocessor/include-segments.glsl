@@ -0,0 +1,3 @@
+float a;
+#include "include-segments-dep.glsl"
+float b;
@@ -0,0 +1,2 @@
+#include "util.glsl"
+const float PI = 3.14159265;
@@ -0,0 +1 @@
+float sq(float x) { return x * x; }